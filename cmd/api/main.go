@@ -0,0 +1,108 @@
+// cmd/api/main.go
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+	"watchrabbit/internal/config"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/integrity"
+	"watchrabbit/internal/services/logging"
+	"watchrabbit/internal/services/storage"
+	"watchrabbit/internal/transport/api"
+	"watchrabbit/pkg/messaging"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// JSON logs, log.Printf calls that are left go through the same handler
+	logger, err := logging.Setup(cfg.LogLevel, "api")
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	db, err := database.NewPostgresSerivce(database.PostgresConfig{
+		Host:     cfg.Postgres.Host,
+		Port:     cfg.Postgres.Port,
+		User:     cfg.Postgres.User,
+		Password: cfg.Postgres.Password,
+		DBName:   cfg.Postgres.DBName,
+		SSLMode:  cfg.Postgres.SSLMode,
+		Logger:   logger,
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	defer db.Close()
+
+	storageService, err := storage.NewS3Service(storage.S3Config{
+		Bucket:         cfg.S3.Bucket,
+		Region:         cfg.S3.Region,
+		AccessKey:      cfg.S3.AccessKey,
+		SecretKey:      cfg.S3.SecretKey,
+		Endpoint:       cfg.S3.Endpoint,
+		Compress:       cfg.S3.Compress,
+		Dispositions:   cfg.S3.Dispositions,
+		PublicEndpoint: cfg.S3.PublicEndpoint,
+		SSE:            cfg.S3.SSE,
+		KMSKeyID:       cfg.S3.KMSKeyID,
+		Logger:         logger,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize S3 storage: %v", err)
+	}
+
+	presignExpiry := time.Duration(cfg.API.PresignExpiry) * time.Second
+
+	mux := http.NewServeMux()
+	// every file path plus a download link for every result, admins only
+	if len(cfg.API.AdminTokens) == 0 {
+		log.Printf("BIOMARKER_API_ADMIN_TOKENS not set, /admin/analyses/export is disabled")
+	} else {
+		mux.Handle("GET /admin/analyses/export", api.RequireAdmin(cfg.API.AdminTokens, api.NewExportHandler(db, storageService, presignExpiry)))
+	}
+	mux.Handle("GET /analyses", api.NewAnalysisListHandler(db))
+	mux.Handle("GET /analyses/{uuid}", api.NewAnalysisHandler(db))
+	mux.Handle("GET /healthz", api.HealthHandler(db.Ping))
+
+	// live completion notifications for the dashboard and manual re-runs, the rest of the API works without RabbitMQ
+	rabbitMQ, err := messaging.NewRabbitMQClient(cfg.RabbitMQ.URI)
+	if err != nil {
+		log.Printf("RabbitMQ unavailable, /events/completed and POST /analyses are disabled: %v", err)
+	} else {
+		defer rabbitMQ.Close()
+		rabbitMQ.SetLogger(logger)
+		mux.Handle("GET /events/completed", api.NewCompletedStream(rabbitMQ))
+		if len(cfg.API.AdminTokens) == 0 {
+			log.Printf("BIOMARKER_API_ADMIN_TOKENS not set, POST /analyses is disabled")
+		} else {
+			scripts, err := analyzer.NewScriptRegistry(cfg.Analysis.Scripts)
+			if err != nil {
+				log.Fatalf("Invalid analysis scripts: %v", err)
+			}
+			mux.Handle("POST /analyses", api.RequireAdmin(cfg.API.AdminTokens, api.NewTriggerHandler(db, rabbitMQ, scripts)))
+		}
+	}
+
+	// each download holds an S3 stream open while it's copied to the client, so a burst of report fetches is queued instead of run all at once
+	downloads := api.NewDownloadLimiter(cfg.S3.MaxConcurrentDownloads, time.Duration(cfg.S3.DownloadQueueTimeout)*time.Second)
+	mux.Handle("GET /results/{key...}", downloads.Wrap(api.NewResultHandler(db, storageService, storage.StorageTypeS3)))
+
+	// the bucket's lifecycle rules delete old results, keep the records in step
+	if cfg.API.ExpiryCheckInterval > 0 {
+		reconciler := integrity.NewExpiryReconciler(db, storageService, storage.StorageTypeS3, 500)
+		go reconciler.Run(context.Background(), time.Duration(cfg.API.ExpiryCheckInterval)*time.Second)
+	}
+
+	log.Printf("API listening on %s", cfg.API.ListenAddr)
+	if err := http.ListenAndServe(cfg.API.ListenAddr, api.LogRequests(mux)); err != nil {
+		log.Fatalf("API server failed: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// cmd/dlq-replay/main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"watchrabbit/internal/config"
+	"watchrabbit/internal/services/logging"
+	"watchrabbit/pkg/messaging"
+)
+
+// admin tool: once the root cause of a failure is fixed, push dead-lettered messages back to where they came from
+// e.g. dlq-replay -queue analysis.requested.dlq -routing-key 'analysis.requested.*' -limit 10 -dry-run
+func main() {
+	queue := flag.String("queue", "", "dead-letter queue to replay from (required)")
+	limit := flag.Int("limit", 0, "max messages to replay, 0 for all")
+	messageID := flag.String("message-id", "", "only replay the message with this id")
+	routingKey := flag.String("routing-key", "", "only replay messages whose original routing key matches this glob")
+	reason := flag.String("reason", "", "only replay messages dead-lettered for this reason (rejected, expired, ...)")
+	dryRun := flag.Bool("dry-run", false, "list what would be replayed without changing anything")
+	flag.Parse()
+
+	if *queue == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// JSON logs, log.Printf calls that are left go through the same handler
+	logger, err := logging.Setup(cfg.LogLevel, "dlq-replay")
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	rabbitMQ, err := messaging.NewRabbitMQClient(cfg.RabbitMQ.URI)
+	if err != nil {
+		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+	}
+	defer rabbitMQ.Close()
+	rabbitMQ.SetLogger(logger)
+
+	filter := replayFilter(*messageID, *reason, *routingKey)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := rabbitMQ.ReplayDeadLetters(ctx, *queue, messaging.ReplayOptions{
+		Limit:  *limit,
+		Filter: filter,
+		DryRun: *dryRun,
+	})
+
+	verb := "Replayed"
+	if *dryRun {
+		verb = "Would replay"
+	}
+	for _, letter := range result.Replayed {
+		log.Printf("%s message %s to exchange %q with routing key %s (dead-lettered from %s: %s, x%d)",
+			verb, letter.MessageID, letter.Exchange, letter.RoutingKey, letter.Queue, letter.Reason, letter.Count)
+	}
+	log.Printf("%s %d messages from %s, %d left in place", verb, len(result.Replayed), *queue, result.Skipped)
+
+	if err != nil {
+		log.Fatalf("Replay stopped early: %v", err)
+	}
+}
+
+// empty values match everything
+func replayFilter(messageID, reason, routingKey string) func(messaging.DeadLetter) bool {
+	return func(letter messaging.DeadLetter) bool {
+		if messageID != "" && letter.MessageID != messageID {
+			return false
+		}
+		if reason != "" && letter.Reason != reason {
+			return false
+		}
+		if routingKey != "" {
+			// plain glob rather than topic syntax, * here also matches across dots
+			if matched, _ := path.Match(routingKey, letter.RoutingKey); !matched {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"watchrabbit/pkg/messaging"
+)
+
+func TestReplayFilter(t *testing.T) {
+	letter := messaging.DeadLetter{
+		MessageID:  "msg-1",
+		Queue:      "analysis.requested",
+		Exchange:   "biomarker.analysis.events",
+		RoutingKey: "analysis.requested.csv",
+		Reason:     "expired",
+	}
+
+	tests := []struct {
+		name       string
+		messageID  string
+		reason     string
+		routingKey string
+		want       bool
+	}{
+		{"no filter", "", "", "", true},
+		{"matching message id", "msg-1", "", "", true},
+		{"other message id", "msg-2", "", "", false},
+		{"matching reason", "", "expired", "", true},
+		{"other reason", "", "rejected", "", false},
+		{"routing key glob", "", "", "analysis.requested.*", true},
+		{"glob crosses dots", "", "", "analysis.*", true},
+		{"other routing key", "", "", "file.detected.*", false},
+		{"every filter must match", "msg-1", "rejected", "analysis.requested.*", false},
+		{"all matching", "msg-1", "expired", "analysis.requested.csv", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replayFilter(tt.messageID, tt.reason, tt.routingKey)(letter); got != tt.want {
+				t.Errorf("filter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
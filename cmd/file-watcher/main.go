@@ -5,10 +5,20 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 	"watchrabbit/internal/config"
 	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/heartbeat"
+	"watchrabbit/internal/services/logging"
+	"watchrabbit/internal/services/metrics"
+	"watchrabbit/internal/services/redact"
+	"watchrabbit/internal/services/replica"
+	"watchrabbit/internal/services/watcher"
+	"watchrabbit/pkg/fileutil"
 	"watchrabbit/pkg/messaging"
 
 	"github.com/fsnotify/fsnotify"
@@ -18,7 +28,7 @@ import (
 // init rabbitmq client - setup exchanges/queues
 // setup rabbitmq infrastructure
 //init file watcher - use fsnotify to watch for file changes
-// process file events - filter files (.csv or .sas7bdat)
+// process file events - filter files (.csv, .sas7bdat, .xlsx, .parquet)
 // publish events if occur
 func main() {
 	cfg, err := config.Load()
@@ -26,74 +36,144 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// JSON logs, log.Printf calls that are left go through the same handler
+	logger, err := logging.Setup(cfg.LogLevel, "file-watcher")
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	// set up before anything logs a file path
+	redactor, err := redact.New(cfg.Redact.Mode, cfg.Redact.PathPatterns, cfg.Redact.MetadataKeys)
+	if err != nil {
+		log.Fatalf("Invalid redaction configuration: %v", err)
+	}
+	redact.SetDefault(redactor)
+
+	// stagger replicas started by the same deploy
+	replica.SleepJitter(time.Duration(cfg.Replica.StartupJitterMs) * time.Millisecond)
+
 	rabbitClient, err := messaging.NewRabbitMQClient(cfg.RabbitMQ.URI)
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
 	}
 	defer rabbitClient.Close()
+	rabbitClient.SetLogger(logger)
+	rabbitClient.SetPublishBufferSize(cfg.RabbitMQ.PublishBufferSize)
+	rabbitClient.SetMaxMessageSize(cfg.RabbitMQ.MaxMessageBytes)
+	rabbitClient.SetPublishErrorHook(metrics.PublishErrors.Inc)
+	rabbitClient.SetRecreateMismatchedQueues(cfg.RabbitMQ.RecreateMismatchedQueues)
 
 	if err := rabbitClient.SetupInfrastructure(); err != nil {
 		log.Fatalf("Failed to set up RabbitMQ infrastructure: %v", err)
 	}
 
-	watcher, err := fsnotify.NewWatcher()
+	// file events are cheap to re-detect, so they go out transient by default
+	// mandatory so a routing key that matches no binding fails the publish (ErrUnroutable) instead of vanishing
+	fileEventOpts := messaging.PublishOptions{DeliveryMode: messaging.Transient, Mandatory: true}
+	if cfg.RabbitMQ.PersistentFileEvents {
+		fileEventOpts.DeliveryMode = messaging.Persistent
+	}
+
+	// skips unsupported extensions plus temp/lock files like ~$data.csv
+	filter, err := watcher.NewFilter(cfg.FileWatcher.SupportedExtensions, cfg.FileWatcher.Include, cfg.FileWatcher.Exclude)
+	if err != nil {
+		log.Fatalf("Invalid file watcher filters: %v", err)
+	}
+
+	// large uploads fire a Create and then a stream of Writes, only publish once the file stops changing
+	settleFor := time.Duration(cfg.FileWatcher.SettleMs) * time.Millisecond
+	settler := watcher.NewSettler(settleFor, func(path string, fileInfo os.FileInfo, created bool) {
+		publishFileEvent(rabbitClient, fileEventOpts, cfg.FileWatcher.Requester, path, fileInfo, created)
+	})
+	// vendors that mark in-progress uploads with a companion lock file are waited on until it's removed
+	locks := watcher.NewLockFiles(cfg.FileWatcher.LockSuffixes,
+		time.Duration(cfg.FileWatcher.LockPollMs)*time.Millisecond,
+		time.Duration(cfg.FileWatcher.LockTimeout)*time.Second)
+	settler.SetLockFiles(locks)
+	// runs before rabbitClient.Close, waits for a publish that's already under way
+	defer settler.Stop()
+
+	// SIGINT/SIGTERM stops the watch loop, no new events are accepted after that
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	instanceID := cfg.FileWatcher.ID
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+	heartbeatInterval := time.Duration(cfg.Heartbeat.Interval) * time.Second
+	go heartbeat.NewPublisher(rabbitClient, "file-watcher", instanceID, heartbeatInterval, settler.Pending).Run(ctx)
+
+	if cfg.FileWatcher.MetricsAddr != "" {
+		go metrics.Serve(ctx, cfg.FileWatcher.MetricsAddr)
+	}
+
+	onRemove := func(path string) {
+		settler.Forget(path)
+		publishFileRemoved(rabbitClient, fileEventOpts, path)
+	}
+
+	if cfg.FileWatcher.ScanOnStart {
+		// runs alongside the watcher so nothing written during the scan is missed
+		go runStartupScan(ctx, cfg, filter, func(path string, fileInfo os.FileInfo) {
+			// a transfer still in progress goes through the settler, which waits for its lock file
+			if _, locked := locks.Locked(path); locked {
+				settler.Touch(path, true)
+				return
+			}
+			publishFileEvent(rabbitClient, fileEventOpts, cfg.FileWatcher.Requester, path, fileInfo, true)
+		})
+	}
+
+	switch cfg.FileWatcher.Mode {
+	case "poll":
+		runPoller(ctx, cfg.FileWatcher, filter, settler, onRemove)
+	case "inotify", "":
+		runInotify(ctx, cfg.FileWatcher, filter, settler, onRemove)
+	default:
+		log.Fatalf("Unknown file watcher mode %q (expected inotify or poll)", cfg.FileWatcher.Mode)
+	}
+	log.Println("File watcher stopped")
+}
+
+func runInotify(ctx context.Context, cfg config.FileWatcherConfig, filter *watcher.Filter, settler *watcher.Settler, onRemove func(path string)) {
+	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer watcher.Close()
+	defer fsWatcher.Close()
 
 	//adding directories to watch:
-	for _, dir := range cfg.FileWatcher.Directories {
-		if err := watcher.Add(dir); err != nil {
-			log.Fatalf("Error in watching directory %s: $v", dir, err)
+	for _, dir := range cfg.Directories {
+		if err := fsWatcher.Add(dir); err != nil {
+			log.Fatalf("Error in watching directory %s: %v", dir, err)
 		}
 		//for development, prod will have a lot of directories
 		log.Printf("Watching Directory: %s", dir)
 	}
 
-	// infinite loop w/ no exit condition to constantly watch files
+	// watch until signalled
 	for { 
 		select {
-		case event, ok := <-watcher.Events:
+		case <-ctx.Done():
+			return
+		case event, ok := <-fsWatcher.Events:
 			if !ok {
 				return
 			}
-			//only process create/write events
-			if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write {
-				ext := filepath.Ext(event.Name)
-				if !isFileTypeSupported(ext, cfg.FileWatcher.SupportedExtensions) {
-					continue
-				}
-				fileInfo, err := os.Stat(event.Name)
-				if err != nil {
-					log.Printf("Error getting file info: %v", err)
-					continue
-				}
-				//skip directories
-				if fileInfo.IsDir() {
-					continue
-				}
-
-				//publish event:
-				fileEvent := events.FileDetectedEvent{
-					FilePath: event.Name,
-					FileType: ext,
-					Size: fileInfo.Size(),
-					Timestamp: time.Now(),
-				}
-
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				routingKey := "file.detected" + ext
-				err = rabbitClient.PublishEvent(ctx, "biomarker.file.events", routingKey, fileEvent)
-				cancel()
-
-				if err != nil {
-					log.Printf("Failed to publish file detected event: %v", err)
-				} else {
-					log.Printf("Published file detected event for %s", event.Name)
-				}
+			if !filter.Allows(event.Name) {
+				continue
+			}
+			switch {
+			// renamed away or deleted - the new name (if any) shows up as its own Create
+			case event.Op&fsnotify.Remove == fsnotify.Remove || event.Op&fsnotify.Rename == fsnotify.Rename:
+				onRemove(event.Name)
+			case event.Op&fsnotify.Create == fsnotify.Create:
+				settler.Touch(event.Name, true)
+			case event.Op&fsnotify.Write == fsnotify.Write:
+				settler.Touch(event.Name, false)
 			}
-		case err, ok := <-watcher.Errors:
+		case err, ok := <-fsWatcher.Errors:
 			if !ok {
 				return
 			}
@@ -102,11 +182,141 @@ func main() {
 	}
 }
 
-func isFileTypeSupported(ext string, supportedExts []string) bool {
-	for _, supported := range supportedExts {
-		if ext == supported {
-			return true
+// for mounts where inotify never fires (NFS etc.) - same filter and settling, just driven by a directory scan
+func runPoller(ctx context.Context, cfg config.FileWatcherConfig, filter *watcher.Filter, settler *watcher.Settler, onRemove func(path string)) {
+	interval := time.Duration(cfg.PollInterval) * time.Second
+	for _, dir := range cfg.Directories {
+		log.Printf("Polling Directory every %s: %s", interval, dir)
+	}
+
+	poller := watcher.NewPoller(cfg.Directories, interval, filter)
+	poller.Run(ctx.Done(), settler.Touch, onRemove)
+}
+
+// publishes detected events for files that were already there before startup and that Postgres has never seen
+func runStartupScan(ctx context.Context, cfg *config.Config, filter *watcher.Filter, onFound func(path string, fileInfo os.FileInfo)) {
+	partition, err := replica.NewPartition(cfg.Replica.Index, cfg.Replica.Count)
+	if err != nil {
+		log.Printf("Skipping startup scan: %v", err)
+		return
+	}
+
+	db, err := database.NewPostgresSerivce(database.PostgresConfig{
+		Host:     cfg.Postgres.Host,
+		Port:     cfg.Postgres.Port,
+		User:     cfg.Postgres.User,
+		Password: cfg.Postgres.Password,
+		DBName:   cfg.Postgres.DBName,
+		SSLMode:  cfg.Postgres.SSLMode,
+	})
+	if err != nil {
+		log.Printf("Skipping startup scan, failed to connect to PostgreSQL: %v", err)
+		return
+	}
+	defer db.Close()
+
+	known := func(ctx context.Context, path string) (bool, error) {
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		file, err := db.GetFileRecordByPath(lookupCtx, path)
+		if err != nil {
+			return false, err
 		}
+		// a file that was removed and has since reappeared needs analyzing again
+		return file != nil && file.RemovedAt == nil, nil
 	}
-	return false
-}
\ No newline at end of file
+
+	pause := time.Duration(cfg.FileWatcher.ScanPagePauseMs) * time.Millisecond
+	scan := watcher.NewStartupScan(cfg.FileWatcher.Directories, filter, known, partition.Owns, cfg.FileWatcher.ScanPageSize, pause)
+	if cfg.FileWatcher.ScanProgressFile != "" {
+		progress, err := watcher.OpenScanProgress(cfg.FileWatcher.ScanProgressFile)
+		if err != nil {
+			// still safe to scan, with result caching on the worker skips anything published twice by checksum
+			log.Printf("Startup scan won't be resumable: %v", err)
+		} else {
+			scan.SetProgress(progress)
+		}
+	}
+
+	log.Printf("Scanning watched directories for existing files (replica %d of %d)", partition.Index, partition.Count)
+	found, err := scan.Run(ctx, onFound)
+	if err != nil {
+		log.Printf("Startup scan stopped after %d files: %v", found, err)
+		return
+	}
+	log.Printf("Startup scan complete, published %d existing files", found)
+}
+
+// publishes a FileDetectedEvent for new files and a FileChangedEvent for files modified in place
+// requester is who the resulting analyses are attributed to
+func publishFileEvent(rabbitClient messaging.MessageBus, opts messaging.PublishOptions, requester, path string, fileInfo os.FileInfo, created bool) {
+	//skip directories
+	if fileInfo.IsDir() {
+		return
+	}
+	ext := filepath.Ext(path)
+
+	// checksum lets the worker tell if a stale request still refers to the same content
+	checksum, err := fileutil.SHA256File(path)
+	if err != nil {
+		log.Printf("Error computing checksum for %s: %v", redact.Path(path), err)
+	}
+
+	//publish event:
+	var fileEvent interface{}
+	routingKey := events.RoutingKey("file.detected", ext)
+	if created {
+		fileEvent = events.FileDetectedEvent{
+			FilePath: path,
+			FileType: ext,
+			Size: fileInfo.Size(),
+			Checksum: checksum,
+			Requester: requester,
+			Timestamp: time.Now(),
+		}
+	} else {
+		routingKey = events.RoutingKey("file.changed", ext)
+		fileEvent = events.FileChangedEvent{
+			FilePath: path,
+			FileType: ext,
+			Size: fileInfo.Size(),
+			Checksum: checksum,
+			Requester: requester,
+			Timestamp: time.Now(),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = rabbitClient.PublishEventWithOptions(ctx, "biomarker.file.events", routingKey, fileEvent, opts)
+	cancel()
+
+	if err != nil {
+		stats := rabbitClient.PublishStats()
+		log.Printf("Failed to publish %s event: %v (buffered: %d, dropped: %d)", routingKey, err, stats.Buffered, stats.Dropped)
+	} else {
+		log.Printf("Published %s event for %s", routingKey, redact.Path(path))
+		if created {
+			metrics.FilesDetected.Inc()
+		}
+	}
+}
+
+func publishFileRemoved(rabbitClient messaging.MessageBus, opts messaging.PublishOptions, path string) {
+	ext := filepath.Ext(path)
+	fileEvent := events.FileRemovedEvent{
+		FilePath: path,
+		FileType: ext,
+		Timestamp: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	routingKey := events.RoutingKey("file.removed", ext)
+	err := rabbitClient.PublishEventWithOptions(ctx, "biomarker.file.events", routingKey, fileEvent, opts)
+	cancel()
+
+	if err != nil {
+		log.Printf("Failed to publish file removed event: %v", err)
+	} else {
+		log.Printf("Published file removed event for %s", redact.Path(path))
+	}
+}
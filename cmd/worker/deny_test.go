@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/redact"
+	"watchrabbit/internal/services/watcher"
+	"watchrabbit/pkg/messaging"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+func TestRejectDeniedFiles(t *testing.T) {
+	denyPatterns, err := watcher.CompilePatterns([]string{"*_PHI_raw*", "re:^scratch_\\d+\\.csv$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		filePath     string
+		wantDecision messaging.Decision
+	}{
+		{"allowed", "/data/study1/labs.csv", messaging.Ack},
+		{"glob denied", "/data/study1/labs_PHI_raw.csv", messaging.Reject},
+		{"regex denied", "/data/study1/scratch_42.csv", messaging.Reject},
+		{"regex only matches the base name", "/data/scratch_42.csv/labs.csv", messaging.Ack},
+		{"regex anchored", "/data/study1/old_scratch_42.csv", messaging.Ack},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyzed := false
+			handler := rejectDeniedFiles(denyPatterns, func([]byte) error {
+				analyzed = true
+				return nil
+			})
+			body, err := json.Marshal(events.AnalysisRequestedEvent{FilePath: tt.filePath, FileType: "csv"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decision, err := messaging.Decide(handler)(body)
+			if decision != tt.wantDecision {
+				t.Fatalf("decision = %s (%v), want %s", decision, err, tt.wantDecision)
+			}
+			if denied := tt.wantDecision == messaging.Reject; analyzed == denied {
+				t.Errorf("analyzed = %v for %s", analyzed, tt.filePath)
+			}
+		})
+	}
+}
+
+// the rejection ends up in the logs and the audit log, the path in it must be redacted like the log lines are
+func TestRejectionErrorsAreRedacted(t *testing.T) {
+	redactor, err := redact.New(redact.ModeMask, []string{`SUBJ-\d+`}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redact.SetDefault(redactor)
+	t.Cleanup(func() { redact.SetDefault(nil) })
+
+	denyPatterns, err := watcher.CompilePatterns([]string{"*_PHI_raw*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loops := analyzer.NewLoopDetector(1, time.Hour, time.Hour)
+	bus := memory.New()
+	defer bus.Close()
+
+	filePath := "/data/study1/SUBJ-0042_PHI_raw.csv"
+	var analyzedPath string
+	next := func(data []byte) error {
+		var requestEvent events.AnalysisRequestedEvent
+		if err := json.Unmarshal(data, &requestEvent); err != nil {
+			return err
+		}
+		analyzedPath = requestEvent.FilePath
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		handler EventHandler
+		path    string
+	}{
+		{"denied", rejectDeniedFiles(denyPatterns, next), filePath},
+		{"quarantined", quarantineLoopingFiles(bus, loops, 1, time.Hour, time.Hour, next), "/data/study1/SUBJ-0042_labs.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(events.AnalysisRequestedEvent{FilePath: tt.path, FileType: "csv"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the loop detector lets the first request through untouched
+			for i := 0; i < 3; i++ {
+				err = tt.handler(body)
+				if err != nil {
+					break
+				}
+				if analyzedPath != tt.path {
+					t.Fatalf("handler got %q, want the unredacted %q", analyzedPath, tt.path)
+				}
+			}
+			if !messaging.IsPermanent(err) {
+				t.Fatalf("err = %v, want a permanent rejection", err)
+			}
+			if strings.Contains(err.Error(), "SUBJ-0042") || !strings.Contains(err.Error(), "***") {
+				t.Errorf("rejection %q leaks the subject id", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+// fakeRepo keeps analyses and results in memory, writes made through WithTx only land if fn returns nil
+type fakeRepo struct {
+	mu       sync.Mutex
+	nextID   int64
+	analyses map[string]*fakeAnalysis
+	results  []fakeResult
+	latest   map[string]int64
+	// returned by the nth CreateResultRecord call (1-based), 0 to never fail
+	failResultRecord int
+	resultRecords    int
+}
+
+type fakeAnalysis struct {
+	id           int64
+	status       string
+	errorMessage string
+	metadata     map[string]string
+}
+
+type fakeResult struct {
+	id          int64
+	analysisID  int64
+	resultType  string
+	storageKey  string
+	contentType string
+	metadata    map[string]string
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{analyses: make(map[string]*fakeAnalysis), latest: make(map[string]int64)}
+}
+
+func (r *fakeRepo) WithTx(ctx context.Context, fn func(tx database.TxWriter) error) error {
+	tx := &fakeTx{repo: r, statuses: make(map[string]string)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uuid, analysis := range tx.analyses {
+		r.analyses[uuid] = analysis
+	}
+	for uuid, status := range tx.statuses {
+		r.analyses[uuid].status = status
+	}
+	r.results = append(r.results, tx.results...)
+	return nil
+}
+
+func (r *fakeRepo) UpdateAnalysisStatus(ctx context.Context, analysisUUID, status, errorMessage string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	analysis, ok := r.analyses[analysisUUID]
+	if !ok {
+		return fmt.Errorf("analysis %s not found", analysisUUID)
+	}
+	analysis.status = status
+	analysis.errorMessage = errorMessage
+	return nil
+}
+
+func (r *fakeRepo) MergeAnalysisMetadata(ctx context.Context, analysisUUID string, metadata map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	analysis, ok := r.analyses[analysisUUID]
+	if !ok {
+		return fmt.Errorf("analysis %s not found", analysisUUID)
+	}
+	for key, value := range metadata {
+		analysis.metadata[key] = value
+	}
+	return nil
+}
+
+func (r *fakeRepo) UpdateLatestResult(ctx context.Context, analysisUUID string, resultID int64, ordered bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latest[analysisUUID] = resultID
+	return true, nil
+}
+
+func (r *fakeRepo) FindCachedResult(ctx context.Context, inputChecksum, analysisType string) (*database.CachedResult, error) {
+	return nil, nil
+}
+
+func (r *fakeRepo) MarkFileRemoved(ctx context.Context, filePath string) (bool, error) {
+	return false, nil
+}
+
+// the only analysis the handler created, tests run one request at a time
+func (r *fakeRepo) analysis() (string, *fakeAnalysis) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uuid, analysis := range r.analyses {
+		return uuid, analysis
+	}
+	return "", nil
+}
+
+func (r *fakeRepo) resultKeys(resultType string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for _, result := range r.results {
+		if result.resultType == resultType {
+			keys = append(keys, result.storageKey)
+		}
+	}
+	return keys
+}
+
+type fakeTx struct {
+	repo     *fakeRepo
+	analyses map[string]*fakeAnalysis
+	statuses map[string]string
+	results  []fakeResult
+}
+
+func (t *fakeTx) GetOrCreateFileRecord(ctx context.Context, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
+	return 1, nil
+}
+
+func (t *fakeTx) CreateAnalysisRecord(ctx context.Context, fileID int64, analysisType, status, createdBy string, metadata map[string]string) (string, int64, error) {
+	t.repo.mu.Lock()
+	t.repo.nextID++
+	id := t.repo.nextID
+	t.repo.mu.Unlock()
+
+	uuid := fmt.Sprintf("00000000-0000-0000-0000-%012d", id)
+	if t.analyses == nil {
+		t.analyses = make(map[string]*fakeAnalysis)
+	}
+	t.analyses[uuid] = &fakeAnalysis{id: id, status: status, metadata: metadata}
+	return uuid, id, nil
+}
+
+func (t *fakeTx) UpdateAnalysisStatus(ctx context.Context, analysisUUID, status, errorMessage string) error {
+	t.statuses[analysisUUID] = status
+	return nil
+}
+
+func (t *fakeTx) CreateResultRecord(ctx context.Context, analysisID int64, resultType, storageType, storageKey, contentType string, sizeBytes int64, checksum string, metadata map[string]string) (int64, error) {
+	t.repo.mu.Lock()
+	t.repo.resultRecords++
+	failed := t.repo.resultRecords == t.repo.failResultRecord
+	t.repo.nextID++
+	id := t.repo.nextID
+	t.repo.mu.Unlock()
+
+	if failed {
+		return 0, errors.New("connection reset by peer")
+	}
+	t.results = append(t.results, fakeResult{id: id, analysisID: analysisID, resultType: resultType, storageKey: storageKey, contentType: contentType, metadata: metadata})
+	return id, nil
+}
+
+// fakeAnalyzer returns canned results instead of running R
+type fakeAnalyzer struct {
+	mu sync.Mutex
+	// one per attempt, the last one repeats
+	errs           []error
+	logFiles       map[string]string
+	logTails       map[string]string
+	afterUploadErr error
+	runs           int
+	afterUploads   []string
+	cleaned        int
+	options        []analyzer.AnalysisOptions
+	// primary output of successful runs, an html report when empty
+	outputExt   string
+	contentType string
+}
+
+func (a *fakeAnalyzer) ExecuteAnalysis(ctx context.Context, filePath, analysisType string, opts analyzer.AnalysisOptions) (*analyzer.DescriptiveAnalysisMetadata, error) {
+	a.mu.Lock()
+	a.runs++
+	run := a.runs
+	a.options = append(a.options, opts)
+	var err error
+	if len(a.errs) > 0 {
+		err = a.errs[min(run, len(a.errs))-1]
+	}
+	a.mu.Unlock()
+
+	if opts.OnStart != nil {
+		opts.OnStart()
+	}
+	analysisID := opts.AnalysisID
+	if analysisID == "" {
+		analysisID = fmt.Sprintf("run-%d", run)
+	}
+	result := &analyzer.DescriptiveAnalysisMetadata{
+		AnalysisID: analysisID,
+		FilePath:   filePath,
+		Status:     "success",
+		Metadata:   map[string]string{},
+		LogFiles:   a.logFiles,
+		LogTails:   a.logTails,
+	}
+	if err != nil {
+		result.Status = "failed"
+		result.ErrorMessage = err.Error()
+		return result, err
+	}
+	outputExt, contentType := ".html", "text/html; charset=utf-8"
+	if a.outputExt != "" {
+		outputExt, contentType = a.outputExt, a.contentType
+	}
+	result.OutputPath = filepath.Join("/tmp/watchrabbit", fmt.Sprintf("run-%d%s", run, outputExt))
+	result.ContentType = contentType
+	return result, nil
+}
+
+func (a *fakeAnalyzer) SupportsStdin(analysisType string) bool {
+	return false
+}
+
+func (a *fakeAnalyzer) CleanupOutput(result *analyzer.DescriptiveAnalysisMetadata) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cleaned++
+}
+
+func (a *fakeAnalyzer) AfterUpload(ctx context.Context, result *analyzer.DescriptiveAnalysisMetadata, resultKey string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.afterUploads = append(a.afterUploads, resultKey)
+	return a.afterUploadErr
+}
+
+// fakeStorer keeps the keys it was asked to store, uploads of output paths in failPaths fail
+type fakeStorer struct {
+	mu        sync.Mutex
+	failPaths map[string]bool
+	objects   map[string]bool
+	metadata  map[string]map[string]string
+	deleted   []string
+}
+
+func newFakeStorer() *fakeStorer {
+	return &fakeStorer{objects: make(map[string]bool), metadata: make(map[string]map[string]string)}
+}
+
+func (s *fakeStorer) StoreResult(result *storage.ResultData) (string, error) {
+	stored, err := s.StoreResultWithInfo(result)
+	if err != nil {
+		return "", err
+	}
+	return stored.Key, nil
+}
+
+func (s *fakeStorer) StoreResultWithInfo(result *storage.ResultData) (*storage.StoredResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failPaths[result.OutputPath] {
+		return nil, errors.New("failed to upload to S3: RequestTimeout")
+	}
+	key := "results/" + result.AnalysisID + "/" + filepath.Base(result.OutputPath)
+	s.objects[key] = true
+	s.metadata[key] = result.Metadata
+	return &storage.StoredResult{Key: key, ContentType: result.ContentType, Checksum: "abc"}, nil
+}
+
+func (s *fakeStorer) GetResult(key string) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.objects[key] {
+		return nil, "", fmt.Errorf("%s not found", key)
+	}
+	return []byte{}, "", nil
+}
+
+func (s *fakeStorer) GetResultStream(key string) (io.ReadCloser, string, error) {
+	data, contentType, err := s.GetResult(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(bytes.NewReader(data)), contentType, nil
+}
+
+func (s *fakeStorer) DeleteResult(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func (s *fakeStorer) ListResults(prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *fakeStorer) ResultExists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key], nil
+}
+
+func (s *fakeStorer) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+// fails publishes of the given analysis types, everything else goes through to the memory bus
+type failingBus struct {
+	*memory.Bus
+	failTypes map[string]bool
+}
+
+func (b *failingBus) PublishEvent(ctx context.Context, exchange, routingKey string, event interface{}) error {
+	if request, ok := event.(events.AnalysisRequestedEvent); ok && b.failTypes[request.AnalysisType] {
+		return errors.New("broker unavailable")
+	}
+	return b.Bus.PublishEvent(ctx, exchange, routingKey, event)
+}
+
+func TestFileDetectedFansOutToEveryAnalysisType(t *testing.T) {
+	types := []string{"descriptive", "qc", "survival"}
+
+	tests := []struct {
+		name      string
+		failTypes map[string]bool
+		wantTypes []string
+		wantErr   []string
+	}{
+		{"all published", nil, types, nil},
+		{"one failure doesn't stop the rest", map[string]bool{"qc": true}, []string{"descriptive", "survival"}, []string{"abc123:qc"}},
+		{"every failure is reported", map[string]bool{"descriptive": true, "survival": true}, []string{"qc"}, []string{"abc123:descriptive", "abc123:survival"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := &failingBus{Bus: memory.New(), failTypes: tt.failTypes}
+			defer bus.Close()
+			handler := handleFileDetectedEvent(bus, analyzer.NewFanOut(types, nil))
+
+			body, _ := json.Marshal(events.FileDetectedEvent{
+				FilePath:  "/data/study/a.csv",
+				FileType:  "csv",
+				Checksum:  "abc123",
+				Requester: "file-watcher",
+				Timestamp: time.Now(),
+			})
+			err := handler(body)
+
+			if len(tt.wantErr) == 0 && err != nil {
+				t.Fatalf("handler returned %v", err)
+			}
+			for _, key := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), key) {
+					t.Errorf("error %v doesn't mention %s", err, key)
+				}
+			}
+
+			var gotTypes []string
+			for _, msg := range bus.Published() {
+				if msg.Exchange != "biomarker.analysis.events" || msg.RoutingKey != "analysis.requested.csv" {
+					t.Errorf("published to %s/%s", msg.Exchange, msg.RoutingKey)
+				}
+				var request events.AnalysisRequestedEvent
+				if err := json.Unmarshal(msg.Body, &request); err != nil {
+					t.Fatal(err)
+				}
+				if request.FilePath != "/data/study/a.csv" || request.Checksum != "abc123" || request.Requester != "file-watcher" {
+					t.Errorf("request lost file details: %+v", request)
+				}
+				gotTypes = append(gotTypes, request.AnalysisType)
+			}
+			if strings.Join(gotTypes, ",") != strings.Join(tt.wantTypes, ",") {
+				t.Errorf("requested %v, want %v", gotTypes, tt.wantTypes)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/source"
+	"watchrabbit/internal/services/storage"
+	"watchrabbit/pkg/messaging"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+// runs one analysis request through the handler against fakes, the bus gets the events the handler publishes
+func runAnalysisRequest(t *testing.T, repo *fakeRepo, analyzerService *fakeAnalyzer, storer *fakeStorer) (messaging.Decision, error, *memory.Bus) {
+	t.Helper()
+
+	bus := memory.New()
+	t.Cleanup(func() { bus.Close() })
+
+	handler := handleAnalysisRequestedEvent(context.Background(), bus, analyzerService, repo, storer, storage.StorageTypeS3, time.Hour, true, nil, analyzer.RetryPolicy{})
+	body, err := json.Marshal(events.AnalysisRequestedEvent{
+		FilePath:     "/data/study/a.csv",
+		FileType:     "csv",
+		AnalysisType: "descriptive",
+		Requester:    "file-watcher",
+		Timestamp:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decision, err := messaging.Decide(handler)(body)
+	return decision, err, bus
+}
+
+// the status of the analysis.completed event the handler published, empty if it didn't publish one
+func completedStatus(t *testing.T, bus *memory.Bus) string {
+	t.Helper()
+
+	status := ""
+	for _, msg := range bus.Published() {
+		if msg.Exchange != "biomarker.result.events" || msg.RoutingKey != "analysis.completed.csv" {
+			continue
+		}
+		if status != "" {
+			t.Fatalf("analysis.completed published more than once")
+		}
+		var completed events.AnalysisCompletedEvent
+		if err := json.Unmarshal(msg.Body, &completed); err != nil {
+			t.Fatal(err)
+		}
+		status = completed.Status
+	}
+	return status
+}
+
+func TestHandleAnalysisRequested(t *testing.T) {
+	reportPath := "/tmp/watchrabbit/run-1.html"
+
+	tests := []struct {
+		name           string
+		analysisErrs   []error
+		afterUploadErr error
+		logFiles       map[string]string
+		failPaths      map[string]bool
+		failRecord     int
+		wantDecision   messaging.Decision
+		wantStatus     string
+		wantPublished  string
+		wantReports    int
+		wantLogs       int
+		wantObjects    int
+	}{
+		{
+			name:          "success",
+			wantDecision:  messaging.Ack,
+			wantStatus:    database.AnalysisStatusCompleted,
+			wantPublished: "success",
+			wantReports:   1,
+			wantObjects:   1,
+		},
+		{
+			name:          "analysis failure",
+			analysisErrs:  []error{errors.New("R script exited with status 1")},
+			wantDecision:  messaging.Ack,
+			wantStatus:    database.AnalysisStatusFailed,
+			wantPublished: "failed",
+		},
+		{
+			name:          "analysis failure keeps its logs",
+			analysisErrs:  []error{errors.New("R script exited with status 1")},
+			logFiles:      map[string]string{"stderr": "/tmp/watchrabbit/run-1.html.stderr.log"},
+			wantDecision:  messaging.Ack,
+			wantStatus:    database.AnalysisStatusFailed,
+			wantPublished: "failed",
+			wantLogs:      1,
+			wantObjects:   1,
+		},
+		{
+			name:          "upload failure",
+			failPaths:     map[string]bool{reportPath: true},
+			wantDecision:  messaging.Ack,
+			wantStatus:    database.AnalysisStatusFailed,
+			wantPublished: "failed",
+		},
+		{
+			name:           "after upload hook failure",
+			afterUploadErr: errors.New("post-analysis hook: exit status 2"),
+			logFiles:       map[string]string{"stderr": "/tmp/watchrabbit/run-1.html.stderr.log"},
+			wantDecision:   messaging.Ack,
+			wantStatus:     database.AnalysisStatusFailed,
+			wantPublished:  "failed",
+			wantLogs:       1,
+			wantObjects:    1,
+		},
+		{
+			// the log's result row fails after the report's, the whole transaction rolls back
+			name:          "database failure after upload",
+			logFiles:      map[string]string{"stderr": "/tmp/watchrabbit/run-1.html.stderr.log"},
+			failRecord:    2,
+			wantDecision:  messaging.Ack,
+			wantStatus:    database.AnalysisStatusFailed,
+			wantPublished: "failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepo()
+			repo.failResultRecord = tt.failRecord
+			analyzerService := &fakeAnalyzer{errs: tt.analysisErrs, afterUploadErr: tt.afterUploadErr, logFiles: tt.logFiles}
+			storer := newFakeStorer()
+			storer.failPaths = tt.failPaths
+
+			decision, _, bus := runAnalysisRequest(t, repo, analyzerService, storer)
+
+			if decision != tt.wantDecision {
+				t.Errorf("decision = %s, want %s", decision, tt.wantDecision)
+			}
+			if _, analysis := repo.analysis(); analysis == nil || analysis.status != tt.wantStatus {
+				t.Errorf("analysis = %+v, want status %s", analysis, tt.wantStatus)
+			}
+			if got := completedStatus(t, bus); got != tt.wantPublished {
+				t.Errorf("published completed status %q, want %q", got, tt.wantPublished)
+			}
+			if got := len(repo.resultKeys("report")); got != tt.wantReports {
+				t.Errorf("%d report results recorded, want %d", got, tt.wantReports)
+			}
+			if got := len(repo.resultKeys(database.ResultTypeLog)); got != tt.wantLogs {
+				t.Errorf("%d log results recorded, want %d", got, tt.wantLogs)
+			}
+			if got := len(storer.keys()); got != tt.wantObjects {
+				t.Errorf("%d objects stored, want %d: %v", got, tt.wantObjects, storer.keys())
+			}
+		})
+	}
+}
+
+func TestHandleAnalysisRequestedUsesAnalysisUUID(t *testing.T) {
+	repo := newFakeRepo()
+	analyzerService := &fakeAnalyzer{}
+	storer := newFakeStorer()
+
+	if _, err, _ := runAnalysisRequest(t, repo, analyzerService, storer); err != nil {
+		t.Fatalf("handler returned %v", err)
+	}
+
+	analysisUUID, _ := repo.analysis()
+	if got := analyzerService.options[0].AnalysisID; got != analysisUUID {
+		t.Errorf("analyzer ran as %q, want the analysis record's %s", got, analysisUUID)
+	}
+	wantKey := "results/" + analysisUUID + "/run-1.html"
+	if len(analyzerService.afterUploads) != 1 || analyzerService.afterUploads[0] != wantKey {
+		t.Errorf("after upload hook got keys %v, want %s", analyzerService.afterUploads, wantKey)
+	}
+}
+
+func TestHandleAnalysisRequestedRecordsLogTails(t *testing.T) {
+	repo := newFakeRepo()
+	analyzerService := &fakeAnalyzer{logTails: map[string]string{"rOutput": "rendering | done"}}
+	storer := newFakeStorer()
+
+	if _, err, _ := runAnalysisRequest(t, repo, analyzerService, storer); err != nil {
+		t.Fatalf("handler returned %v", err)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if len(repo.results) != 1 || repo.results[0].metadata["rOutput"] != "rendering | done" {
+		t.Fatalf("results = %+v, want the report recorded with its rOutput tail", repo.results)
+	}
+	key := repo.results[0].storageKey
+	if _, ok := storer.metadata[key]["rOutput"]; ok {
+		t.Errorf("%s was stored with the log tail in its object metadata", key)
+	}
+}
+
+func TestHandleAnalysisRequestedFetchFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantDecision  messaging.Decision
+		wantPublished string
+	}{
+		// redelivered, consumers only hear about it once the retries run out
+		{"transient", http.StatusServiceUnavailable, messaging.Nack, ""},
+		{"permanent", http.StatusNotFound, messaging.Reject, "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			bus := memory.New()
+			defer bus.Close()
+			repo := newFakeRepo()
+			analyzerService := &fakeAnalyzer{}
+			fetcher := source.NewFetcher(server.Client(), nil, 1<<20, nil)
+
+			handler := handleAnalysisRequestedEvent(context.Background(), bus, analyzerService, repo, newFakeStorer(), storage.StorageTypeS3, time.Hour, true, fetcher, analyzer.RetryPolicy{})
+			body, err := json.Marshal(events.AnalysisRequestedEvent{
+				FilePath:     "a.csv",
+				SourceURL:    server.URL + "/a.csv",
+				FileType:     "csv",
+				AnalysisType: "descriptive",
+				Timestamp:    time.Now(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decision, _ := messaging.Decide(handler)(body)
+			if decision != tt.wantDecision {
+				t.Errorf("decision = %s, want %s", decision, tt.wantDecision)
+			}
+			if got := completedStatus(t, bus); got != tt.wantPublished {
+				t.Errorf("published completed status %q, want %q", got, tt.wantPublished)
+			}
+			// the attempt's record isn't left running either way
+			if _, analysis := repo.analysis(); analysis == nil || analysis.status != database.AnalysisStatusFailed {
+				t.Errorf("analysis = %+v, want it marked failed", analysis)
+			}
+			if analyzerService.runs != 0 {
+				t.Errorf("analyzer ran %d times without an input", analyzerService.runs)
+			}
+		})
+	}
+}
+
+func TestHandleAnalysisRequestedNonHTMLOutput(t *testing.T) {
+	tests := []struct {
+		name           string
+		outputExt      string
+		contentType    string
+		wantResultType string
+	}{
+		{"html report", "", "", "report"},
+		{"pdf report", ".pdf", "application/pdf", "report"},
+		{"csv export", ".csv", "text/csv", "data"},
+		{"parquet export", ".parquet", "application/vnd.apache.parquet", "data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepo()
+			storer := newFakeStorer()
+			analyzerService := &fakeAnalyzer{outputExt: tt.outputExt, contentType: tt.contentType}
+
+			decision, err, bus := runAnalysisRequest(t, repo, analyzerService, storer)
+			if decision != messaging.Ack || err != nil {
+				t.Fatalf("decision = %v, %v, want ack", decision, err)
+			}
+			if status := completedStatus(t, bus); status != "success" {
+				t.Errorf("completed status = %q, want success", status)
+			}
+
+			keys := repo.resultKeys(tt.wantResultType)
+			if len(keys) != 1 {
+				t.Fatalf("%d %s results recorded, want 1", len(keys), tt.wantResultType)
+			}
+			repo.mu.Lock()
+			defer repo.mu.Unlock()
+			for _, result := range repo.results {
+				if result.storageKey != keys[0] {
+					continue
+				}
+				wantContentType := tt.contentType
+				if wantContentType == "" {
+					wantContentType = "text/html; charset=utf-8"
+				}
+				if result.contentType != wantContentType {
+					t.Errorf("recorded content type = %q, want %q", result.contentType, wantContentType)
+				}
+				if tt.outputExt != "" && filepath.Ext(result.storageKey) != tt.outputExt {
+					t.Errorf("stored as %s, want a %s object", result.storageKey, tt.outputExt)
+				}
+			}
+		})
+	}
+}
@@ -4,13 +4,37 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 	"watchrabbit/internal/config"
 	"watchrabbit/internal/domain/events"
 	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/autoscale"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/dedup"
+	"watchrabbit/internal/services/heartbeat"
+	"watchrabbit/internal/services/logging"
+	"watchrabbit/internal/services/metrics"
+	"watchrabbit/internal/services/redact"
+	"watchrabbit/internal/services/replica"
+	"watchrabbit/internal/services/source"
 	"watchrabbit/internal/services/storage"
+	"watchrabbit/internal/services/watcher"
+	"watchrabbit/pkg/fileutil"
 	"watchrabbit/pkg/messaging"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -20,60 +44,370 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// JSON logs, log.Printf calls that are left go through the same handler
+	logger, err := logging.Setup(cfg.LogLevel, "worker")
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	// set up before anything logs a file path
+	redactor, err := redact.New(cfg.Redact.Mode, cfg.Redact.PathPatterns, cfg.Redact.MetadataKeys)
+	if err != nil {
+		log.Fatalf("Invalid redaction configuration: %v", err)
+	}
+	redact.SetDefault(redactor)
+
+	// stagger replicas started by the same deploy
+	replica.SleepJitter(time.Duration(cfg.Replica.StartupJitterMs) * time.Millisecond)
+
 	// Initialize RabbitMQ client
 	rabbitMQ, err := messaging.NewRabbitMQClient(cfg.RabbitMQ.URI)
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
 	}
 	defer rabbitMQ.Close()
+	rabbitMQ.SetLogger(logger)
+	rabbitMQ.SetPublishBufferSize(cfg.RabbitMQ.PublishBufferSize)
+	rabbitMQ.SetMaxMessageSize(cfg.RabbitMQ.MaxMessageBytes)
+	rabbitMQ.SetPublishErrorHook(metrics.PublishErrors.Inc)
+	rabbitMQ.SetRecreateMismatchedQueues(cfg.RabbitMQ.RecreateMismatchedQueues)
+	rabbitMQ.SetRetry("analysis.requested", time.Duration(cfg.RabbitMQ.RetryDelay)*time.Second, cfg.RabbitMQ.MaxRetries)
 
 	// Set up RabbitMQ infrastructure
 	if err := rabbitMQ.SetupInfrastructure(); err != nil {
 		log.Fatalf("Failed to set up RabbitMQ infrastructure: %v", err)
 	}
 
+	// Initialize PostgreSQL
+	db, err := database.NewPostgresSerivce(database.PostgresConfig{
+		Host:     cfg.Postgres.Host,
+		Port:     cfg.Postgres.Port,
+		User:     cfg.Postgres.User,
+		Password: cfg.Postgres.Password,
+		DBName:   cfg.Postgres.DBName,
+		SSLMode:  cfg.Postgres.SSLMode,
+		IDScheme: cfg.Analysis.IDScheme,
+		Logger:   logger,
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	defer db.Close()
+	if cfg.Postgres.Migrate {
+		if err := db.Migrate(context.Background()); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	// names this worker in the audit log and its heartbeats
+	workerID := cfg.Worker.ID
+	if workerID == "" {
+		workerID, _ = os.Hostname()
+	}
+
+	// compliance audit trail, written async so it never holds up processing
+	if cfg.Worker.AuditLog {
+		auditLogger := database.NewAuditLogger(db, 1000)
+		defer auditLogger.Close()
+		rabbitMQ.SetDeliveryHook(auditHook(auditLogger, workerID))
+	}
+
 	// Initialize analyzer service - to replace with actual biomarker scripts or adapt template to use different R files
 	// currently using a test script that generates an Rmd .html from a .csv file
-	analyzerService, err := analyzer.NewDescriptiveService(
-		cfg.Analysis.RExecutable,
-		cfg.Analysis.ScriptsDir,
-		cfg.Analysis.Timeout,
-	)
+	analyzerService, err := analyzer.NewDescriptiveService(analyzer.DescriptiveConfig{
+		RExecutable: cfg.Analysis.RExecutable,
+		PythonExecutable: cfg.Analysis.PythonExecutable,
+		ScriptsDir:  cfg.Analysis.ScriptsDir,
+		Timeout:     cfg.Analysis.Timeout,
+		Timeouts:    cfg.Analysis.Timeouts,
+		Backend:     cfg.Analysis.Backend,
+		RserveAddr:  cfg.Analysis.RserveAddr,
+		Scripts:     cfg.Analysis.Scripts,
+		MaxConcurrency: cfg.Analysis.MaxConcurrency,
+		OutputDir:      cfg.Analysis.OutputDir,
+		RetainOutput:   cfg.Analysis.RetainOutput,
+		IDScheme:       cfg.Analysis.IDScheme,
+		BaseDir:        cfg.Analysis.BaseDir,
+		PreHook:        cfg.Analysis.PreHook,
+		PostHook:       cfg.Analysis.PostHook,
+		PostHookStage:  cfg.Analysis.PostHookStage,
+		PostHookOnFail: cfg.Analysis.PostHookOnFail,
+		Logger:         logger,
+		FileTypes:      cfg.FileWatcher.SupportedExtensions,
+		OutputValidation: analyzer.OutputValidation{
+			Enabled:  cfg.Analysis.ValidateOutput,
+			MinBytes: cfg.Analysis.OutputMinBytes,
+			Marker:   cfg.Analysis.OutputMarker,
+			WarnOnly: cfg.Analysis.OutputValidationMode == "warn",
+		},
+		HookTimeout:    cfg.Analysis.HookTimeout,
+	})
 
 	if err != nil {
 		log.Fatalf("Failed to initialize descriptive report genreator: %v", err)
 	}
+	// reports written where the watcher looks get detected and analyzed again, endlessly
+	for _, dir := range analyzer.OverlappingDirs(analyzerService.OutputDir, cfg.FileWatcher.Directories) {
+		logger.Warn("Analysis output dir overlaps a watched directory, reports may trigger re-analysis",
+			slog.String("output_dir", analyzerService.OutputDir),
+			slog.String("watched_dir", dir))
+	}
+	// a missing R package would otherwise only show up as every analysis failing
+	// (routing-only workers never run R, so they skip it)
+	if len(cfg.Analysis.RequiredPackages) > 0 && slices.Contains(cfg.Worker.Queues, "analysis.requested") {
+		preflightCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		err := analyzerService.Preflight(preflightCtx, cfg.Analysis.RequiredPackages)
+		cancel()
+		if err != nil {
+			log.Fatalf("R environment check failed: %v", err)
+		}
+	}
 	// Initialize storage service
-	storageService, err := storage.NewS3Service(cfg.S3)
+	var storageService storage.Storer
+	var s3Service *storage.S3Service // also serves s3:// analysis inputs, nil with the local backend
+	storageType := storage.StorageTypeS3
+	switch cfg.Storage.Backend {
+	case "s3", "":
+		s3Service, err = storage.NewS3Service(storage.S3Config{
+			Bucket:         cfg.S3.Bucket,
+			Region:         cfg.S3.Region,
+			AccessKey:      cfg.S3.AccessKey,
+			SecretKey:      cfg.S3.SecretKey,
+			Endpoint:       cfg.S3.Endpoint,
+			PublicEndpoint: cfg.S3.PublicEndpoint,
+			Compress:       cfg.S3.Compress,
+			Dispositions:   cfg.S3.Dispositions,
+			SSE:            cfg.S3.SSE,
+			KMSKeyID:       cfg.S3.KMSKeyID,
+			Tags:           cfg.S3.Tags,
+			StorageClass:   cfg.S3.StorageClass,
+			Logger:         logger,
+		})
+		storageService = s3Service
+	case "local":
+		storageService, err = storage.NewLocalFSStore(cfg.Storage.LocalDir)
+		storageType = storage.StorageTypeLocal
+	default:
+		err = fmt.Errorf("unknown storage backend %q (expected s3 or local)", cfg.Storage.Backend)
+	}
+	if err != nil {
+		log.Fatalf("Failed to initialize result storage: %v", err)
+	}
+
+	// SIGINT/SIGTERM stops consuming, lets in-flight handlers finish, then the deferred Closes run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.RabbitMQ.Inspect {
+		if err := rabbitMQ.Inspect(ctx, cfg.RabbitMQ.InspectExchanges, cfg.RabbitMQ.InspectMaxBody); err != nil {
+			log.Printf("Failed to start event inspector: %v", err)
+		}
+	}
+
+	// scaled deployments split roles, e.g. routing-only workers and analysis-only workers
+	queues, err := workerQueues(cfg.Worker.Queues)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 storage: %v", err)
+		log.Fatalf("Invalid worker queue configuration: %v", err)
 	}
 
 	// Subscribe to RabbitMQ queues: 
 	// file detected, analysis requested
-	if err := subscribeToQueue(rabbitMQ, "file.detected", handleFileDetectedEvent(rabbitMQ)); err != nil {
-		log.Fatalf("Failed to subscribe to file detected events: %v", err)
+	fanOut := analyzer.NewFanOut(cfg.Analysis.Types, cfg.Analysis.DirectoryTypes)
+	if queues["file.detected"] {
+		if err := subscribeToQueue(ctx, rabbitMQ, "file.detected", handleFileDetectedEvent(rabbitMQ, fanOut)); err != nil {
+			log.Fatalf("Failed to subscribe to file detected events: %v", err)
+		}
 	}
 	
-	if err := subscribeToQueue(rabbitMQ, "analysis.requested", handleAnalysisRequestedEvent(rabbitMQ, analyzerService, storageService)); err != nil {
-		log.Fatalf("Failed to subscribe to analysis requested events: %v", err)
+	// in-place modifications re-run the same analyses as a newly detected file
+	if queues["file.changed"] {
+		if err := subscribeToQueue(ctx, rabbitMQ, "file.changed", handleFileChangedEvent(rabbitMQ, fanOut)); err != nil {
+			log.Fatalf("Failed to subscribe to file changed events: %v", err)
+		}
 	}
 
-	// Keep the application running
-	select {}
+	if queues["file.removed"] {
+		if err := subscribeToQueue(ctx, rabbitMQ, "file.removed", handleFileRemovedEvent(db)); err != nil {
+			log.Fatalf("Failed to subscribe to file removed events: %v", err)
+		}
+	}
+
+	// inputs submitted by URL are downloaded to a temp file first
+	fetcher := source.NewFetcher(&http.Client{Timeout: time.Duration(cfg.Analysis.Timeout) * time.Second}, s3Service, cfg.Analysis.SourceMaxBytes, cfg.Analysis.SourceContentTypes)
+
+	// defense in depth on top of the watcher's excludes, e.g. raw PHI extracts that must never be processed
+	denyPatterns, err := watcher.CompilePatterns(cfg.Analysis.DenyPatterns)
+	if err != nil {
+		log.Fatalf("Invalid analysis deny pattern: %v", err)
+	}
+
+	// outlives ctx on purpose: in-flight analyses get the shutdown timeout to finish before they're killed
+	analysisCtx, cancelAnalyses := context.WithCancel(context.Background())
+	defer cancelAnalyses()
+
+	staleAfter := time.Duration(cfg.Analysis.StaleAfter) * time.Second
+	presignExpiry := time.Duration(cfg.S3.PresignExpiry) * time.Second
+	if presignExpiry > storage.MaxPresignExpiry {
+		log.Fatalf("S3 presign expiry %s exceeds the %s maximum", presignExpiry, storage.MaxPresignExpiry)
+	}
+	retry := analyzer.RetryPolicy{
+		MaxAttempts:       cfg.Analysis.MaxAttempts,
+		Backoff:           time.Duration(cfg.Analysis.RetryBackoff) * time.Second,
+		MaxBackoff:        time.Duration(cfg.Analysis.RetryMaxBackoff) * time.Second,
+		TransientPatterns: cfg.Analysis.RetryPatterns,
+	}
+	analysisHandler := handleAnalysisRequestedEvent(analysisCtx, rabbitMQ, analyzerService, db, storageService, storageType, presignExpiry, cfg.Analysis.OrderedLatest, fetcher, retry)
+	if cfg.Analysis.CacheResults {
+		analysisHandler = serveCachedResults(rabbitMQ, db, storageService, presignExpiry, analysisHandler)
+	}
+	analysisHandler = revalidateStaleRequests(rabbitMQ, staleAfter, analysisHandler)
+	loops := analyzer.NewLoopDetector(cfg.Analysis.MaxPerFile, time.Duration(cfg.Analysis.PerFileWindow)*time.Second, time.Duration(cfg.Analysis.Quarantine)*time.Second)
+	if loops != nil {
+		analysisHandler = quarantineLoopingFiles(rabbitMQ, loops, cfg.Analysis.MaxPerFile, time.Duration(cfg.Analysis.PerFileWindow)*time.Second, time.Duration(cfg.Analysis.Quarantine)*time.Second, analysisHandler)
+	}
+	// Subscribe requeues on error, so the same request can come back after it was already processed
+	seen := dedup.NewStore(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, time.Duration(cfg.Redis.DedupTTL)*time.Second)
+	if seen != nil {
+		defer seen.Close()
+		analysisHandler = skipProcessedRequests(seen, analysisHandler)
+	}
+	analysisHandler = rejectDeniedFiles(denyPatterns, analysisHandler)
+	if queues["analysis.requested"] {
+		subscribeAnalysis(ctx, rabbitMQ, cfg.Analysis, analysisHandler)
+	}
+
+	heartbeatInterval := time.Duration(cfg.Heartbeat.Interval) * time.Second
+	go heartbeat.NewPublisher(rabbitMQ, "worker", workerID, heartbeatInterval, rabbitMQ.InFlight).Run(ctx)
+
+	// readiness probe for k8s (reports unready while RabbitMQ is reconnecting) and prometheus /metrics
+	go serveHealth(ctx, cfg.Worker.HealthAddr, rabbitMQ)
+
+	// run until signalled
+	<-ctx.Done()
+	log.Printf("Shutting down, waiting for %d in-flight messages", rabbitMQ.InFlight())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Worker.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := rabbitMQ.WaitForHandlers(shutdownCtx); err != nil {
+		// unacked messages are redelivered by the broker once the connection closes
+		log.Printf("Gave up waiting for handlers, killing running analyses: %v", err)
+		cancelAnalyses()
+		killCtx, cancelKill := context.WithTimeout(context.Background(), 10*time.Second)
+		rabbitMQ.WaitForHandlers(killCtx)
+		cancelKill()
+	}
+	log.Println("Worker stopped")
+}
+
+func serveHealth(ctx context.Context, addr string, rabbitMQ *messaging.RabbitMQClient) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		if err := rabbitMQ.HealthCheck(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Printf("Serving health checks on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Health check server stopped: %v", err)
+	}
+}
+
+func auditHook(auditLogger *database.AuditLogger, workerID string) messaging.DeliveryHook {
+	return func(record messaging.DeliveryRecord) {
+		entry := database.AuditEntry{
+			Queue:      record.Queue,
+			MessageID:  record.MessageID,
+			WorkerID:   workerID,
+			Outcome:    record.Outcome,
+			Duration:   record.Duration,
+			ReceivedAt: record.ReceivedAt,
+		}
+		if record.Err != nil {
+			entry.Error = record.Err.Error()
+		}
+		auditLogger.Log(entry)
+	}
+}
+
+// runs one analysis.requested consumer, or a pool sized by queue depth when autoscaling is on
+func subscribeAnalysis(ctx context.Context, rabbitMQ *messaging.RabbitMQClient, cfg config.AnalysisConfig, analysisHandler EventHandler) {
+	if !cfg.Autoscale {
+		if cfg.Workers > 1 {
+			// every worker needs an unacked delivery of its own
+			if err := rabbitMQ.SetPrefetch(cfg.Workers); err != nil {
+				log.Fatalf("Failed to set RabbitMQ prefetch: %v", err)
+			}
+		}
+		log.Printf("Subscribing to queue: analysis.requested (%d workers)", cfg.Workers)
+		if err := rabbitMQ.SubscribeConcurrentWithContext(ctx, "analysis.requested", analysisHandler, cfg.Workers); err != nil {
+			log.Fatalf("Failed to subscribe to analysis requested events: %v", err)
+		}
+		return
+	}
+
+	// without a prefetch limit the first consumer would be handed the whole backlog
+	if err := rabbitMQ.SetPrefetch(1); err != nil {
+		log.Fatalf("Failed to set RabbitMQ prefetch: %v", err)
+	}
+	policy := autoscale.NewPolicy(cfg.AutoscaleMin, cfg.AutoscaleMax, cfg.AutoscaleUpDepth, cfg.AutoscaleDownDepth)
+	scaler := autoscale.NewScaler(rabbitMQ, "analysis.requested", policy, time.Duration(cfg.AutoscaleInterval)*time.Second, func(consumerCtx context.Context) error {
+		return subscribeToQueue(consumerCtx, rabbitMQ, "analysis.requested", analysisHandler)
+	})
+	go func() {
+		if err := scaler.Run(ctx); err != nil {
+			log.Fatalf("Failed to subscribe to analysis requested events: %v", err)
+		}
+	}()
+}
+
+// queues a worker knows how to handle
+var knownQueues = []string{"file.detected", "file.changed", "file.removed", "analysis.requested"}
+
+// validates the configured queue names, returning them as a set
+func workerQueues(configured []string) (map[string]bool, error) {
+	queues := make(map[string]bool)
+	for _, name := range configured {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(knownQueues, name) {
+			return nil, fmt.Errorf("unknown queue %q (expected one of %s)", name, strings.Join(knownQueues, ", "))
+		}
+		queues[name] = true
+	}
+	if len(queues) == 0 {
+		return nil, fmt.Errorf("no queues configured")
+	}
+	return queues, nil
 }
 
 // RabbitMQ queue subscription helper functions:
 type EventHandler func([]byte) error
 
-func subscribeToQueue(rabbitMQ *messaging.RabbitMQClient, queueName string, handler EventHandler) error {
+func subscribeToQueue(ctx context.Context, rabbitMQ messaging.MessageBus, queueName string, handler EventHandler) error {
     log.Printf("Subscribing to queue: %s", queueName)
-    return rabbitMQ.Subscribe(queueName, handler)
+    return rabbitMQ.SubscribeWithContext(ctx, queueName, handler)
 }
 
 // sends any file change events to the RabbitMQ queue
 // will also request an analysis (and send that to the queue) to generate a Rmarkdown report
-func handleFileDetectedEvent(rabbitMQ *messaging.RabbitMQClient) EventHandler {
+// one request is published per analysis type the file fans out to
+func handleFileDetectedEvent(rabbitMQ messaging.MessageBus, fanOut *analyzer.FanOut) EventHandler {
 	return func(data []byte) error {
 		var fileEvent events.FileDetectedEvent
 		if err := json.Unmarshal(data, &fileEvent); err != nil {
@@ -82,77 +416,695 @@ func handleFileDetectedEvent(rabbitMQ *messaging.RabbitMQClient) EventHandler {
 		}
 		// file detected handler logic
 		// may need to adjust types
-		log.Printf("Received file detected event for: %s", fileEvent.FilePath)
+		log.Printf("Received file detected event for: %s", redact.Path(fileEvent.FilePath))
 
-		requestEvent := fileEvent.AnalysisRequestedEvent{
-			FilePath: fileEvent.FilePath,
-			FileType: fileEvent.FileType,
-			Timestamp: time.Now(),
+		analysisTypes, err := fanOut.AnalysisTypes(fileEvent.FilePath)
+		if err != nil {
+			log.Printf("Failed to resolve analysis types for %s: %v", redact.Path(fileEvent.FilePath), err)
+			return err
+		}
+
+		// every type is attempted even if one fails, the redelivery re-requests them all and the per-type
+		// idempotency keys let skipProcessedRequests drop the ones that already went out
+		var failed []error
+		for _, analysisType := range analysisTypes {
+			requestEvent := events.AnalysisRequestedEvent{
+				FilePath: fileEvent.FilePath,
+				FileType: fileEvent.FileType,
+				AnalysisType: analysisType,
+				Checksum: fileEvent.Checksum,
+				Requester: fileEvent.Requester,
+				Timestamp: time.Now(),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			routingKey := events.RoutingKey("analysis.requested", fileEvent.FileType)
+			err := rabbitMQ.PublishEvent(ctx, "biomarker.analysis.events", routingKey, requestEvent)
+			cancel()
+
+			if err != nil {
+				log.Printf("Failed to publish %s analysis requested event: %v", analysisType, err)
+				failed = append(failed, fmt.Errorf("%s (%s): %v", analysisType, requestEvent.IdempotencyKey(), err))
+				continue
+			}
+
+			log.Printf("Published %s analysis requested event for file: %s", analysisType, redact.Path(fileEvent.FilePath))
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to request %d of %d analysis types: %w", len(failed), len(analysisTypes), errors.Join(failed...))
+		}
+		return nil
+	}
+}
+
+// a file modified in place goes through the same fan-out as a newly detected one
+func handleFileChangedEvent(rabbitMQ messaging.MessageBus, fanOut *analyzer.FanOut) EventHandler {
+	detected := handleFileDetectedEvent(rabbitMQ, fanOut)
+	return func(data []byte) error {
+		var changedEvent events.FileChangedEvent
+		if err := json.Unmarshal(data, &changedEvent); err != nil {
+			log.Printf("Failed to unmarshal file changed event: %v", err)
+			return err
+		}
+		log.Printf("Received file changed event for: %s", redact.Path(changedEvent.FilePath))
+
+		fileEvent, err := json.Marshal(events.FileDetectedEvent{
+			FilePath:  changedEvent.FilePath,
+			FileType:  changedEvent.FileType,
+			Size:      changedEvent.Size,
+			Checksum:  changedEvent.Checksum,
+			Requester: changedEvent.Requester,
+			Timestamp: changedEvent.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+		return detected(fileEvent)
 	}
+}
+
+// marks deleted/renamed files as removed so they stop showing up as current
+func handleFileRemovedEvent(db database.Repository) EventHandler {
+	return func(data []byte) error {
+		var removedEvent events.FileRemovedEvent
+		if err := json.Unmarshal(data, &removedEvent); err != nil {
+			log.Printf("Failed to unmarshal file removed event: %v", err)
+			return err
+		}
+		log.Printf("Received file removed event for: %s", redact.Path(removedEvent.FilePath))
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		routingKey := "analysis.requested" + fileEvent.FileType
+		if _, err := db.MarkFileRemoved(ctx, removedEvent.FilePath); err != nil {
+			log.Printf("Failed to mark file removed: %v", err)
+			return err
+		}
+		return nil
+	}
+}
+
+// requests for files matching a deny pattern are rejected permanently: parked in analysis.requested.dlq for review
+// rather than requeued, and the delivery hook records the rejection in the audit log along with the reason
+func rejectDeniedFiles(denyPatterns *watcher.Patterns, next EventHandler) EventHandler {
+	return func(data []byte) error {
+		var requestEvent events.AnalysisRequestedEvent
+		if err := json.Unmarshal(data, &requestEvent); err != nil {
+			log.Printf("Failed to unmarshal analysis requested event: %v", err)
+			return err
+		}
+
+		if pattern, denied := denyPatterns.Match(requestEvent.FilePath); denied {
+			log.Printf("Refusing to analyze %s, matches deny pattern %q", redact.Path(requestEvent.FilePath), pattern)
+			return messaging.Permanent(fmt.Errorf("file %s matches analysis deny pattern %q", redact.Path(requestEvent.FilePath), pattern))
+		}
+		return next(data)
+	}
+}
 
-		if err := rabbitMQ.PublishEvent(ctx, "biomarker.analysis.events", routingKey, requestEvent); err != nil {
-			log.Printf("Failed to publish analysis requested event: %v", err)
+// requests for content (checksum + analysis type) processed within the dedup TTL are acked without running again
+// redis is optional: if it can't be reached the request is processed anyway
+func skipProcessedRequests(seen *dedup.Store, next EventHandler) EventHandler {
+	return func(data []byte) error {
+		var requestEvent events.AnalysisRequestedEvent
+		if err := json.Unmarshal(data, &requestEvent); err != nil {
+			log.Printf("Failed to unmarshal analysis requested event: %v", err)
 			return err
 		}
+		// without a checksum the key would be the path, which would skip genuinely changed files
+		if requestEvent.Force || requestEvent.Checksum == "" {
+			return next(data)
+		}
+		if requestEvent.AnalysisType == "" {
+			requestEvent.AnalysisType = analyzer.DefaultAnalysisType
+		}
+		key := requestEvent.IdempotencyKey()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		alreadySeen, err := seen.SeenBefore(ctx, key)
+		cancel()
+		if err != nil {
+			log.Printf("WARNING: dedup check failed, processing %s anyway: %v", redact.Path(requestEvent.FilePath), err)
+			return next(data)
+		}
+		if alreadySeen {
+			log.Printf("Skipping %s analysis of %s, already processed", requestEvent.AnalysisType, redact.Path(requestEvent.FilePath))
+			return nil
+		}
 
-		log.Printf("Published analysis requested event for file: %s", fileEvent.FilePath)
+		if err := next(data); err != nil {
+			// failed for good and already recorded, a resend of the same content would fail the same way
+			if messaging.IsHandled(err) {
+				return err
+			}
+			// let the redelivery run
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if forgetErr := seen.Forget(ctx, key); forgetErr != nil {
+				log.Printf("Failed to release dedup key for %s: %v", redact.Path(requestEvent.FilePath), forgetErr)
+			}
+			return err
+		}
 		return nil
 	}
 }
 
+// a file analyzed more than max times within window is almost always a feedback loop (a script writing into a
+// watched dir), it's quarantined: requests are rejected permanently (parked in analysis.requested.dlq) for the
+// quarantine period and an alert published
+func quarantineLoopingFiles(rabbitMQ messaging.MessageBus, loops *analyzer.LoopDetector, max int, window, quarantine time.Duration, next EventHandler) EventHandler {
+	return func(data []byte) error {
+		var requestEvent events.AnalysisRequestedEvent
+		if err := json.Unmarshal(data, &requestEvent); err != nil {
+			log.Printf("Failed to unmarshal analysis requested event: %v", err)
+			return err
+		}
+
+		now := time.Now()
+		allowed, tripped := loops.Allow(requestEvent.FilePath, now)
+		if tripped {
+			log.Printf("ALERT: %s was requested more than %d times in %s, quarantining it for %s", redact.Path(requestEvent.FilePath), max, window, quarantine)
+			metrics.FilesQuarantined.Inc()
+			alert := events.FileQuarantinedEvent{
+				FilePath:  requestEvent.FilePath,
+				FileType:  requestEvent.FileType,
+				Requests:  max,
+				Window:    window,
+				Until:     now.Add(quarantine),
+				Timestamp: now,
+			}
+			if err := rabbitMQ.PublishEvent(context.Background(), "biomarker.file.events", events.RoutingKey("file.quarantined", requestEvent.FileType), alert); err != nil {
+				log.Printf("Failed to publish quarantine alert for %s: %v", redact.Path(requestEvent.FilePath), err)
+			}
+		}
+		if !allowed {
+			return messaging.Permanent(fmt.Errorf("file %s is quarantined for exceeding %d analyses in %s", redact.Path(requestEvent.FilePath), max, window))
+		}
+		return next(data)
+	}
+}
+
+// pipeline reruns often re-submit identical files, if the same content (by checksum) was already analyzed
+// successfully the existing result is announced instead of re-running R and re-uploading
+// requests with Force set, or without a checksum, always run
+func serveCachedResults(rabbitMQ messaging.MessageBus, db database.Repository, storageService storage.Storer, presignExpiry time.Duration, next EventHandler) EventHandler {
+	return func(data []byte) error {
+		var requestEvent events.AnalysisRequestedEvent
+		if err := json.Unmarshal(data, &requestEvent); err != nil {
+			log.Printf("Failed to unmarshal analysis requested event: %v", err)
+			return err
+		}
+		if requestEvent.Force || requestEvent.Checksum == "" {
+			return next(data)
+		}
+
+		analysisType := requestEvent.AnalysisType
+		if analysisType == "" {
+			analysisType = analyzer.DefaultAnalysisType
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cached, err := db.FindCachedResult(ctx, requestEvent.Checksum, analysisType)
+		if err != nil {
+			// the cache is an optimization, fall through to a normal run
+			log.Printf("Result cache lookup failed, running analysis: %v", err)
+			return next(data)
+		}
+		if cached == nil {
+			return next(data)
+		}
+		if exists, err := storageService.ResultExists(ctx, cached.StorageKey); err != nil || !exists {
+			log.Printf("Cached result %s for %s is no longer in storage, running analysis", cached.StorageKey, redact.Path(requestEvent.FilePath))
+			return next(data)
+		}
+
+		log.Printf("Reusing %s result of analysis %s for %s (identical input)", analysisType, cached.AnalysisUUID, redact.Path(requestEvent.FilePath))
+		completedEvent := events.AnalysisCompletedEvent{
+			FilePath:       requestEvent.FilePath,
+			ResultKey:      cached.StorageKey,
+			AnalysisType:   analysisType,
+			ProcessingTime: 0,
+			Timestamp:      time.Now(),
+			Status:         "success",
+			PresignedURL:   presignedURL(storageService, cached.StorageKey, presignExpiry),
+		}
+
+		routingKey := events.RoutingKey("analysis.completed", requestEvent.FileType)
+		return rabbitMQ.PublishEvent(ctx, "biomarker.result.events", routingKey, completedEvent)
+	}
+}
+
+// download link for analysis.completed, empty when presigning is disabled (expiry 0), unsupported by the backend or fails,
+// the event still carries the key so consumers with their own credentials aren't affected
+func presignedURL(storageService storage.Storer, s3Key string, expiry time.Duration) string {
+	presigner, ok := storageService.(storage.Presigner)
+	if !ok || expiry <= 0 || s3Key == "" {
+		return ""
+	}
+	url, err := presigner.PresignResult(s3Key, expiry)
+	if err != nil {
+		log.Printf("Failed to presign result %s: %v", s3Key, err)
+		return ""
+	}
+	return url
+}
+
+// records the file (once per path) and a pending analysis of it before R starts, so an analysis that crashes the
+// worker still shows up, markAnalysisStarted moves it to running
+func startAnalysisRecord(ctx context.Context, db database.Repository, requestEvent events.AnalysisRequestedEvent) (string, int64, error) {
+	var fileSize int64
+	if info, err := os.Stat(requestEvent.FilePath); err == nil {
+		fileSize = info.Size()
+	}
+
+	analysisMetadata := map[string]string{}
+	if requestEvent.Checksum != "" {
+		// lets the result cache find this analysis for identical input later
+		analysisMetadata[database.InputChecksumKey] = requestEvent.Checksum
+	}
+
+	var analysisUUID string
+	var analysisID int64
+	err := db.WithTx(ctx, func(tx database.TxWriter) error {
+		fileID, err := tx.GetOrCreateFileRecord(ctx, requestEvent.FilePath, fileSize, nil)
+		if err != nil {
+			return err
+		}
+		analysisUUID, analysisID, err = tx.CreateAnalysisRecord(ctx, fileID, requestEvent.AnalysisType, database.AnalysisStatusPending, requestEvent.Requester, analysisMetadata)
+		return err
+	})
+	return analysisUUID, analysisID, err
+}
+
+// keeps the analysis's attempt count current, failures are only logged
+func recordAttempts(db database.Repository, analysisUUID string, attempts int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MergeAnalysisMetadata(ctx, analysisUUID, map[string]string{database.AttemptsKey: strconv.Itoa(attempts)}); err != nil {
+		log.Printf("Failed to record attempts of analysis %s: %v", analysisUUID, err)
+	}
+}
+
+// moves the analysis to running and announces it, failures are only logged - R runs either way
+func markAnalysisStarted(rabbitMQ messaging.MessageBus, db database.Repository, analysisUUID string, requestEvent events.AnalysisRequestedEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.UpdateAnalysisStatus(ctx, analysisUUID, database.AnalysisStatusRunning, ""); err != nil {
+		log.Printf("Failed to mark analysis %s running: %v", analysisUUID, err)
+	}
+
+	now := time.Now()
+	startedEvent := events.AnalysisStartedEvent{
+		AnalysisUUID: analysisUUID,
+		FilePath:     requestEvent.FilePath,
+		AnalysisType: requestEvent.AnalysisType,
+		StartedAt:    now,
+		Timestamp:    now,
+	}
+	routingKey := events.RoutingKey("analysis.started", requestEvent.FileType)
+	if err := rabbitMQ.PublishEvent(ctx, "biomarker.result.events", routingKey, startedEvent); err != nil {
+		log.Printf("Failed to publish analysis started event for %s: %v", analysisUUID, err)
+	}
+}
+
+// writes the result row (and one per run log) and completes the analysis in one transaction, so a crash part way
+// can't leave a completed analysis without its result
+func recordCompletedAnalysis(ctx context.Context, db database.Repository, analysisUUID string, analysisID int64, result *analyzer.DescriptiveAnalysisMetadata, storageType string, stored *storage.StoredResult, logs []storedLog) (int64, error) {
+	metadata := stored.RecordMetadata()
+	for key, value := range result.Metadata {
+		metadata[key] = value
+	}
+	// only the record keeps the log tails, they were left out of the stored object's metadata
+	for key, value := range result.LogTails {
+		metadata[key] = value
+	}
+
+	var resultID int64
+	err := db.WithTx(ctx, func(tx database.TxWriter) error {
+		var err error
+		// the store fills in the content type when the analysis didn't set one
+		contentType := stored.ContentType
+		if contentType == "" {
+			contentType = result.ContentType
+		}
+		resultID, err = tx.CreateResultRecord(ctx, analysisID, resultType(contentType), storageType, stored.Key, contentType, stored.OriginalSize, stored.Checksum, metadata)
+		if err != nil {
+			return err
+		}
+		if err := createLogRecords(ctx, tx, analysisID, storageType, logs); err != nil {
+			return err
+		}
+		return tx.UpdateAnalysisStatus(ctx, analysisUUID, database.AnalysisStatusCompleted, "")
+	})
+	return resultID, err
+}
+
+// keeps a failed run's uploaded logs with its analysis, they're usually the only explanation of the failure
+// failures are only logged, the analysis is marked failed either way
+func recordFailedRunLogs(db database.Repository, analysisUUID string, analysisID int64, storageType string, logs []storedLog) {
+	if len(logs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.WithTx(ctx, func(tx database.TxWriter) error {
+		return createLogRecords(ctx, tx, analysisID, storageType, logs)
+	})
+	if err != nil {
+		log.Printf("Failed to record logs of failed analysis %s: %v", analysisUUID, err)
+	}
+}
+
+func createLogRecords(ctx context.Context, tx database.TxWriter, analysisID int64, storageType string, logs []storedLog) error {
+	for _, runLog := range logs {
+		logMetadata := runLog.stored.RecordMetadata()
+		logMetadata["stream"] = runLog.stream
+		if _, err := tx.CreateResultRecord(ctx, analysisID, database.ResultTypeLog, storageType, runLog.stored.Key, runLogContentType, runLog.stored.OriginalSize, runLog.stored.Checksum, logMetadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes uploads nothing is going to record, a failed delete only leaves an unreferenced object behind
+func deleteStoredResults(storageService storage.Storer, keys ...string) {
+	for _, key := range keys {
+		if err := storageService.DeleteResult(key); err != nil {
+			log.Printf("Failed to delete stored result %s: %v", key, err)
+		}
+	}
+}
+
+const runLogContentType = "text/plain; charset=utf-8"
+
+// a script's stdout or stderr, uploaded next to its report
+type storedLog struct {
+	stream string
+	stored *storage.StoredResult
+}
+
+// uploads the run's log files, one that fails to upload is skipped - the report matters, the log is a debugging aid
+func storeRunLogs(storageService storage.Storer, filePath string, result *analyzer.DescriptiveAnalysisMetadata) []storedLog {
+	streams := make([]string, 0, len(result.LogFiles))
+	for stream := range result.LogFiles {
+		streams = append(streams, stream)
+	}
+	slices.Sort(streams)
+
+	var logs []storedLog
+	for _, stream := range streams {
+		stored, err := storageService.StoreResultWithInfo(&storage.ResultData{
+			FilePath:    filePath,
+			AnalysisID:  result.AnalysisID,
+			ContentType: runLogContentType,
+			OutputPath:  result.LogFiles[stream],
+			Metadata:    map[string]string{"stream": stream},
+		})
+		if err != nil {
+			log.Printf("Failed to store %s log of analysis %s: %v", stream, result.AnalysisID, err)
+			continue
+		}
+		logs = append(logs, storedLog{stream: stream, stored: stored})
+	}
+	return logs
+}
+
+// rendered documents are reports, anything else an analysis type produces (csv, json, ...) is data
+func resultType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/html"), strings.HasPrefix(contentType, "application/pdf"):
+		return "report"
+	default:
+		return "data"
+	}
+}
+
+// requests that waited in the queue past staleAfter (e.g. during a worker outage) are re-validated first:
+// missing files are discarded, files whose checksum changed are re-detected instead of analyzed
+func revalidateStaleRequests(rabbitMQ messaging.MessageBus, staleAfter time.Duration, next EventHandler) EventHandler {
+	return func(data []byte) error {
+		var requestEvent events.AnalysisRequestedEvent
+		if err := json.Unmarshal(data, &requestEvent); err != nil {
+			log.Printf("Failed to unmarshal analysis requested event: %v", err)
+			return err
+		}
+
+		// remote inputs are fetched fresh anyway, nothing local to re-validate
+		if requestEvent.SourceURL != "" || !requestEvent.IsStale(staleAfter, time.Now()) {
+			return next(data)
+		}
+
+		log.Printf("Analysis request for %s is stale (queued at %s), re-validating file", redact.Path(requestEvent.FilePath), requestEvent.Timestamp.Format(time.RFC3339))
+
+		fileInfo, err := os.Stat(requestEvent.FilePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// nothing left to analyze, ack and drop
+				log.Printf("Discarding stale analysis request, file no longer exists: %s", redact.Path(requestEvent.FilePath))
+				return nil
+			}
+			return err
+		}
+
+		// older producers didn't send a checksum, existence is all we can check
+		if requestEvent.Checksum == "" {
+			return next(data)
+		}
+
+		checksum, err := fileutil.SHA256File(requestEvent.FilePath)
+		if err != nil {
+			return err
+		}
+		if checksum == requestEvent.Checksum {
+			return next(data)
+		}
+
+		// file changed while the request was queued - re-detect it so it goes through the normal flow again
+		log.Printf("File changed since stale analysis request was queued, re-detecting: %s", redact.Path(requestEvent.FilePath))
+		fileEvent := events.FileDetectedEvent{
+			FilePath:  requestEvent.FilePath,
+			FileType:  requestEvent.FileType,
+			Size:      fileInfo.Size(),
+			Checksum:  checksum,
+			Requester: requestEvent.Requester,
+			Timestamp: time.Now(),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		routingKey := events.RoutingKey("file.detected", requestEvent.FileType)
+		return rabbitMQ.PublishEvent(ctx, "biomarker.file.events", routingKey, fileEvent)
+	}
+}
+
 // subscribes to the analysis requested events + executes them via cmd line (in analyzer/descriptive_analyzer.go)
-func handleAnalysisRequestedEvent(rabbitMQ *messaging.RabbitMQClient) EventHandler {
+// analysisCtx is only cancelled once a graceful shutdown gives up waiting, killing the running R processes
+// the analyzer, database and storage are captured by the returned handler
+// transient failures are retried in place per the retry policy, failed is only published once they run out
+func handleAnalysisRequestedEvent(analysisCtx context.Context, rabbitMQ messaging.MessageBus, analyzerService analyzer.Analyzer, db database.Repository, storageService storage.Storer, storageType string, presignExpiry time.Duration, orderedLatest bool, fetcher *source.Fetcher, retry analyzer.RetryPolicy) EventHandler {
 	return func(data []byte) error {
 		var requestEvent events.AnalysisRequestedEvent
 		if err := json.Unmarshal(data, &requestEvent); err != nil {
 			log.Printf("Failed to unmarshal analysis requested event: %v", err)
 			return err
 		}
+		// requests from producers that predate analysis types
+		if requestEvent.AnalysisType == "" {
+			requestEvent.AnalysisType = analyzer.DefaultAnalysisType
+		}
 		// Analysis handler logic
-		log.Printf("Processing analysis request for file: %s", requestEvent.FilePath)
+		log.Printf("Processing analysis request for file: %s", redact.Path(requestEvent.FilePath))
 
-		result, err := analyzerService.ExecuteAnalysis(requestEvent.FilePath)
+		// a failed insert is returned so the request is redelivered rather than run untracked
+		dbCtx, dbCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		analysisUUID, analysisID, err := startAnalysisRecord(dbCtx, db, requestEvent)
+		dbCancel()
 		if err != nil {
-			log.Printf("Analysis Failed: %v", err)
-			// update analysis status if failed and close the queue ticket
+			log.Printf("Failed to record analysis start for %s: %v", redact.Path(requestEvent.FilePath), err)
+			return err
+		}
+
+		// marks the analysis failed and announces it, err is what's reported
+		// the request is acked once that's done, rerunning the same file would only fail the same way
+		fail := func(err error) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if dbErr := db.UpdateAnalysisStatus(ctx, analysisUUID, database.AnalysisStatusFailed, err.Error()); dbErr != nil {
+				log.Printf("Failed to mark analysis %s failed: %v", analysisUUID, dbErr)
+			}
+
 			completedEvent := events.AnalysisCompletedEvent{
 				FilePath: requestEvent.FilePath,
 				ResultKey: "",
-				AnalysisType: requestEvent.FilePath,
+				AnalysisType: requestEvent.AnalysisType,
 				ProcessingTime: time.Since(requestEvent.Timestamp),
 				Timestamp: time.Now(),
 				Status: "failed",
 				ErrorMessage: err.Error(),
 			}
 
+			routingKey := events.RoutingKey("analysis.completed", requestEvent.FileType)
+			if pubErr := rabbitMQ.PublishEvent(ctx, "biomarker.result.events", routingKey, completedEvent); pubErr != nil {
+				return pubErr
+			}
+			return messaging.Handled(err)
+		}
+		// inputs the source rejected or that are too big fail the analysis and are parked in analysis.requested.dlq
+		// for a look, anything else may work on redelivery: this attempt's record is closed off without announcing
+		// anything, failed is left to the retry queue running out (parked in the DLQ too)
+		failFetch := func(err error) error {
+			if source.IsPermanent(err) {
+				if failErr := fail(err); !messaging.IsHandled(failErr) {
+					return failErr
+				}
+				return messaging.Permanent(err)
+			}
+
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
+			if dbErr := db.UpdateAnalysisStatus(ctx, analysisUUID, database.AnalysisStatusFailed, "input fetch failed, request redelivered: "+err.Error()); dbErr != nil {
+				log.Printf("Failed to mark analysis %s failed: %v", analysisUUID, dbErr)
+			}
+			return err
+		}
+
+		inputPath := requestEvent.FilePath
+		streamInput := requestEvent.SourceURL != "" && analyzerService.SupportsStdin(requestEvent.AnalysisType)
+		if requestEvent.SourceURL != "" && !streamInput {
+			fetchCtx, cancel := context.WithTimeout(analysisCtx, 10*time.Minute)
+			localPath, cleanup, err := fetcher.Fetch(fetchCtx, requestEvent.SourceURL, requestEvent.FileType)
+			cancel()
+			defer cleanup()
+			if err != nil {
+				log.Printf("Failed to download analysis input: %v", err)
+				return failFetch(err)
+			}
+			inputPath = localPath
+		}
+
+		var result *analyzer.DescriptiveAnalysisMetadata
+		started := false
+		for attempt := 1; ; attempt++ {
+			var input io.Reader
+			var body io.ReadCloser
+			if streamInput {
+				// straight from the download into R, no temp copy - reopened per attempt, a stream can only be read once
+				body, err = fetcher.Open(analysisCtx, requestEvent.SourceURL)
+				if err != nil {
+					log.Printf("Failed to open analysis input: %v", err)
+					return failFetch(err)
+				}
+				input = body
+			}
+
+			result, err = analyzerService.ExecuteAnalysis(analysisCtx, inputPath, requestEvent.AnalysisType, analyzer.AnalysisOptions{
+				// hooks and the storage key see the same id as the database and the API
+				AnalysisID:   analysisUUID,
+				Params:       requestEvent.Params,
+				OutputFormat: requestEvent.OutputFormat,
+				Input:        input,
+				OnStart: func() {
+					// running and announced once, retries stay running
+					if !started {
+						started = true
+						markAnalysisStarted(rabbitMQ, db, analysisUUID, requestEvent)
+					}
+				},
+			})
+			if body != nil {
+				body.Close()
+			}
+			recordAttempts(db, analysisUUID, attempt)
+
+			if err == nil || !retry.ShouldRetry(attempt, err) {
+				break
+			}
+			// only the last attempt's logs are kept
+			analyzerService.CleanupOutput(result)
+			delay := retry.Delay(attempt)
+			log.Printf("Analysis %s failed with a transient error (attempt %d of %d), retrying in %s: %v", analysisUUID, attempt, retry.MaxAttempts, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-analysisCtx.Done():
+				// shutting down, the next attempt fails straight away and is reported as such
+			}
+		}
+		if err != nil {
+			log.Printf("Analysis Failed: %v", err)
+			if result != nil && len(result.LogFiles) > 0 {
+				defer analyzerService.CleanupOutput(result)
+				recordFailedRunLogs(db, analysisUUID, analysisID, storageType, storeRunLogs(storageService, requestEvent.FilePath, result))
+			}
+			// update analysis status if failed and close the queue ticket
+			return fail(err)
+		}
+		// the report is only needed locally until it's uploaded
+		defer analyzerService.CleanupOutput(result)
 
-			routingKey := "analysis.completed" + requestEvent.FileType
-			return rabbitMQ.PublishEvent(ctx, "biomarker.result.events", routingKey, completedEvent)
+		stored, err := storageService.StoreResultWithInfo(&storage.ResultData{
+			FilePath:    requestEvent.FilePath,
+			AnalysisID:  result.AnalysisID,
+			ContentType: result.ContentType,
+			OutputPath:  result.OutputPath,
+			Metadata:    result.Metadata,
+		})
+		if err != nil {
+			log.Printf("Failed to store result of analysis %s: %v", analysisUUID, err)
+			return fail(err)
+		}
+		logs := storeRunLogs(storageService, requestEvent.FilePath, result)
+
+		// post-analysis hooks configured for the after_upload stage get the stored key, before the analysis is
+		// completed so a failing hook fails it instead of the request being redelivered and R run again
+		if err := analyzerService.AfterUpload(analysisCtx, result, stored.Key); err != nil {
+			log.Printf("Post-analysis hook failed for analysis %s: %v", analysisUUID, err)
+			// the report of a failed analysis isn't kept, its logs are like any other failed run's
+			deleteStoredResults(storageService, stored.Key)
+			recordFailedRunLogs(db, analysisUUID, analysisID, storageType, logs)
+			return fail(err)
 		}
+
 		// if successful, store result to postgres DB
-		// TODO: implement postgres with GO
+		dbCtx, dbCancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer dbCancel()
+		resultID, err := recordCompletedAnalysis(dbCtx, db, analysisUUID, analysisID, result, storageType, stored, logs)
+		if err != nil {
+			log.Printf("Failed to record analysis %s: %v", analysisUUID, err)
+			// nothing references the uploads now, and a redelivery would run R again only to upload them twice
+			keys := []string{stored.Key}
+			for _, runLog := range logs {
+				keys = append(keys, runLog.stored.Key)
+			}
+			deleteStoredResults(storageService, keys...)
+			return fail(err)
+		}
+		// an older analysis finishing late doesn't replace a newer latest result unless ordering is off
+		if _, err := db.UpdateLatestResult(dbCtx, analysisUUID, resultID, orderedLatest); err != nil {
+			log.Printf("Failed to update latest result for %s: %v", redact.Path(requestEvent.FilePath), err)
+		}
 
 		// create & publish completed analysis to rabbitMQ
 		completedEvent := events.AnalysisCompletedEvent{
 			FilePath:       requestEvent.FilePath,
-			ResultKey:      s3Key,
-			AnalysisType:   requestEvent.FileType,
+			ResultKey:      stored.Key,
+			AnalysisType:   requestEvent.AnalysisType,
 			ProcessingTime: result.Duration,
 			Timestamp:      time.Now(),
-			Status:         "success",
+			Status:         result.Status, // success, or success_with_warnings when output validation only warns
+			PresignedURL:   presignedURL(storageService, stored.Key, presignExpiry),
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		routingKey := "analysis.completed" + requestEvent.FileType
+		routingKey := events.RoutingKey("analysis.completed", requestEvent.FileType)
 		return rabbitMQ.PublishEvent(ctx, "biomarker.result.events", routingKey, completedEvent)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+// a detected file through to its completed analysis, with the handlers wired and subscribed the way main does it
+func TestPipelineSmoke(t *testing.T) {
+	bus := memory.New()
+	defer bus.Close()
+	bus.Bind("file.detected", "biomarker.file.events", "file.detected.*")
+	bus.Bind("analysis.requested", "biomarker.analysis.events", "analysis.requested.*")
+
+	repo := newFakeRepo()
+	analyzerService := &fakeAnalyzer{}
+	storer := newFakeStorer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fanOut := analyzer.NewFanOut([]string{analyzer.DefaultAnalysisType}, nil)
+	if err := subscribeToQueue(ctx, bus, "file.detected", handleFileDetectedEvent(bus, fanOut)); err != nil {
+		t.Fatal(err)
+	}
+	analysisHandler := handleAnalysisRequestedEvent(ctx, bus, analyzerService, repo, storer, storage.StorageTypeS3, time.Hour, true, nil, analyzer.RetryPolicy{})
+	if err := subscribeToQueue(ctx, bus, "analysis.requested", analysisHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	detected := events.FileDetectedEvent{
+		FilePath:  "/data/study/a.csv",
+		FileType:  ".csv",
+		Size:      12,
+		Requester: "file-watcher",
+		Timestamp: time.Now(),
+	}
+	if err := bus.PublishEvent(ctx, "biomarker.file.events", events.RoutingKey("file.detected", detected.FileType), detected); err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	if err := bus.Wait(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, queue := range []string{"file.detected", "analysis.requested"} {
+		if letters := bus.DeadLetters(queue); len(letters) != 0 {
+			t.Errorf("%d messages dead-lettered from %s", len(letters), queue)
+		}
+	}
+	if status := completedStatus(t, bus); status != "success" {
+		t.Errorf("published completed status %q, want success", status)
+	}
+	if _, analysis := repo.analysis(); analysis == nil || analysis.status != database.AnalysisStatusCompleted {
+		t.Errorf("analysis = %+v, want it completed", analysis)
+	}
+	if keys := storer.keys(); len(keys) != 1 {
+		t.Errorf("stored %v, want the one report", keys)
+	}
+}
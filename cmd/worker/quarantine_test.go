@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/pkg/messaging"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+func TestQuarantineLoopingFiles(t *testing.T) {
+	bus := memory.New()
+	defer bus.Close()
+	loops := analyzer.NewLoopDetector(2, time.Hour, time.Hour)
+
+	analyzed := 0
+	handler := quarantineLoopingFiles(bus, loops, 2, time.Hour, time.Hour, func([]byte) error {
+		analyzed++
+		return nil
+	})
+	request := func(filePath string) messaging.Decision {
+		t.Helper()
+		body, err := json.Marshal(events.AnalysisRequestedEvent{FilePath: filePath, FileType: "csv"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision, _ := messaging.Decide(handler)(body)
+		return decision
+	}
+
+	looping := "/data/out/report.csv"
+	want := []messaging.Decision{messaging.Ack, messaging.Ack, messaging.Reject, messaging.Reject}
+	for i, wantDecision := range want {
+		if got := request(looping); got != wantDecision {
+			t.Fatalf("request %d = %s, want %s", i+1, got, wantDecision)
+		}
+	}
+	if got := request("/data/study1/labs.csv"); got != messaging.Ack {
+		t.Errorf("unrelated file = %s, want it analyzed", got)
+	}
+	if analyzed != 3 {
+		t.Errorf("analyzed %d times, want 3", analyzed)
+	}
+
+	// one alert for the loop, not one per refused request
+	var alerts []events.FileQuarantinedEvent
+	for _, msg := range bus.Published() {
+		if msg.RoutingKey != "file.quarantined.csv" {
+			continue
+		}
+		var alert events.FileQuarantinedEvent
+		if err := json.Unmarshal(msg.Body, &alert); err != nil {
+			t.Fatal(err)
+		}
+		alerts = append(alerts, alert)
+	}
+	if len(alerts) != 1 || alerts[0].FilePath != looping || alerts[0].Requests != 2 {
+		t.Fatalf("alerts = %+v, want one for %s", alerts, looping)
+	}
+	if until := alerts[0].Until.Sub(alerts[0].Timestamp); until != time.Hour {
+		t.Errorf("quarantined for %s, want 1h", until)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestWorkerQueues(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured []string
+		want       []string
+		wantErr    bool
+	}{
+		{"analysis only", []string{"analysis.requested"}, []string{"analysis.requested"}, false},
+		{"file events only", []string{"file.detected", "file.changed", "file.removed"}, []string{"file.changed", "file.detected", "file.removed"}, false},
+		{"all", knownQueues, []string{"analysis.requested", "file.changed", "file.detected", "file.removed"}, false},
+		{"whitespace and duplicates", []string{" file.detected ", "", "file.detected"}, []string{"file.detected"}, false},
+		{"unknown queue", []string{"analysis.requested", "analysis.completed"}, nil, true},
+		{"typo", []string{"file.detect"}, nil, true},
+		{"none", nil, nil, true},
+		{"only blanks", []string{" ", ""}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queues, err := workerQueues(tt.configured)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("workerQueues(%q) error = %v, want error %v", tt.configured, err, tt.wantErr)
+			}
+			if got := slices.Sorted(maps.Keys(queues)); !slices.Equal(got, tt.want) {
+				t.Errorf("workerQueues(%q) = %v, want %v", tt.configured, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/pkg/fileutil"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+func TestRevalidateStaleRequests(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(path, []byte("id,value\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := fileutil.SHA256File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		checksum     string
+		queuedAgo    time.Duration
+		wantNext     bool
+		wantRedetect bool
+	}{
+		{"fresh request runs", path, "stale-checksum", time.Minute, true, false},
+		{"stale request for unchanged file runs", path, checksum, 2 * time.Hour, true, false},
+		{"stale request without checksum runs", path, "", 2 * time.Hour, true, false},
+		{"stale request for changed file is re-detected", path, "old-checksum", 2 * time.Hour, false, true},
+		{"stale request for missing file is dropped", filepath.Join(dir, "gone.csv"), checksum, 2 * time.Hour, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := memory.New()
+			defer bus.Close()
+
+			ranNext := false
+			handler := revalidateStaleRequests(bus, time.Hour, func([]byte) error {
+				ranNext = true
+				return nil
+			})
+
+			body, _ := json.Marshal(events.AnalysisRequestedEvent{
+				FilePath:     tt.path,
+				FileType:     "csv",
+				AnalysisType: "descriptive",
+				Checksum:     tt.checksum,
+				Timestamp:    time.Now().Add(-tt.queuedAgo),
+			})
+			if err := handler(body); err != nil {
+				t.Fatalf("handler returned %v", err)
+			}
+
+			if ranNext != tt.wantNext {
+				t.Errorf("ran analysis = %v, want %v", ranNext, tt.wantNext)
+			}
+			published := bus.Published()
+			if redetected := len(published) == 1 && published[0].RoutingKey == "file.detected.csv"; redetected != tt.wantRedetect || len(published) > 1 {
+				t.Errorf("published %v, want re-detection = %v", published, tt.wantRedetect)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clears every BIOMARKER_* variable for the test, including the ones applyFile exports, restoring them afterwards
+func isolateEnv(t *testing.T, extra ...string) {
+	t.Helper()
+	names := extra
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "BIOMARKER_") {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+rabbitmq:
+  uri: amqp://file-host:5672/
+s3:
+  bucket: from-file
+filewatcher:
+  directories: [/data/one, /data/two]
+analysis:
+  timeout: 120
+  scripts: {qc: qc_report.R|.html}
+`,
+		"config.json": `{
+  "rabbitmq": {"uri": "amqp://file-host:5672/"},
+  "s3": {"bucket": "from-file"},
+  "filewatcher": {"directories": ["/data/one", "/data/two"]},
+  "analysis": {"timeout": 120, "scripts": {"qc": "qc_report.R|.html"}}
+}`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			isolateEnv(t, "BIOMARKER_RABBITMQ_URI", "BIOMARKER_FILEWATCHER_DIRECTORIES", "BIOMARKER_ANALYSIS_SCRIPTS")
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv(configFileEnv, path)
+			t.Setenv("BIOMARKER_S3_BUCKET", "from-env")
+			t.Setenv("BIOMARKER_ANALYSIS_TIMEOUT", "600")
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			// set in both, env wins
+			if cfg.S3.Bucket != "from-env" {
+				t.Errorf("S3 bucket = %q, want the env var's from-env", cfg.S3.Bucket)
+			}
+			if cfg.Analysis.Timeout != 600 {
+				t.Errorf("analysis timeout = %d, want the env var's 600", cfg.Analysis.Timeout)
+			}
+			// only in the file
+			if cfg.RabbitMQ.URI != "amqp://file-host:5672/" {
+				t.Errorf("RabbitMQ URI = %q, want the file's", cfg.RabbitMQ.URI)
+			}
+			if strings.Join(cfg.FileWatcher.Directories, ",") != "/data/one,/data/two" {
+				t.Errorf("directories = %v, want the file's", cfg.FileWatcher.Directories)
+			}
+			if cfg.Analysis.Scripts["qc"] != "qc_report.R|.html" {
+				t.Errorf("scripts = %v, want the file's", cfg.Analysis.Scripts)
+			}
+			// in neither, the default
+			if cfg.LogLevel != "info" {
+				t.Errorf("log level = %q, want the default", cfg.LogLevel)
+			}
+		})
+	}
+}
+
+func TestLoadWithoutFileUsesEnvOnly(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("BIOMARKER_S3_BUCKET", "from-env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.S3.Bucket != "from-env" || cfg.Analysis.Timeout != 300 {
+		t.Errorf("bucket %q and timeout %d, want from-env and the default 300", cfg.S3.Bucket, cfg.Analysis.Timeout)
+	}
+}
+
+func TestLoadRejectsUnknownFileSettings(t *testing.T) {
+	isolateEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("s3:\n  bukket: typo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configFileEnv, path)
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "s3_bukket") {
+		t.Errorf("Load = %v, want an unknown setting error naming s3_bukket", err)
+	}
+}
@@ -0,0 +1,74 @@
+// internal/config/validate.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"watchrabbit/internal/services/logging"
+)
+
+// Validate checks the settings every service relies on and reports all problems at once,
+// so a misconfigured deployment fails at startup instead of deep in the pipeline
+func (c *Config) Validate() error {
+	var problems []error
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if u, err := url.Parse(c.RabbitMQ.URI); err != nil {
+		add("RABBITMQ_URI is not a valid URI: %v", err)
+	} else if u.Scheme != "amqp" && u.Scheme != "amqps" {
+		add("RABBITMQ_URI must be an amqp:// or amqps:// URI, got %q", u.Scheme)
+	} else if u.Host == "" {
+		add("RABBITMQ_URI has no host")
+	}
+
+	if !hasNonEmpty(c.FileWatcher.Directories) {
+		add("FILEWATCHER_DIRECTORIES needs at least one directory")
+	}
+	if !hasNonEmpty(c.FileWatcher.SupportedExtensions) {
+		add("FILEWATCHER_SUPPORTED_EXTENSIONS needs at least one extension")
+	}
+
+	switch c.Storage.Backend {
+	case "s3", "":
+		if c.S3.Bucket == "" {
+			add("S3_BUCKET is required with the s3 storage backend")
+		}
+	case "local":
+		if c.Storage.LocalDir == "" {
+			add("STORAGE_LOCAL_DIR is required with the local storage backend")
+		}
+	default:
+		add("STORAGE_BACKEND must be s3 or local, got %q", c.Storage.Backend)
+	}
+
+	if c.Analysis.Timeout <= 0 {
+		add("ANALYSIS_TIMEOUT must be greater than 0, got %d", c.Analysis.Timeout)
+	}
+	if c.Analysis.MaxAttempts < 1 {
+		add("ANALYSIS_MAX_ATTEMPTS must be at least 1, got %d", c.Analysis.MaxAttempts)
+	}
+	if c.Analysis.Workers < 1 {
+		add("ANALYSIS_WORKERS must be at least 1, got %d", c.Analysis.Workers)
+	}
+
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		add("LOG_LEVEL: %v", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration (BIOMARKER_ prefix omitted):\n%w", errors.Join(problems...))
+	}
+	return nil
+}
+
+func hasNonEmpty(values []string) bool {
+	for _, value := range values {
+		if value != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -8,17 +8,82 @@ type FileDetectedEvent struct {
 	FilePath  string    `json:"filePath"`
 	FileType  string    `json:"fileType"`
 	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"` // sha256 of the file at detection time
+	Requester string    `json:"requester,omitempty"` // who triggered it, carried into the analysis requests
 	Timestamp time.Time `json:"timestamp"`
 }
 
-//TODO: FileChangedEvent struct {}
+// an already known file was modified in place, triggers a re-run of its analyses
+type FileChangedEvent struct {
+	FilePath  string    `json:"filePath"`
+	FileType  string    `json:"fileType"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Requester string    `json:"requester,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
 
-type AnalysisRequestedEvent struct {
+// a watched file was deleted or renamed away
+type FileRemovedEvent struct {
 	FilePath  string    `json:"filePath"`
 	FileType  string    `json:"fileType"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// alert: the worker stopped analyzing a file that was requested too often, usually a script writing into a watched dir
+type FileQuarantinedEvent struct {
+	FilePath  string        `json:"filePath"`
+	FileType  string        `json:"fileType"`
+	Requests  int           `json:"requests"` // limit that was exceeded within Window
+	Window    time.Duration `json:"window"`
+	Until     time.Time     `json:"until"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+type AnalysisRequestedEvent struct {
+	FilePath     string    `json:"filePath"`
+	FileType     string    `json:"fileType"`
+	AnalysisType string    `json:"analysisType"` // one file can fan out into several analysis types
+	Checksum     string    `json:"checksum,omitempty"` // carried over from FileDetectedEvent
+	// passed to the R script as --key=value flags, e.g. treatment_arm, reference_range, title
+	Params       map[string]string `json:"params,omitempty"`
+	// http(s):// or s3:// location to download the input from instead of reading FilePath locally
+	// FilePath is still used to identify the file in records and events
+	SourceURL    string    `json:"sourceUrl,omitempty"`
+	OutputFormat string    `json:"outputFormat,omitempty"` // html (default) or pdf
+	// re-run even if a completed result for identical input (same checksum) already exists
+	Force        bool      `json:"force,omitempty"`
+	// user or service that triggered the analysis, recorded as the analysis's created_by
+	Requester    string    `json:"requester,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// identifies one analysis of one version of a file, includes the type so fanned-out requests don't collide
+func (e AnalysisRequestedEvent) IdempotencyKey() string {
+	content := e.Checksum
+	if content == "" {
+		content = e.FilePath
+	}
+	return content + ":" + e.AnalysisType
+}
+
+// a request that sat in the queue longer than maxWait may point at a file that has since changed
+func (e AnalysisRequestedEvent) IsStale(maxWait time.Duration, now time.Time) bool {
+	if maxWait <= 0 {
+		return false
+	}
+	return now.Sub(e.Timestamp) > maxWait
+}
+
+// published by the worker right before R is invoked, tells a running analysis apart from a queued one
+type AnalysisStartedEvent struct {
+	AnalysisUUID string    `json:"analysisUuid"`
+	FilePath     string    `json:"filePath"`
+	AnalysisType string    `json:"analysisType"`
+	StartedAt    time.Time `json:"startedAt"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
 type AnalysisCompletedEvent struct {
 	FilePath       string        `json:"filePath"`
 	ResultKey      string        `json:"resultKey"`      // S3 key where the result is stored
@@ -27,4 +92,15 @@ type AnalysisCompletedEvent struct {
 	Timestamp      time.Time     `json:"timestamp"`
 	Status         string        `json:"status"`         // "success", "failed", "timeout"
 	ErrorMessage   string        `json:"errorMessage,omitempty"` // Error message if analysis failed
-}
\ No newline at end of file
+	// time-limited download link for the result, only set when the worker is configured to presign
+	PresignedURL   string        `json:"presignedUrl,omitempty"`
+}
+// published periodically by every service instance, consumers detect dead instances by missing heartbeats
+type HeartbeatEvent struct {
+	Service    string        `json:"service"` // "worker", "file-watcher"
+	InstanceID string        `json:"instanceId"`
+	Uptime     time.Duration `json:"uptime"`
+	InFlight   int           `json:"inFlight"` // messages being handled / files waiting to settle
+	Interval   time.Duration `json:"interval"` // expected time until the next heartbeat
+	Timestamp  time.Time     `json:"timestamp"`
+}
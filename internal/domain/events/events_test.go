@@ -0,0 +1,32 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalysisRequestedEventIsStale(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		queuedAt time.Time
+		maxWait  time.Duration
+		want     bool
+	}{
+		{"fresh request", now.Add(-time.Minute), time.Hour, false},
+		{"exactly at the limit", now.Add(-time.Hour), time.Hour, false},
+		{"past the limit", now.Add(-time.Hour - time.Second), time.Hour, true},
+		{"check disabled", now.Add(-48 * time.Hour), 0, false},
+		{"negative limit disables the check", now.Add(-48 * time.Hour), -time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := AnalysisRequestedEvent{FilePath: "/data/a.csv", Timestamp: tt.queuedAt}
+			if got := event.IsStale(tt.maxWait, now); got != tt.want {
+				t.Errorf("IsStale(%s) = %v, want %v", tt.maxWait, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+// internal/domain/events/routing.go
+package events
+
+import "strings"
+
+// RoutingKey builds the topic routing key for an event about a file of fileType, e.g.
+// ("file.detected", ".csv") -> file.detected.csv, so it's always exactly one word after the prefix and matches
+// the prefix.* bindings. the extension is lowercased with its leading dot dropped, inner dots become
+// underscores (.tar.gz -> tar_gz) and an empty one is "unknown"
+func RoutingKey(prefix, fileType string) string {
+	word := strings.ToLower(strings.TrimLeft(strings.TrimSpace(fileType), "."))
+	// topic routing treats dots as word separators and * / # as wildcards
+	word = strings.NewReplacer(".", "_", "*", "_", "#", "_").Replace(word)
+	if word == "" {
+		word = "unknown"
+	}
+	return prefix + "." + word
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoutingKey(t *testing.T) {
+	tests := []struct {
+		fileType string
+		want     string
+	}{
+		{".csv", "file.detected.csv"},
+		{".sas7bdat", "file.detected.sas7bdat"},
+		{"", "file.detected.unknown"},
+		{".tar.gz", "file.detected.tar_gz"},
+		{".CSV", "file.detected.csv"},
+		{"csv", "file.detected.csv"},
+		{" .xlsx ", "file.detected.xlsx"},
+		{".", "file.detected.unknown"},
+		{"*", "file.detected._"},
+		{".#", "file.detected._"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileType, func(t *testing.T) {
+			got := RoutingKey("file.detected", tt.fileType)
+			if got != tt.want {
+				t.Errorf("RoutingKey(%q) = %q, want %q", tt.fileType, got, tt.want)
+			}
+			// exactly one word after the prefix, or the file.detected.* binding wouldn't match it
+			if words := strings.Split(got, "."); len(words) != 3 || words[2] == "" {
+				t.Errorf("RoutingKey(%q) = %q isn't one word after the prefix", tt.fileType, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// internal/domain/ids/ids.go
+package ids
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+// analysis identifier schemes
+const (
+	SchemeUUID = "uuid" // random v4, the default
+	SchemeULID = "ulid" // time-sortable, ordered by creation time
+)
+
+// Generator returns a new identifier, always in the 36 character UUID text form
+// so it fits the existing uuid columns whichever scheme is used
+type Generator func() string
+
+func NewGenerator(scheme string) (Generator, error) {
+	switch scheme {
+	case SchemeUUID, "":
+		return func() string { return uuid.New().String() }, nil
+	case SchemeULID:
+		// a ULID is 128 bits like a UUID, written in UUID form it still sorts by time
+		// (the 48 bit timestamp comes first), ulid.Make is monotonic within the process
+		return func() string { return uuid.UUID(ulid.Make()).String() }, nil
+	default:
+		return nil, fmt.Errorf("unknown identifier scheme %q (expected uuid or ulid)", scheme)
+	}
+}
@@ -0,0 +1,76 @@
+package ids
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+var uuidForm = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func TestNewGenerator(t *testing.T) {
+	for _, scheme := range []string{"", SchemeUUID, SchemeULID} {
+		t.Run(scheme, func(t *testing.T) {
+			generate, err := NewGenerator(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				id := generate()
+				if !uuidForm.MatchString(id) {
+					t.Fatalf("%q isn't in 36 character uuid form", id)
+				}
+				if seen[id] {
+					t.Fatalf("%q generated twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+
+	if _, err := NewGenerator("snowflake"); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
+
+func TestUUIDSchemeIsVersion4(t *testing.T) {
+	generate, _ := NewGenerator(SchemeUUID)
+	parsed, err := uuid.Parse(generate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Version() != 4 || parsed.Variant() != uuid.RFC4122 {
+		t.Errorf("version %d variant %v, want a v4 RFC 4122 uuid", parsed.Version(), parsed.Variant())
+	}
+}
+
+func TestULIDSchemeSortsByCreation(t *testing.T) {
+	generate, _ := NewGenerator(SchemeULID)
+
+	before := time.Now().Truncate(time.Millisecond)
+	var generated []string
+	for i := 0; i < 50; i++ {
+		generated = append(generated, generate())
+	}
+	after := time.Now()
+
+	if !sort.StringsAreSorted(generated) {
+		t.Errorf("ulids don't sort in creation order: %v", generated)
+	}
+
+	// the uuid text is the ulid's bytes, so the timestamp survives the conversion
+	parsed, err := uuid.Parse(generated[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := ulid.Time(ulid.ULID(parsed).Time())
+	if created.Before(before) || created.After(after) {
+		t.Errorf("ulid timestamp %v, want between %v and %v", created, before, after)
+	}
+}
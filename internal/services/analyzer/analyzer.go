@@ -0,0 +1,16 @@
+// internal/services/analyzer/analyzer.go
+package analyzer
+
+import (
+	"context"
+)
+
+// Analyzer is the part of DescriptiveService the worker's handlers use, so they can run against a fake
+type Analyzer interface {
+	ExecuteAnalysis(ctx context.Context, filePath, analysisType string, opts AnalysisOptions) (*DescriptiveAnalysisMetadata, error)
+	SupportsStdin(analysisType string) bool
+	CleanupOutput(result *DescriptiveAnalysisMetadata)
+	AfterUpload(ctx context.Context, result *DescriptiveAnalysisMetadata, resultKey string) error
+}
+
+var _ Analyzer = (*DescriptiveService)(nil)
@@ -1,17 +1,21 @@
 package analyzer
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
-
-	"github.com/google/uuid"
+	"watchrabbit/internal/domain/ids"
+	"watchrabbit/internal/services/metrics"
+	"watchrabbit/internal/services/redact"
 )
 
 type DescriptiveAnalysisMetadata struct {
@@ -19,27 +23,88 @@ type DescriptiveAnalysisMetadata struct {
 	FilePath      string            `json:"filePath"`
 	Status        string            `json:"status"` // "success", "failed", "timeout"
 	OutputPath    string            `json:"outputPath"`
+	ContentType   string            `json:"contentType,omitempty"` // MIME type of OutputPath
 	StartTime     time.Time         `json:"startTime"`
 	EndTime       time.Time         `json:"endTime"`
 	Duration      time.Duration     `json:"duration"`
 	ErrorMessage  string            `json:"errorMessage,omitempty"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+	// stream ("stdout", "stderr") -> full log written next to OutputPath, LogTails only keeps the end of it
+	LogFiles      map[string]string `json:"logFiles,omitempty"`
+	// e.g. rOutput -> the last lines of stdout on one line, recorded with the result but not with the stored
+	// object, whose metadata goes out as x-amz-meta headers
+	LogTails      map[string]string `json:"logTails,omitempty"`
+}
+
+// DescriptiveConfig picks the R backend, exec (default) or rserve, python scripts always run as a fresh process
+type DescriptiveConfig struct {
+	RExecutable string // exec backend only, empty to auto-detect
+	PythonExecutable string // empty to auto-detect, only looked up when a .py script is registered
+	ScriptsDir  string
+	Timeout     int // seconds
+	// seconds per analysis type or input extension (".sas7bdat"), overriding Timeout, see timeoutFor
+	Timeouts    map[string]int
+	Backend     string // "exec" or "rserve"
+	RserveAddr  string // host:port, rserve backend only
+	Scripts     map[string]string // extra analysis types, type -> "script.R|.ext"
+	MaxConcurrency int // R processes allowed at once, 0 for one per CPU
+	OutputDir      string // where reports are written, empty for the system temp dir
+	RetainOutput   bool   // keep reports on disk after upload
+	IDScheme       string // analysis ids, "uuid" (default) or "ulid"
+	BaseDir        string // relative ScriptsDir/OutputDir are resolved against this, empty for the executable's directory
+	PreHook        []string // command run before R, gets the input path and analysis id (empty for none)
+	PostHook       []string // command run on a successful report, gets the report path and analysis id (empty for none)
+	PostHookStage  string   // "before_upload" (default) or "after_upload"
+	PostHookOnFail string   // "fail" (default) fails the analysis, "warn" only logs
+	HookTimeout    int      // seconds, per hook run
+	OutputValidation OutputValidation // checks on rendered html reports
+	Logger         *slog.Logger // nil for slog.Default()
+	// input extensions the default analysis type accepts, empty for DefaultFileTypes
+	// the worker passes the watcher's supported extensions so the list lives in one place
+	FileTypes      []string
 }
 
-// TODO: analysis connection to R backend using roger/Rserve
-// FOR NOW, we will use os/exec for PoC
 type DescriptiveService struct {
 	// Path to R executable
 	RExecutable string
+	// Path to python, empty when no python script is registered
+	PythonExecutable string
 	// Directory containing R scripts
 	ScriptsDir string
 	// Timeout for R script execution in seconds
 	Timeout int
+	// per analysis type / input extension overrides of Timeout
+	timeouts map[string]time.Duration
+	// reports go to <OutputDir>/<date>/
+	OutputDir string
+	// false removes reports once uploaded (see CleanupOutput) and after failures
+	RetainOutput bool
+	// interpreter -> what runs its scripts, R is either a fresh Rscript per file or a persistent Rserve session
+	runners map[string]AnalysisRunner
+	// analysis type -> script
+	scripts ScriptRegistry
+	// analysis ids, per the configured scheme
+	newID ids.Generator
+	// optional command run before R, a failure fails the analysis
+	preHook *Hook
+	// optional command run on the finished report, see PostHookStage/PostHookOnFail
+	postHook          *Hook
+	postHookAfterUpload bool
+	postHookWarnOnly  bool
+	// checks on html reports before they count as a success
+	validation OutputValidation
+	// semaphore bounding concurrent R runs, a backlog would otherwise start one process per message and OOM the box
+	slots chan struct{}
+	logger *slog.Logger
 }
 
-func NewDescriptiveService(rExecutable, scriptsDir string, timeoutSeconds int) (*DescriptiveService, error) {
-	// attempt to find R executable if not in PATH:
-	if rExecutable == "" {
+func NewDescriptiveService(cfg DescriptiveConfig) (*DescriptiveService, error) {
+	rExecutable := cfg.RExecutable
+	scriptsDir := cfg.ScriptsDir
+	timeoutSeconds := cfg.Timeout
+
+	// attempt to find R executable if not in PATH (Rserve has its own R)
+	if rExecutable == "" && (cfg.Backend == "" || cfg.Backend == "exec") {
 		// Try to find Rscript in PATH
 		rPath, err := exec.LookPath("Rscript")
 		if err == nil {
@@ -77,7 +142,11 @@ func NewDescriptiveService(rExecutable, scriptsDir string, timeoutSeconds int) (
 	}
 
 	// Verify scripts directory exists
-	if _, err := os.Stat(scriptsDir); err != nil {
+	scriptsDir, err := resolveDir(cfg.BaseDir, scriptsDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDir(scriptsDir); err != nil {
 		return nil, fmt.Errorf("scripts directory not found: %v", err)
 	}
 
@@ -86,103 +155,441 @@ func NewDescriptiveService(rExecutable, scriptsDir string, timeoutSeconds int) (
 		timeoutSeconds = 300 // 5 minutes default
 	}
 
-	log.Printf("Analysis service initialized with R executable: %s", rExecutable)
-	log.Printf("Using R scripts from: %s", scriptsDir)
+	scripts, err := NewScriptRegistry(cfg.Scripts)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.FileTypes) > 0 {
+		spec := scripts[DefaultAnalysisType]
+		spec.FileTypes = normalizeExtensions(cfg.FileTypes)
+		scripts[DefaultAnalysisType] = spec
+	}
+
+	timeouts, err := newTimeoutOverrides(cfg.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	newID, err := ids.NewGenerator(cfg.IDScheme)
+	if err != nil {
+		return nil, err
+	}
+
+	preHook, err := newHook("pre-analysis", cfg.PreHook, cfg.HookTimeout)
+	if err != nil {
+		return nil, err
+	}
+	postHook, err := newHook("post-analysis", cfg.PostHook, cfg.HookTimeout)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.PostHookStage {
+	case "", "before_upload", "after_upload":
+	default:
+		return nil, fmt.Errorf("invalid post-analysis hook stage %q (expected before_upload or after_upload)", cfg.PostHookStage)
+	}
+	switch cfg.PostHookOnFail {
+	case "", "fail", "warn":
+	default:
+		return nil, fmt.Errorf("invalid post-analysis hook failure mode %q (expected fail or warn)", cfg.PostHookOnFail)
+	}
+
+	outputDir := cfg.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(os.TempDir(), "biomarker-analysis")
+	}
+	outputDir, err = resolveDir(cfg.BaseDir, outputDir)
+	if err != nil {
+		return nil, err
+	}
+	// create it now so a bad path fails at startup instead of on every analysis
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("output directory not usable: %v", err)
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	maxConcurrency := cfg.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = runtime.NumCPU()
+	}
+
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	runners := make(map[string]AnalysisRunner, 2)
+	switch cfg.Backend {
+	case "exec", "":
+		runners[InterpreterR] = NewRRunner(rExecutable, timeout, logger)
+		logger.Info("Analysis service initialized", slog.String("backend", "exec"), slog.String("r_executable", rExecutable))
+	case "rserve":
+		runners[InterpreterR] = NewRserveRunner(cfg.RserveAddr, timeout)
+		logger.Info("Analysis service initialized", slog.String("backend", "rserve"), slog.String("rserve_addr", cfg.RserveAddr))
+	default:
+		return nil, fmt.Errorf("unknown analysis backend %q (expected exec or rserve)", cfg.Backend)
+	}
+
+	// python is only required once something is registered to use it
+	pythonExecutable := cfg.PythonExecutable
+	if scripts.Uses(InterpreterPython) {
+		if pythonExecutable == "" {
+			pythonExecutable, err = findPython()
+			if err != nil {
+				return nil, err
+			}
+		}
+		runners[InterpreterPython] = NewPythonRunner(pythonExecutable, timeout, logger)
+		logger.Info("Python runner initialized", slog.String("python_executable", pythonExecutable))
+	}
+	logger.Info("Analysis settings",
+		slog.String("scripts_dir", scriptsDir),
+		slog.String("output_dir", outputDir),
+		slog.Int("max_concurrency", maxConcurrency))
 
 	return &DescriptiveService{
 		RExecutable: rExecutable,
+		PythonExecutable: pythonExecutable,
 		ScriptsDir:  scriptsDir,
 		Timeout:     timeoutSeconds,
+		timeouts:    timeouts,
+		OutputDir:   outputDir,
+		RetainOutput: cfg.RetainOutput,
+		runners:     runners,
+		scripts:     scripts,
+		slots:       make(chan struct{}, maxConcurrency),
+		newID:       newID,
+		preHook:     preHook,
+		postHook:    postHook,
+		postHookAfterUpload: cfg.PostHookStage == "after_upload",
+		postHookWarnOnly:    cfg.PostHookOnFail == "warn",
+		validation:          cfg.OutputValidation,
+		logger:              logger,
 	}, nil
 }
 
-// Delegates analysis to R (doesn't actually perform analysis)
-// TODO: generalize once we have 2-3 more R scripts, fine to do this for now
-func (s *DescriptiveService) ExecuteAnalysis(filePath string) (*DescriptiveAnalysisMetadata, error) {
-	//File & Script verification (in case files/folders are moved/missing)
-	analysisID := uuid.New().String()
+// python3 first, plain python is python 2 on older distros
+func findPython() (string, error) {
+	for _, name := range []string{"python3", "python"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("could not find python executable for the registered .py scripts, please specify path explicitly")
+}
 
-	outputDir := filepath.Join(os.TempDir(), "biomarker-analysis", time.Now().Format("20060102"))
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return createFailedResult(analysisID, filePath, fmt.Sprintf("Failed to create output directory: %v", err)), err
+// AnalysisOptions are the per-request knobs from AnalysisRequestedEvent
+type AnalysisOptions struct {
+	// the analysis record's UUID, names the output and is what the hooks and the storage key see,
+	// a fresh id is generated when empty
+	AnalysisID   string
+	Params       map[string]string // passed to the script as --key=value
+	OutputFormat string            // html (default) or pdf, only applies to scripts that render reports
+	// streamed to the script's stdin instead of reading filePath (which then only names the input),
+	// only for scripts registered with stdin support, see SupportsStdin
+	Input io.Reader
+	// called once a slot is free and the pre-hook passed, right before R is invoked
+	OnStart func()
+}
+
+// SupportsStdin reports whether the analysis type's script can read its input from stdin
+// and the backend can deliver it, callers fall back to a temp file otherwise
+func (s *DescriptiveService) SupportsStdin(analysisType string) bool {
+	if analysisType == "" {
+		analysisType = DefaultAnalysisType
+	}
+	spec := s.scripts[analysisType]
+	if _, ok := s.runners[spec.Interpreter].(*ExecRunner); !ok {
+		return false
 	}
+	return spec.Stdin
+}
 
-	baseFileName := filepath.Base(filePath)
-	outputFile := filepath.Join(outputDir, fmt.Sprintf("analysis_%s_%s.html", 
-		baseFileName[:len(baseFileName)-len(filepath.Ext(baseFileName))], 
-		analysisID[:8]))
+// Delegates analysis to R or python (doesn't actually perform analysis)
+// the script and the runner for its interpreter come from the registry, keyed by the requested analysis type,
+// params are passed as --key=value flags
+// cancelling ctx (e.g. on worker shutdown) kills the R process
+func (s *DescriptiveService) ExecuteAnalysis(ctx context.Context, filePath, analysisType string, opts AnalysisOptions) (*DescriptiveAnalysisMetadata, error) {
+	result, err := s.executeAnalysis(ctx, filePath, analysisType, opts)
+
+	status := "failed"
+	switch {
+	case errors.Is(err, ErrTimedOut), errors.Is(err, context.DeadlineExceeded):
+		status = "timeout"
+	case err == nil && result != nil:
+		status = result.Status
+	}
+	metrics.AnalysesTotal.WithLabelValues(status).Inc()
+	// only analyses that got as far as R have a duration
+	if result != nil && result.Duration > 0 {
+		metrics.AnalysisDuration.Observe(result.Duration.Seconds())
+	}
+	return result, err
+}
 
-	scriptName := "wr_dummy_analysis.R"
+func (s *DescriptiveService) executeAnalysis(ctx context.Context, filePath, analysisType string, opts AnalysisOptions) (*DescriptiveAnalysisMetadata, error) {
+	//File & Script verification (in case files/folders are moved/missing)
+	analysisID := opts.AnalysisID
+	if analysisID == "" {
+		analysisID = s.newID()
+	}
+	if analysisType == "" {
+		analysisType = DefaultAnalysisType
+	}
 
 	fileExt := filepath.Ext(filePath)
-	if fileExt != ".csv" && fileExt != ".sas7bdat" {
-		err := fmt.Errorf("unsupported file type: %s", fileExt)
+	spec, err := s.scripts.Lookup(analysisType, fileExt)
+	if err != nil {
+		return createFailedResult(analysisID, filePath, err.Error()), err
+	}
+	scriptName := spec.Script
+	runner, ok := s.runners[spec.Interpreter]
+	if !ok {
+		err := fmt.Errorf("no runner for %s scripts", spec.Interpreter)
+		return createFailedResult(analysisID, filePath, err.Error()), err
+	}
+
+	params := opts.Params
+	outputExt := spec.OutputExt
+	contentType := spec.ContentType
+	if contentType == "" {
+		contentType = outputContentType(outputExt)
+	}
+	// html scripts are rmarkdown reports and can render other formats, data outputs (json etc.) can't
+	if spec.OutputExt == ".html" {
+		formatName, format, err := lookupOutputFormat(opts.OutputFormat)
+		if err != nil {
+			return createFailedResult(analysisID, filePath, err.Error()), err
+		}
+		outputExt, contentType = format.Ext, format.ContentType
+
+		params = make(map[string]string, len(opts.Params)+1)
+		for key, value := range opts.Params {
+			params[key] = value
+		}
+		params["output_format"] = formatName
+		// the path is "-" when the input is streamed, so the reader to use (readxl, arrow, ...) is passed explicitly
+		params["input_type"] = strings.TrimPrefix(strings.ToLower(fileExt), ".")
+	} else if opts.OutputFormat != "" {
+		err := fmt.Errorf("%s analysis doesn't produce a report, output format %q can't apply", analysisType, opts.OutputFormat)
+		return createFailedResult(analysisID, filePath, err.Error()), err
+	}
+
+	args, err := paramArgs(params)
+	if err != nil {
 		return createFailedResult(analysisID, filePath, err.Error()), err
 	}
 
+	outputDir := filepath.Join(s.OutputDir, time.Now().Format("20060102"))
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return createFailedResult(analysisID, filePath, fmt.Sprintf("Failed to create output directory: %v", err)), err
+	}
+
+	baseFileName := filepath.Base(filePath)
+	outputFile := filepath.Join(outputDir, fmt.Sprintf("analysis_%s_%s_%s%s", 
+		baseFileName[:len(baseFileName)-len(filepath.Ext(baseFileName))], 
+		analysisType,
+		analysisID[len(analysisID)-8:], // the tail is random under both id schemes, a ULID's head is its timestamp
+		outputExt))
+
 	scriptPath := filepath.Join(s.ScriptsDir, scriptName)
 
-	// R will handle the parsing of data (read_csv/read_sas through haven package)
+	// the script handles the parsing of data (read_csv/read_sas through haven package, pandas for python)
 	if _, err := os.Stat(scriptPath); err != nil {
-		errMsg := fmt.Sprintf("R script not found: %s", scriptPath)
+		errMsg := fmt.Sprintf("analysis script not found: %s", scriptPath)
 		return createFailedResult(analysisID, filePath, errMsg), errors.New(errMsg)
 	}
 
-	//Running the R script through cmd line -
-	startTime := time.Now()
-	cmd := exec.Command(s.RExecutable, scriptPath, filePath, outputFile)
+	logger := s.logger.With(slog.String("analysis_id", analysisID), slog.String("analysis_type", analysisType))
+	logger.Info("Starting analysis",
+		slog.String("interpreter", spec.Interpreter),
+		slog.String("file_path", redact.Path(filePath)),
+		slog.String("output_path", redact.Path(outputFile)))
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	if opts.Input != nil && !spec.Stdin {
+		err := fmt.Errorf("%s script doesn't read from stdin", analysisType)
+		return createFailedResult(analysisID, filePath, err.Error()), err
+	}
 
-		//logging, to reduce lines in prod
-	log.Printf("Starting R analysis for file: %s", filePath)
-	log.Printf("Analysis ID: %s", analysisID)
-	log.Printf("Output will be written to: %s", outputFile)
+	// for capacity planning, recorded once per analysis actually sent to R
+	if opts.Input != nil {
+		counted := &countingReader{r: opts.Input}
+		opts.Input = counted
+		defer func() { metrics.ObserveFileSize(fileExt, counted.n) }()
+	} else if info, err := os.Stat(filePath); err == nil {
+		metrics.ObserveFileSize(fileExt, info.Size())
+	}
 
-	err := runWithTimeout(cmd, time.Duration(s.Timeout)*time.Second)
-	endTime := time.Now()
-	duration := endTime.Sub(startTime)
+	// wait for a free slot, the timeout only starts once the script is actually running
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return createFailedResult(analysisID, filePath, ctx.Err().Error()), ctx.Err()
+	}
+	defer func() { <-s.slots }()
 
-	//verifying outputs:
+	if s.preHook != nil {
+		if _, err := s.preHook.Run(ctx, filePath, analysisID, "WATCHRABBIT_ANALYSIS_TYPE="+analysisType); err != nil {
+			logger.Error("Pre-analysis hook failed", slog.Any("error", err))
+			return createFailedResult(analysisID, filePath, err.Error()), err
+		}
+	}
+
+	if opts.OnStart != nil {
+		opts.OnStart()
+	}
+
+	timeout := s.timeoutFor(analysisType, fileExt)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := runner.Run(ctx, AnalysisRequest{
+		AnalysisID: analysisID,
+		FilePath:   filePath,
+		ScriptPath: scriptPath,
+		OutputFile: outputFile,
+		Args:       args,
+		Input:      opts.Input,
+		Timeout:    timeout,
+	})
 	if err != nil {
-		errorMsg := fmt.Sprintf("R script execution failed: %v\nStderr: %s", err, stderr.String())
-		log.Printf(errorMsg)
-		return createFailedResult(analysisID, filePath, errorMsg), err
+		// a failed render can leave a partial report behind, its logs stay until CleanupOutput so they can be uploaded
+		s.removeFiles(outputFile)
+		return result, err
 	}
+
+	//verifying outputs:
 	//
 	if _, err := os.Stat(outputFile); err != nil {
-		errorMsg := fmt.Sprintf("R script did not generate expected output file: %v", err)
-		log.Printf(errorMsg)
+		errorMsg := fmt.Sprintf("script did not generate expected output file: %v", err)
+		logger.Error("Script did not generate expected output file", slog.Any("error", err))
 		return createFailedResult(analysisID, filePath, errorMsg), errors.New(errorMsg)
 	}
+	if err := verifyPrimaryOutput(outputFile, contentType); err != nil {
+		logger.Error("Output verification failed", slog.Any("error", err))
+		s.removeOutput(outputFile)
+		return createFailedResult(analysisID, filePath, err.Error()), err
+	}
 
-	// Success! Create the analysis result
-	result := &DescriptiveAnalysisMetadata{
-		AnalysisID:   analysisID,
-		FilePath:     filePath,
-		Status:       "success",
-		OutputPath:   outputFile,
-		StartTime:    startTime,
-		EndTime:      endTime,
-		Duration:     duration,
-		Metadata: map[string]string{
-			"fileType":     fileExt,
-			"analysisType": "descriptive",
-			"rScript":      scriptName,
-			"rOutput":      stdout.String(),
-		},
+	if s.validation.Enabled && contentType == "text/html" {
+		if err := validateHTMLOutput(outputFile, s.validation); err != nil {
+			if !s.validation.WarnOnly {
+				logger.Error("Output validation failed", slog.Any("error", err))
+				s.removeOutput(outputFile)
+				return createFailedResult(analysisID, filePath, err.Error()), err
+			}
+			logger.Warn("Output validation failed, keeping the report (validation only warns)", slog.Any("error", err))
+			result.Status = StatusSuccessWithWarnings
+			result.Metadata["outputWarning"] = err.Error()
+		}
+	}
+
+	// Success! fill in what the runner doesn't know about
+	result.Metadata["fileType"] = fileExt
+	result.Metadata["analysisType"] = analysisType
+	result.Metadata["script"] = scriptName
+	result.Metadata["interpreter"] = spec.Interpreter
+	if spec.Interpreter == InterpreterR {
+		// kept for consumers that predate python scripts
+		result.Metadata["rScript"] = scriptName
+	}
+	result.ContentType = contentType
+	// echoed back so a report can be traced to the exact inputs that produced it
+	if len(params) > 0 {
+		paramsJSON, _ := json.Marshal(params)
+		result.Metadata["params"] = string(paramsJSON)
 	}
 
+	if !s.postHookAfterUpload {
+		if err := s.runPostHook(ctx, result, "WATCHRABBIT_ANALYSIS_TYPE="+analysisType); err != nil {
+			s.removeOutput(outputFile)
+			return createFailedResult(analysisID, filePath, err.Error()), err
+		}
+	}
 
-	log.Printf("Analysis completed successfully for file: %s", filePath)
-	log.Printf("Analysis duration: %v", duration)
-	log.Printf("Output saved to: %s", outputFile)
+	logger.Info("Analysis completed successfully",
+		slog.String("file_path", redact.Path(filePath)),
+		slog.Duration("duration", result.Duration),
+		slog.String("output_path", redact.Path(outputFile)))
 	
 	return result, nil
 }
 
+// counts bytes streamed to stdin, for the file size metric
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// CleanupOutput removes a report and its logs once they've been uploaded, unless RetainOutput is set
+// a failed result has no report, only logs
+func (s *DescriptiveService) CleanupOutput(result *DescriptiveAnalysisMetadata) {
+	if result == nil {
+		return
+	}
+	if result.OutputPath != "" {
+		s.removeOutput(result.OutputPath)
+	}
+	for _, path := range result.LogFiles {
+		s.removeFiles(path)
+	}
+}
+
+func (s *DescriptiveService) removeOutput(outputFile string) {
+	s.removeFiles(outputFile, outputFile+".stdout.log", outputFile+".stderr.log")
+}
+
+func (s *DescriptiveService) removeFiles(paths ...string) {
+	if s.RetainOutput {
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn("Failed to remove analysis output", slog.String("path", redact.Path(path)), slog.Any("error", err))
+		}
+	}
+}
+
+// AfterUpload runs the post-analysis hook when it's configured for the after_upload stage, with the stored key
+// in WATCHRABBIT_RESULT_KEY, call it once the report is in storage (before CleanupOutput) but before the
+// analysis is recorded as completed, an error fails the analysis
+func (s *DescriptiveService) AfterUpload(ctx context.Context, result *DescriptiveAnalysisMetadata, resultKey string) error {
+	if !s.postHookAfterUpload {
+		return nil
+	}
+	return s.runPostHook(ctx, result, "WATCHRABBIT_RESULT_KEY="+resultKey)
+}
+
+// runPostHook returns nil when the hook isn't configured, succeeds, or fails in warn mode
+// (the warning is kept in the result metadata)
+func (s *DescriptiveService) runPostHook(ctx context.Context, result *DescriptiveAnalysisMetadata, extraEnv ...string) error {
+	if s.postHook == nil {
+		return nil
+	}
+
+	extraEnv = append(extraEnv, "WATCHRABBIT_INPUT_PATH="+result.FilePath)
+	_, err := s.postHook.Run(ctx, result.OutputPath, result.AnalysisID, extraEnv...)
+	if err == nil {
+		return nil
+	}
+	if s.postHookWarnOnly {
+		s.logger.Warn("Post-analysis hook failed, continuing (hook failures only warn)", slog.String("analysis_id", result.AnalysisID), slog.Any("error", err))
+		result.Metadata["postHookWarning"] = err.Error()
+		return nil
+	}
+	s.logger.Error("Post-analysis hook failed", slog.String("analysis_id", result.AnalysisID), slog.Any("error", err))
+	return err
+}
+
+// returned when a script runs past the analysis timeout
+var ErrTimedOut = errors.New("process timed out")
+
 // message template in case the execution fails
 func createFailedResult(analysisID, filePath, errorMessage string) *DescriptiveAnalysisMetadata {
 	return &DescriptiveAnalysisMetadata{
@@ -202,25 +609,20 @@ func createFailedResult(analysisID, filePath, errorMessage string) *DescriptiveA
 }
 
 // command line execution of Scripts
-func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-	//channel signals when the process finishes
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
+// the command must come from exec.CommandContext with a ctx that carries the timeout;
+// when ctx ends the process and its children are killed instead of being orphaned
+func runWithTimeout(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcess(cmd) }
+	// don't hang on pipes held open by a grandchild that somehow survived
+	cmd.WaitDelay = 5 * time.Second
 
-	//waiting on command line completion or timeout
-	select {
-	case err := <-done:
-		return err
-	case <-time.After(timeout):
-		if err := cmd.Process.Kill(); err != nil {
-			return fmt.Errorf("failed to kill process after timeout: %v", err)
+	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return ErrTimedOut
 		}
-		return errors.New("process timed out")
+		return fmt.Errorf("analysis cancelled: %w", ctxErr)
 	}
-
-}
\ No newline at end of file
+	return err
+}
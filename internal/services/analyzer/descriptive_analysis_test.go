@@ -0,0 +1,427 @@
+//go:build unix
+
+package analyzer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stands in for Rscript: <script> <input> <output> [--key=value...]
+// records how many runs are in flight (markers in $RUNNING) before writing a minimal report,
+// with $FAIL set writes a partial report and fails with $FAIL on stderr, and given "-" as the input
+// wraps whatever it reads from stdin in the report
+const fakeRscript = `#!/bin/sh
+if [ "$2" = "-" ]; then
+	{ printf '<html><body><pre>'; cat; printf '</pre></body></html>'; } > "$3"
+	exit 0
+fi
+if [ -n "$FAIL" ]; then
+	printf '<html>' > "$3"
+	echo "Error: $FAIL" >&2
+	exit 1
+fi
+touch "$RUNNING/$$"
+ls "$RUNNING" | wc -l >> "$PEAKS"
+sleep 0.2
+printf '<html><body>ok</body></html>' > "$3"
+rm "$RUNNING/$$"
+`
+
+func newFakeRService(t *testing.T, maxConcurrency int, configure ...func(*DescriptiveConfig)) (*DescriptiveService, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	rscript := filepath.Join(dir, "Rscript")
+	if err := os.WriteFile(rscript, []byte(fakeRscript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	scripts := filepath.Join(dir, "scripts")
+	if err := os.MkdirAll(scripts, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scripts, "wr_dummy_analysis.R"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	running := filepath.Join(dir, "running")
+	if err := os.MkdirAll(running, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	peaks := filepath.Join(dir, "peaks")
+	t.Setenv("RUNNING", running)
+	t.Setenv("PEAKS", peaks)
+
+	cfg := DescriptiveConfig{
+		RExecutable:    rscript,
+		ScriptsDir:     scripts,
+		OutputDir:      filepath.Join(dir, "out"),
+		MaxConcurrency: maxConcurrency,
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	service, err := NewDescriptiveService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, peaks
+}
+
+func TestExecuteAnalysisRespectsMaxConcurrency(t *testing.T) {
+	const limit, analyses = 2, 6
+	service, peaks := newFakeRService(t, limit)
+
+	input := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(input, []byte("id,value\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, analyses)
+	for i := 0; i < analyses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := service.ExecuteAnalysis(context.Background(), input, DefaultAnalysisType, AnalysisOptions{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			service.CleanupOutput(result)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("analysis failed: %v", err)
+	}
+
+	data, err := os.ReadFile(peaks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(data))
+	if len(lines) != analyses {
+		t.Fatalf("%d runs recorded, want %d", len(lines), analyses)
+	}
+	peak := 0
+	for _, line := range lines {
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peak = max(peak, n)
+	}
+	if peak > limit {
+		t.Errorf("peak concurrency = %d, want at most %d", peak, limit)
+	}
+	if peak < limit {
+		t.Logf("peak concurrency only reached %d of %d, runs didn't overlap", peak, limit)
+	}
+}
+
+func TestFailedAnalysisKeepsLogsUntilCleanup(t *testing.T) {
+	service, _ := newFakeRService(t, 1)
+	t.Setenv("FAIL", "object 'value' not found")
+
+	input := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(input, []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := service.ExecuteAnalysis(context.Background(), input, DefaultAnalysisType, AnalysisOptions{})
+	if err == nil {
+		t.Fatal("expected the analysis to fail")
+	}
+	stderrLog := result.LogFiles["stderr"]
+	if stderrLog == "" {
+		t.Fatalf("failed result has no stderr log: %+v", result)
+	}
+	data, err := os.ReadFile(stderrLog)
+	if err != nil {
+		t.Fatalf("stderr log removed before it could be uploaded: %v", err)
+	}
+	if !strings.Contains(string(data), "object 'value' not found") {
+		t.Errorf("stderr log = %q", data)
+	}
+	// the partial report is gone straight away, nothing uploads it
+	if _, err := os.Stat(strings.TrimSuffix(stderrLog, ".stderr.log")); !os.IsNotExist(err) {
+		t.Errorf("partial report left behind: %v", err)
+	}
+
+	service.CleanupOutput(result)
+	if _, err := os.Stat(stderrLog); !os.IsNotExist(err) {
+		t.Errorf("stderr log left behind after cleanup: %v", err)
+	}
+}
+
+func TestExecuteAnalysisUsesGivenAnalysisID(t *testing.T) {
+	hookIDs := filepath.Join(t.TempDir(), "hook-ids")
+	// hooks get the input/report path and the analysis id as their last two arguments
+	recordID := []string{"sh", "-c", `echo "$2" >> "$HOOK_IDS"`, "hook"}
+	t.Setenv("HOOK_IDS", hookIDs)
+	service, _ := newFakeRService(t, 1, func(cfg *DescriptiveConfig) {
+		cfg.PreHook = recordID
+		cfg.PostHook = recordID
+	})
+
+	input := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(input, []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const analysisUUID = "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c"
+	result, err := service.ExecuteAnalysis(context.Background(), input, DefaultAnalysisType, AnalysisOptions{AnalysisID: analysisUUID})
+	if err != nil {
+		t.Fatalf("analysis failed: %v", err)
+	}
+	defer service.CleanupOutput(result)
+
+	if result.AnalysisID != analysisUUID {
+		t.Errorf("result analysis id = %q, want %s", result.AnalysisID, analysisUUID)
+	}
+	if !strings.Contains(filepath.Base(result.OutputPath), analysisUUID[len(analysisUUID)-8:]) {
+		t.Errorf("output %s isn't named after the analysis", result.OutputPath)
+	}
+	data, err := os.ReadFile(hookIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); len(got) != 2 || got[0] != analysisUUID || got[1] != analysisUUID {
+		t.Errorf("hooks got analysis ids %v, want %s twice", got, analysisUUID)
+	}
+}
+
+func TestExecuteAnalysisStreamsStdin(t *testing.T) {
+	service, _ := newFakeRService(t, 1, func(cfg *DescriptiveConfig) {
+		cfg.Scripts = map[string]string{"stream": "stream.R|.html|stdin"}
+	})
+	if err := os.WriteFile(filepath.Join(service.ScriptsDir, "stream.R"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !service.SupportsStdin("stream") || service.SupportsStdin(DefaultAnalysisType) {
+		t.Fatalf("SupportsStdin = %v for stream and %v for %s, want only stream", service.SupportsStdin("stream"), service.SupportsStdin(DefaultAnalysisType), DefaultAnalysisType)
+	}
+
+	// no file on disk, the script only gets the input through stdin
+	const data = "id,value\n1,2\n3,4\n"
+	result, err := service.ExecuteAnalysis(context.Background(), "https://example.org/labs.csv", "stream", AnalysisOptions{Input: strings.NewReader(data)})
+	if err != nil {
+		t.Fatalf("analysis failed: %v", err)
+	}
+	defer service.CleanupOutput(result)
+
+	report, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), data) {
+		t.Errorf("report = %q, want it to contain the streamed input", report)
+	}
+
+	// a script that expects a file path can't be handed a stream
+	if _, err := service.ExecuteAnalysis(context.Background(), "https://example.org/labs.csv", DefaultAnalysisType, AnalysisOptions{Input: strings.NewReader(data)}); err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Errorf("stdin to a file-only script = %v, want it refused", err)
+	}
+}
+
+func TestExecuteAnalysisOutputValidation(t *testing.T) {
+	// the fake script renders <html><body>ok</body></html>, which has no marker
+	tests := []struct {
+		name       string
+		warnOnly   bool
+		wantErr    bool
+		wantStatus string
+	}{
+		{"fail mode", false, true, "failed"},
+		{"warn mode", true, false, StatusSuccessWithWarnings},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newFakeRService(t, 1, func(cfg *DescriptiveConfig) {
+				cfg.OutputValidation = OutputValidation{Enabled: true, Marker: `id="watchrabbit-report"`, WarnOnly: tt.warnOnly}
+			})
+			input := filepath.Join(t.TempDir(), "data.csv")
+			if err := os.WriteFile(input, []byte("id\n1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := service.ExecuteAnalysis(context.Background(), input, DefaultAnalysisType, AnalysisOptions{})
+			defer service.CleanupOutput(result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExecuteAnalysis = %v, want error %v", err, tt.wantErr)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", result.Status, tt.wantStatus)
+			}
+			if tt.warnOnly {
+				if !strings.Contains(result.Metadata["outputWarning"], "marker") {
+					t.Errorf("outputWarning = %q, want the validation failure", result.Metadata["outputWarning"])
+				}
+				if _, err := os.Stat(result.OutputPath); err != nil {
+					t.Errorf("report not kept in warn mode: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteAnalysisNonHTMLOutput(t *testing.T) {
+	// writes a pdf header rather than the fake Rscript's html report
+	const pdfRscript = "#!/bin/sh\nprintf '%%PDF-1.7\\n' > \"$3\"\n"
+
+	tests := []struct {
+		name            string
+		analysisType    string
+		spec            string
+		script          string
+		writesPDF       bool
+		wantErr         string
+		wantContentType string
+		wantExt         string
+	}{
+		{
+			name:            "pdf report",
+			analysisType:    "model",
+			spec:            "model.R|.pdf",
+			script:          "model.R",
+			writesPDF:       true,
+			wantContentType: "application/pdf",
+			wantExt:         ".pdf",
+		},
+		{
+			name:         "html written as pdf",
+			analysisType: "model",
+			spec:         "model.R|.pdf",
+			script:       "model.R",
+			wantErr:      "doesn't look like application/pdf",
+		},
+		{
+			// html validation doesn't apply to a csv export
+			name:            "csv export",
+			analysisType:    "export",
+			spec:            "export.R|.csv:text/csv",
+			script:          "export.R",
+			wantContentType: "text/csv",
+			wantExt:         ".csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rscript := filepath.Join(t.TempDir(), "Rscript")
+			if err := os.WriteFile(rscript, []byte(pdfRscript), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			service, _ := newFakeRService(t, 1, func(cfg *DescriptiveConfig) {
+				cfg.Scripts = map[string]string{tt.analysisType: tt.spec}
+				cfg.OutputValidation = OutputValidation{Enabled: true, Marker: `id="watchrabbit-report"`}
+				if tt.writesPDF {
+					cfg.RExecutable = rscript
+				}
+			})
+			if err := os.WriteFile(filepath.Join(service.ScriptsDir, tt.script), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			input := filepath.Join(t.TempDir(), "data.csv")
+			if err := os.WriteFile(input, []byte("id\n1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := service.ExecuteAnalysis(context.Background(), input, tt.analysisType, AnalysisOptions{})
+			defer service.CleanupOutput(result)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ExecuteAnalysis = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExecuteAnalysis = %v", err)
+			}
+			if result.ContentType != tt.wantContentType {
+				t.Errorf("content type = %q, want %q", result.ContentType, tt.wantContentType)
+			}
+			if filepath.Ext(result.OutputPath) != tt.wantExt {
+				t.Errorf("output path = %s, want a %s file", result.OutputPath, tt.wantExt)
+			}
+		})
+	}
+}
+
+func TestExecuteAnalysisDispatchesByExtension(t *testing.T) {
+	// records the script and args it was run with before writing a minimal report
+	const recordingRscript = "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$ARGS\"\nprintf '<html><body>ok</body></html>' > \"$3\"\n"
+
+	tests := []struct {
+		input         string
+		analysisType  string
+		wantScript    string
+		wantInputType string
+	}{
+		{"labs.csv", DefaultAnalysisType, "wr_dummy_analysis.R", "csv"},
+		{"labs.sas7bdat", DefaultAnalysisType, "wr_dummy_analysis.R", "sas7bdat"},
+		{"labs.xlsx", DefaultAnalysisType, "wr_dummy_analysis.R", "xlsx"},
+		{"labs.parquet", DefaultAnalysisType, "wr_dummy_analysis.R", "parquet"},
+		{"LABS.XLSX", DefaultAnalysisType, "wr_dummy_analysis.R", "xlsx"},
+		{"labs.parquet", "wide", "wide_report.R", "parquet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.analysisType+"/"+tt.input, func(t *testing.T) {
+			dir := t.TempDir()
+			rscript := filepath.Join(dir, "Rscript")
+			if err := os.WriteFile(rscript, []byte(recordingRscript), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			recorded := filepath.Join(dir, "args")
+			t.Setenv("ARGS", recorded)
+			service, _ := newFakeRService(t, 1, func(cfg *DescriptiveConfig) {
+				cfg.RExecutable = rscript
+				cfg.Scripts = map[string]string{"wide": "wide_report.R"}
+				// as the worker passes them from the watcher config
+				cfg.FileTypes = []string{"csv", ".sas7bdat", "XLSX", ".parquet"}
+			})
+			if err := os.WriteFile(filepath.Join(service.ScriptsDir, "wide_report.R"), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			input := filepath.Join(dir, tt.input)
+			if err := os.WriteFile(input, []byte("id\n1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := service.ExecuteAnalysis(context.Background(), input, tt.analysisType, AnalysisOptions{})
+			defer service.CleanupOutput(result)
+			if err != nil {
+				t.Fatalf("ExecuteAnalysis = %v", err)
+			}
+
+			data, err := os.ReadFile(recorded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if filepath.Base(args[0]) != tt.wantScript || args[1] != input {
+				t.Errorf("ran %s on %s, want %s on %s", filepath.Base(args[0]), args[1], tt.wantScript, input)
+			}
+			wantArg := "--input_type=" + tt.wantInputType
+			found := false
+			for _, arg := range args[3:] {
+				found = found || arg == wantArg
+			}
+			if !found {
+				t.Errorf("args = %q, want %s", args[3:], wantArg)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// internal/services/analyzer/fanout.go
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// suffix of the optional per-file manifest, e.g. data.csv -> data.csv.analyses.json
+const ManifestSuffix = ".analyses.json"
+
+// FanOut decides which analysis types a detected file turns into
+// lookup order: sidecar manifest next to the file, then the longest matching directory, then Default
+type FanOut struct {
+	Default     []string
+	Directories map[string][]string
+}
+
+type fanOutManifest struct {
+	AnalysisTypes []string `json:"analysisTypes"`
+}
+
+// NewFanOut builds a FanOut from config values
+// directoryTypes maps a directory to a "|" separated list, e.g. /data/study1 -> descriptive|qc
+func NewFanOut(defaultTypes []string, directoryTypes map[string]string) *FanOut {
+	directories := make(map[string][]string, len(directoryTypes))
+	for dir, types := range directoryTypes {
+		directories[filepath.Clean(dir)] = splitTypes(types)
+	}
+
+	return &FanOut{
+		Default:     defaultTypes,
+		Directories: directories,
+	}
+}
+
+// AnalysisTypes returns the de-duplicated list of analysis types to request for filePath
+func (f *FanOut) AnalysisTypes(filePath string) ([]string, error) {
+	manifestPath := filePath + ManifestSuffix
+	data, err := os.ReadFile(manifestPath)
+	if err == nil {
+		var manifest fanOutManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid analysis manifest %s: %v", manifestPath, err)
+		}
+		if len(manifest.AnalysisTypes) > 0 {
+			return dedupeTypes(manifest.AnalysisTypes), nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read analysis manifest %s: %v", manifestPath, err)
+	}
+
+	// most specific directory wins, so /data/study1/qc can override /data/study1
+	bestMatch := ""
+	dir := filepath.Dir(filepath.Clean(filePath))
+	for configured := range f.Directories {
+		if (dir == configured || strings.HasPrefix(dir, configured+string(filepath.Separator))) && len(configured) > len(bestMatch) {
+			bestMatch = configured
+		}
+	}
+	if bestMatch != "" {
+		return dedupeTypes(f.Directories[bestMatch]), nil
+	}
+
+	return dedupeTypes(f.Default), nil
+}
+
+func splitTypes(types string) []string {
+	var result []string
+	for _, t := range strings.Split(types, "|") {
+		if t = strings.TrimSpace(t); t != "" {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func dedupeTypes(types []string) []string {
+	seen := make(map[string]bool, len(types))
+	var result []string
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	return result
+}
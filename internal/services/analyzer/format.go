@@ -0,0 +1,33 @@
+// internal/services/analyzer/format.go
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultOutputFormat = "html"
+
+// OutputFormat is a report format the R scripts can render
+type OutputFormat struct {
+	Ext         string
+	ContentType string
+}
+
+// allowlist checked before R is invoked, the name is passed to the script as --output_format=<name>
+var outputFormats = map[string]OutputFormat{
+	"html": {Ext: ".html", ContentType: "text/html"},
+	"pdf":  {Ext: ".pdf", ContentType: "application/pdf"},
+}
+
+func lookupOutputFormat(name string) (string, OutputFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultOutputFormat
+	}
+	format, ok := outputFormats[name]
+	if !ok {
+		return "", OutputFormat{}, fmt.Errorf("unsupported output format %q (expected html or pdf)", name)
+	}
+	return name, format, nil
+}
@@ -0,0 +1,100 @@
+// internal/services/analyzer/hook.go
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// how much of a failed hook's output ends up in the error message
+const maxHookOutputInError = 2048
+
+// Hook is an operator-configured command run around an analysis, e.g. decrypting the input or fetching a credential
+// it's started without a shell: Command[0] is the program and the rest are fixed arguments, followed by the
+// (absolute) path it acts on - the input for the pre-analysis hook, the report for the post-analysis one - and the
+// analysis id, which are also in WATCHRABBIT_FILE_PATH / WATCHRABBIT_ANALYSIS_ID
+type Hook struct {
+	Name    string // "pre-analysis" / "post-analysis", for logs and errors
+	Command []string
+	Timeout time.Duration
+}
+
+// newHook returns nil for an empty command (no hook configured)
+func newHook(name string, command []string, timeoutSeconds int) (*Hook, error) {
+	if len(command) == 0 || strings.TrimSpace(command[0]) == "" {
+		return nil, nil
+	}
+	program, err := exec.LookPath(command[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s hook: %v", name, err)
+	}
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = 60
+	}
+
+	return &Hook{
+		Name:    name,
+		Command: append([]string{program}, command[1:]...),
+		Timeout: time.Duration(timeoutSeconds) * time.Second,
+	}, nil
+}
+
+// Run executes the hook and returns its combined output, a non-zero exit or timeout is an error
+// extraEnv is KEY=value pairs added to the hook's environment
+func (h *Hook) Run(ctx context.Context, filePath, analysisID string, extraEnv ...string) (string, error) {
+	// absolute so a file named like a flag (-rf) can't be read as one, control characters could split
+	// lines in whatever the hook writes the path to
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("%s hook: %v", h.Name, err)
+	}
+	if strings.IndexFunc(absPath, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%s hook: file path contains control characters", h.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	args := append(append([]string{}, h.Command[1:]...), absPath, analysisID)
+	cmd := exec.CommandContext(ctx, h.Command[0], args...)
+	cmd.Env = append(os.Environ(),
+		"WATCHRABBIT_FILE_PATH="+absPath,
+		"WATCHRABBIT_ANALYSIS_ID="+analysisID,
+	)
+	cmd.Env = append(cmd.Env, extraEnv...)
+
+	output := newLineLogger(slog.Default().With(slog.String("hook", h.Name), slog.String("analysis_id", analysisID)), "Hook output")
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	start := time.Now()
+	err = runWithTimeout(ctx, cmd)
+	output.Flush()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("exit status %d", exitErr.ExitCode())
+		}
+		return output.String(), fmt.Errorf("%s hook failed after %v: %v%s", h.Name, time.Since(start).Round(time.Millisecond), err, hookOutputTail(output.String()))
+	}
+	return output.String(), nil
+}
+
+func hookOutputTail(output string) string {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return ""
+	}
+	if len(output) > maxHookOutputInError {
+		output = "..." + output[len(output)-maxHookOutputInError:]
+	}
+	return ": " + output
+}
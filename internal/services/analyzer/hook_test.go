@@ -0,0 +1,161 @@
+//go:build unix
+
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookRun(t *testing.T) {
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	t.Setenv("RECORD", record)
+
+	tests := []struct {
+		name     string
+		command  string
+		timeout  time.Duration
+		filePath string
+		wantErr  []string
+		wantOut  string
+	}{
+		{
+			name:     "success",
+			command:  `echo "$0 $1 $2 $3|$WATCHRABBIT_FILE_PATH|$WATCHRABBIT_ANALYSIS_ID|$WATCHRABBIT_ANALYSIS_TYPE" > "$RECORD"; echo decrypted`,
+			timeout:  5 * time.Second,
+			filePath: filepath.Join(dir, "labs.csv"),
+			wantOut:  "decrypted",
+		},
+		{
+			name:     "non-zero exit",
+			command:  `echo "gpg: decryption failed: No secret key" >&2; exit 3`,
+			timeout:  5 * time.Second,
+			filePath: filepath.Join(dir, "labs.csv"),
+			wantErr:  []string{"pre-analysis hook failed", "exit status 3", "gpg: decryption failed: No secret key"},
+		},
+		{
+			name:     "timeout",
+			command:  `sleep 5`,
+			timeout:  100 * time.Millisecond,
+			filePath: filepath.Join(dir, "labs.csv"),
+			wantErr:  []string{"pre-analysis hook failed"},
+		},
+		{
+			name:     "control characters in the path",
+			command:  `exit 0`,
+			timeout:  5 * time.Second,
+			filePath: filepath.Join(dir, "labs\n.csv"),
+			wantErr:  []string{"control characters"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(record)
+			hook := &Hook{Name: "pre-analysis", Command: []string{"/bin/sh", "-c", tt.command, "decrypt", "--armor"}, Timeout: tt.timeout}
+
+			start := time.Now()
+			output, err := hook.Run(context.Background(), tt.filePath, "analysis-1", "WATCHRABBIT_ANALYSIS_TYPE=descriptive")
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("hook took %v", elapsed)
+			}
+
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatal("Run = nil, want an error")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q doesn't mention %q", err, want)
+					}
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if strings.TrimSpace(output) != tt.wantOut {
+				t.Errorf("output = %q, want %q", output, tt.wantOut)
+			}
+			// fixed arguments first, then the path and the analysis id, also in the environment
+			got, err := os.ReadFile(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "decrypt --armor " + tt.filePath + " analysis-1|" + tt.filePath + "|analysis-1|descriptive"
+			if strings.TrimSpace(string(got)) != want {
+				t.Errorf("hook saw %q, want %q", strings.TrimSpace(string(got)), want)
+			}
+		})
+	}
+}
+
+func TestNewHook(t *testing.T) {
+	if hook, err := newHook("pre-analysis", nil, 0); hook != nil || err != nil {
+		t.Errorf("newHook(nil) = %v, %v, want no hook", hook, err)
+	}
+	if hook, err := newHook("pre-analysis", []string{" "}, 0); hook != nil || err != nil {
+		t.Errorf("newHook(blank) = %v, %v, want no hook", hook, err)
+	}
+	if _, err := newHook("pre-analysis", []string{"no-such-decrypt-tool"}, 0); err == nil {
+		t.Error("newHook with a missing program = nil error")
+	}
+
+	hook, err := newHook("pre-analysis", []string{"sh", "-c", "exit 0"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(hook.Command[0]) || hook.Timeout != 60*time.Second {
+		t.Errorf("hook = %+v, want the program resolved on PATH and a 60s default timeout", hook)
+	}
+}
+
+func TestPreHookGatesAnalysis(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		wantErr string
+	}{
+		{"success runs the analysis", `exit 0`, ""},
+		{"failure stops before R", `echo "cannot decrypt $1" >&2; exit 3`, "cannot decrypt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, peaks := newFakeRService(t, 1, func(cfg *DescriptiveConfig) {
+				cfg.PreHook = []string{"sh", "-c", tt.command, "hook"}
+			})
+			input := filepath.Join(t.TempDir(), "data.csv")
+			if err := os.WriteFile(input, []byte("id\n1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := service.ExecuteAnalysis(context.Background(), input, DefaultAnalysisType, AnalysisOptions{})
+			defer service.CleanupOutput(result)
+			_, statErr := os.Stat(peaks)
+			ran := statErr == nil
+
+			if tt.wantErr == "" {
+				if err != nil || !ran {
+					t.Fatalf("analysis = %v (R ran %v), want a successful run", err, ran)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), input) {
+				t.Errorf("analysis = %v, want the hook's error for %s", err, input)
+			}
+			if ran {
+				t.Error("R ran after the pre-analysis hook failed")
+			}
+			if result == nil || result.Status != "failed" {
+				t.Errorf("result = %+v, want a failed result", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// internal/services/analyzer/logwriter.go
+package analyzer
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+	"watchrabbit/internal/services/redact"
+)
+
+// how much of a process's output is kept with the result record, the rest is in the log files
+// (a tail never goes into S3 object metadata, but stays well under the 2KB S3 allows there anyway)
+const (
+	logTailLines = 10
+	maxLogTail   = 500
+)
+
+// lineLogger is an io.Writer for a process's stdout/stderr: it logs each line as it arrives
+// (so a 4 minute render shows progress) and keeps everything written for the metadata / error message
+type lineLogger struct {
+	logger *slog.Logger
+	msg    string
+
+	mu      sync.Mutex
+	all     bytes.Buffer
+	partial []byte
+}
+
+// each line is logged as msg with the text in a "line" field, logger carries the process's identifying fields
+func newLineLogger(logger *slog.Logger, msg string) *lineLogger {
+	return &lineLogger{logger: logger, msg: msg}
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.all.Write(p)
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.logger.Info(l.msg, slog.String("line", string(bytes.TrimRight(l.partial[:i], "\r"))))
+		l.partial = l.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs a trailing line that didn't end in a newline
+func (l *lineLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.partial) > 0 {
+		l.logger.Info(l.msg, slog.String("line", string(l.partial)))
+		l.partial = nil
+	}
+}
+
+func (l *lineLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.all.String()
+}
+
+func (l *lineLogger) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]byte(nil), l.all.Bytes()...)
+}
+
+// logTail is the last few non-empty lines of a process's output joined into one line, with control characters
+// (\r, tabs, terminal escapes) as spaces and cut to maxLogTail bytes without splitting a character
+func logTail(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(strings.Map(printable, line)); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > logTailLines {
+		lines = lines[len(lines)-logTailLines:]
+	}
+	tail := strings.Join(lines, " | ")
+	if len(tail) > maxLogTail {
+		cut := len(tail) - maxLogTail
+		for cut < len(tail) && !utf8.RuneStart(tail[cut]) {
+			cut++
+		}
+		tail = "..." + tail[cut:]
+	}
+	return tail
+}
+
+func printable(r rune) rune {
+	if unicode.IsPrint(r) {
+		return r
+	}
+	return ' '
+}
+
+// writes each non-empty stream to <outputFile>.<stream>.log, returns stream -> path for the ones written
+// a log that can't be written is only a warning, the report itself is fine
+func writeLogFiles(logger *slog.Logger, outputFile string, streams map[string][]byte) map[string]string {
+	logFiles := make(map[string]string, len(streams))
+	for stream, content := range streams {
+		if len(content) == 0 {
+			continue
+		}
+		path := outputFile + "." + stream + ".log"
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			logger.Warn("Failed to write script log", slog.String("stream", stream), slog.String("path", redact.Path(path)), slog.Any("error", err))
+			continue
+		}
+		logFiles[stream] = path
+	}
+	return logFiles
+}
@@ -0,0 +1,45 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func TestLogTail(t *testing.T) {
+	long := strings.Repeat("é", maxLogTail) // two bytes each
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"one line", "processing\n", "processing"},
+		{"lines joined", "a\nb\r\n\nc\n", "a | b | c"},
+		{"last lines only", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "3 | 4 | 5 | 6 | 7 | 8 | 9 | 10 | 11 | 12"},
+		{"control characters", "\x1b[31mError\x1b[0m:\tbad input\n", "[31mError [0m: bad input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logTail(tt.output); got != tt.want {
+				t.Errorf("logTail(%q) = %q, want %q", tt.output, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("cut on a rune boundary", func(t *testing.T) {
+		got := logTail("first line\n" + long + "\n")
+		if !strings.HasPrefix(got, "...") || len(got) > maxLogTail+len("...") {
+			t.Errorf("tail of %d bytes doesn't start with ... or is over the cap", len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Error("tail cut a character in half")
+		}
+		if strings.IndexFunc(got, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			t.Error("tail isn't a single printable line")
+		}
+	})
+}
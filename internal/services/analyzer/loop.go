@@ -0,0 +1,102 @@
+// internal/services/analyzer/loop.go
+package analyzer
+
+import (
+	"sync"
+	"time"
+)
+
+// LoopDetector limits how often one file can be analyzed, a script writing into a watched directory (or a watched
+// output dir) otherwise re-triggers itself forever. a file that exceeds the limit is quarantined: every request
+// for it is refused until the quarantine runs out
+type LoopDetector struct {
+	max        int
+	window     time.Duration
+	quarantine time.Duration
+
+	mu          sync.Mutex
+	seen        map[string][]time.Time // request times within the window, oldest first
+	quarantined map[string]time.Time   // path -> quarantined until
+	lastSweep   time.Time
+}
+
+// NewLoopDetector allows max analyses per file per window, returns nil (no limit) when max or window is 0
+func NewLoopDetector(max int, window, quarantine time.Duration) *LoopDetector {
+	if max <= 0 || window <= 0 {
+		return nil
+	}
+	return &LoopDetector{
+		max:         max,
+		window:      window,
+		quarantine:  quarantine,
+		seen:        make(map[string][]time.Time),
+		quarantined: make(map[string]time.Time),
+	}
+}
+
+// Allow records a request for path at now and reports whether it may run
+// tripped is only true for the request that pushed the file into quarantine, so callers alert once per loop
+func (d *LoopDetector) Allow(path string, now time.Time) (allowed, tripped bool) {
+	if d == nil {
+		return true, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+
+	if until, ok := d.quarantined[path]; ok {
+		if now.Before(until) {
+			return false, false
+		}
+		delete(d.quarantined, path)
+	}
+
+	times := append(pruneBefore(d.seen[path], now.Add(-d.window)), now)
+	if len(times) > d.max {
+		delete(d.seen, path)
+		d.quarantined[path] = now.Add(d.quarantine)
+		return false, true
+	}
+	d.seen[path] = times
+	return true, false
+}
+
+// Release lifts a file's quarantine early, e.g. once the offending script is fixed
+func (d *LoopDetector) Release(path string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	delete(d.quarantined, path)
+	d.mu.Unlock()
+}
+
+// drops files that haven't been seen for a window, at most once per window so Allow stays cheap
+func (d *LoopDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	d.lastSweep = now
+	cutoff := now.Add(-d.window)
+	for path, times := range d.seen {
+		if times = pruneBefore(times, cutoff); len(times) == 0 {
+			delete(d.seen, path)
+		} else {
+			d.seen[path] = times
+		}
+	}
+	for path, until := range d.quarantined {
+		if !now.Before(until) {
+			delete(d.quarantined, path)
+		}
+	}
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
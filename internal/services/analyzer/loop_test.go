@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoopDetector(t *testing.T) {
+	const path = "/data/study1/labs.csv"
+	start := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	type request struct {
+		at          time.Duration
+		path        string
+		wantAllowed bool
+		wantTripped bool
+	}
+	tests := []struct {
+		name     string
+		requests []request
+	}{
+		{
+			name: "threshold",
+			requests: []request{
+				{0, path, true, false},
+				{time.Second, path, true, false},
+				{2 * time.Second, path, true, false},
+				// the fourth within the window trips it, alerting once
+				{3 * time.Second, path, false, true},
+				{4 * time.Second, path, false, false},
+			},
+		},
+		{
+			name: "other files aren't affected",
+			requests: []request{
+				{0, path, true, false},
+				{time.Second, path, true, false},
+				{2 * time.Second, path, true, false},
+				{3 * time.Second, path, false, true},
+				{4 * time.Second, "/data/study1/other.csv", true, false},
+			},
+		},
+		{
+			name: "window expiry",
+			requests: []request{
+				{0, path, true, false},
+				{time.Second, path, true, false},
+				{2 * time.Second, path, true, false},
+				// only what's left in the minute window counts
+				{60500 * time.Millisecond, path, true, false},
+				{61500 * time.Millisecond, path, true, false},
+				// +2s, +60.5s, +61.5s and this one
+				{61900 * time.Millisecond, path, false, true},
+			},
+		},
+		{
+			name: "quarantine ttl",
+			requests: []request{
+				{0, path, true, false},
+				{0, path, true, false},
+				{0, path, true, false},
+				{0, path, false, true},
+				{59 * time.Minute, path, false, false},
+				// released after an hour with a clean slate
+				{time.Hour, path, true, false},
+				{time.Hour, path, true, false},
+				{time.Hour, path, true, false},
+				{time.Hour, path, false, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewLoopDetector(3, time.Minute, time.Hour)
+			for i, r := range tt.requests {
+				allowed, tripped := d.Allow(r.path, at(r.at))
+				if allowed != r.wantAllowed || tripped != r.wantTripped {
+					t.Fatalf("request %d for %s at +%s = allowed %v, tripped %v, want %v, %v", i, r.path, r.at, allowed, tripped, r.wantAllowed, r.wantTripped)
+				}
+			}
+		})
+	}
+}
+
+func TestLoopDetectorRelease(t *testing.T) {
+	const path = "/data/study1/labs.csv"
+	now := time.Now()
+	d := NewLoopDetector(1, time.Minute, time.Hour)
+	d.Allow(path, now)
+	if allowed, tripped := d.Allow(path, now); allowed || !tripped {
+		t.Fatalf("second request = %v, %v, want it to trip the quarantine", allowed, tripped)
+	}
+
+	d.Release(path)
+	if allowed, _ := d.Allow(path, now); !allowed {
+		t.Error("still quarantined after Release")
+	}
+}
+
+func TestLoopDetectorDisabled(t *testing.T) {
+	for _, d := range []*LoopDetector{NewLoopDetector(0, time.Minute, time.Hour), NewLoopDetector(3, 0, time.Hour)} {
+		if d != nil {
+			t.Fatalf("NewLoopDetector = %+v, want nil (no limit)", d)
+		}
+		for i := 0; i < 10; i++ {
+			if allowed, tripped := d.Allow("/data/a.csv", time.Now()); !allowed || tripped {
+				t.Fatalf("disabled detector refused request %d", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// internal/services/analyzer/params.go
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// names R's argument parsing handles without quoting, e.g. treatment_arm or ref.range
+var paramKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.]*$`)
+
+const maxParamValueLen = 1024
+
+// paramArgs turns analysis params into --key=value flags, sorted so the command line is reproducible
+// R is started without a shell, so values are never interpreted - this only rejects things a script
+// could mis-parse (control characters, flag-looking keys) and absurdly long values
+func paramArgs(params map[string]string) ([]string, error) {
+	keys := make([]string, 0, len(params))
+	for key, value := range params {
+		if !paramKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid analysis param name %q", key)
+		}
+		if len(value) > maxParamValueLen {
+			return nil, fmt.Errorf("analysis param %s is longer than %d bytes", key, maxParamValueLen)
+		}
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("analysis param %s contains control characters", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, "--"+key+"="+params[key])
+	}
+	return args, nil
+}
@@ -0,0 +1,80 @@
+// internal/services/analyzer/paths.go
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// resolveDir makes a configured directory absolute so it doesn't depend on the worker's CWD (systemd, containers)
+// relative paths are taken from baseDir, or the directory of the running executable when baseDir is empty
+// (under `go run` that's a temp build dir, set a base dir there)
+func resolveDir(baseDir, dir string) (string, error) {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir), nil
+	}
+
+	if baseDir == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate executable to resolve %s: %v", dir, err)
+		}
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		baseDir = filepath.Dir(exe)
+	}
+
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve base directory %s: %v", baseDir, err)
+	}
+	return filepath.Join(base, dir), nil
+}
+
+// requireDir fails unless path exists and is a directory
+func requireDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// OverlappingDirs returns the watched directories that contain outputDir or sit inside it, reports written
+// there would be picked up by the watcher and analyzed again
+func OverlappingDirs(outputDir string, watched []string) []string {
+	output := canonicalDir(outputDir)
+	var overlaps []string
+	for _, dir := range watched {
+		if dir == "" {
+			continue
+		}
+		watchedDir := canonicalDir(dir)
+		if isWithin(output, watchedDir) || isWithin(watchedDir, output) {
+			overlaps = append(overlaps, dir)
+		}
+	}
+	return overlaps
+}
+
+// absolute, with symlinks resolved where the directory exists
+func canonicalDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return filepath.Clean(dir)
+}
+
+// reports whether path is dir or below it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
@@ -0,0 +1,144 @@
+package analyzer
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOverlappingDirs(t *testing.T) {
+	root := t.TempDir()
+	data := filepath.Join(root, "data")
+	reports := filepath.Join(root, "reports")
+	for _, dir := range []string{data, reports, filepath.Join(data, "out")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(root, "data-link")
+	if err := os.Symlink(data, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		outputDir string
+		watched   []string
+		want      []string
+	}{
+		{"separate", reports, []string{data}, nil},
+		{"same dir", data, []string{data, reports}, []string{data}},
+		{"output inside a watched dir", filepath.Join(data, "out"), []string{data}, []string{data}},
+		{"watched dir inside the output", root, []string{data, reports}, []string{data, reports}},
+		{"through a symlink", filepath.Join(link, "out"), []string{data}, []string{data}},
+		{"sibling with a shared prefix", filepath.Join(root, "data2"), []string{data}, nil},
+		{"unclean path", data + "/../data/", []string{data}, []string{data}},
+		{"empty watched entry", reports, []string{""}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OverlappingDirs(tt.outputDir, tt.watched); !slices.Equal(got, tt.want) {
+				t.Errorf("OverlappingDirs(%s, %v) = %v, want %v", tt.outputDir, tt.watched, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDir(t *testing.T) {
+	base := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	tests := []struct {
+		name    string
+		baseDir string
+		dir     string
+		want    string
+	}{
+		{"absolute kept", base, "/srv/scripts/r", "/srv/scripts/r"},
+		{"absolute cleaned", base, "/srv/scripts/../scripts/r/", "/srv/scripts/r"},
+		{"relative to the base", base, "./scripts/r", filepath.Join(base, "scripts", "r")},
+		{"relative base made absolute", "deploy", "scripts/r", filepath.Join(cwd, "deploy", "scripts", "r")},
+		{"relative to the executable", "", "scripts/r", filepath.Join(filepath.Dir(exe), "scripts", "r")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveDir(tt.baseDir, tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveDir(%q, %q) = %q, want %q", tt.baseDir, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "wr_dummy_analysis.R")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := requireDir(dir); err != nil {
+		t.Errorf("requireDir(existing dir) = %v", err)
+	}
+	if err := requireDir(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("requireDir(missing) = %v, want not exist", err)
+	}
+	if err := requireDir(file); err == nil {
+		t.Error("requireDir(file) = nil, want an error")
+	}
+}
+
+func TestNewDescriptiveServiceResolvesDirs(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "scripts", "r"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	newService := func(scriptsDir string) (*DescriptiveService, error) {
+		return NewDescriptiveService(DescriptiveConfig{
+			RExecutable: "/usr/bin/Rscript",
+			ScriptsDir:  scriptsDir,
+			OutputDir:   "out",
+			BaseDir:     base,
+			Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+	}
+
+	service, err := newService("./scripts/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(base, "scripts", "r"); service.ScriptsDir != want {
+		t.Errorf("ScriptsDir = %q, want %q", service.ScriptsDir, want)
+	}
+	// the output dir is created up front
+	if want := filepath.Join(base, "out"); service.OutputDir != want {
+		t.Errorf("OutputDir = %q, want %q", service.OutputDir, want)
+	} else if err := requireDir(want); err != nil {
+		t.Errorf("output dir not created: %v", err)
+	}
+
+	// a missing scripts dir fails at startup, naming where it looked
+	_, err = newService("./scripts/python")
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(base, "scripts", "python")) {
+		t.Errorf("NewDescriptiveService with a missing scripts dir = %v, want an error naming the resolved path", err)
+	}
+}
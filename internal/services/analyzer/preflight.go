@@ -0,0 +1,77 @@
+// internal/services/analyzer/preflight.go
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// R package names are letters, digits and dots
+var rPackagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9.]*$`)
+
+// Preflight loads the required R packages once so a misconfigured worker fails at startup
+// instead of nacking every message, "pandoc" in the list checks rmarkdown can find pandoc
+func (s *DescriptiveService) Preflight(ctx context.Context, packages []string) error {
+	if _, ok := s.runners[InterpreterR].(*ExecRunner); !ok {
+		// Rserve has its own R installation, it's checked by whoever runs Rserve
+		s.logger.Info("Skipping R preflight for non-exec backend")
+		return nil
+	}
+
+	var rPackages []string
+	checkPandoc := false
+	for _, pkg := range packages {
+		pkg = strings.TrimSpace(pkg)
+		switch {
+		case pkg == "":
+		case pkg == "pandoc":
+			checkPandoc = true
+		case rPackagePattern.MatchString(pkg):
+			rPackages = append(rPackages, pkg)
+		default:
+			return fmt.Errorf("invalid R package name %q", pkg)
+		}
+	}
+
+	quoted := make([]string, len(rPackages))
+	for i, pkg := range rPackages {
+		quoted[i] = rString(pkg)
+	}
+	// prints one missing dependency per line
+	snippet := fmt.Sprintf(`pkgs <- c(%s)
+missing <- pkgs[!vapply(pkgs, requireNamespace, logical(1), quietly = TRUE)]
+if (%s) {
+  if (!requireNamespace("rmarkdown", quietly = TRUE) || !rmarkdown::pandoc_available()) missing <- c(missing, "pandoc")
+}
+cat(missing, sep = "\n")`, strings.Join(quoted, ", "), strings.ToUpper(fmt.Sprint(checkPandoc)))
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.RExecutable, "-e", snippet)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runWithTimeout(ctx, cmd); err != nil {
+		return fmt.Errorf("R preflight failed to run %s: %v: %s", s.RExecutable, err, extractRError(stderr.String()))
+	}
+
+	var missing []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("R environment is missing required packages: %s", strings.Join(missing, ", "))
+	}
+
+	s.logger.Info("R preflight passed", slog.String("packages", strings.Join(packages, ", ")))
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+// internal/services/analyzer/proc_other.go
+package analyzer
+
+import "os/exec"
+
+// no process groups here, children of R may outlive it
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
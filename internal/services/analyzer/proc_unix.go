@@ -0,0 +1,22 @@
+//go:build unix
+
+// internal/services/analyzer/proc_unix.go
+package analyzer
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// runs R in its own process group so pandoc/rmarkdown children can be killed along with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// kills the whole process group (negative pid), not just Rscript
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+// internal/services/analyzer/proc_windows.go
+package analyzer
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// own process group so a console interrupt aimed at the worker doesn't reach R first
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// taskkill /T takes the whole tree (pandoc, LaTeX) down with Rscript, plain Kill only ends Rscript itself
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		// taskkill missing or the tree already gone, make sure R at least is
+		return cmd.Process.Kill()
+	}
+	return nil
+}
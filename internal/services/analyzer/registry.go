@@ -0,0 +1,163 @@
+// internal/services/analyzer/registry.go
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAnalysisType is used for requests from producers that predate analysis types
+const DefaultAnalysisType = "descriptive"
+
+// returned (wrapped) when a request names an analysis type with no script behind it
+var ErrUnregisteredAnalysis = errors.New("unregistered analysis type")
+
+// interpreters a script can run under, picked from the script's extension
+const (
+	InterpreterR      = "r"
+	InterpreterPython = "python"
+)
+
+// ScriptSpec is the script (and the interpreter running it) that produces one analysis type
+type ScriptSpec struct {
+	Script      string // file name inside ScriptsDir
+	Interpreter string // InterpreterR or InterpreterPython
+	OutputExt   string // extension the script writes, e.g. ".html"
+	// content type of the output, recorded on the result and used to verify it, defaults from OutputExt
+	ContentType string
+	// input extensions the script can read, empty for any
+	FileTypes []string
+	// script reads its input from stdin when given "-" as the input path, so downloads can skip the temp file
+	Stdin bool
+}
+
+// ScriptRegistry maps analysis types to their scripts
+type ScriptRegistry map[string]ScriptSpec
+
+// input extensions the bundled script reads (read.csv, haven, readxl, arrow), overridden by DescriptiveConfig.FileTypes
+var DefaultFileTypes = []string{".csv", ".sas7bdat", ".xlsx", ".parquet"}
+
+// the scripts that ship with the repo, config entries are layered on top
+func DefaultScripts() ScriptRegistry {
+	return ScriptRegistry{
+		DefaultAnalysisType: {Script: "wr_dummy_analysis.R", Interpreter: InterpreterR, OutputExt: ".html", ContentType: "text/html", FileTypes: DefaultFileTypes},
+	}
+}
+
+// NewScriptRegistry adds config entries of the form type -> "script.R|.ext:content/type|stdin" (ext defaults to .html,
+// the content type to the one registered for ext, the stdin flag is optional) to the defaults
+// .R scripts run under R, .py scripts under python
+func NewScriptRegistry(entries map[string]string) (ScriptRegistry, error) {
+	registry := DefaultScripts()
+	for analysisType, entry := range entries {
+		parts := strings.SplitN(entry, "|", 3)
+		spec := ScriptSpec{Script: strings.TrimSpace(parts[0]), OutputExt: ".html"}
+		if spec.Script == "" {
+			return nil, fmt.Errorf("no script given for analysis type %s", analysisType)
+		}
+		interpreter, err := scriptInterpreter(spec.Script)
+		if err != nil {
+			return nil, fmt.Errorf("analysis type %s: %v", analysisType, err)
+		}
+		spec.Interpreter = interpreter
+		if len(parts) >= 2 && strings.TrimSpace(parts[1]) != "" {
+			ext, contentType, _ := strings.Cut(parts[1], ":")
+			if ext = strings.TrimSpace(ext); ext != "" {
+				spec.OutputExt = ext
+				if !strings.HasPrefix(spec.OutputExt, ".") {
+					spec.OutputExt = "." + spec.OutputExt
+				}
+			}
+			spec.ContentType = strings.TrimSpace(contentType)
+			if spec.ContentType != "" {
+				if _, _, err := mime.ParseMediaType(spec.ContentType); err != nil {
+					return nil, fmt.Errorf("invalid content type %q for analysis type %s: %v", spec.ContentType, analysisType, err)
+				}
+			}
+		}
+		if spec.ContentType == "" {
+			spec.ContentType = outputContentType(spec.OutputExt)
+		}
+		if len(parts) == 3 {
+			switch strings.TrimSpace(parts[2]) {
+			case "stdin":
+				spec.Stdin = true
+			case "":
+			default:
+				return nil, fmt.Errorf("unknown script option %q for analysis type %s", parts[2], analysisType)
+			}
+		}
+		// config'd scripts keep the file types of the default they replace, if any
+		if existing, ok := registry[analysisType]; ok {
+			spec.FileTypes = existing.FileTypes
+		}
+		registry[analysisType] = spec
+	}
+	return registry, nil
+}
+
+// Lookup returns the script for analysisType, checking it can read the given input extension
+func (r ScriptRegistry) Lookup(analysisType, fileExt string) (ScriptSpec, error) {
+	if analysisType == "" {
+		analysisType = DefaultAnalysisType
+	}
+	spec, ok := r[analysisType]
+	if !ok {
+		return ScriptSpec{}, fmt.Errorf("%w: %s", ErrUnregisteredAnalysis, analysisType)
+	}
+	if len(spec.FileTypes) == 0 {
+		return spec, nil
+	}
+	for _, ext := range spec.FileTypes {
+		if strings.EqualFold(ext, fileExt) {
+			return spec, nil
+		}
+	}
+	return ScriptSpec{}, fmt.Errorf("unsupported file type %q for %s analysis (supported: %s)", fileExt, analysisType, strings.Join(spec.FileTypes, ", "))
+}
+
+// Uses reports whether any registered script runs under interpreter
+func (r ScriptRegistry) Uses(interpreter string) bool {
+	for _, spec := range r {
+		if spec.Interpreter == interpreter {
+			return true
+		}
+	}
+	return false
+}
+
+func scriptInterpreter(script string) (string, error) {
+	switch strings.ToLower(filepath.Ext(script)) {
+	case ".r":
+		return InterpreterR, nil
+	case ".py":
+		return InterpreterPython, nil
+	default:
+		return "", fmt.Errorf("can't tell which interpreter runs %s (expected a .R or .py script)", script)
+	}
+}
+
+// content type for an output extension nobody gave one for, the system mime table can be sparse
+// so it's empty when unknown and the store detects it from the output itself
+func outputContentType(ext string) string {
+	return mime.TypeByExtension(ext)
+}
+
+// lowercased with a leading dot, blanks dropped
+func normalizeExtensions(exts []string) []string {
+	normalized := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScriptRegistryLookup(t *testing.T) {
+	scripts, err := NewScriptRegistry(map[string]string{"qc": "qc_report.py|.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		analysisType    string
+		fileExt         string
+		wantScript      string
+		wantInterpreter string
+		wantErr         string
+	}{
+		{"", ".csv", "wr_dummy_analysis.R", InterpreterR, ""},
+		{DefaultAnalysisType, ".csv", "wr_dummy_analysis.R", InterpreterR, ""},
+		{DefaultAnalysisType, ".sas7bdat", "wr_dummy_analysis.R", InterpreterR, ""},
+		{DefaultAnalysisType, ".xlsx", "wr_dummy_analysis.R", InterpreterR, ""},
+		{DefaultAnalysisType, ".parquet", "wr_dummy_analysis.R", InterpreterR, ""},
+		{DefaultAnalysisType, ".XLSX", "wr_dummy_analysis.R", InterpreterR, ""},
+		{DefaultAnalysisType, ".txt", "", "", "unsupported file type"},
+		// config'd scripts without file types of their own take anything
+		{"qc", ".parquet", "qc_report.py", InterpreterPython, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.analysisType+tt.fileExt, func(t *testing.T) {
+			spec, err := scripts.Lookup(tt.analysisType, tt.fileExt)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Lookup = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup = %v", err)
+			}
+			if spec.Script != tt.wantScript || spec.Interpreter != tt.wantInterpreter {
+				t.Errorf("Lookup = %s under %s, want %s under %s", spec.Script, spec.Interpreter, tt.wantScript, tt.wantInterpreter)
+			}
+		})
+	}
+
+	if _, err := scripts.Lookup("qcc", ".csv"); !errors.Is(err, ErrUnregisteredAnalysis) {
+		t.Errorf("unknown analysis type = %v, want ErrUnregisteredAnalysis", err)
+	}
+}
+
+func TestServiceAnalyzeDispatch(t *testing.T) {
+	service := NewService()
+
+	tests := []struct {
+		path         string
+		wantFileType string
+	}{
+		{"/data/labs.csv", "csv"},
+		{"/data/labs.sas7bdat", "sas7bdat"},
+		{"/data/labs.xlsx", "xlsx"},
+		{"/data/labs.parquet", "parquet"},
+		{"/data/LABS.XLSX", "xlsx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := service.Analyze(tt.path)
+			if err != nil {
+				t.Fatalf("Analyze = %v", err)
+			}
+			if result.Metadata["fileType"] != tt.wantFileType {
+				t.Errorf("analyzed as %v, want %s", result.Metadata["fileType"], tt.wantFileType)
+			}
+		})
+	}
+
+	if _, err := service.Analyze("/data/labs.txt"); err == nil || !strings.Contains(err.Error(), "unsupported file type") {
+		t.Errorf("Analyze(.txt) = %v, want unsupported file type", err)
+	}
+}
+
+func TestNormalizeExtensions(t *testing.T) {
+	got := normalizeExtensions([]string{"csv", " .XLSX ", "", ".parquet"})
+	want := []string{".csv", ".xlsx", ".parquet"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("normalizeExtensions = %q, want %q", got, want)
+	}
+}
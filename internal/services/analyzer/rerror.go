@@ -0,0 +1,98 @@
+// internal/services/analyzer/rerror.go
+package analyzer
+
+import (
+	"strings"
+)
+
+const (
+	// lines kept when stderr has no recognizable Error block
+	rErrorTailLines = 5
+	maxRErrorLen    = 1000
+)
+
+// extractRError pulls the useful part out of R's stderr for ErrorMessage:
+// the last "Error in ..."/"Error:" line plus its continuation lines, dropping
+// package startup noise, the "Calls:" traceback and "Execution halted"
+func extractRError(stderr string) string {
+	lines := strings.Split(strings.ReplaceAll(stderr, "\r\n", "\n"), "\n")
+
+	start := -1
+	for i, line := range lines {
+		if isRErrorStart(line) {
+			start = i
+		}
+	}
+
+	var kept []string
+	if start >= 0 {
+		for _, line := range lines[start:] {
+			trimmed := strings.TrimSpace(line)
+			if len(kept) > 0 && (trimmed == "" || isRErrorEnd(trimmed)) {
+				break
+			}
+			kept = append(kept, trimmed)
+		}
+	} else {
+		// no Error block (e.g. killed, or a warning-as-error), fall back to the tail
+		for i := len(lines) - 1; i >= 0 && len(kept) < rErrorTailLines; i-- {
+			trimmed := strings.TrimSpace(lines[i])
+			if trimmed == "" || trimmed == "Execution halted" {
+				continue
+			}
+			kept = append([]string{trimmed}, kept...)
+		}
+	}
+
+	return truncateError(strings.Join(kept, " "))
+}
+
+// extractPythonError keeps the exception line that ends a traceback ("ValueError: ..."),
+// or the last few lines when the script wrote something else
+func extractPythonError(stderr string) string {
+	lines := strings.Split(strings.ReplaceAll(stderr, "\r\n", "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "Traceback (most recent call last):") {
+			// the exception is the first unindented line after the traceback
+			for _, line := range lines[i+1:] {
+				if line != "" && !strings.HasPrefix(line, " ") {
+					return truncateError(strings.TrimSpace(line))
+				}
+			}
+			break
+		}
+	}
+	return tailLines(stderr)
+}
+
+// last non-blank lines of stderr joined into one, when there's nothing better to go on
+func tailLines(stderr string) string {
+	lines := strings.Split(strings.ReplaceAll(stderr, "\r\n", "\n"), "\n")
+	var kept []string
+	for i := len(lines) - 1; i >= 0 && len(kept) < rErrorTailLines; i-- {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" {
+			kept = append([]string{trimmed}, kept...)
+		}
+	}
+	return truncateError(strings.Join(kept, " "))
+}
+
+func truncateError(message string) string {
+	if len(message) > maxRErrorLen {
+		return message[:maxRErrorLen] + "..."
+	}
+	return message
+}
+
+func isRErrorStart(line string) bool {
+	return strings.HasPrefix(line, "Error in ") || strings.HasPrefix(line, "Error:") || strings.HasPrefix(line, "Error ")
+}
+
+// lines R prints after the error message itself
+func isRErrorEnd(line string) bool {
+	return strings.HasPrefix(line, "Calls:") ||
+		strings.HasPrefix(line, "Execution halted") ||
+		strings.HasPrefix(line, "In addition:") ||
+		strings.HasPrefix(line, "Backtrace:") ||
+		strings.HasPrefix(line, "Warning message")
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractRError(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{
+			name: "error with a continuation line",
+			stderr: `Loading required package: dplyr
+
+Attaching package: 'dplyr'
+
+Error in read.csv(input_file) : 
+  more columns than column names
+Calls: main -> read.csv -> read.table
+Execution halted
+`,
+			want: "Error in read.csv(input_file) : more columns than column names",
+		},
+		{
+			name: "last error wins",
+			stderr: `Error in value[[3L]](cond) : first reader failed
+Retrying with the fallback reader
+Error: Column ` + "`visit_date`" + ` not found in ` + "`.data`" + `.
+Backtrace:
+    x
+ 1. dplyr::select(...)
+Execution halted
+`,
+			want: "Error: Column `visit_date` not found in `.data`.",
+		},
+		{
+			name:   "windows line endings and a trailing warning",
+			stderr: "Error in solve.default(m) : \r\n  Lapack routine dgesv: system is exactly singular: U[2,2] = 0\r\nIn addition: Warning message:\r\nIn log(x) : NaNs produced\r\nExecution halted\r\n",
+			want:   "Error in solve.default(m) : Lapack routine dgesv: system is exactly singular: U[2,2] = 0",
+		},
+		{
+			name: "multi-line message up to the blank line",
+			stderr: `Error in check_input(df) : 
+  input failed validation:
+  - subject_id has 3 missing values
+  - visit has unexpected levels
+
+Calls: main -> check_input
+Execution halted
+`,
+			want: "Error in check_input(df) : input failed validation: - subject_id has 3 missing values - visit has unexpected levels",
+		},
+		{
+			name: "no error block falls back to the tail",
+			stderr: `Loading required package: ggplot2
+processing 10000 rows
+step 1
+step 2
+step 3
+step 4
+Killed
+Execution halted
+`,
+			want: "step 1 step 2 step 3 step 4 Killed",
+		},
+		{
+			name:   "empty",
+			stderr: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractRError(tt.stderr); got != tt.want {
+				t.Errorf("extractRError = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractRErrorTruncates(t *testing.T) {
+	got := extractRError("Error: " + strings.Repeat("x", 2*maxRErrorLen) + "\nExecution halted\n")
+	if len(got) != maxRErrorLen+len("...") || !strings.HasSuffix(got, "...") {
+		t.Errorf("extractRError returned %d chars, want %d plus ...", len(got), maxRErrorLen)
+	}
+}
+
+func TestExtractPythonError(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{
+			name: "traceback",
+			stderr: `Traceback (most recent call last):
+  File "/scripts/summary.py", line 12, in <module>
+    values = [float(v) for v in row]
+  File "/scripts/summary.py", line 12, in <listcomp>
+    values = [float(v) for v in row]
+ValueError: could not convert string to float: 'NA'
+`,
+			want: "ValueError: could not convert string to float: 'NA'",
+		},
+		{
+			name:   "no traceback",
+			stderr: "reading input\nwarning: 2 rows skipped\n",
+			want:   "reading input warning: 2 rows skipped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractPythonError(tt.stderr); got != tt.want {
+				t.Errorf("extractPythonError = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// internal/services/analyzer/retry.go
+package analyzer
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides which failed analyses are worth running again and how long to wait in between
+type RetryPolicy struct {
+	MaxAttempts int           // runs per request including the first, 1 or less disables retries
+	Backoff     time.Duration // wait before the first retry, doubled for each one after
+	MaxBackoff  time.Duration // cap on the wait, 0 for none
+	// error message substrings that make a script failure transient too, e.g. "pandoc" or "locked"
+	TransientPatterns []string
+}
+
+// Transient reports whether err is a blip rather than the script genuinely failing: the script timed out,
+// the interpreter couldn't be started or Rserve couldn't be reached, or the message matches a TransientPatterns entry
+func (p RetryPolicy) Transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrTimedOut) {
+		return true
+	}
+	var execErr *exec.Error
+	if errors.As(err, &execErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	message := err.Error()
+	for _, pattern := range p.TransientPatterns {
+		if pattern != "" && strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldRetry reports whether a request whose attempt-th run failed with err gets another one
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	return attempt < p.MaxAttempts && p.Transient(err)
+}
+
+// Delay is the wait after the attempt-th run failed
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,282 @@
+// internal/services/analyzer/rserve.go
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RserveRunner keeps one R session open in Rserve and sources the analysis scripts into it,
+// avoiding the ~1s R startup per file. Scripts still read commandArgs() exactly like under Rscript.
+// The session is single threaded, so runs are serialized - scale with more Rserve instances/workers.
+type RserveRunner struct {
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewRserveRunner(addr string, timeout time.Duration) *RserveRunner {
+	return &RserveRunner{addr: addr, timeout: timeout}
+}
+
+func (r *RserveRunner) Run(ctx context.Context, req AnalysisRequest) (*DescriptiveAnalysisMetadata, error) {
+	if req.Input != nil {
+		// the R session is remote, it can only read files
+		err := errors.New("rserve backend can't stream input via stdin")
+		return createFailedResult(req.AnalysisID, req.FilePath, err.Error()), err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		conn, err := dialRserve(ctx, r.addr)
+		if err != nil {
+			return createFailedResult(req.AnalysisID, req.FilePath, err.Error()), err
+		}
+		r.conn = conn
+	}
+
+	args := []string{rString(req.FilePath), rString(req.OutputFile)}
+	for _, arg := range req.Args {
+		args = append(args, rString(arg))
+	}
+
+	// commandArgs is shadowed inside a throwaway environment, so the script sees the same args Rscript would pass
+	// tryCatch keeps R errors from tearing down the session
+	expr := fmt.Sprintf(`local({
+		commandArgs <- function(trailingOnly = FALSE) c(%s)
+		tryCatch(c("ok", paste(capture.output(source(%s, local = TRUE)), collapse = "\n")),
+			error = function(e) c("error", conditionMessage(e)))
+	})`, strings.Join(args, ", "), rString(req.ScriptPath))
+
+	timeout := r.timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	r.conn.SetDeadline(deadline)
+
+	// cancellation unblocks the read, the session is then dropped below like any other failure
+	conn := r.conn
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	startTime := time.Now()
+	out, err := rserveEvalStrings(conn, expr)
+	endTime := time.Now()
+
+	if err != nil {
+		// protocol/timeout errors leave the session in an unknown state, start over next time
+		r.conn.Close()
+		r.conn = nil
+		errorMsg := fmt.Sprintf("Rserve evaluation failed: %v", err)
+		slog.Error("Rserve evaluation failed", slog.String("analysis_id", req.AnalysisID), slog.Any("error", err))
+		return createFailedResult(req.AnalysisID, req.FilePath, errorMsg), err
+	}
+	if len(out) != 2 || out[0] != "ok" {
+		errorMsg := fmt.Sprintf("R script execution failed: %s", strings.Join(out, ": "))
+		slog.Error("R script execution failed", slog.String("analysis_id", req.AnalysisID), slog.String("error", strings.Join(out, ": ")))
+		return createFailedResult(req.AnalysisID, req.FilePath, errorMsg), errors.New(errorMsg)
+	}
+
+	return &DescriptiveAnalysisMetadata{
+		AnalysisID: req.AnalysisID,
+		FilePath:   req.FilePath,
+		Status:     "success",
+		OutputPath: req.OutputFile,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Duration:   endTime.Sub(startTime),
+		Metadata: map[string]string{
+			"backend": "rserve",
+		},
+		// capture.output only sees stdout, warnings stay in the Rserve process's own log
+		LogFiles: writeLogFiles(slog.Default(), req.OutputFile, map[string][]byte{"stdout": []byte(out[1])}),
+		LogTails: map[string]string{"rOutput": logTail(out[1])},
+	}, nil
+}
+
+// Close drops the R session
+func (r *RserveRunner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// quotes s as an R string literal
+func rString(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// minimal QAP1 client, just enough to evaluate an expression that returns a character vector
+// (see https://www.rforge.net/Rserve/dev/prot.html)
+const (
+	rserveCmdEval  = 0x003
+	rserveRespOK   = 0x10001
+	rserveRespErr  = 0x10002
+	rserveDTString = 4
+	rserveDTSexp   = 10
+	rserveDTLarge  = 0x40
+	rserveXTStrArr = 34
+	rserveXTLarge  = 64
+	rserveXTAttr   = 128
+)
+
+func dialRserve(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Rserve at %s: %w", addr, err)
+	}
+
+	// 32 byte greeting, e.g. "Rsrv0103QAP1\r\n\r\n--------------\r\n"
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	greeting := make([]byte, 32)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read Rserve greeting: %v", err)
+	}
+	if string(greeting[0:4]) != "Rsrv" || string(greeting[8:12]) != "QAP1" {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected Rserve greeting %q", greeting)
+	}
+	// attributes follow in 4 byte blocks, "AR.." means the server wants a login we don't support
+	for i := 12; i+4 <= len(greeting); i += 4 {
+		if string(greeting[i:i+2]) == "AR" {
+			conn.Close()
+			return nil, errors.New("Rserve requires authentication, which is not supported")
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	slog.Info("Connected to Rserve", slog.String("addr", addr))
+	return conn, nil
+}
+
+func rserveEvalStrings(conn net.Conn, expr string) ([]string, error) {
+	// DT_STRING parameter: null terminated and padded to a multiple of 4
+	str := append([]byte(expr), 0)
+	for len(str)%4 != 0 {
+		str = append(str, 0)
+	}
+	if len(str) >= 1<<24 {
+		return nil, errors.New("expression too long for Rserve")
+	}
+
+	payload := make([]byte, 4, 4+len(str))
+	payload[0] = rserveDTString
+	putUint24(payload[1:4], len(str))
+	payload = append(payload, str...)
+
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:4], rserveCmdEval)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(payload)))
+	if _, err := conn.Write(append(header, payload...)); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	resp := binary.LittleEndian.Uint32(header[0:4])
+	length := uint64(binary.LittleEndian.Uint32(header[4:8])) | uint64(binary.LittleEndian.Uint32(header[12:16]))<<32
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+
+	if resp&0xffffff == rserveRespErr {
+		return nil, fmt.Errorf("Rserve returned error code %d", (resp>>24)&0x7f)
+	}
+	if resp&0xffffff != rserveRespOK {
+		return nil, fmt.Errorf("unexpected Rserve response 0x%x", resp)
+	}
+
+	return parseStringSexp(body)
+}
+
+// pulls the character vector out of a DT_SEXP response
+func parseStringSexp(body []byte) ([]string, error) {
+	typ, data, _, err := readItem(body)
+	if err != nil {
+		return nil, err
+	}
+	if typ&^rserveDTLarge != rserveDTSexp {
+		return nil, fmt.Errorf("unexpected Rserve data type %d", typ)
+	}
+
+	xt, sexp, _, err := readItem(data)
+	if err != nil {
+		return nil, err
+	}
+	if xt&rserveXTAttr != 0 {
+		// skip the attribute pairlist
+		_, _, n, err := readItem(sexp)
+		if err != nil {
+			return nil, err
+		}
+		sexp = sexp[n:]
+	}
+	if xt&^(rserveXTLarge|rserveXTAttr) != rserveXTStrArr {
+		return nil, fmt.Errorf("unexpected R result type %d (expected a character vector)", xt)
+	}
+
+	// null separated strings, padded with \x01
+	var out []string
+	for _, s := range bytes.Split(bytes.TrimRight(sexp, "\x01"), []byte{0}) {
+		out = append(out, string(s))
+	}
+	if len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return out, nil
+}
+
+// reads a type byte + 24 bit (or 56 bit when large) length header, returns the type, its content and total bytes used
+func readItem(b []byte) (byte, []byte, int, error) {
+	if len(b) < 4 {
+		return 0, nil, 0, errors.New("truncated Rserve response")
+	}
+	typ := b[0]
+	length := uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16
+	headerLen := 4
+	if typ&rserveDTLarge != 0 {
+		if len(b) < 8 {
+			return 0, nil, 0, errors.New("truncated Rserve response")
+		}
+		length |= uint64(binary.LittleEndian.Uint32(b[4:8])) << 24
+		headerLen = 8
+	}
+	if uint64(len(b)-headerLen) < length {
+		return 0, nil, 0, errors.New("truncated Rserve response")
+	}
+	end := headerLen + int(length)
+	return typ, b[headerLen:end], end, nil
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,132 @@
+// internal/services/analyzer/runner.go
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AnalysisRequest is everything a runner needs to produce one report
+type AnalysisRequest struct {
+	AnalysisID string
+	FilePath   string
+	ScriptPath string
+	OutputFile string
+	// extra script arguments after the input and output paths (--key=value params)
+	Args []string
+	// when set, streamed to the script's stdin and "-" is passed instead of FilePath
+	Input io.Reader
+	// limit on this run, resolved per analysis type / extension, 0 for the runner's own
+	Timeout time.Duration
+}
+
+// AnalysisRunner executes an analysis script against an input file
+// implementations fill in the timing, status and script output, ExecuteAnalysis does the rest
+type AnalysisRunner interface {
+	Run(ctx context.Context, req AnalysisRequest) (*DescriptiveAnalysisMetadata, error)
+}
+
+// ExecRunner starts a fresh interpreter process per analysis (pays startup every time, but nothing is shared between runs)
+// the script is called as <Executable> <Args...> <script> <input> <output> [--key=value...] whatever the language
+type ExecRunner struct {
+	Executable string
+	Args       []string // interpreter flags before the script path
+	// "R", "Python", ... for log and error messages
+	Language string
+	// pulls the useful part out of stderr for the failure message, nil keeps the last lines
+	ExtractError func(stderr string) string
+	Timeout      time.Duration
+	Logger       *slog.Logger // nil for slog.Default()
+}
+
+// NewRRunner runs scripts with Rscript
+func NewRRunner(rExecutable string, timeout time.Duration, logger *slog.Logger) *ExecRunner {
+	return &ExecRunner{Executable: rExecutable, Language: "R", ExtractError: extractRError, Timeout: timeout, Logger: logger}
+}
+
+// NewPythonRunner runs scripts with python, unbuffered so output is logged as it's printed
+func NewPythonRunner(pythonExecutable string, timeout time.Duration, logger *slog.Logger) *ExecRunner {
+	return &ExecRunner{Executable: pythonExecutable, Args: []string{"-u"}, Language: "Python", ExtractError: extractPythonError, Timeout: timeout, Logger: logger}
+}
+
+func (r *ExecRunner) Run(ctx context.Context, req AnalysisRequest) (*DescriptiveAnalysisMetadata, error) {
+	//Running the script through cmd line -
+	startTime := time.Now()
+	timeout := r.Timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	inputArg := req.FilePath
+	if req.Input != nil {
+		inputArg = "-"
+	}
+	args := append(append([]string{}, r.Args...), req.ScriptPath, inputArg, req.OutputFile)
+	args = append(args, req.Args...)
+	cmd := exec.CommandContext(ctx, r.Executable, args...)
+	cmd.Stdin = req.Input
+
+	logger := r.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With(slog.String("analysis_id", req.AnalysisID))
+
+	// logged line by line as R runs, and captured in full for the metadata / failure message
+	stdout := newLineLogger(logger.With(slog.String("stream", "stdout")), r.Language+" output")
+	stderr := newLineLogger(logger.With(slog.String("stream", "stderr")), r.Language+" output")
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := runWithTimeout(ctx, cmd)
+	endTime := time.Now()
+	stdout.Flush()
+	stderr.Flush()
+
+	if err != nil {
+		// the full stderr was already logged and goes to a file next to the output, the event only carries the error itself
+		logger.Error(r.Language+" script execution failed", slog.Any("error", err))
+		errorMsg := fmt.Sprintf("%s script execution failed: %v", r.Language, err)
+		extract := r.ExtractError
+		if extract == nil {
+			extract = tailLines
+		}
+		if scriptErr := extract(stderr.String()); scriptErr != "" {
+			errorMsg += ": " + scriptErr
+		}
+
+		result := createFailedResult(req.AnalysisID, req.FilePath, errorMsg)
+		// uploaded with the failed analysis, they're usually the only explanation of what went wrong
+		result.LogFiles = writeLogFiles(logger, req.OutputFile, map[string][]byte{"stdout": stdout.Bytes(), "stderr": stderr.Bytes()})
+		return result, err
+	}
+
+	// the full output goes to log files uploaded next to the report, only the end of it is kept in LogTails
+	// rOutput/rStderr for R, pythonOutput/pythonStderr for Python - warnings end up in stderr
+	prefix := strings.ToLower(r.Language)
+	result := &DescriptiveAnalysisMetadata{
+		AnalysisID: req.AnalysisID,
+		FilePath:   req.FilePath,
+		Status:     "success",
+		OutputPath: req.OutputFile,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Duration:   endTime.Sub(startTime),
+		Metadata: map[string]string{
+			"backend": "exec",
+		},
+		LogFiles: writeLogFiles(logger, req.OutputFile, map[string][]byte{"stdout": stdout.Bytes(), "stderr": stderr.Bytes()}),
+		LogTails: map[string]string{prefix + "Output": logTail(stdout.String())},
+	}
+	if tail := logTail(stderr.String()); tail != "" {
+		result.LogTails[prefix+"Stderr"] = tail
+	}
+	return result, nil
+}
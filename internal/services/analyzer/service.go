@@ -2,9 +2,11 @@
 package analyzer
 
 import (
-	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"path/filepath"
+	"strings"
+	"watchrabbit/internal/services/redact"
 )
 
 // ResultData represents the output of an analysis
@@ -29,22 +31,26 @@ func NewService() *Service {
 // Analyze performs analysis on a biomarker file
 func (s *Service) Analyze(filePath string) (*ResultData, error) {
 	// Get file extension to determine file type
-	ext := filepath.Ext(filePath)
+	ext := strings.ToLower(filepath.Ext(filePath))
 	
 	switch ext {
 	case ".csv":
 		return s.analyzeCSV(filePath)
 	case ".sas7bdat":
 		return s.analyzeSAS(filePath)
+	case ".xlsx":
+		return s.analyzeExcel(filePath)
+	case ".parquet":
+		return s.analyzeParquet(filePath)
 	default:
-		return nil, errors.New("unsupported file type: " + ext)
+		return nil, fmt.Errorf("unsupported file type %q (supported: .csv, .sas7bdat, .xlsx, .parquet)", ext)
 	}
 }
 
 // analyzeCSV analyzes CSV files
 func (s *Service) analyzeCSV(filePath string) (*ResultData, error) {
 	// TODO: Implement CSV analysis
-	log.Printf("Analyzing CSV file: %s", filePath)
+	slog.Info("Analyzing CSV file", slog.String("file_path", redact.Path(filePath)))
 	
 	// Placeholder for actual implementation
 	result := &ResultData{
@@ -64,7 +70,7 @@ func (s *Service) analyzeCSV(filePath string) (*ResultData, error) {
 // analyzeSAS analyzes SAS7BDAT files
 func (s *Service) analyzeSAS(filePath string) (*ResultData, error) {
 	// TODO: Implement SAS7BDAT analysis
-	log.Printf("Analyzing SAS file: %s", filePath)
+	slog.Info("Analyzing SAS file", slog.String("file_path", redact.Path(filePath)))
 	
 	// Placeholder for actual implementation
 	result := &ResultData{
@@ -81,6 +87,46 @@ func (s *Service) analyzeSAS(filePath string) (*ResultData, error) {
 	return result, nil
 }
 
+// analyzeExcel analyzes XLSX workbooks (first sheet)
+func (s *Service) analyzeExcel(filePath string) (*ResultData, error) {
+	// TODO: Implement XLSX analysis
+	slog.Info("Analyzing Excel file", slog.String("file_path", redact.Path(filePath)))
+	
+	// Placeholder for actual implementation
+	result := &ResultData{
+		FilePath:    filePath,
+		AnalysisID:  generateAnalysisID(filePath),
+		ContentType: "text/html",
+		Data:        []byte("<html><body><h1>Excel Analysis Results</h1><p>Placeholder</p></body></html>"),
+		Metadata: map[string]interface{}{
+			"fileType": "xlsx",
+			"status":   "completed",
+		},
+	}
+	
+	return result, nil
+}
+
+// analyzeParquet analyzes Parquet files
+func (s *Service) analyzeParquet(filePath string) (*ResultData, error) {
+	// TODO: Implement Parquet analysis
+	slog.Info("Analyzing Parquet file", slog.String("file_path", redact.Path(filePath)))
+	
+	// Placeholder for actual implementation
+	result := &ResultData{
+		FilePath:    filePath,
+		AnalysisID:  generateAnalysisID(filePath),
+		ContentType: "text/html",
+		Data:        []byte("<html><body><h1>Parquet Analysis Results</h1><p>Placeholder</p></body></html>"),
+		Metadata: map[string]interface{}{
+			"fileType": "parquet",
+			"status":   "completed",
+		},
+	}
+	
+	return result, nil
+}
+
 // generateAnalysisID creates a unique identifier for an analysis
 func generateAnalysisID(filePath string) string {
 	// TODO: Implement a better ID generation strategy
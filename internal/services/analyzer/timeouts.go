@@ -0,0 +1,40 @@
+// internal/services/analyzer/timeouts.go
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parses DescriptiveConfig.Timeouts, keys are analysis types or input extensions (starting with a dot)
+func newTimeoutOverrides(overrides map[string]int) (map[string]time.Duration, error) {
+	resolved := make(map[string]time.Duration, len(overrides))
+	for key, seconds := range overrides {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if seconds <= 0 {
+			return nil, fmt.Errorf("invalid timeout %d for %s (seconds, must be greater than 0)", seconds, key)
+		}
+		// extensions match case-insensitively, like the registry's file types
+		if strings.HasPrefix(key, ".") {
+			key = strings.ToLower(key)
+		}
+		resolved[key] = time.Duration(seconds) * time.Second
+	}
+	return resolved, nil
+}
+
+// timeoutFor is the limit on one script run: an override for the analysis type wins (the script decides most of the
+// run time), then one for the input's extension, then the default Timeout
+func (s *DescriptiveService) timeoutFor(analysisType, fileExt string) time.Duration {
+	if timeout, ok := s.timeouts[analysisType]; ok {
+		return timeout
+	}
+	if timeout, ok := s.timeouts[strings.ToLower(fileExt)]; ok {
+		return timeout
+	}
+	return time.Duration(s.Timeout) * time.Second
+}
@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutFor(t *testing.T) {
+	timeouts, err := newTimeoutOverrides(map[string]int{
+		"qc":        60,
+		".SAS7BDAT": 1800,
+		".parquet":  900,
+		" ":         5, // blank keys are dropped
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeouts) != 3 {
+		t.Fatalf("%d overrides, want 3", len(timeouts))
+	}
+	service := &DescriptiveService{Timeout: 300, timeouts: timeouts}
+
+	tests := []struct {
+		name         string
+		analysisType string
+		fileExt      string
+		want         time.Duration
+	}{
+		{"analysis type override", "qc", ".csv", time.Minute},
+		// the analysis type wins over the extension
+		{"analysis type over extension", "qc", ".sas7bdat", time.Minute},
+		{"extension override", DefaultAnalysisType, ".sas7bdat", 30 * time.Minute},
+		{"extension matched case-insensitively", DefaultAnalysisType, ".Parquet", 15 * time.Minute},
+		{"fallback to the default", DefaultAnalysisType, ".csv", 5 * time.Minute},
+		{"fallback without an extension", "", "", 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.timeoutFor(tt.analysisType, tt.fileExt); got != tt.want {
+				t.Errorf("timeoutFor(%q, %q) = %v, want %v", tt.analysisType, tt.fileExt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutForWithoutOverrides(t *testing.T) {
+	service := &DescriptiveService{Timeout: 120}
+	if got := service.timeoutFor("qc", ".sas7bdat"); got != 2*time.Minute {
+		t.Errorf("timeoutFor = %v, want the 2m default", got)
+	}
+}
+
+func TestNewTimeoutOverridesRejectsNonPositive(t *testing.T) {
+	for _, seconds := range []int{0, -30} {
+		if _, err := newTimeoutOverrides(map[string]int{"qc": seconds}); err == nil || !strings.Contains(err.Error(), "qc") {
+			t.Errorf("newTimeoutOverrides(qc=%d) = %v, want an error naming qc", seconds, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// internal/services/analyzer/validate.go
+package analyzer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// status for reports that rendered but failed output validation in warn mode
+const StatusSuccessWithWarnings = "success_with_warnings"
+
+// OutputValidation catches "successful" R runs that rendered an empty or broken report (e.g. a data issue
+// blanking every section), which the output file existing doesn't tell us
+type OutputValidation struct {
+	Enabled  bool
+	MinBytes int64  // reports smaller than this are treated as empty
+	Marker   string // text the script always emits in a real report, e.g. id="watchrabbit-report" (empty skips the check)
+	WarnOnly bool   // mark the analysis success_with_warnings instead of failing it
+}
+
+var errInvalidOutput = errors.New("invalid report output")
+
+// leading bytes of binary outputs, a script that wrote e.g. an html error page under a .pdf name fails here
+var outputSignatures = map[string][]byte{
+	"application/pdf": []byte("%PDF-"),
+	"image/png":       []byte("\x89PNG"),
+}
+
+// verifyPrimaryOutput checks the output is non-empty and, for types with a known signature, starts with it
+func verifyPrimaryOutput(path, contentType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidOutput, err)
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("%w: %v", errInvalidOutput, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s output is empty", errInvalidOutput, contentType)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	if signature, ok := outputSignatures[mediaType]; ok && !bytes.HasPrefix(header[:n], signature) {
+		return fmt.Errorf("%w: output doesn't look like %s", errInvalidOutput, mediaType)
+	}
+	return nil
+}
+
+// validateHTMLOutput checks size, the marker, and that the document parses through to a closing </html>
+// with some text in the body (a render cut off part way has no closing tag)
+func validateHTMLOutput(path string, v OutputValidation) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidOutput, err)
+	}
+	if int64(len(data)) < v.MinBytes {
+		return fmt.Errorf("%w: report is %d bytes, expected at least %d", errInvalidOutput, len(data), v.MinBytes)
+	}
+	if v.Marker != "" && !bytes.Contains(data, []byte(v.Marker)) {
+		return fmt.Errorf("%w: report is missing the %q marker", errInvalidOutput, v.Marker)
+	}
+
+	var inBody, sawBody, sawHTMLEnd, hasText bool
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			if err := tokenizer.Err(); err != io.EOF {
+				return fmt.Errorf("%w: %v", errInvalidOutput, err)
+			}
+			break
+		}
+
+		switch tt {
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "body" {
+				inBody, sawBody = true, true
+			}
+		case html.EndTagToken:
+			switch name, _ := tokenizer.TagName(); string(name) {
+			case "body":
+				inBody = false
+			case "html":
+				sawHTMLEnd = true
+			}
+		case html.TextToken:
+			if inBody && strings.TrimSpace(string(tokenizer.Text())) != "" {
+				hasText = true
+			}
+		}
+	}
+
+	switch {
+	case !sawBody:
+		return fmt.Errorf("%w: report has no <body>", errInvalidOutput)
+	case !sawHTMLEnd:
+		return fmt.Errorf("%w: report ends without </html>, likely truncated", errInvalidOutput)
+	case !hasText:
+		return fmt.Errorf("%w: report body has no text", errInvalidOutput)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validReport = `<!DOCTYPE html>
+<html>
+<head><title>Descriptive statistics</title></head>
+<body>
+<div id="watchrabbit-report">
+<h1>labs.csv</h1>
+<table><tr><th>variable</th><th>mean</th></tr><tr><td>ldl</td><td>3.2</td></tr></table>
+</div>
+</body>
+</html>
+`
+
+func writeReport(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateHTMLOutput(t *testing.T) {
+	validation := OutputValidation{Enabled: true, MinBytes: 100, Marker: `id="watchrabbit-report"`}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: validReport},
+		{name: "empty file", content: "", wantErr: "0 bytes"},
+		{name: "under the size floor", content: `<html><body>x</body></html>`, wantErr: "expected at least 100"},
+		{name: "missing marker", content: strings.Replace(validReport, `id="watchrabbit-report"`, `id="other"`, 1), wantErr: "marker"},
+		{name: "truncated mid-render", content: validReport[:strings.Index(validReport, "</table>")], wantErr: "without </html>"},
+		{name: "no body", content: `<html><head><title>` + strings.Repeat("x", 100) + `</title><meta id="watchrabbit-report"></head></html>`, wantErr: "no <body>"},
+		{name: "blank body", content: `<html><head><title>` + strings.Repeat("x", 100) + `</title></head><body><div id="watchrabbit-report">   </div></body></html>`, wantErr: "no text"},
+		{name: "not html", content: strings.Repeat("Error in rmarkdown::render(): pandoc not found\n", 3) + `id="watchrabbit-report"`, wantErr: "no <body>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHTMLOutput(writeReport(t, tt.content), validation)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateHTMLOutput = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, errInvalidOutput) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateHTMLOutput = %v, want errInvalidOutput mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHTMLOutputOptionalChecks(t *testing.T) {
+	// no floor and no marker, only the structure is checked
+	if err := validateHTMLOutput(writeReport(t, `<html><body>ok</body></html>`), OutputValidation{Enabled: true}); err != nil {
+		t.Errorf("validateHTMLOutput = %v, want nil without a size floor or marker", err)
+	}
+}
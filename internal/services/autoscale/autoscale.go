@@ -0,0 +1,142 @@
+// internal/services/autoscale/autoscale.go
+package autoscale
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"time"
+	"watchrabbit/pkg/messaging"
+)
+
+// Policy decides how many consumers a queue should have from its depth
+type Policy struct {
+	Min int
+	Max int
+	// add a consumer while there are more than this many ready messages per consumer
+	ScaleUpDepth int
+	// drop a consumer once the queue holds this many messages or fewer
+	ScaleDownDepth int
+}
+
+// NewPolicy clamps the configured bounds to something usable on this host
+// R is CPU bound, so more consumers than CPUs just makes every analysis slower
+func NewPolicy(min, max, scaleUpDepth, scaleDownDepth int) Policy {
+	if min < 1 {
+		min = 1
+	}
+	if cpus := runtime.NumCPU(); max > cpus {
+		max = cpus
+	}
+	if max < min {
+		max = min
+	}
+	if scaleUpDepth < 1 {
+		scaleUpDepth = 1
+	}
+	if scaleDownDepth < 0 {
+		scaleDownDepth = 0
+	}
+	return Policy{Min: min, Max: max, ScaleUpDepth: scaleUpDepth, ScaleDownDepth: scaleDownDepth}
+}
+
+// Desired returns the consumer count for the next interval
+// moves by at most one per call so a single spike doesn't launch a burst of R processes
+func (p Policy) Desired(current, depth int) int {
+	desired := current
+	switch {
+	case depth > current*p.ScaleUpDepth:
+		desired = current + 1
+	case depth <= p.ScaleDownDepth:
+		desired = current - 1
+	}
+
+	if desired < p.Min {
+		desired = p.Min
+	}
+	if desired > p.Max {
+		desired = p.Max
+	}
+	return desired
+}
+
+// Scaler starts and stops consumers on a queue as its depth changes
+type Scaler struct {
+	client    *messaging.RabbitMQClient
+	queue     string
+	policy    Policy
+	interval  time.Duration
+	subscribe func(ctx context.Context) error
+	// one cancel per running consumer, newest last
+	consumers []context.CancelFunc
+}
+
+// NewScaler calls subscribe once per consumer it wants, cancelling the ctx it passed stops that consumer
+func NewScaler(client *messaging.RabbitMQClient, queue string, policy Policy, interval time.Duration, subscribe func(ctx context.Context) error) *Scaler {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	return &Scaler{
+		client:    client,
+		queue:     queue,
+		policy:    policy,
+		interval:  interval,
+		subscribe: subscribe,
+	}
+}
+
+// Run starts the minimum number of consumers and rescales every interval until ctx is done
+func (s *Scaler) Run(ctx context.Context) error {
+	if err := s.scaleTo(ctx, s.policy.Min); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		statsCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		stats, err := s.client.QueueStats(statsCtx, s.queue)
+		cancel()
+		if err != nil {
+			// keep the current consumers, we'll try again next tick
+			log.Printf("Autoscaler couldn't read %s depth: %v", s.queue, err)
+			continue
+		}
+
+		current := len(s.consumers)
+		desired := s.policy.Desired(current, stats.Messages)
+		if desired == current {
+			continue
+		}
+
+		log.Printf("Scaling %s consumers %d -> %d (queue depth %d)", s.queue, current, desired, stats.Messages)
+		if err := s.scaleTo(ctx, desired); err != nil {
+			log.Printf("Failed to scale %s consumers: %v", s.queue, err)
+		}
+	}
+}
+
+func (s *Scaler) scaleTo(ctx context.Context, n int) error {
+	for len(s.consumers) < n {
+		consumerCtx, cancel := context.WithCancel(ctx)
+		if err := s.subscribe(consumerCtx); err != nil {
+			cancel()
+			return err
+		}
+		s.consumers = append(s.consumers, cancel)
+	}
+	// cancelled consumers finish the message they're handling before exiting
+	for len(s.consumers) > n {
+		last := len(s.consumers) - 1
+		s.consumers[last]()
+		s.consumers = s.consumers[:last]
+	}
+	return nil
+}
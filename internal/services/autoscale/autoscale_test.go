@@ -0,0 +1,59 @@
+package autoscale
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestPolicyDesired(t *testing.T) {
+	policy := Policy{Min: 1, Max: 4, ScaleUpDepth: 10, ScaleDownDepth: 2}
+
+	tests := []struct {
+		name    string
+		current int
+		depth   int
+		want    int
+	}{
+		{"backlog adds one consumer", 1, 11, 2},
+		{"big spike still adds only one", 1, 1000, 2},
+		{"at the threshold stays put", 2, 20, 2},
+		{"between thresholds stays put", 2, 5, 2},
+		{"drained queue drops one", 3, 2, 2},
+		{"empty queue drops one", 3, 0, 2},
+		{"never below min", 1, 0, 1},
+		{"never above max", 4, 1000, 4},
+		{"below min after a restart is raised", 0, 5, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Desired(tt.current, tt.depth); got != tt.want {
+				t.Errorf("Desired(%d, %d) = %d, want %d", tt.current, tt.depth, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyClampsBounds(t *testing.T) {
+	cpus := runtime.NumCPU()
+
+	tests := []struct {
+		name               string
+		min, max, up, down int
+		want               Policy
+	}{
+		{"usable values kept", 1, 1, 5, 0, Policy{Min: 1, Max: 1, ScaleUpDepth: 5, ScaleDownDepth: 0}},
+		{"min at least one", 0, 1, 5, 0, Policy{Min: 1, Max: 1, ScaleUpDepth: 5, ScaleDownDepth: 0}},
+		{"max capped at cpus", 1, cpus + 8, 5, 0, Policy{Min: 1, Max: cpus, ScaleUpDepth: 5, ScaleDownDepth: 0}},
+		{"max raised to min", 1, 0, 5, 0, Policy{Min: 1, Max: 1, ScaleUpDepth: 5, ScaleDownDepth: 0}},
+		{"depths kept sane", 1, 1, 0, -3, Policy{Min: 1, Max: 1, ScaleUpDepth: 1, ScaleDownDepth: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPolicy(tt.min, tt.max, tt.up, tt.down); got != tt.want {
+				t.Errorf("NewPolicy = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var analysisColumns = []string{
+	"analysis_id", "analysis_uuid", "file_id", "analysis_type", "status", "sequence", "started_at", "completed_at",
+	"duration_ms", "error_message", "created_by", "metadata",
+}
+
+// fakeAnalyses is biomarker.analyses plus the update_analysis_status function, enough for create/status round trips
+type fakeAnalyses struct {
+	rows      map[string][]driver.Value // analysis uuid -> row in analysisColumns order
+	sequences map[int64]int64           // file id -> biomarker.files.analysis_seq
+}
+
+func (f *fakeAnalyses) respond(query string, args []driver.NamedValue) (*fakeRows, error) {
+	uuid := args[0].Value.(string)
+	row, ok := f.rows[uuid]
+
+	switch {
+	case strings.Contains(query, "INSERT INTO biomarker.analyses"):
+		fileID := args[1].Value.(int64)
+		f.sequences[fileID]++
+		analysisID := int64(len(f.rows) + 1)
+		f.rows[uuid] = []driver.Value{analysisID, uuid, fileID, args[2].Value, args[3].Value, f.sequences[fileID],
+			nil, nil, nil, "", args[4].Value, args[5].Value}
+		return &fakeRows{columns: []string{"analysis_id"}, values: [][]driver.Value{{analysisID}}}, nil
+	case strings.Contains(query, "biomarker.update_analysis_status"):
+		if !ok {
+			return nil, &pq.Error{Code: "P0001", Message: fmt.Sprintf("analysis %s not found", uuid)}
+		}
+		status := args[1].Value.(string)
+		row[4], row[9] = status, args[2].Value.(string)
+		now := time.Now()
+		if status == AnalysisStatusRunning && row[6] == nil {
+			row[6] = now
+		}
+		if status != AnalysisStatusRunning && status != AnalysisStatusPending {
+			row[7] = now
+			if started, ok := row[6].(time.Time); ok {
+				row[8] = now.Sub(started).Milliseconds()
+			}
+		}
+		return &fakeRows{values: [][]driver.Value{{}}}, nil
+	case strings.Contains(query, "FROM biomarker.analyses"):
+		if !ok {
+			return &fakeRows{columns: analysisColumns}, nil
+		}
+		return &fakeRows{columns: analysisColumns, values: [][]driver.Value{row}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+func newFakeAnalyses(t *testing.T) (*PostgresService, *fakeAnalyses) {
+	t.Helper()
+	analyses := &fakeAnalyses{sequences: map[int64]int64{3: 2}, rows: map[string][]driver.Value{
+		"6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c": {int64(7), "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c", int64(3), "descriptive",
+			AnalysisStatusPending, int64(2), nil, nil, nil, "", "file-watcher", []byte(`{"input_checksum":"abc123"}`)},
+	}}
+	return newFakeService(t, &fakeDB{respond: analyses.respond}), analyses
+}
+
+func TestUpdateAnalysisStatusRunningToFailed(t *testing.T) {
+	service, _ := newFakeAnalyses(t)
+	ctx := context.Background()
+	const uuid = "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c"
+
+	if err := service.UpdateAnalysisStatus(ctx, uuid, AnalysisStatusRunning, ""); err != nil {
+		t.Fatal(err)
+	}
+	running, err := service.GetAnalysisRecordByUUID(ctx, uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running.Status != AnalysisStatusRunning || running.StartedAt == nil || running.CompletedAt != nil {
+		t.Fatalf("after running: %+v", running)
+	}
+
+	const message = "Error in read.csv(input_file) : more columns than column names"
+	if err := service.UpdateAnalysisStatus(ctx, uuid, AnalysisStatusFailed, message); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := service.GetAnalysisRecordByUUID(ctx, uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != AnalysisStatusFailed || failed.ErrorMessage != message {
+		t.Errorf("status %q, error %q, want failed with %q", failed.Status, failed.ErrorMessage, message)
+	}
+	if failed.CompletedAt == nil || failed.DurationMs == nil {
+		t.Errorf("failed analysis has completed_at %v and duration %v, want both set", failed.CompletedAt, failed.DurationMs)
+	}
+	if !failed.StartedAt.Equal(*running.StartedAt) {
+		t.Errorf("started_at moved from %v to %v", running.StartedAt, failed.StartedAt)
+	}
+}
+
+func TestUpdateAnalysisStatusUnknownAnalysis(t *testing.T) {
+	service, _ := newFakeAnalyses(t)
+
+	err := service.UpdateAnalysisStatus(context.Background(), "00000000-0000-0000-0000-000000000000", AnalysisStatusFailed, "boom")
+	if err == nil || !strings.Contains(err.Error(), "failed to update analysis status") || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("UpdateAnalysisStatus = %v, want a not found error", err)
+	}
+}
+
+func TestGetAnalysisRecordByUUID(t *testing.T) {
+	service, _ := newFakeAnalyses(t)
+	ctx := context.Background()
+
+	// file 3 already has an analysis, so this one is its second
+	analysisUUID, err := service.CreateAnalysisRecord(ctx, 3, "qc", AnalysisStatusPending, "api:ops", map[string]string{"input_checksum": "def456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := service.GetAnalysisRecordByUUID(ctx, analysisUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("GetAnalysisRecordByUUID = nil, want the created analysis")
+	}
+	if got.AnalysisUUID != analysisUUID || got.AnalysisID == 0 || got.FileID != 3 || got.AnalysisType != "qc" ||
+		got.Status != AnalysisStatusPending || got.CreatedBy != "api:ops" {
+		t.Errorf("analysis = %+v", got)
+	}
+	if got.Sequence == nil || *got.Sequence != 3 {
+		t.Errorf("sequence = %v, want 3", got.Sequence)
+	}
+	if got.StartedAt != nil || got.CompletedAt != nil || got.DurationMs != nil {
+		t.Errorf("pending analysis has timings: %v %v %v", got.StartedAt, got.CompletedAt, got.DurationMs)
+	}
+	if got.MetadataMap["input_checksum"] != "def456" {
+		t.Errorf("metadata = %v, want input_checksum def456", got.MetadataMap)
+	}
+
+	missing, err := service.GetAnalysisRecordByUUID(ctx, "00000000-0000-0000-0000-000000000000")
+	if err != nil || missing != nil {
+		t.Errorf("unknown uuid = %+v, %v, want nil, nil", missing, err)
+	}
+}
+
+func TestGetAnalysisRecordByUUIDBadMetadata(t *testing.T) {
+	service, analyses := newFakeAnalyses(t)
+	const uuid = "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c"
+	analyses.rows[uuid][11] = []byte(`{"attempts": 2}`)
+
+	if _, err := service.GetAnalysisRecordByUUID(context.Background(), uuid); err == nil {
+		t.Error("GetAnalysisRecordByUUID with non-string metadata = nil error")
+	}
+}
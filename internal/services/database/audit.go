@@ -0,0 +1,105 @@
+// internal/services/database/audit.go
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one row of biomarker.audit_log - one per message handled by a worker
+type AuditEntry struct {
+	Queue      string        `db:"queue" json:"queue"`
+	MessageID  string        `db:"message_id" json:"message_id"`
+	WorkerID   string        `db:"worker_id" json:"worker_id"`
+	Outcome    string        `db:"outcome" json:"outcome"`
+	Error      string        `db:"error" json:"error,omitempty"`
+	Duration   time.Duration `db:"-" json:"-"`
+	ReceivedAt time.Time     `db:"received_at" json:"received_at"`
+}
+
+func (p *PostgresService) InsertAuditEntry(ctx context.Context, entry AuditEntry) error {
+	query := `
+	INSERT INTO biomarker.audit_log (queue, message_id, worker_id, outcome, error, duration_ms, received_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := p.db.ExecContext(ctx, query, entry.Queue, entry.MessageID, entry.WorkerID,
+		entry.Outcome, entry.Error, entry.Duration.Milliseconds(), entry.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %v", err)
+	}
+	return nil
+}
+
+// AuditLogger writes audit entries in the background so auditing never blocks message processing
+// entries are dropped (and logged) if the database falls too far behind
+type AuditLogger struct {
+	db      *PostgresService
+	entries chan AuditEntry
+	wg      sync.WaitGroup
+
+	// guards entries against a Log racing Close during shutdown
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAuditLogger(db *PostgresService, bufferSize int) *AuditLogger {
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+
+	a := &AuditLogger{
+		db:      db,
+		entries: make(chan AuditEntry, bufferSize),
+	}
+
+	a.wg.Add(1)
+	go a.run()
+
+	return a
+}
+
+// Log queues an entry without blocking, entries logged after Close are dropped
+func (a *AuditLogger) Log(entry AuditEntry) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		a.db.logger.Warn("Audit logger closed, dropping entry", slog.String("message_id", entry.MessageID), slog.String("queue", entry.Queue))
+		return
+	}
+
+	select {
+	case a.entries <- entry:
+	default:
+		a.db.logger.Warn("Audit log buffer full, dropping entry", slog.String("message_id", entry.MessageID), slog.String("queue", entry.Queue))
+	}
+}
+
+func (a *AuditLogger) run() {
+	defer a.wg.Done()
+	for entry := range a.entries {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := a.db.InsertAuditEntry(ctx, entry); err != nil {
+			a.db.logger.Error("Failed to write audit entry", slog.String("message_id", entry.MessageID), slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// Close flushes queued entries
+func (a *AuditLogger) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.entries)
+	a.mu.Unlock()
+
+	a.wg.Wait()
+}
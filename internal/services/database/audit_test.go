@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditLoggerWritesOneRowPerMessage(t *testing.T) {
+	var mu sync.Mutex
+	inserted := map[string]int{}
+	db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+		if strings.Contains(query, "INSERT INTO biomarker.audit_log") {
+			mu.Lock()
+			inserted[args[1].Value.(string)]++
+			mu.Unlock()
+		}
+		return &fakeRows{}, nil
+	}}
+	auditLogger := NewAuditLogger(newFakeService(t, db), 10)
+
+	ids := []string{"msg-1", "msg-2", "msg-3", "msg-4"}
+	for _, id := range ids {
+		auditLogger.Log(AuditEntry{
+			Queue:      "analysis.requested",
+			MessageID:  id,
+			WorkerID:   "worker-1",
+			Outcome:    "acked",
+			Duration:   120 * time.Millisecond,
+			ReceivedAt: time.Now(),
+		})
+	}
+	auditLogger.Close()
+
+	if len(inserted) != len(ids) {
+		t.Fatalf("audit rows for %d messages, want %d: %v", len(inserted), len(ids), inserted)
+	}
+	for _, id := range ids {
+		if inserted[id] != 1 {
+			t.Errorf("%s has %d audit rows, want 1", id, inserted[id])
+		}
+	}
+
+	// entries after Close are dropped rather than written or panicking on a closed channel
+	auditLogger.Log(AuditEntry{MessageID: "late"})
+	if inserted["late"] != 0 {
+		t.Error("entry logged after Close was written")
+	}
+}
+
+func TestInsertAuditEntryArgs(t *testing.T) {
+	var got []driver.NamedValue
+	db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+		got = args
+		return &fakeRows{}, nil
+	}}
+	service := newFakeService(t, db)
+
+	receivedAt := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	err := service.InsertAuditEntry(t.Context(), AuditEntry{
+		Queue:      "analysis.requested",
+		MessageID:  "msg-1",
+		WorkerID:   "worker-1",
+		Outcome:    "rejected",
+		Error:      "denied file",
+		Duration:   1500 * time.Millisecond,
+		ReceivedAt: receivedAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []driver.Value{"analysis.requested", "msg-1", "worker-1", "rejected", "denied file", int64(1500), receivedAt}
+	if len(got) != len(want) {
+		t.Fatalf("got %d args, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Value != want[i] {
+			t.Errorf("arg %d = %v, want %v", i+1, got[i].Value, want[i])
+		}
+	}
+}
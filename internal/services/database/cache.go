@@ -0,0 +1,55 @@
+// internal/services/database/cache.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// analysis metadata key holding the sha256 of the input file, written when the analysis is created
+const InputChecksumKey = "input_checksum"
+
+// analysis statuses written by the worker
+const (
+	AnalysisStatusPending   = "pending" // recorded, waiting for a slot or its input
+	AnalysisStatusRunning   = "running"
+	AnalysisStatusCompleted = "completed" // finished and has results
+	AnalysisStatusFailed    = "failed"
+)
+
+// CachedResult is an earlier completed analysis of byte-identical input
+type CachedResult struct {
+	AnalysisUUID string    `db:"analysis_uuid"`
+	StorageType  string    `db:"storage_type"`
+	StorageKey   string    `db:"storage_key"`
+	CompletedAt  time.Time `db:"completed_at"`
+}
+
+// FindCachedResult returns the most recent completed analysis of the given type whose input had this checksum,
+// or nil if there isn't one
+func (p *PostgresService) FindCachedResult(ctx context.Context, inputChecksum, analysisType string) (*CachedResult, error) {
+	query := `
+		SELECT a.analysis_uuid, r.storage_type, r.storage_key, COALESCE(a.completed_at, a.created_at) AS completed_at
+		FROM biomarker.analyses a
+		JOIN biomarker.results r ON r.analysis_id = a.analysis_id
+		WHERE a.metadata->>'input_checksum' = $1
+		AND a.analysis_type = $2
+		AND a.status = $3
+		AND r.result_type <> $4
+		ORDER BY a.completed_at DESC NULLS LAST, r.result_id
+		LIMIT 1
+	`
+
+	var cached CachedResult
+	err := p.db.GetContext(ctx, &cached, query, inputChecksum, analysisType, AnalysisStatusCompleted, ResultTypeLog)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up cached result: %v", err)
+	}
+	return &cached, nil
+}
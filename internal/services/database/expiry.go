@@ -0,0 +1,67 @@
+// internal/services/database/expiry.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MarkResultExpired records that a result's stored object no longer exists, marking twice keeps the first time
+func (p *PostgresService) MarkResultExpired(ctx context.Context, resultID int64) error {
+	query := `
+		UPDATE biomarker.results
+		SET expired_at = NOW()
+		WHERE result_id = $1 AND expired_at IS NULL
+	`
+	if _, err := p.db.ExecContext(ctx, query, resultID); err != nil {
+		return fmt.Errorf("failed to mark result %d expired: %v", resultID, err)
+	}
+	return nil
+}
+
+// ListLiveResults pages through results not yet marked expired, in result_id order starting after afterID
+func (p *PostgresService) ListLiveResults(ctx context.Context, storageType string, afterID int64, limit int) ([]ResultRecord, error) {
+	query := `
+		SELECT result_id, analysis_id, result_type, storage_type, storage_key, content_type,
+		size_bytes, COALESCE(checksum, '') AS checksum, created_at, expired_at, metadata
+		FROM biomarker.results
+		WHERE storage_type = $1 AND expired_at IS NULL AND result_id > $2
+		ORDER BY result_id
+		LIMIT $3
+	`
+
+	var results []ResultRecord
+	if err := p.db.SelectContext(ctx, &results, query, storageType, afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list live results: %v", err)
+	}
+	return results, nil
+}
+
+// GetResultRecordByStorageKey returns the result stored under key, nil if there is none
+func (p *PostgresService) GetResultRecordByStorageKey(ctx context.Context, storageType, storageKey string) (*ResultRecord, error) {
+	query := `
+		SELECT result_id, analysis_id, result_type, storage_type, storage_key, content_type,
+		size_bytes, COALESCE(checksum, '') AS checksum, created_at, expired_at, metadata
+		FROM biomarker.results
+		WHERE storage_type = $1 AND storage_key = $2
+	`
+
+	var result ResultRecord
+	if err := p.db.GetContext(ctx, &result, query, storageType, storageKey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get result record: %v", err)
+	}
+
+	if result.Metadata != nil {
+		result.MetadataMap = make(map[string]string)
+		if err := json.Unmarshal(result.Metadata, &result.MetadataMap); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result metadata: %v", err)
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,63 @@
+// internal/services/database/export.go
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExportFilter narrows the analyses included in an export, zero values are ignored
+type ExportFilter = AnalysisFilter
+
+// AnalysisExportRow is one line of the analysis index export
+// StorageKey is the first result stored for the analysis (empty if it has none)
+type AnalysisExportRow struct {
+	AnalysisUUID string    `db:"analysis_uuid"`
+	FilePath     string    `db:"file_path"`
+	AnalysisType string    `db:"analysis_type"`
+	Status       string    `db:"status"`
+	DurationMs   *int64    `db:"duration_ms"`
+	CreatedAt    time.Time `db:"created_at"`
+	StorageKey   *string   `db:"storage_key"`
+}
+
+// ExportAnalyses streams matching analyses to fn one row at a time, oldest first,
+// so large date ranges never have to be held in memory
+func (p *PostgresService) ExportAnalyses(ctx context.Context, filter ExportFilter, fn func(AnalysisExportRow) error) error {
+	whereClause, args := filter.where()
+
+	query := `
+		SELECT a.analysis_uuid, f.file_path, a.analysis_type, a.status, a.duration_ms, a.created_at, r.storage_key
+		FROM biomarker.analyses a
+		JOIN biomarker.files f ON f.file_id = a.file_id
+		LEFT JOIN LATERAL (
+			SELECT storage_key FROM biomarker.results
+			WHERE analysis_id = a.analysis_id AND expired_at IS NULL AND result_type <> '` + ResultTypeLog + `'
+			ORDER BY result_id
+			LIMIT 1
+		) r ON true
+	` + whereClause + " ORDER BY a.created_at"
+
+	rows, err := p.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export analyses: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row AnalysisExportRow
+		if err := rows.StructScan(&row); err != nil {
+			return fmt.Errorf("failed to scan export row: %v", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read export rows: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB is a database/sql connector that answers statements through respond instead of Postgres and records
+// what it was asked, enough to test transaction handling and query counts without a server
+type fakeDB struct {
+	respond func(query string, args []driver.NamedValue) (*fakeRows, error)
+
+	mu        sync.Mutex
+	queries   []string
+	commits   int
+	rollbacks int
+}
+
+// a PostgresService on top of db, closed with the test
+func newFakeService(t *testing.T, db *fakeDB) *PostgresService {
+	t.Helper()
+	sqlDB := sql.OpenDB(db)
+	t.Cleanup(func() { sqlDB.Close() })
+	return &PostgresService{
+		db:     sqlx.NewDb(sqlDB, "postgres"),
+		newID:  func() string { return uuid.New().String() },
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (db *fakeDB) run(query string, args []driver.NamedValue) (*fakeRows, error) {
+	db.mu.Lock()
+	db.queries = append(db.queries, query)
+	db.mu.Unlock()
+	if db.respond == nil {
+		return &fakeRows{}, nil
+	}
+	return db.respond(query, args)
+}
+
+func (db *fakeDB) counts() (queries, commits, rollbacks int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return len(db.queries), db.commits, db.rollbacks
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake database doesn't prepare statements")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.run(query, args)
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows.values)), nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.rollbacks++
+	return nil
+}
+
+// fakeRows is a canned result set, values are in columns order
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+// fakeFileRow is the part of a biomarker.files row the upsert looks at
+type fakeFileRow struct {
+	id      int64
+	size    int64
+	removed bool
+}
+
+// fakeFiles answers GetOrCreateFileRecord the way the upsert on files_file_path_unique behaves
+type fakeFiles struct {
+	rows    map[string]*fakeFileRow // file_path -> row
+	nextID  int64
+	inserts int
+	updates int
+}
+
+func (f *fakeFiles) respond(query string, args []driver.NamedValue) (*fakeRows, error) {
+	if strings.Contains(query, "INSERT INTO biomarker.files") {
+		path, size := args[0].Value.(string), args[3].Value.(int64)
+		row, ok := f.rows[path]
+		switch {
+		case !ok:
+			f.nextID++
+			row = &fakeFileRow{id: f.nextID, size: size}
+			f.rows[path] = row
+			f.inserts++
+		case row.size != size || row.removed:
+			row.size, row.removed = size, false
+			f.updates++
+		default:
+			// the conflict's WHERE didn't match, nothing is returned
+			return &fakeRows{columns: []string{"file_id"}}, nil
+		}
+		return &fakeRows{columns: []string{"file_id"}, values: [][]driver.Value{{row.id}}}, nil
+	}
+
+	if strings.Contains(query, "SELECT file_id FROM biomarker.files") {
+		row, ok := f.rows[args[0].Value.(string)]
+		if !ok {
+			return &fakeRows{columns: []string{"file_id"}}, nil
+		}
+		return &fakeRows{columns: []string{"file_id"}, values: [][]driver.Value{{row.id}}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+func TestGetOrCreateFileRecordTwice(t *testing.T) {
+	const path = "/data/study1/labs.csv"
+
+	tests := []struct {
+		name        string
+		secondSize  int64
+		removed     bool
+		wantSize    int64
+		wantUpdates int
+	}{
+		{"unchanged file", 128, false, 128, 0},
+		{"file grew", 256, false, 256, 1},
+		{"removed file came back", 128, true, 128, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := &fakeFiles{rows: map[string]*fakeFileRow{}}
+			service := newFakeService(t, &fakeDB{respond: files.respond})
+			ctx := context.Background()
+
+			first, err := service.GetOrCreateFileRecord(ctx, path, 128, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files.rows[path].removed = tt.removed
+			second, err := service.GetOrCreateFileRecord(ctx, path, tt.secondSize, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if second != first {
+				t.Errorf("second call returned file_id %d, want %d", second, first)
+			}
+			if len(files.rows) != 1 || files.inserts != 1 {
+				t.Fatalf("%d rows from %d inserts, want 1", len(files.rows), files.inserts)
+			}
+			row := files.rows[path]
+			if row.size != tt.wantSize || row.removed {
+				t.Errorf("row = %+v, want size %d and not removed", *row, tt.wantSize)
+			}
+			if files.updates != tt.wantUpdates {
+				t.Errorf("updates = %d, want %d", files.updates, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestGetOrCreateFileRecordDistinctPaths(t *testing.T) {
+	files := &fakeFiles{rows: map[string]*fakeFileRow{}}
+	service := newFakeService(t, &fakeDB{respond: files.respond})
+	ctx := context.Background()
+
+	labs, err := service.GetOrCreateFileRecord(ctx, "/data/study1/labs.csv", 128, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vitals, err := service.GetOrCreateFileRecord(ctx, "/data/study1/vitals.csv", 128, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labs == vitals || len(files.rows) != 2 {
+		t.Errorf("file_ids %d and %d over %d rows, want two distinct rows", labs, vitals, len(files.rows))
+	}
+}
@@ -0,0 +1,53 @@
+// internal/services/database/filter.go
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnalysisFilter narrows analysis listings and exports, zero values are ignored
+type AnalysisFilter struct {
+	Status        string
+	AnalysisType  string
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+	// top-level key/value in the analysis metadata, e.g. study=ABC123 (nested keys aren't matched)
+	MetadataKey   string
+	MetadataValue string
+}
+
+// where builds the WHERE clause (empty when nothing is set) against the analyses table aliased as a,
+// placeholders are numbered from 1 in the order of the returned args
+func (f AnalysisFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Status != "" {
+		add("a.status = $%d", f.Status)
+	}
+	if f.AnalysisType != "" {
+		add("a.analysis_type = $%d", f.AnalysisType)
+	}
+	if !f.CreatedAfter.IsZero() {
+		add("a.created_at >= $%d", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		add("a.created_at < $%d", f.CreatedBefore)
+	}
+	if f.MetadataKey != "" {
+		// @> so the GIN index from migrations/0009_metadata_gin.sql applies
+		args = append(args, f.MetadataKey, f.MetadataValue)
+		conditions = append(conditions, fmt.Sprintf("a.metadata @> jsonb_build_object($%d::text, $%d::text)", len(args)-1, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
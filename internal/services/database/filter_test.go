@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListAnalysesPageFilters(t *testing.T) {
+	after := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		filter         AnalysisFilter
+		wantConditions []string
+		wantArgs       []driver.Value
+	}{
+		{
+			name:     "none set",
+			wantArgs: []driver.Value{int64(50), int64(0)},
+		},
+		{
+			name:           "analysis type",
+			filter:         AnalysisFilter{AnalysisType: "qc"},
+			wantConditions: []string{"a.analysis_type = $1"},
+			wantArgs:       []driver.Value{"qc", int64(50), int64(0)},
+		},
+		{
+			name:           "created after",
+			filter:         AnalysisFilter{CreatedAfter: after},
+			wantConditions: []string{"a.created_at >= $1"},
+			wantArgs:       []driver.Value{after, int64(50), int64(0)},
+		},
+		{
+			name:           "created before",
+			filter:         AnalysisFilter{CreatedBefore: before},
+			wantConditions: []string{"a.created_at < $1"},
+			wantArgs:       []driver.Value{before, int64(50), int64(0)},
+		},
+		{
+			name:           "created between",
+			filter:         AnalysisFilter{CreatedAfter: after, CreatedBefore: before},
+			wantConditions: []string{"a.created_at >= $1", "a.created_at < $2"},
+			wantArgs:       []driver.Value{after, before, int64(50), int64(0)},
+		},
+		{
+			name:           "analysis type and created after",
+			filter:         AnalysisFilter{AnalysisType: "qc", CreatedAfter: after},
+			wantConditions: []string{"a.analysis_type = $1", "a.created_at >= $2"},
+			wantArgs:       []driver.Value{"qc", after, int64(50), int64(0)},
+		},
+		{
+			name:           "every filter set",
+			filter:         AnalysisFilter{Status: AnalysisStatusCompleted, AnalysisType: "qc", CreatedAfter: after, CreatedBefore: before},
+			wantConditions: []string{"a.status = $1", "a.analysis_type = $2", "a.created_at >= $3", "a.created_at < $4"},
+			wantArgs:       []driver.Value{AnalysisStatusCompleted, "qc", after, before, int64(50), int64(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			var args []driver.Value
+			db := &fakeDB{respond: func(q string, named []driver.NamedValue) (*fakeRows, error) {
+				if strings.Contains(q, "FROM biomarker.analyses a") {
+					query = q
+					for _, arg := range named {
+						args = append(args, arg.Value)
+					}
+				}
+				return &fakeRows{columns: analysisListColumns}, nil
+			}}
+			p := newFakeService(t, db)
+
+			if _, err := p.ListAnalysesPage(context.Background(), tt.filter, 50, 0); err != nil {
+				t.Fatalf("ListAnalysesPage: %v", err)
+			}
+
+			_, where, found := strings.Cut(query, " WHERE ")
+			if found != (len(tt.wantConditions) > 0) {
+				t.Fatalf("query has WHERE = %v, want %v: %s", found, len(tt.wantConditions) > 0, query)
+			}
+			where, _, _ = strings.Cut(where, " ORDER BY")
+			var conditions []string
+			if found {
+				conditions = strings.Split(where, " AND ")
+			}
+			if !reflect.DeepEqual(conditions, tt.wantConditions) {
+				t.Errorf("conditions = %q, want %q", conditions, tt.wantConditions)
+			}
+			wantPaging := len(tt.wantArgs) - 1
+			if !strings.Contains(query, fmt.Sprintf("LIMIT $%d OFFSET $%d", wantPaging, wantPaging+1)) {
+				t.Errorf("limit and offset aren't numbered after the filter: %s", query)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
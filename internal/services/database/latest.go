@@ -0,0 +1,66 @@
+// internal/services/database/latest.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LatestResult is the result currently considered current for a file + analysis type
+type LatestResult struct {
+	FileID       int64     `db:"file_id" json:"file_id"`
+	AnalysisType string    `db:"analysis_type" json:"analysis_type"`
+	AnalysisID   int64     `db:"analysis_id" json:"analysis_id"`
+	ResultID     int64     `db:"result_id" json:"result_id"`
+	Sequence     int64     `db:"sequence" json:"sequence"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// UpdateLatestResult points the file's latest result for the analysis's type at resultID
+// with ordered set the pointer only moves to a higher sequence, so an older run finishing after a newer one is ignored,
+// without it the last completion wins. reports whether the pointer was moved
+func (p *PostgresService) UpdateLatestResult(ctx context.Context, analysisUUID string, resultID int64, ordered bool) (bool, error) {
+	query := `
+		INSERT INTO biomarker.latest_results (file_id, analysis_type, analysis_id, result_id, sequence, updated_at)
+		SELECT file_id, analysis_type, analysis_id, $2, COALESCE(sequence, 0), NOW()
+		FROM biomarker.analyses
+		WHERE analysis_uuid = $1
+		ON CONFLICT (file_id, analysis_type) DO UPDATE
+		SET analysis_id = EXCLUDED.analysis_id,
+			result_id = EXCLUDED.result_id,
+			sequence = EXCLUDED.sequence,
+			updated_at = EXCLUDED.updated_at
+		WHERE NOT $3 OR biomarker.latest_results.sequence < EXCLUDED.sequence
+	`
+
+	res, err := p.db.ExecContext(ctx, query, analysisUUID, resultID, ordered)
+	if err != nil {
+		return false, fmt.Errorf("failed to update latest result: %v", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update latest result: %v", err)
+	}
+	return rows > 0, nil
+}
+
+// GetLatestResult returns the current latest result pointer, nil if the file has no completed analysis of that type
+func (p *PostgresService) GetLatestResult(ctx context.Context, fileID int64, analysisType string) (*LatestResult, error) {
+	query := `
+		SELECT file_id, analysis_type, analysis_id, result_id, sequence, updated_at
+		FROM biomarker.latest_results
+		WHERE file_id = $1 AND analysis_type = $2
+	`
+
+	var latest LatestResult
+	if err := p.db.GetContext(ctx, &latest, query, fileID, analysisType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get latest result: %v", err)
+	}
+	return &latest, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLatest answers UpdateLatestResult/GetLatestResult the way the upsert in latest.go behaves,
+// for analyses of a single file and analysis type
+type fakeLatest struct {
+	sequences map[string]int64 // analysis uuid -> sequence
+	resultID  int64
+	sequence  int64
+	set       bool
+}
+
+func (f *fakeLatest) respond(query string, args []driver.NamedValue) (*fakeRows, error) {
+	if strings.Contains(query, "INSERT INTO biomarker.latest_results") {
+		sequence := f.sequences[args[0].Value.(string)]
+		ordered := args[2].Value.(bool)
+		if f.set && ordered && f.sequence >= sequence {
+			return &fakeRows{}, nil
+		}
+		f.resultID, f.sequence, f.set = args[1].Value.(int64), sequence, true
+		return &fakeRows{values: [][]driver.Value{{}}}, nil
+	}
+
+	if !f.set {
+		return &fakeRows{columns: []string{"file_id"}}, nil
+	}
+	return &fakeRows{
+		columns: []string{"file_id", "analysis_type", "analysis_id", "result_id", "sequence", "updated_at"},
+		values:  [][]driver.Value{{int64(1), "descriptive", f.sequence, f.resultID, f.sequence, time.Now()}},
+	}, nil
+}
+
+func TestUpdateLatestResultOutOfOrder(t *testing.T) {
+	// three analyses of the same file, completing 2, 3, 1
+	completions := []struct {
+		uuid     string
+		resultID int64
+	}{
+		{"analysis-2", 20},
+		{"analysis-3", 30},
+		{"analysis-1", 10},
+	}
+
+	tests := []struct {
+		name       string
+		ordered    bool
+		wantMoved  []bool
+		wantResult int64
+	}{
+		{"ordered keeps the newest analysis", true, []bool{true, true, false}, 30},
+		{"unordered takes the last completion", false, []bool{true, true, true}, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest := &fakeLatest{sequences: map[string]int64{"analysis-1": 1, "analysis-2": 2, "analysis-3": 3}}
+			service := newFakeService(t, &fakeDB{respond: latest.respond})
+			ctx := context.Background()
+
+			for i, completion := range completions {
+				moved, err := service.UpdateLatestResult(ctx, completion.uuid, completion.resultID, tt.ordered)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if moved != tt.wantMoved[i] {
+					t.Errorf("%s completing moved the pointer = %v, want %v", completion.uuid, moved, tt.wantMoved[i])
+				}
+			}
+
+			got, err := service.GetLatestResult(ctx, 1, "descriptive")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || got.ResultID != tt.wantResult {
+				t.Fatalf("latest result = %+v, want result %d", got, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestUpdateLatestResultGuardsOnSequence(t *testing.T) {
+	var query string
+	db := &fakeDB{respond: func(q string, args []driver.NamedValue) (*fakeRows, error) {
+		query = q
+		return &fakeRows{}, nil
+	}}
+	service := newFakeService(t, db)
+
+	if _, err := service.UpdateLatestResult(context.Background(), "analysis-1", 10, true); err != nil {
+		t.Fatal(err)
+	}
+	// the ordering lives in the upsert itself, so concurrent completions can't race a separate read
+	if !strings.Contains(query, "biomarker.latest_results.sequence < EXCLUDED.sequence") {
+		t.Errorf("latest result upsert has no sequence guard:\n%s", query)
+	}
+}
+
+func TestGetLatestResultNone(t *testing.T) {
+	service := newFakeService(t, &fakeDB{respond: (&fakeLatest{}).respond})
+
+	got, err := service.GetLatestResult(context.Background(), 1, "descriptive")
+	if err != nil || got != nil {
+		t.Errorf("GetLatestResult = %+v, %v, want nil for a file without results", got, err)
+	}
+}
@@ -0,0 +1,88 @@
+// internal/services/database/migrate.go
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// arbitrary key for pg_advisory_lock, keeps replicas starting together from migrating at the same time
+const migrationLockID = 7311142
+
+// Migrate applies the embedded migrations (migrations/NNNN_name.sql) that haven't been applied yet, in order.
+// each one runs in its own transaction and is recorded in biomarker.schema_migrations by its version (file name
+// without .sql), so it's safe to run on every startup
+func (p *PostgresService) Migrate(ctx context.Context) error {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %v", err)
+	}
+	sort.Strings(names)
+
+	conn, err := p.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migrations: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to take migration lock: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE SCHEMA IF NOT EXISTS biomarker;
+		CREATE TABLE IF NOT EXISTS biomarker.schema_migrations (
+			version    TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	var applied []string
+	if err := conn.SelectContext(ctx, &applied, `SELECT version FROM biomarker.schema_migrations`); err != nil {
+		return fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	done := make(map[string]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		if done[version] {
+			continue
+		}
+		script, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %v", version, err)
+		}
+
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %v", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %v", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO biomarker.schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %v", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %v", version, err)
+		}
+		p.logger.Info("Applied migration", slog.String("version", version))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+-- the tables as they were before versioned migrations, later migrations add to them
+CREATE SCHEMA IF NOT EXISTS biomarker;
+
+CREATE TABLE IF NOT EXISTS biomarker.files (
+    file_id       BIGSERIAL PRIMARY KEY,
+    file_path     TEXT        NOT NULL,
+    file_name     TEXT        NOT NULL,
+    file_type     TEXT        NOT NULL DEFAULT '',
+    file_size     BIGINT      NOT NULL DEFAULT 0,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_modified TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    checksum      TEXT,
+    metadata      JSONB       NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS biomarker.analyses (
+    analysis_id   BIGSERIAL PRIMARY KEY,
+    analysis_uuid UUID        NOT NULL UNIQUE,
+    file_id       BIGINT      NOT NULL REFERENCES biomarker.files (file_id),
+    analysis_type TEXT        NOT NULL,
+    status        TEXT        NOT NULL DEFAULT 'pending',
+    started_at    TIMESTAMPTZ,
+    completed_at  TIMESTAMPTZ,
+    duration_ms   BIGINT,
+    error_message TEXT        NOT NULL DEFAULT '',
+    created_by    TEXT        NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    metadata      JSONB       NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS analyses_file_id_idx ON biomarker.analyses (file_id);
+CREATE INDEX IF NOT EXISTS analyses_status_created_idx ON biomarker.analyses (status, created_at);
+
+CREATE TABLE IF NOT EXISTS biomarker.results (
+    result_id    BIGSERIAL PRIMARY KEY,
+    analysis_id  BIGINT      NOT NULL REFERENCES biomarker.analyses (analysis_id),
+    result_type  TEXT        NOT NULL,
+    storage_type TEXT        NOT NULL,
+    storage_key  TEXT        NOT NULL,
+    content_type TEXT        NOT NULL DEFAULT '',
+    size_bytes   BIGINT      NOT NULL DEFAULT 0,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    metadata     JSONB       NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS results_analysis_id_idx ON biomarker.results (analysis_id);
+
+-- moves an analysis to a new status, stamping started_at when it starts running and
+-- completed_at/duration_ms when it finishes
+CREATE OR REPLACE FUNCTION biomarker.update_analysis_status(p_analysis_uuid UUID, p_status TEXT, p_error_message TEXT)
+RETURNS VOID AS $$
+BEGIN
+    UPDATE biomarker.analyses
+    SET status = p_status,
+        error_message = COALESCE(p_error_message, ''),
+        started_at = CASE WHEN p_status = 'running' THEN COALESCE(started_at, NOW()) ELSE started_at END,
+        completed_at = CASE WHEN p_status IN ('running', 'pending') THEN completed_at ELSE NOW() END,
+        duration_ms = CASE WHEN p_status IN ('running', 'pending') THEN duration_ms
+                           ELSE (EXTRACT(EPOCH FROM (NOW() - COALESCE(started_at, created_at))) * 1000)::BIGINT END
+    WHERE analysis_uuid = p_analysis_uuid;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'analysis % not found', p_analysis_uuid;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
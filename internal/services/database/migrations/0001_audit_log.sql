@@ -0,0 +1,18 @@
+-- immutable trail of every message a worker handled
+CREATE TABLE IF NOT EXISTS biomarker.audit_log (
+    audit_id     BIGSERIAL PRIMARY KEY,
+    queue        TEXT        NOT NULL,
+    message_id   TEXT        NOT NULL DEFAULT '',
+    worker_id    TEXT        NOT NULL,
+    outcome      TEXT        NOT NULL,
+    error        TEXT        NOT NULL DEFAULT '',
+    duration_ms  BIGINT      NOT NULL,
+    received_at  TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_received_at_idx ON biomarker.audit_log (received_at);
+CREATE INDEX IF NOT EXISTS audit_log_message_id_idx ON biomarker.audit_log (message_id);
+
+-- audit rows are append only
+REVOKE UPDATE, DELETE ON biomarker.audit_log FROM PUBLIC;
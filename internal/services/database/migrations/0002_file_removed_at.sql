@@ -0,0 +1,2 @@
+-- set when the watcher reports the file deleted/renamed away, results are kept for history
+ALTER TABLE biomarker.files ADD COLUMN IF NOT EXISTS removed_at TIMESTAMPTZ;
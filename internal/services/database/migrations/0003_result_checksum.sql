@@ -0,0 +1,2 @@
+-- sha256 of the artifact as uploaded, used to detect silent corruption of stored results
+ALTER TABLE biomarker.results ADD COLUMN IF NOT EXISTS checksum TEXT;
@@ -0,0 +1,3 @@
+-- a storage key identifies exactly one object per backend, two result rows pointing at it would make retrieval ambiguous
+ALTER TABLE biomarker.results
+    ADD CONSTRAINT results_storage_type_key_unique UNIQUE (storage_type, storage_key);
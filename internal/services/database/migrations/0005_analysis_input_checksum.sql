@@ -0,0 +1,3 @@
+-- lookups for the result cache: latest completed analysis of identical input content
+CREATE INDEX IF NOT EXISTS analyses_input_checksum_idx
+    ON biomarker.analyses ((metadata->>'input_checksum'), analysis_type);
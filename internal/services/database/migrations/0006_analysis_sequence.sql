@@ -0,0 +1,14 @@
+-- per-file analysis ordering: each analysis of a file gets the next value of files.analysis_seq,
+-- latest_results only ever moves forward to a higher sequence so out-of-order completions can't regress it
+ALTER TABLE biomarker.files ADD COLUMN IF NOT EXISTS analysis_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE biomarker.analyses ADD COLUMN IF NOT EXISTS sequence BIGINT;
+
+CREATE TABLE IF NOT EXISTS biomarker.latest_results (
+    file_id       BIGINT NOT NULL REFERENCES biomarker.files (file_id),
+    analysis_type TEXT NOT NULL,
+    analysis_id   BIGINT NOT NULL REFERENCES biomarker.analyses (analysis_id),
+    result_id     BIGINT NOT NULL REFERENCES biomarker.results (result_id),
+    sequence      BIGINT NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (file_id, analysis_type)
+);
@@ -0,0 +1,5 @@
+-- set when the stored object is gone (S3 lifecycle expiry), the record stays for history
+ALTER TABLE biomarker.results ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS results_live_idx
+    ON biomarker.results (storage_type, result_id) WHERE expired_at IS NULL;
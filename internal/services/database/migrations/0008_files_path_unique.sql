@@ -0,0 +1,30 @@
+-- one row per watched path, GetOrCreateFileRecord upserts on it so re-detections (and replays) don't duplicate files
+-- existing duplicates are folded into the oldest row first
+WITH keep AS (
+    SELECT file_path, MIN(file_id) AS file_id, MAX(analysis_seq) AS analysis_seq
+    FROM biomarker.files
+    GROUP BY file_path
+    HAVING COUNT(*) > 1
+)
+UPDATE biomarker.files f
+SET analysis_seq = keep.analysis_seq
+FROM keep
+WHERE f.file_id = keep.file_id;
+
+UPDATE biomarker.analyses a
+SET file_id = keep.file_id
+FROM (SELECT file_path, MIN(file_id) AS file_id FROM biomarker.files GROUP BY file_path) keep
+JOIN biomarker.files f ON f.file_path = keep.file_path
+WHERE a.file_id = f.file_id AND f.file_id <> keep.file_id;
+
+-- latest pointers of the folded rows are rebuilt by the next completed analysis
+DELETE FROM biomarker.latest_results l
+USING biomarker.files f
+WHERE l.file_id = f.file_id
+  AND f.file_id <> (SELECT MIN(file_id) FROM biomarker.files WHERE file_path = f.file_path);
+
+DELETE FROM biomarker.files f
+WHERE f.file_id <> (SELECT MIN(file_id) FROM biomarker.files WHERE file_path = f.file_path);
+
+ALTER TABLE biomarker.files
+    ADD CONSTRAINT files_file_path_unique UNIQUE (file_path);
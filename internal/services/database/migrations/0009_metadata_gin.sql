@@ -0,0 +1,3 @@
+-- containment lookups on metadata (ListAnalysesByMetadata), jsonb_path_ops only supports @> but is smaller and faster
+CREATE INDEX IF NOT EXISTS analyses_metadata_gin_idx
+    ON biomarker.analyses USING GIN (metadata jsonb_path_ops);
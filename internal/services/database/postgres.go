@@ -3,18 +3,30 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"path/filepath"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
+
+	"watchrabbit/internal/domain/ids"
+	"watchrabbit/internal/services/redact"
 )
 
+// returned (wrapped) by CreateResultRecord when another result already uses the same storage type + key
+var ErrStorageKeyCollision = errors.New("storage key already used by another result")
+
+// unique constraint from migrations/0004_results_storage_key_unique.sql
+const resultsStorageKeyConstraint = "results_storage_type_key_unique"
+
+// unique constraint from migrations/0008_files_path_unique.sql
+const filesPathConstraint = "files_file_path_unique"
+
 type PostgresConfig struct {
 	Host string
 	Port int
@@ -22,6 +34,8 @@ type PostgresConfig struct {
 	Password string
 	DBName string
 	SSLMode string
+	IDScheme string // "uuid" (default) or "ulid" for analysis identifiers
+	Logger   *slog.Logger // nil for slog.Default()
 }
 // 3 main file storage types: Files, Analyses, Results
 // FileRecords - files in the db
@@ -37,6 +51,7 @@ type FileRecord struct {
 	CreatedAt    time.Time         `db:"created_at" json:"created_at"`
 	LastModified time.Time         `db:"last_modified" json:"last_modified"`
 	Checksum     string            `db:"checksum" json:"checksum,omitempty"`
+	RemovedAt    *time.Time        `db:"removed_at" json:"removed_at,omitempty"`
 	Metadata     json.RawMessage   `db:"metadata" json:"-"`
 	MetadataMap  map[string]string `db:"-" json:"metadata,omitempty"`
 }
@@ -47,15 +62,19 @@ type AnalysisRecord struct {
 	FileID        int64             `db:"file_id" json:"file_id"`
 	AnalysisType  string            `db:"analysis_type" json:"analysis_type"`
 	Status        string            `db:"status" json:"status"`
+	Sequence      *int64            `db:"sequence" json:"sequence,omitempty"` // per-file order of creation
 	StartedAt     *time.Time        `db:"started_at" json:"started_at,omitempty"`
 	CompletedAt   *time.Time        `db:"completed_at" json:"completed_at,omitempty"`
 	DurationMs    *int64            `db:"duration_ms" json:"duration_ms,omitempty"`
 	ErrorMessage  string            `db:"error_message" json:"error_message,omitempty"`
-	CreatedBy     string            `db:"created_by" json:"created_by,omitempty"`
+	CreatedBy     string            `db:"created_by" json:"created_by"`
 	Metadata      json.RawMessage   `db:"metadata" json:"-"`
 	MetadataMap   map[string]string `db:"-" json:"metadata,omitempty"`
 }
 
+// result_type of the run logs stored next to an analysis's report, never served as the result itself
+const ResultTypeLog = "log"
+
 type ResultRecord struct {
 	ResultID    int64             `db:"result_id" json:"result_id"`
 	AnalysisID  int64             `db:"analysis_id" json:"analysis_id"`
@@ -64,22 +83,32 @@ type ResultRecord struct {
 	StorageKey  string            `db:"storage_key" json:"storage_key"`
 	ContentType string            `db:"content_type" json:"content_type"`
 	SizeBytes   int64             `db:"size_bytes" json:"size_bytes,omitempty"`
+	Checksum    string            `db:"checksum" json:"checksum,omitempty"` // sha256 of the content as uploaded
 	CreatedAt   time.Time         `db:"created_at" json:"created_at"`
+	ExpiredAt   *time.Time        `db:"expired_at" json:"expired_at,omitempty"` // stored object is gone (lifecycle expiry)
 	Metadata    json.RawMessage   `db:"metadata" json:"-"`
 	MetadataMap map[string]string `db:"-" json:"metadata,omitempty"`
 }
 
+// the file is nested rather than embedded, its file_id/created_at/metadata would collide with the analysis' own
 type AnalysisDetails struct {
 	AnalysisRecord
-	FileRecord
+	File    FileRecord     `db:"file" json:"file"`
 	Results []ResultRecord `json:"results,omitempty"`
 }
 
 type PostgresService struct {
 	db *sqlx.DB
+	newID ids.Generator
+	logger *slog.Logger
 }
 
 func NewPostgresSerivce(config PostgresConfig) (*PostgresService, error) {
+	newID, err := ids.NewGenerator(config.IDScheme)
+	if err != nil {
+		return nil, err
+	}
+
 	connStr := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
@@ -95,9 +124,18 @@ func NewPostgresSerivce(config PostgresConfig) (*PostgresService, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5* time.Minute)
 
-	log.Printf("Connected to PostgreSQL database: %s", config.DBName)
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Info("Connected to PostgreSQL database", slog.String("db_name", config.DBName))
 
-	return &PostgresService{db: db}, nil
+	return &PostgresService{db: db, newID: newID, logger: logger}, nil
+}
+
+// Ping checks the database is reachable, for health checks
+func (p *PostgresService) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
 }
 
 func (p *PostgresService) Close() error {
@@ -106,6 +144,10 @@ func (p *PostgresService) Close() error {
 // File section
 // return the ID of the file record
 func (p *PostgresService) CreateFileRecord(ctx context.Context, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
+	return createFileRecord(ctx, p.db, p.logger, filePath, fileSize, metadata)
+}
+
+func createFileRecord(ctx context.Context, q sqlx.QueryerContext, logger *slog.Logger, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
 	fileName := filepath.Base(filePath)
 	fileType := filepath.Ext(filePath)
 
@@ -121,19 +163,53 @@ func (p *PostgresService) CreateFileRecord(ctx context.Context, filePath string,
 	`
 
 	var fileID int64
-	err = p.db.GetContext(ctx, &fileID, query, filePath, fileName, fileType, fileSize, metadataJSON)
+	err = sqlx.GetContext(ctx, q, &fileID, query, filePath, fileName, fileType, fileSize, metadataJSON)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create file record: %v", err)
 	}
 
-	log.Printf("Created file record with ID: %d", fileID)
+	logger.Debug("Created file record", slog.Int64("file_id", fileID))
+	return fileID, nil
+}
+
+// GetOrCreateFileRecord returns the file_id for filePath, inserting the row if it's new and updating
+// its size if it changed, so re-detecting or replaying the same file never duplicates it
+func (p *PostgresService) GetOrCreateFileRecord(ctx context.Context, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
+	return getOrCreateFileRecord(ctx, p.db, filePath, fileSize, metadata)
+}
+
+func getOrCreateFileRecord(ctx context.Context, q sqlx.QueryerContext, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return -1, fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+
+	// the update only fires when something changed, an unchanged file returns no row and is looked up instead,
+	// which keeps last_modified meaningful
+	query := `
+	INSERT INTO biomarker.files (file_path, file_name, file_type, file_size, metadata)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT ON CONSTRAINT ` + filesPathConstraint + ` DO UPDATE
+	SET file_size = EXCLUDED.file_size, last_modified = NOW(), removed_at = NULL
+	WHERE files.file_size IS DISTINCT FROM EXCLUDED.file_size OR files.removed_at IS NOT NULL
+	RETURNING file_id
+	`
+
+	var fileID int64
+	err = sqlx.GetContext(ctx, q, &fileID, query, filePath, filepath.Base(filePath), filepath.Ext(filePath), fileSize, metadataJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = sqlx.GetContext(ctx, q, &fileID, `SELECT file_id FROM biomarker.files WHERE file_path = $1`, filePath)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get or create file record: %v", err)
+	}
 	return fileID, nil
 }
 
 func (p *PostgresService) GetFileRecordByPath(ctx context.Context, filePath string) (*FileRecord, error) {
 	query := `
-	SELECT file_id, file_path, file_name, file_type, file_size
-	created_at, last_modified, checksum, metadata
+	SELECT file_id, file_path, file_name, file_type, file_size,
+	created_at, last_modified, COALESCE(checksum, '') AS checksum, removed_at, metadata
 	FROM biomarker.files
 	WHERE file_path = $1
 	`
@@ -141,7 +217,7 @@ func (p *PostgresService) GetFileRecordByPath(ctx context.Context, filePath stri
 	var file FileRecord 
 	err := p.db.GetContext(ctx, &file, query, filePath) 
 	if err != nil {
-		if errors.Is(err, sqlx.ErrNoRows) {
+		if errors.Is(err, sql.ErrNoRows) {
 			//file not found in db, no results
 			return nil, nil 
 		}
@@ -158,54 +234,121 @@ func (p *PostgresService) GetFileRecordByPath(ctx context.Context, filePath stri
 	return &file, nil
 }
 
+// flags a file as removed from the watched directories, its analyses and results are kept
+// returns false if the path isn't known (or was already marked removed)
+func (p *PostgresService) MarkFileRemoved(ctx context.Context, filePath string) (bool, error) {
+	query := `
+	UPDATE biomarker.files
+	SET removed_at = now()
+	WHERE file_path = $1 AND removed_at IS NULL
+	`
+
+	res, err := p.db.ExecContext(ctx, query, filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark file removed: %v", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark file removed: %v", err)
+	}
+
+	if rows > 0 {
+		p.logger.Info("Marked file removed", slog.String("file_path", redact.Path(filePath)))
+	}
+	return rows > 0, nil
+}
+
 // Analysis Section
-func (p *PostgresService) CreateAnalysisRecord(ctx context.Context, fileID int64, analysisType, status string, metadata map[string]string) (string, error) {
-	analysisUUID := uuid.New().String()
+func (p *PostgresService) CreateAnalysisRecord(ctx context.Context, fileID int64, analysisType, status, createdBy string, metadata map[string]string) (string, error) {
+	analysisUUID, _, err := createAnalysisRecord(ctx, p.db, p.logger, p.newID(), fileID, analysisType, status, createdBy, metadata)
+	return analysisUUID, err
+}
+
+// returns the new analysis's uuid and analysis_id, createdBy is whoever requested it (empty if unknown)
+func createAnalysisRecord(ctx context.Context, q sqlx.QueryerContext, logger *slog.Logger, analysisUUID string, fileID int64, analysisType, status, createdBy string, metadata map[string]string) (string, int64, error) {
 
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal metadata: %v", err)
+		return "", 0, fmt.Errorf("failed to marshal metadata: %v", err)
 	}
 
+	// the sequence comes from a per-file counter, the row lock on the file serializes concurrent creates
 	query := `
+	WITH seq AS (
+		UPDATE biomarker.files SET analysis_seq = analysis_seq + 1
+		WHERE file_id = $2
+		RETURNING analysis_seq
+	)
 	INSERT INTO biomarker.analyses
-	(analysis_uuid, file_id, analysis_type, status, metadata)
-	VALUES ($1, $2, $3, $4, $5)
+	(analysis_uuid, file_id, analysis_type, status, created_by, metadata, sequence)
+	SELECT $1, $2, $3, $4, $5, $6, analysis_seq FROM seq
+	RETURNING analysis_id
 	`
 
-	_, err = p.db.ExecContext(ctx, query, analysisUUID, fileID, analysisType, status, metadataJSON)
+	var analysisID int64
+	err = sqlx.GetContext(ctx, q, &analysisID, query, analysisUUID, fileID, analysisType, status, createdBy, metadataJSON)
 	if err != nil {
-		return "", fmt.Errorf("failed to create analysis record: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", 0, fmt.Errorf("failed to create analysis record: file %d not found", fileID)
+		}
+		return "", 0, fmt.Errorf("failed to create analysis record: %v", err)
 	}
 
-	log.Printf("Created analysis with UUID: %s", analysisUUID)
-	return analysisUUID, nil
+	logger.Info("Created analysis", slog.String("analysis_uuid", analysisUUID), slog.String("analysis_type", analysisType))
+	return analysisUUID, analysisID, nil
 }
 
-func (p *PostgresService) UpdateAnalysisStatus(ctx context.Context, analysisUUID string, status string, error string) error {
+// UpdateAnalysisStatus moves an analysis to status, errorMessage is empty unless it failed
+func (p *PostgresService) UpdateAnalysisStatus(ctx context.Context, analysisUUID, status, errorMessage string) error {
+	return updateAnalysisStatus(ctx, p.db, p.logger, analysisUUID, status, errorMessage)
+}
+
+func updateAnalysisStatus(ctx context.Context, e sqlx.ExecerContext, logger *slog.Logger, analysisUUID, status, errorMessage string) error {
 	query := `SELECT biomarker.update_analysis_status($1, $2, $3)`
-	_, err = p.db.ExecContext(ctx, query, analysisUUID, status, errorMessage)
+	_, err := e.ExecContext(ctx, query, analysisUUID, status, errorMessage)
 
 	if err != nil {
 		return fmt.Errorf("failed to update analysis status: %v", err)
 	}
 
-	log.Printf("Updated analysis %s status to: %s", analysisUUID, status)
+	logger.Info("Updated analysis status", slog.String("analysis_uuid", analysisUUID), slog.String("status", status))
+	return nil
+}
+
+// analysis metadata key holding how many times the worker ran it (retries of transient failures included)
+const AttemptsKey = "attempts"
+
+// MergeAnalysisMetadata sets the given keys in an analysis's metadata, leaving the others as they are
+func (p *PostgresService) MergeAnalysisMetadata(ctx context.Context, analysisUUID string, metadata map[string]string) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+
+	query := `UPDATE biomarker.analyses SET metadata = metadata || $2::jsonb WHERE analysis_uuid = $1`
+	res, err := p.db.ExecContext(ctx, query, analysisUUID, metadataJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update analysis metadata: %v", err)
+	}
+	if rows, err := res.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("analysis %s not found", analysisUUID)
+	}
 	return nil
 }
 
 func (p *PostgresService) GetAnalysisRecordByUUID(ctx context.Context, analysisUUID string) (*AnalysisRecord, error) {
 	query := `
-	SELECT analysis_id, analysis_uuid, file_id, analysis_type, status, started_at, completed_at,
+	SELECT analysis_id, analysis_uuid, file_id, analysis_type, status, sequence, started_at, completed_at,
 	duration_ms, error_message, created_by, metadata
 	FROM biomarker.analyses
 	WHERE analysis_uuid = $1
 	`
 	var analysis AnalysisRecord
-	err := p.db.ExecContext(ctx, query, analysisUUID)
+	err := p.db.GetContext(ctx, &analysis, query, analysisUUID)
 
 	if err != nil {
-		if errors.Is(err, sqlx.ErrNoRows) {
+		if errors.Is(err, sql.ErrNoRows) {
 			// no analysis found with UUID in db
 			return nil, nil
 		}
@@ -224,7 +367,11 @@ func (p *PostgresService) GetAnalysisRecordByUUID(ctx context.Context, analysisU
 
 // below is mostly copied from AI generation, too much SQL boilerplate - may need to correct later
 //Results section
-func (p *PostgresService) CreateResultRecord(ctx context.Context, analysisID int64, resultType, storageType, storageKey, contentType string, sizeBytes int64, metadata map[string]string) (int64, error) {
+func (p *PostgresService) CreateResultRecord(ctx context.Context, analysisID int64, resultType, storageType, storageKey, contentType string, sizeBytes int64, checksum string, metadata map[string]string) (int64, error) {
+	return createResultRecord(ctx, p.db, p.logger, analysisID, resultType, storageType, storageKey, contentType, sizeBytes, checksum, metadata)
+}
+
+func createResultRecord(ctx context.Context, q sqlx.QueryerContext, logger *slog.Logger, analysisID int64, resultType, storageType, storageKey, contentType string, sizeBytes int64, checksum string, metadata map[string]string) (int64, error) {
 	// Convert metadata to JSON
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
@@ -234,25 +381,56 @@ func (p *PostgresService) CreateResultRecord(ctx context.Context, analysisID int
 	// Insert result record
 	query := `
 		INSERT INTO biomarker.results 
-		(analysis_id, result_type, storage_type, storage_key, content_type, size_bytes, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		(analysis_id, result_type, storage_type, storage_key, content_type, size_bytes, checksum, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
 		RETURNING result_id
 	`
 	
 	var resultID int64
-	err = p.db.GetContext(ctx, &resultID, query, analysisID, resultType, storageType, storageKey, contentType, sizeBytes, metadataJSON)
+	err = sqlx.GetContext(ctx, q, &resultID, query, analysisID, resultType, storageType, storageKey, contentType, sizeBytes, checksum, metadataJSON)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == resultsStorageKeyConstraint {
+			return 0, fmt.Errorf("%w: %s %s (analysis %d)", ErrStorageKeyCollision, storageType, storageKey, analysisID)
+		}
 		return 0, fmt.Errorf("failed to create result record: %v", err)
 	}
 
-	log.Printf("Created result record with ID: %d for analysis ID: %d", resultID, analysisID)
+	logger.Info("Created result record", slog.Int64("result_id", resultID), slog.Int64("analysis_id", analysisID))
 	return resultID, nil
 }
 
+func (p *PostgresService) GetResultRecordByID(ctx context.Context, resultID int64) (*ResultRecord, error) {
+	query := `
+		SELECT result_id, analysis_id, result_type, storage_type, storage_key, content_type,
+		size_bytes, COALESCE(checksum, '') AS checksum, created_at, expired_at, metadata
+		FROM biomarker.results
+		WHERE result_id = $1
+	`
+
+	var result ResultRecord
+	err := p.db.GetContext(ctx, &result, query, resultID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get result record: %v", err)
+	}
+
+	if result.Metadata != nil {
+		result.MetadataMap = make(map[string]string)
+		if err := json.Unmarshal(result.Metadata, &result.MetadataMap); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result metadata: %v", err)
+		}
+	}
+
+	return &result, nil
+}
+
 func (p *PostgresService) GetResultsByAnalysisUUID(ctx context.Context, analysisUUID string) ([]ResultRecord, error) {
 	query := `
 		SELECT r.result_id, r.analysis_id, r.result_type, r.storage_type, 
-		r.storage_key, r.content_type, r.size_bytes, r.created_at, r.metadata
+		r.storage_key, r.content_type, r.size_bytes, COALESCE(r.checksum, '') AS checksum, r.created_at, r.expired_at, r.metadata
 		FROM biomarker.results r
 		JOIN biomarker.analyses a ON r.analysis_id = a.analysis_id
 		WHERE a.analysis_uuid = $1
@@ -287,7 +465,7 @@ func (p *PostgresService) GetLatestAnalysesByFilePath(ctx context.Context, fileP
 	var fileID int64
 	err := p.db.GetContext(ctx, &fileID, "SELECT file_id FROM biomarker.files WHERE file_path = $1", filePath)
 	if err != nil {
-		if errors.Is(err, sqlx.ErrNoRows) {
+		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil // File not found
 		}
 		return nil, fmt.Errorf("failed to get file ID: %v", err)
@@ -295,11 +473,11 @@ func (p *PostgresService) GetLatestAnalysesByFilePath(ctx context.Context, fileP
 
 	// Get analysis records
 	query := `
-		SELECT analysis_id, analysis_uuid, file_id, analysis_type, status,
+		SELECT analysis_id, analysis_uuid, file_id, analysis_type, status, sequence,
 		started_at, completed_at, duration_ms, error_message, created_by, metadata
 		FROM biomarker.analyses
 		WHERE file_id = $1
-		ORDER BY created_at DESC
+		ORDER BY sequence DESC NULLS LAST, created_at DESC
 		LIMIT $2
 	`
 	
@@ -313,7 +491,7 @@ func (p *PostgresService) GetLatestAnalysesByFilePath(ctx context.Context, fileP
 	var file FileRecord
 	err = p.db.GetContext(ctx, &file, `
 		SELECT file_id, file_path, file_name, file_type, file_size, 
-		created_at, last_modified, checksum, metadata
+		created_at, last_modified, COALESCE(checksum, '') AS checksum, removed_at, metadata
 		FROM biomarker.files
 		WHERE file_id = $1
 	`, fileID)
@@ -329,37 +507,74 @@ func (p *PostgresService) GetLatestAnalysesByFilePath(ctx context.Context, fileP
 		}
 	}
 
-	// Combine results
-	var analysisDetails []AnalysisDetails
-	for _, analysis := range analyses {
-		// Parse analysis metadata
-		if analysis.Metadata != nil {
-			analysis.MetadataMap = make(map[string]string)
-			if err := json.Unmarshal(analysis.Metadata, &analysis.MetadataMap); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal analysis metadata: %v", err)
-			}
+	analysisIDs := make([]int64, len(analyses))
+	for i := range analyses {
+		if err := unmarshalMetadata(analyses[i].Metadata, &analyses[i].MetadataMap); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal analysis metadata: %v", err)
 		}
+		analysisIDs[i] = analyses[i].AnalysisID
+	}
 
-		// Get results for this analysis
-		results, err := p.GetResultsByAnalysisUUID(ctx, analysis.AnalysisUUID)
-		if err != nil {
-			return nil, err
-		}
+	results, err := p.getResultsByAnalysisIDs(ctx, analysisIDs)
+	if err != nil {
+		return nil, err
+	}
 
-		details := AnalysisDetails{
+	var analysisDetails []AnalysisDetails
+	for _, analysis := range analyses {
+		analysisDetails = append(analysisDetails, AnalysisDetails{
 			AnalysisRecord: analysis,
-			FileRecord:     file,
-			Results:        results,
-		}
-
-		analysisDetails = append(analysisDetails, details)
+			File:           file,
+			Results:        results[analysis.AnalysisID],
+		})
 	}
 
 	return analysisDetails, nil
 }
 
 // ListAnalyses lists all analyses with optional filters
+// one query for the page of analyses joined with their files and one for all of their results
 func (p *PostgresService) ListAnalyses(ctx context.Context, status string, limit, offset int) ([]AnalysisDetails, error) {
+	page, err := p.ListAnalysesPage(ctx, AnalysisFilter{Status: status}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return page.Analyses, nil
+}
+
+// ListAnalysesByMetadata returns every analysis whose metadata has key set to value, newest first
+// only top-level keys are matched, use ListAnalysesPage with AnalysisFilter.MetadataKey to page through them
+func (p *PostgresService) ListAnalysesByMetadata(ctx context.Context, key, value string) ([]AnalysisDetails, error) {
+	if key == "" {
+		return nil, fmt.Errorf("metadata key is required")
+	}
+	filter := AnalysisFilter{MetadataKey: key, MetadataValue: value}
+
+	const pageSize = 500
+	var analyses []AnalysisDetails
+	for offset := 0; ; offset += pageSize {
+		page, err := p.ListAnalysesPage(ctx, filter, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, page.Analyses...)
+		if len(page.Analyses) < pageSize {
+			return analyses, nil
+		}
+	}
+}
+
+// AnalysisPage is one page of ListAnalysesPage along with the number of analyses matching the filter
+type AnalysisPage struct {
+	Analyses []AnalysisDetails `json:"analyses"`
+	Total    int               `json:"total"`
+	Limit    int               `json:"limit"`
+	Offset   int               `json:"offset"`
+}
+
+// ListAnalysesPage lists the analyses matching filter plus their total count, taken with count(*) OVER ()
+// in the same query
+func (p *PostgresService) ListAnalysesPage(ctx context.Context, filter AnalysisFilter, limit, offset int) (*AnalysisPage, error) {
 	if limit <= 0 {
 		limit = 20 // Default limit
 	}
@@ -368,83 +583,98 @@ func (p *PostgresService) ListAnalyses(ctx context.Context, status string, limit
 		offset = 0
 	}
 	
-	// Base query
+	// file columns are aliased to "file.<column>" so sqlx scans them into AnalysisDetails.File
 	baseQuery := `
-		SELECT a.analysis_id, a.analysis_uuid, a.file_id, a.analysis_type, a.status,
-		a.started_at, a.completed_at, a.duration_ms, a.error_message, a.created_by, a.metadata
+		SELECT a.analysis_id, a.analysis_uuid, a.file_id, a.analysis_type, a.status, a.sequence,
+		a.started_at, a.completed_at, a.duration_ms, a.error_message, a.created_by, a.metadata,
+		f.file_id AS "file.file_id", f.file_path AS "file.file_path", f.file_name AS "file.file_name",
+		f.file_type AS "file.file_type", f.file_size AS "file.file_size", f.created_at AS "file.created_at",
+		f.last_modified AS "file.last_modified", COALESCE(f.checksum, '') AS "file.checksum",
+		f.removed_at AS "file.removed_at", f.metadata AS "file.metadata",
+		count(*) OVER () AS total_count
 		FROM biomarker.analyses a
+		JOIN biomarker.files f ON f.file_id = a.file_id
 	`
 	
-	// Add filters
-	var args []interface{}
-	argCount := 1
+	whereClause, args := filter.where()
+	query := baseQuery + whereClause +
+		fmt.Sprintf(" ORDER BY a.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
 	
-	whereClause := ""
-	if status != "" {
-		whereClause = " WHERE a.status = $1"
-		args = append(args, status)
-		argCount++
+	var rows []struct {
+		AnalysisDetails
+		TotalCount int `db:"total_count"`
 	}
-	
-	// Add ordering and pagination
-	query := baseQuery + whereClause + 
-		" ORDER BY a.created_at DESC LIMIT $" + fmt.Sprintf("%d", argCount) + 
-		" OFFSET $" + fmt.Sprintf("%d", argCount+1)
-	
-	args = append(args, limit, offset)
-	
-	// Execute query
-	var analyses []AnalysisRecord
-	err := p.db.SelectContext(ctx, &analyses, query, args...)
-	if err != nil {
+	if err := p.db.SelectContext(ctx, &rows, query, append(args, limit, offset)...); err != nil {
 		return nil, fmt.Errorf("failed to list analyses: %v", err)
 	}
-	
-	// Assemble full details for each analysis
-	var results []AnalysisDetails
-	for _, analysis := range analyses {
-		// Get file details
-		var file FileRecord
-		err := p.db.GetContext(ctx, &file, `
-			SELECT file_id, file_path, file_name, file_type, file_size, 
-			created_at, last_modified, checksum, metadata
-			FROM biomarker.files
-			WHERE file_id = $1
-		`, analysis.FileID)
-		if err != nil {
-			log.Printf("Warning: failed to get file details for analysis %s: %v", analysis.AnalysisUUID, err)
-			continue
-		}
-		
-		// Parse metadata
-		if analysis.Metadata != nil {
-			analysis.MetadataMap = make(map[string]string)
-			if err := json.Unmarshal(analysis.Metadata, &analysis.MetadataMap); err != nil {
-				log.Printf("Warning: failed to unmarshal analysis metadata: %v", err)
-			}
-		}
-		
-		if file.Metadata != nil {
-			file.MetadataMap = make(map[string]string)
-			if err := json.Unmarshal(file.Metadata, &file.MetadataMap); err != nil {
-				log.Printf("Warning: failed to unmarshal file metadata: %v", err)
-			}
+
+	page := &AnalysisPage{Analyses: make([]AnalysisDetails, len(rows)), Limit: limit, Offset: offset}
+	analysisIDs := make([]int64, len(rows))
+	for i := range rows {
+		details := rows[i].AnalysisDetails
+		if err := unmarshalMetadata(details.AnalysisRecord.Metadata, &details.AnalysisRecord.MetadataMap); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal analysis metadata: %v", err)
 		}
-		
-		// Get results
-		analysisResults, err := p.GetResultsByAnalysisUUID(ctx, analysis.AnalysisUUID)
-		if err != nil {
-			log.Printf("Warning: failed to get results for analysis %s: %v", analysis.AnalysisUUID, err)
+		if err := unmarshalMetadata(details.File.Metadata, &details.File.MetadataMap); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal file metadata: %v", err)
 		}
-		
-		details := AnalysisDetails{
-			AnalysisRecord: analysis,
-			FileRecord:     file,
-			Results:        analysisResults,
+		page.Analyses[i] = details
+		page.Total = rows[i].TotalCount
+		analysisIDs[i] = details.AnalysisID
+	}
+
+	// a page past the end has no rows to carry the window count, count separately
+	if len(rows) == 0 && offset > 0 {
+		countQuery := `SELECT count(*) FROM biomarker.analyses a` + whereClause
+		if err := p.db.GetContext(ctx, &page.Total, countQuery, args...); err != nil {
+			return nil, fmt.Errorf("failed to count analyses: %v", err)
 		}
-		
-		results = append(results, details)
+	}
+
+	results, err := p.getResultsByAnalysisIDs(ctx, analysisIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Analyses {
+		page.Analyses[i].Results = results[page.Analyses[i].AnalysisID]
 	}
 	
-	return results, nil
-}
\ No newline at end of file
+	return page, nil
+}
+
+// getResultsByAnalysisIDs loads the results of several analyses in one query, keyed by analysis_id
+func (p *PostgresService) getResultsByAnalysisIDs(ctx context.Context, analysisIDs []int64) (map[int64][]ResultRecord, error) {
+	byAnalysis := make(map[int64][]ResultRecord, len(analysisIDs))
+	if len(analysisIDs) == 0 {
+		return byAnalysis, nil
+	}
+
+	query := `
+		SELECT result_id, analysis_id, result_type, storage_type, storage_key, content_type, size_bytes,
+		COALESCE(checksum, '') AS checksum, created_at, expired_at, metadata
+		FROM biomarker.results
+		WHERE analysis_id = ANY($1)
+		ORDER BY result_id
+	`
+
+	var results []ResultRecord
+	if err := p.db.SelectContext(ctx, &results, query, pq.Array(analysisIDs)); err != nil {
+		return nil, fmt.Errorf("failed to query results: %v", err)
+	}
+	for _, result := range results {
+		if err := unmarshalMetadata(result.Metadata, &result.MetadataMap); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result metadata: %v", err)
+		}
+		byAnalysis[result.AnalysisID] = append(byAnalysis[result.AnalysisID], result)
+	}
+	return byAnalysis, nil
+}
+
+// unmarshalMetadata fills into from a jsonb metadata column, leaving it nil for a NULL column
+func unmarshalMetadata(raw json.RawMessage, into *map[string]string) error {
+	if raw == nil {
+		return nil
+	}
+	*into = make(map[string]string)
+	return json.Unmarshal(raw, into)
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var analysisListColumns = []string{
+	"analysis_id", "analysis_uuid", "file_id", "analysis_type", "status", "sequence",
+	"started_at", "completed_at", "duration_ms", "error_message", "created_by", "metadata",
+	"file.file_id", "file.file_path", "file.file_name", "file.file_type", "file.file_size", "file.created_at",
+	"file.last_modified", "file.checksum", "file.removed_at", "file.metadata",
+	"total_count",
+}
+
+var resultColumns = []string{
+	"result_id", "analysis_id", "result_type", "storage_type", "storage_key", "content_type", "size_bytes",
+	"checksum", "created_at", "expired_at", "metadata",
+}
+
+func TestListAnalysesPageQueryCount(t *testing.T) {
+	now := time.Now()
+
+	for _, analyses := range []int{1, 5, 20} {
+		t.Run(fmt.Sprintf("%d analyses", analyses), func(t *testing.T) {
+			db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+				switch {
+				case strings.Contains(query, "FROM biomarker.analyses a"):
+					rows := &fakeRows{columns: analysisListColumns}
+					for i := 1; i <= analyses; i++ {
+						rows.values = append(rows.values, []driver.Value{
+							int64(i), fmt.Sprintf("uuid-%d", i), int64(i), "descriptive", AnalysisStatusCompleted, nil,
+							nil, nil, nil, "", "file-watcher", []byte(`{}`),
+							int64(i), fmt.Sprintf("/data/%d.csv", i), fmt.Sprintf("%d.csv", i), ".csv", int64(100), now,
+							now, "", nil, []byte(`{}`),
+							int64(analyses),
+						})
+					}
+					return rows, nil
+				case strings.Contains(query, "FROM biomarker.results"):
+					// a report and a log per analysis
+					rows := &fakeRows{columns: resultColumns}
+					for i := 1; i <= analyses; i++ {
+						for j, resultType := range []string{"report", ResultTypeLog} {
+							rows.values = append(rows.values, []driver.Value{
+								int64(i*10 + j), int64(i), resultType, "s3", fmt.Sprintf("results/%d/%s", i, resultType), "text/html", int64(10),
+								"", now, nil, []byte(`{}`),
+							})
+						}
+					}
+					return rows, nil
+				}
+				return nil, fmt.Errorf("unexpected query: %s", query)
+			}}
+			p := newFakeService(t, db)
+
+			page, err := p.ListAnalysesPage(context.Background(), AnalysisFilter{}, 50, 0)
+			if err != nil {
+				t.Fatalf("ListAnalysesPage: %v", err)
+			}
+
+			// one for the analyses and their files, one for every result on the page
+			if queries, _, _ := db.counts(); queries != 2 {
+				t.Errorf("%d queries for %d analyses, want 2", queries, analyses)
+			}
+			if len(page.Analyses) != analyses || page.Total != analyses {
+				t.Fatalf("page has %d analyses (total %d), want %d", len(page.Analyses), page.Total, analyses)
+			}
+			for _, analysis := range page.Analyses {
+				if analysis.File.FileID != analysis.FileID {
+					t.Errorf("analysis %d got file %d", analysis.AnalysisID, analysis.File.FileID)
+				}
+				if len(analysis.Results) != 2 {
+					t.Errorf("analysis %d has %d results, want 2", analysis.AnalysisID, len(analysis.Results))
+				}
+				for _, result := range analysis.Results {
+					if result.AnalysisID != analysis.AnalysisID {
+						t.Errorf("analysis %d got result %d of analysis %d", analysis.AnalysisID, result.ResultID, result.AnalysisID)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestListAnalysesPageReturnsQueryErrors(t *testing.T) {
+	db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+		return nil, fmt.Errorf("connection refused")
+	}}
+	p := newFakeService(t, db)
+
+	if _, err := p.ListAnalysesPage(context.Background(), AnalysisFilter{}, 50, 0); err == nil {
+		t.Fatal("expected the query error")
+	}
+}
+
+func TestCreateResultRecordStorageKeyCollision(t *testing.T) {
+	// enforces results_storage_type_key_unique like Postgres would
+	taken := map[string]bool{}
+	nextID := int64(0)
+	db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+		key := args[2].Value.(string) + " " + args[3].Value.(string)
+		if taken[key] {
+			return nil, &pq.Error{Code: "23505", Constraint: resultsStorageKeyConstraint}
+		}
+		taken[key] = true
+		nextID++
+		return &fakeRows{columns: []string{"result_id"}, values: [][]driver.Value{{nextID}}}, nil
+	}}
+	service := newFakeService(t, db)
+	ctx := context.Background()
+
+	create := func(analysisID int64, storageType, storageKey string) (int64, error) {
+		return service.CreateResultRecord(ctx, analysisID, "html", storageType, storageKey, "text/html", 1024, "", nil)
+	}
+
+	if _, err := create(1, "s3", "results/2026/03/01/a/report.html"); err != nil {
+		t.Fatalf("first result: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		analysisID  int64
+		storageType string
+		storageKey  string
+		wantErr     bool
+	}{
+		{"distinct key", 2, "s3", "results/2026/03/01/b/report.html", false},
+		{"same key on another backend", 2, "local", "results/2026/03/01/a/report.html", false},
+		{"same key on the same backend", 2, "s3", "results/2026/03/01/a/report.html", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultID, err := create(tt.analysisID, tt.storageType, tt.storageKey)
+			if !tt.wantErr {
+				if err != nil || resultID == 0 {
+					t.Fatalf("CreateResultRecord = %d, %v, want a new result", resultID, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrStorageKeyCollision) {
+				t.Fatalf("CreateResultRecord = %v, want ErrStorageKeyCollision", err)
+			}
+			if !strings.Contains(err.Error(), tt.storageKey) {
+				t.Errorf("error %q doesn't name the key", err)
+			}
+		})
+	}
+}
+
+func TestCreateResultRecordOtherUniqueViolation(t *testing.T) {
+	db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+		return nil, &pq.Error{Code: "23505", Constraint: "results_pkey"}
+	}}
+	service := newFakeService(t, db)
+
+	_, err := service.CreateResultRecord(context.Background(), 1, "html", "s3", "results/a/report.html", "text/html", 1024, "", nil)
+	if err == nil || errors.Is(err, ErrStorageKeyCollision) {
+		t.Errorf("CreateResultRecord = %v, want a plain failure for another constraint", err)
+	}
+}
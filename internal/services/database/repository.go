@@ -0,0 +1,29 @@
+// internal/services/database/repository.go
+package database
+
+import (
+	"context"
+)
+
+// Repository is the part of PostgresService the worker's handlers use, so they can run against a fake
+type Repository interface {
+	WithTx(ctx context.Context, fn func(tx TxWriter) error) error
+	UpdateAnalysisStatus(ctx context.Context, analysisUUID, status, errorMessage string) error
+	MergeAnalysisMetadata(ctx context.Context, analysisUUID string, metadata map[string]string) error
+	UpdateLatestResult(ctx context.Context, analysisUUID string, resultID int64, ordered bool) (bool, error)
+	FindCachedResult(ctx context.Context, inputChecksum, analysisType string) (*CachedResult, error)
+	MarkFileRemoved(ctx context.Context, filePath string) (bool, error)
+}
+
+// TxWriter is the part of Tx the worker writes through, a fake's WithTx hands out its own
+type TxWriter interface {
+	GetOrCreateFileRecord(ctx context.Context, filePath string, fileSize int64, metadata map[string]string) (int64, error)
+	CreateAnalysisRecord(ctx context.Context, fileID int64, analysisType, status, createdBy string, metadata map[string]string) (string, int64, error)
+	UpdateAnalysisStatus(ctx context.Context, analysisUUID, status, errorMessage string) error
+	CreateResultRecord(ctx context.Context, analysisID int64, resultType, storageType, storageKey, contentType string, sizeBytes int64, checksum string, metadata map[string]string) (int64, error)
+}
+
+var (
+	_ Repository = (*PostgresService)(nil)
+	_ TxWriter   = (*Tx)(nil)
+)
@@ -0,0 +1,66 @@
+// internal/services/database/tx.go
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Tx is a transaction with the same create methods as PostgresService, for writes that must land together
+type Tx struct {
+	tx     *sqlx.Tx
+	newID  func() string
+	logger *slog.Logger
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling back otherwise (or if it panics)
+func (p *PostgresService) WithTx(ctx context.Context, fn func(tx TxWriter) error) (err error) {
+	sqlTx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			sqlTx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			if rbErr := sqlTx.Rollback(); rbErr != nil {
+				p.logger.Error("Failed to roll back transaction", slog.Any("error", rbErr))
+			}
+		}
+	}()
+
+	if err = fn(&Tx{tx: sqlTx, newID: p.newID, logger: p.logger}); err != nil {
+		return err
+	}
+	if err = sqlTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (t *Tx) CreateFileRecord(ctx context.Context, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
+	return createFileRecord(ctx, t.tx, t.logger, filePath, fileSize, metadata)
+}
+
+func (t *Tx) GetOrCreateFileRecord(ctx context.Context, filePath string, fileSize int64, metadata map[string]string) (int64, error) {
+	return getOrCreateFileRecord(ctx, t.tx, filePath, fileSize, metadata)
+}
+
+// CreateAnalysisRecord also returns the analysis_id, which CreateResultRecord needs within the same transaction
+func (t *Tx) CreateAnalysisRecord(ctx context.Context, fileID int64, analysisType, status, createdBy string, metadata map[string]string) (string, int64, error) {
+	return createAnalysisRecord(ctx, t.tx, t.logger, t.newID(), fileID, analysisType, status, createdBy, metadata)
+}
+
+func (t *Tx) UpdateAnalysisStatus(ctx context.Context, analysisUUID, status, errorMessage string) error {
+	return updateAnalysisStatus(ctx, t.tx, t.logger, analysisUUID, status, errorMessage)
+}
+
+func (t *Tx) CreateResultRecord(ctx context.Context, analysisID int64, resultType, storageType, storageKey, contentType string, sizeBytes int64, checksum string, metadata map[string]string) (int64, error) {
+	return createResultRecord(ctx, t.tx, t.logger, analysisID, resultType, storageType, storageKey, contentType, sizeBytes, checksum, metadata)
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	errInsert := errors.New("insert failed")
+
+	tests := []struct {
+		name          string
+		failInsert    int // which result insert fails (1-based), 0 for none
+		panics        bool
+		wantErr       bool
+		wantCommits   int
+		wantRollbacks int
+	}{
+		{"commits when fn succeeds", 0, false, false, 1, 0},
+		{"rolls back a failed write", 2, false, true, 0, 1},
+		{"rolls back a panic", 0, true, false, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inserts := 0
+			db := &fakeDB{respond: func(query string, args []driver.NamedValue) (*fakeRows, error) {
+				if !strings.Contains(query, "INSERT INTO biomarker.results") {
+					return nil, errors.New("unexpected query: " + query)
+				}
+				inserts++
+				if inserts == tt.failInsert {
+					return nil, errInsert
+				}
+				return &fakeRows{columns: []string{"result_id"}, values: [][]driver.Value{{int64(inserts)}}}, nil
+			}}
+			p := newFakeService(t, db)
+			ctx := context.Background()
+
+			var err error
+			panicked := false
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						panicked = true
+					}
+				}()
+				err = p.WithTx(ctx, func(tx TxWriter) error {
+					for i := 0; i < 2; i++ {
+						if _, err := tx.CreateResultRecord(ctx, 1, "report", "s3", "results/a.html", "text/html", 10, "", nil); err != nil {
+							return err
+						}
+					}
+					if tt.panics {
+						panic("boom")
+					}
+					return nil
+				})
+			}()
+
+			if panicked != tt.panics {
+				t.Errorf("panicked = %v, want %v", panicked, tt.panics)
+			}
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), errInsert.Error())) {
+				t.Errorf("WithTx = %v, want the insert's error", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("WithTx = %v", err)
+			}
+			if _, commits, rollbacks := db.counts(); commits != tt.wantCommits || rollbacks != tt.wantRollbacks {
+				t.Errorf("%d commits and %d rollbacks, want %d and %d", commits, rollbacks, tt.wantCommits, tt.wantRollbacks)
+			}
+		})
+	}
+}
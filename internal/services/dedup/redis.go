@@ -0,0 +1,194 @@
+// internal/services/dedup/redis.go
+package dedup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prefix for every key we write, keeps us out of the way of anything else in the same redis db
+const keyPrefix = "watchrabbit:seen:"
+
+// how long a failed dial is remembered before we try again, so a missing redis doesn't add a dial to every event
+const redialDelay = 10 * time.Second
+
+// used when the caller's context has no deadline
+const defaultTimeout = 2 * time.Second
+
+// Store remembers processed event keys in redis for a TTL
+// it's a minimal RESP client over a single connection - we only ever need SET NX and DEL
+type Store struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+
+	mu         sync.Mutex
+	conn       net.Conn
+	rd         *bufio.Reader
+	dialErr    error
+	nextDialAt time.Time
+}
+
+// NewStore connects lazily on first use, returns nil (deduplication disabled) when ttl or addr is unset
+func NewStore(addr, password string, db int, ttl time.Duration) *Store {
+	if addr == "" || ttl <= 0 {
+		return nil
+	}
+	return &Store{addr: addr, password: password, db: db, ttl: ttl}
+}
+
+// SeenBefore claims key for the TTL, it reports true when the key was already claimed
+// callers that fail to process the event should Forget it so a redelivery isn't skipped
+func (s *Store) SeenBefore(ctx context.Context, key string) (bool, error) {
+	reply, err := s.do(ctx, "SET", keyPrefix+key, "1", "NX", "PX", strconv.FormatInt(s.ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	// nil reply: NX didn't set it because it already exists
+	return reply == nil, nil
+}
+
+// Forget releases a claimed key
+func (s *Store) Forget(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", keyPrefix+key)
+	return err
+}
+
+// Close drops the connection, the store reconnects if it's used again
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.drop()
+}
+
+// sends one command and reads its reply, the connection is dropped on any i/o error
+func (s *Store) do(ctx context.Context, args ...string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	reply, err := s.roundTrip(ctx, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		s.drop()
+	}
+	return reply, err
+}
+
+// must be called with mu held
+func (s *Store) connect(ctx context.Context) error {
+	if s.conn != nil {
+		return nil
+	}
+	if time.Now().Before(s.nextDialAt) {
+		return s.dialErr
+	}
+
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	conn, err := d.DialContext(dialCtx, "tcp", s.addr)
+	if err != nil {
+		s.dialErr = fmt.Errorf("failed to connect to redis at %s: %v", s.addr, err)
+		s.nextDialAt = time.Now().Add(redialDelay)
+		return s.dialErr
+	}
+	s.conn = conn
+	s.rd = bufio.NewReader(conn)
+
+	if s.password != "" {
+		if _, err := s.roundTrip(ctx, "AUTH", s.password); err != nil {
+			s.drop()
+			return fmt.Errorf("redis auth failed: %v", err)
+		}
+	}
+	if s.db != 0 {
+		if _, err := s.roundTrip(ctx, "SELECT", strconv.Itoa(s.db)); err != nil {
+			s.drop()
+			return fmt.Errorf("failed to select redis db %d: %v", s.db, err)
+		}
+	}
+	return nil
+}
+
+// must be called with mu held
+func (s *Store) drop() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	s.rd = nil
+	return err
+}
+
+func (s *Store) roundTrip(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	s.conn.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(s.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return s.readReply()
+}
+
+// an error reply from redis itself, the connection is still usable
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// reads a simple string, error, integer or bulk string reply - nothing we send returns an array
+func (s *Store) readReply() (interface{}, error) {
+	line, err := s.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply from redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk length from redis: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(s.rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, fmt.Errorf("unexpected reply from redis: %q", line)
+	}
+}
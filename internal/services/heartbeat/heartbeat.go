@@ -0,0 +1,83 @@
+// internal/services/heartbeat/heartbeat.go
+package heartbeat
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/pkg/messaging"
+)
+
+const Exchange = "biomarker.heartbeat.events"
+
+// Publisher periodically announces that a service instance is alive
+// dashboards treat a few missed intervals as a dead instance
+type Publisher struct {
+	client     messaging.MessageBus
+	service    string
+	instanceID string
+	interval   time.Duration
+	inFlight   func() int
+	startedAt  time.Time
+}
+
+// NewPublisher builds a heartbeat publisher, instanceID defaults to the hostname
+// inFlight reports the current amount of work in progress (nil reports 0)
+func NewPublisher(client messaging.MessageBus, service, instanceID string, interval time.Duration, inFlight func() int) *Publisher {
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+	if inFlight == nil {
+		inFlight = func() int { return 0 }
+	}
+
+	return &Publisher{
+		client:     client,
+		service:    service,
+		instanceID: instanceID,
+		interval:   interval,
+		inFlight:   inFlight,
+		startedAt:  time.Now(),
+	}
+}
+
+// Run publishes one heartbeat immediately and then every interval until ctx is done
+func (p *Publisher) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.publish(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Publisher) publish(ctx context.Context) {
+	event := events.HeartbeatEvent{
+		Service:    p.service,
+		InstanceID: p.instanceID,
+		Uptime:     time.Since(p.startedAt),
+		InFlight:   p.inFlight(),
+		Interval:   p.interval,
+		Timestamp:  time.Now(),
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// a missed heartbeat is exactly what consumers look for, so no point buffering stale ones
+	opts := messaging.PublishOptions{DeliveryMode: messaging.Transient}
+	if err := p.client.PublishEventWithOptions(publishCtx, Exchange, "heartbeat."+p.service, event, opts); err != nil {
+		log.Printf("Failed to publish heartbeat: %v", err)
+	}
+}
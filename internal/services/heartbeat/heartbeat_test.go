@@ -0,0 +1,99 @@
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/pkg/messaging"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+func TestPublisherRun(t *testing.T) {
+	bus := memory.New()
+	defer bus.Close()
+
+	interval := 50 * time.Millisecond
+	publisher := NewPublisher(bus, "worker", "worker-7", interval, func() int { return 3 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		publisher.Run(ctx)
+		close(done)
+	}()
+
+	// one straight away plus one per interval
+	time.Sleep(4*interval + interval/2)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after ctx was cancelled")
+	}
+
+	published := bus.Published()
+	if len(published) < 4 || len(published) > 6 {
+		t.Fatalf("published %d heartbeats in ~%v, want about 5", len(published), 4*interval)
+	}
+
+	var previous events.HeartbeatEvent
+	for i, message := range published {
+		if message.Exchange != Exchange || message.RoutingKey != "heartbeat.worker" {
+			t.Errorf("heartbeat %d went to %s/%s, want %s/heartbeat.worker", i, message.Exchange, message.RoutingKey, Exchange)
+		}
+		if message.Options.DeliveryMode != messaging.Transient {
+			t.Errorf("heartbeat %d delivery mode = %d, want transient", i, message.Options.DeliveryMode)
+		}
+
+		var heartbeat events.HeartbeatEvent
+		if err := json.Unmarshal(message.Body, &heartbeat); err != nil {
+			t.Fatal(err)
+		}
+		if heartbeat.Service != "worker" || heartbeat.InstanceID != "worker-7" || heartbeat.InFlight != 3 || heartbeat.Interval != interval {
+			t.Errorf("heartbeat %d = %+v", i, heartbeat)
+		}
+		if i > 0 {
+			if gap := heartbeat.Timestamp.Sub(previous.Timestamp); gap < interval/2 || gap > 3*interval {
+				t.Errorf("heartbeat %d came %v after the previous one, want about %v", i, gap, interval)
+			}
+			if heartbeat.Uptime <= previous.Uptime {
+				t.Errorf("uptime went from %v to %v", previous.Uptime, heartbeat.Uptime)
+			}
+		}
+		previous = heartbeat
+	}
+}
+
+func TestPublisherDefaults(t *testing.T) {
+	bus := memory.New()
+	defer bus.Close()
+
+	publisher := NewPublisher(bus, "file-watcher", "", time.Minute, nil)
+	hostname, _ := os.Hostname()
+	if publisher.instanceID != hostname {
+		t.Errorf("instance id = %q, want hostname %q", publisher.instanceID, hostname)
+	}
+
+	publisher.publish(context.Background())
+	var heartbeat events.HeartbeatEvent
+	if err := json.Unmarshal(bus.Published()[0].Body, &heartbeat); err != nil {
+		t.Fatal(err)
+	}
+	if heartbeat.InFlight != 0 {
+		t.Errorf("in flight = %d, want 0 without a callback", heartbeat.InFlight)
+	}
+}
+
+func TestPublisherDisabled(t *testing.T) {
+	bus := memory.New()
+	defer bus.Close()
+
+	// a zero interval returns straight away rather than ticking
+	NewPublisher(bus, "worker", "worker-7", 0, nil).Run(context.Background())
+	if published := bus.Published(); len(published) != 0 {
+		t.Errorf("published %d heartbeats with heartbeats disabled", len(published))
+	}
+}
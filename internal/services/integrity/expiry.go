@@ -0,0 +1,78 @@
+// internal/services/integrity/expiry.go
+package integrity
+
+import (
+	"context"
+	"log"
+	"time"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+// ExpiryReconciler marks result records whose stored object has disappeared (bucket lifecycle rules) as expired,
+// so lookups can answer "expired" instead of failing on a dangling key
+type ExpiryReconciler struct {
+	db          *database.PostgresService
+	storage     storage.Storer
+	storageType string // results.storage_type this backend's records use, e.g. "s3"
+	pageSize    int
+}
+
+func NewExpiryReconciler(db *database.PostgresService, storage storage.Storer, storageType string, pageSize int) *ExpiryReconciler {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+	return &ExpiryReconciler{db: db, storage: storage, storageType: storageType, pageSize: pageSize}
+}
+
+// ReconcileOnce checks every live result once and returns how many were marked expired
+func (r *ExpiryReconciler) ReconcileOnce(ctx context.Context) (int, error) {
+	expired := 0
+	var afterID int64
+	for {
+		results, err := r.db.ListLiveResults(ctx, r.storageType, afterID, r.pageSize)
+		if err != nil {
+			return expired, err
+		}
+		for _, result := range results {
+			afterID = result.ResultID
+			exists, err := r.storage.ResultExists(ctx, result.StorageKey)
+			if err != nil {
+				// one unreachable object shouldn't stop the pass, the next run retries it
+				log.Printf("Failed to check result %d (%s): %v", result.ResultID, result.StorageKey, err)
+				continue
+			}
+			if exists {
+				continue
+			}
+			if err := r.db.MarkResultExpired(ctx, result.ResultID); err != nil {
+				return expired, err
+			}
+			expired++
+		}
+		if len(results) < r.pageSize {
+			return expired, nil
+		}
+	}
+}
+
+// Run reconciles every interval until ctx is cancelled
+func (r *ExpiryReconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := r.ReconcileOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Result expiry reconciliation failed: %v", err)
+		} else if expired > 0 {
+			log.Printf("Marked %d results expired", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
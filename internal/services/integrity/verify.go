@@ -0,0 +1,71 @@
+// internal/services/integrity/verify.go
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+var (
+	// the stored object no longer matches the checksum recorded at upload
+	ErrChecksumMismatch = errors.New("stored result checksum mismatch")
+	// results uploaded before checksums were recorded can't be verified
+	ErrNoChecksum = errors.New("result has no recorded checksum")
+)
+
+// Verifier re-downloads stored results and compares them against the checksum recorded at upload
+// intended for periodic audits of the results bucket
+type Verifier struct {
+	db      resultLookup
+	storage resultDownloader
+}
+
+// the part of PostgresService the verifier needs
+type resultLookup interface {
+	GetResultRecordByID(ctx context.Context, resultID int64) (*database.ResultRecord, error)
+}
+
+// the part of S3Service the verifier needs, returns the original (decompressed) content
+type resultDownloader interface {
+	GetResult(s3Key string) ([]byte, string, error)
+}
+
+var _ resultDownloader = (*storage.S3Service)(nil)
+
+func NewVerifier(db resultLookup, storage resultDownloader) *Verifier {
+	return &Verifier{db: db, storage: storage}
+}
+
+// VerifyStoredResult returns nil if the stored object still hashes to the recorded checksum
+func (v *Verifier) VerifyStoredResult(ctx context.Context, resultID int64) error {
+	result, err := v.db.GetResultRecordByID(ctx, resultID)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("result %d not found", resultID)
+	}
+	if result.Checksum == "" {
+		return fmt.Errorf("result %d: %w", resultID, ErrNoChecksum)
+	}
+
+	// GetResult undoes any upload compression, so this hashes the original content
+	data, _, err := v.storage.GetResult(result.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to download result %d: %v", resultID, err)
+	}
+
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if actual != result.Checksum {
+		return fmt.Errorf("result %d (%s): %w: recorded %s, stored object %s",
+			resultID, result.StorageKey, ErrChecksumMismatch, result.Checksum, actual)
+	}
+
+	return nil
+}
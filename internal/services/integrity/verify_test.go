@@ -0,0 +1,78 @@
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"watchrabbit/internal/services/database"
+)
+
+type fakeResults map[int64]*database.ResultRecord
+
+func (f fakeResults) GetResultRecordByID(ctx context.Context, resultID int64) (*database.ResultRecord, error) {
+	return f[resultID], nil
+}
+
+type fakeDownloads map[string][]byte
+
+func (f fakeDownloads) GetResult(s3Key string) ([]byte, string, error) {
+	data, ok := f[s3Key]
+	if !ok {
+		return nil, "", errors.New("no such key")
+	}
+	return data, "text/html", nil
+}
+
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyStoredResult(t *testing.T) {
+	report := "<html><body>mean 4.2</body></html>"
+	results := fakeResults{
+		1: {ResultID: 1, StorageKey: "results/intact.html", Checksum: checksum(report)},
+		2: {ResultID: 2, StorageKey: "results/tampered.html", Checksum: checksum(report)},
+		3: {ResultID: 3, StorageKey: "results/legacy.html"},
+		4: {ResultID: 4, StorageKey: "results/gone.html", Checksum: checksum(report)},
+	}
+	downloads := fakeDownloads{
+		"results/intact.html":   []byte(report),
+		"results/tampered.html": []byte("<html><body>mean 9.9</body></html>"),
+		"results/legacy.html":   []byte(report),
+	}
+	verifier := NewVerifier(results, downloads)
+
+	tests := []struct {
+		name     string
+		resultID int64
+		wantErr  error
+		anyErr   bool
+	}{
+		{name: "matches", resultID: 1},
+		{name: "mismatch", resultID: 2, wantErr: ErrChecksumMismatch},
+		{name: "no recorded checksum", resultID: 3, wantErr: ErrNoChecksum},
+		{name: "object missing", resultID: 4, anyErr: true},
+		{name: "unknown result", resultID: 99, anyErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.VerifyStoredResult(context.Background(), tt.resultID)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyStoredResult = %v, want %v", err, tt.wantErr)
+				}
+			case tt.anyErr:
+				if err == nil || errors.Is(err, ErrChecksumMismatch) {
+					t.Errorf("VerifyStoredResult = %v, want a lookup error", err)
+				}
+			case err != nil:
+				t.Errorf("VerifyStoredResult = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// internal/services/logging/logging.go
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// New builds the JSON logger every command installs at startup, level is debug, info, warn or error
+func New(level string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+// Setup installs New's logger, tagged with the service name, as the slog default
+// log.Printf calls that are left go through it too (at info)
+func Setup(level, service string) (*slog.Logger, error) {
+	logger, err := New(level)
+	if err != nil {
+		return nil, err
+	}
+	logger = logger.With(slog.String("service", service))
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// ParseLevel accepts the level names case-insensitively, empty means info
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", level)
+	}
+}
@@ -0,0 +1,91 @@
+// internal/services/metrics/metrics.go
+package metrics
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serve exposes /metrics on addr until ctx is done, run it in its own goroutine
+// commands with their own http server (the worker's health server) mount promhttp.Handler() there instead
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Printf("Serving metrics on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
+
+// input file sizes seen by the analyzer, 1KiB up to 4GiB in 4x steps
+// shows whether we're mostly handling small CSVs or huge SAS extracts
+var FileSizeBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "watchrabbit",
+	Name:      "processed_file_size_bytes",
+	Help:      "Size of input files processed by analyses, by file type.",
+	Buckets:   prometheus.ExponentialBuckets(1024, 4, 12),
+}, []string{"file_type"})
+
+// ObserveFileSize records one processed file, the extension (e.g. ".csv") is the label
+func ObserveFileSize(fileType string, size int64) {
+	if fileType == "" {
+		fileType = "none"
+	}
+	FileSizeBytes.WithLabelValues(fileType).Observe(float64(size))
+}
+
+// files the worker quarantined for being re-analyzed in a loop, any increase is worth an alert
+var FilesQuarantined = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "watchrabbit",
+	Name:      "files_quarantined_total",
+	Help:      "Files quarantined for exceeding the per-file analysis rate.",
+})
+
+// files the watcher published a file.detected event for
+var FilesDetected = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "watchrabbit",
+	Name:      "files_detected_total",
+	Help:      "Files detected by the file watcher.",
+})
+
+// analyses finished by the worker, status is success, success_with_warnings, failed or timeout
+var AnalysesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "watchrabbit",
+	Name:      "analyses_total",
+	Help:      "Analyses run, by outcome.",
+}, []string{"status"})
+
+// time spent in R, 1s up to ~1h
+var AnalysisDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "watchrabbit",
+	Name:      "analysis_duration_seconds",
+	Help:      "Duration of R analyses.",
+	Buckets:   prometheus.ExponentialBuckets(1, 2, 13),
+})
+
+// events that couldn't be published (or buffered for a reconnect)
+var PublishErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "watchrabbit",
+	Name:      "publish_errors_total",
+	Help:      "Events that failed to publish.",
+})
+
+// bytes sent to S3 per result, after compression, 1KiB up to 4GiB in 4x steps
+var S3UploadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "watchrabbit",
+	Name:      "s3_upload_bytes",
+	Help:      "Size of result objects uploaded to S3.",
+	Buckets:   prometheus.ExponentialBuckets(1024, 4, 12),
+})
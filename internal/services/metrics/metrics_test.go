@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// snapshot of a histogram's count, sum and cumulative bucket counts
+func histogram(t *testing.T, observer prometheus.Observer) *dto.Histogram {
+	t.Helper()
+	var metric dto.Metric
+	if err := observer.(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram()
+}
+
+// cumulative count of the bucket with upper bound le
+func bucketCount(t *testing.T, h *dto.Histogram, le float64) uint64 {
+	t.Helper()
+	for _, bucket := range h.GetBucket() {
+		if bucket.GetUpperBound() == le {
+			return bucket.GetCumulativeCount()
+		}
+	}
+	t.Fatalf("no bucket with upper bound %v", le)
+	return 0
+}
+
+func TestObserveFileSize(t *testing.T) {
+	csvBefore := histogram(t, FileSizeBytes.WithLabelValues(".csv"))
+	noneBefore := histogram(t, FileSizeBytes.WithLabelValues("none"))
+
+	ObserveFileSize(".csv", 5000)
+	ObserveFileSize(".csv", 3<<30)
+	// files without an extension still get a label
+	ObserveFileSize("", 100)
+
+	csv := histogram(t, FileSizeBytes.WithLabelValues(".csv"))
+	if got := csv.GetSampleCount() - csvBefore.GetSampleCount(); got != 2 {
+		t.Errorf(".csv observations = %d, want 2", got)
+	}
+	if got := csv.GetSampleSum() - csvBefore.GetSampleSum(); got != 5000+3<<30 {
+		t.Errorf(".csv sum = %v, want %v", got, 5000+3<<30)
+	}
+	// 5000 bytes lands between the 4KiB and 16KiB buckets
+	if got := bucketCount(t, csv, 4096) - bucketCount(t, csvBefore, 4096); got != 0 {
+		t.Errorf("4KiB bucket gained %d, want 0", got)
+	}
+	if got := bucketCount(t, csv, 16384) - bucketCount(t, csvBefore, 16384); got != 1 {
+		t.Errorf("16KiB bucket gained %d, want 1", got)
+	}
+
+	none := histogram(t, FileSizeBytes.WithLabelValues("none"))
+	if got := none.GetSampleCount() - noneBefore.GetSampleCount(); got != 1 {
+		t.Errorf("none observations = %d, want 1", got)
+	}
+}
+
+func TestDurationAndUploadHistograms(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram prometheus.Histogram
+		value     float64
+		bucket    float64 // smallest bucket the value falls in
+	}{
+		{"analysis duration", AnalysisDuration, 90, 128},
+		{"s3 upload bytes", S3UploadBytes, 300 << 10, 1 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := histogram(t, tt.histogram)
+			tt.histogram.Observe(tt.value)
+			after := histogram(t, tt.histogram)
+
+			if got := after.GetSampleCount() - before.GetSampleCount(); got != 1 {
+				t.Errorf("observations = %d, want 1", got)
+			}
+			if got := after.GetSampleSum() - before.GetSampleSum(); got != tt.value {
+				t.Errorf("sum grew by %v, want %v", got, tt.value)
+			}
+			if got := bucketCount(t, after, tt.bucket) - bucketCount(t, before, tt.bucket); got != 1 {
+				t.Errorf("bucket %v gained %d, want 1", tt.bucket, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// internal/services/redact/redact.go
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"regexp"
+	"sync/atomic"
+)
+
+// redaction modes
+const (
+	ModeHash = "hash" // replace with a short sha256, the same value always redacts the same way so logs stay correlatable
+	ModeMask = "mask" // replace with a fixed mask
+)
+
+const mask = "***"
+
+// Redactor hides sensitive parts of file paths and event metadata before they're logged
+// (e.g. subject IDs in filenames), the values used for processing are never touched
+type Redactor struct {
+	mode         string
+	pathPatterns []*regexp.Regexp
+	metadataKeys map[string]bool
+}
+
+// pathPatterns are regexes matched against file paths, each match is redacted
+// metadataKeys name metadata entries whose values are redacted
+func New(mode string, pathPatterns, metadataKeys []string) (*Redactor, error) {
+	switch mode {
+	case "":
+		mode = ModeHash
+	case ModeHash, ModeMask:
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q (expected hash or mask)", mode)
+	}
+
+	r := &Redactor{mode: mode, metadataKeys: make(map[string]bool)}
+	for _, pattern := range pathPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err)
+		}
+		r.pathPatterns = append(r.pathPatterns, re)
+	}
+	for _, key := range metadataKeys {
+		r.metadataKeys[key] = true
+	}
+	return r, nil
+}
+
+func (r *Redactor) value(v string) string {
+	if r.mode == ModeMask {
+		return mask
+	}
+	sum := sha256.Sum256([]byte(v))
+	return "h:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Path returns path with every configured pattern match redacted
+func (r *Redactor) Path(path string) string {
+	if r == nil {
+		return path
+	}
+	for _, re := range r.pathPatterns {
+		path = re.ReplaceAllStringFunc(path, r.value)
+	}
+	return path
+}
+
+// Metadata returns a copy of metadata with the configured keys' values redacted
+func (r *Redactor) Metadata(metadata map[string]string) map[string]string {
+	if r == nil || len(r.metadataKeys) == 0 || len(metadata) == 0 {
+		return metadata
+	}
+	redacted := maps.Clone(metadata)
+	for key, value := range redacted {
+		if r.metadataKeys[key] {
+			redacted[key] = r.value(value)
+		}
+	}
+	return redacted
+}
+
+// process-wide redactor used by the package functions, like the log package's default logger
+var defaultRedactor atomic.Pointer[Redactor]
+
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// Path redacts with the default redactor, returns path unchanged if none is set
+func Path(path string) string {
+	return defaultRedactor.Load().Path(path)
+}
+
+// Metadata redacts with the default redactor, returns metadata unchanged if none is set
+func Metadata(metadata map[string]string) map[string]string {
+	return defaultRedactor.Load().Metadata(metadata)
+}
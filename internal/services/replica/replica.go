@@ -0,0 +1,52 @@
+// internal/services/replica/replica.go
+package replica
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Partition splits work (e.g. the startup scan) across replicas so each handles a disjoint subset
+// every key maps to exactly one index in [0, Count)
+type Partition struct {
+	Index int
+	Count int
+}
+
+func NewPartition(index, count int) (Partition, error) {
+	if count <= 0 {
+		count = 1
+	}
+	if index < 0 || index >= count {
+		return Partition{}, fmt.Errorf("replica index %d out of range for %d replicas", index, count)
+	}
+	return Partition{Index: index, Count: count}, nil
+}
+
+// Owns reports whether this replica is responsible for key (typically a file path)
+func (p Partition) Owns(key string) bool {
+	if p.Count <= 1 {
+		return true
+	}
+	return p.slot(key) == p.Index
+}
+
+func (p Partition) slot(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(p.Count))
+}
+
+// SleepJitter waits a random duration in [0, max) so replicas started by the same deploy
+// don't all hit RabbitMQ/S3 at the same instant
+func SleepJitter(max time.Duration) {
+	if max <= 0 {
+		return
+	}
+	delay := time.Duration(rand.Int63n(int64(max)))
+	log.Printf("Delaying startup by %s", delay.Round(time.Millisecond))
+	time.Sleep(delay)
+}
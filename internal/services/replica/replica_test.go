@@ -0,0 +1,82 @@
+package replica
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewPartition(t *testing.T) {
+	tests := []struct {
+		index, count int
+		want         Partition
+		wantErr      bool
+	}{
+		{0, 1, Partition{Index: 0, Count: 1}, false},
+		{2, 3, Partition{Index: 2, Count: 3}, false},
+		{0, 0, Partition{Index: 0, Count: 1}, false},
+		{3, 3, Partition{}, true},
+		{-1, 3, Partition{}, true},
+		{1, 0, Partition{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d of %d", tt.index, tt.count), func(t *testing.T) {
+			got, err := NewPartition(tt.index, tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("partition = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// every key belongs to exactly one replica, and the work is actually spread out
+func TestPartitionOwnsEachKeyOnce(t *testing.T) {
+	const count = 4
+	var partitions []Partition
+	for i := 0; i < count; i++ {
+		p, err := NewPartition(i, count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partitions = append(partitions, p)
+	}
+
+	owned := make([]int, count)
+	for k := 0; k < 1000; k++ {
+		key := fmt.Sprintf("/data/study%d/file%d.csv", k%7, k)
+		owners := 0
+		for i, p := range partitions {
+			if p.Owns(key) {
+				owners++
+				owned[i]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("%s owned by %d replicas", key, owners)
+		}
+		// stable across calls, so a restart doesn't reshuffle
+		if partitions[0].Owns(key) != partitions[0].Owns(key) {
+			t.Fatalf("ownership of %s changed between calls", key)
+		}
+	}
+	for i, n := range owned {
+		if n == 0 {
+			t.Errorf("replica %d owns nothing", i)
+		}
+	}
+}
+
+func TestSingleReplicaOwnsEverything(t *testing.T) {
+	p, err := NewPartition(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "/data/a.csv", "/data/b.sas7bdat"} {
+		if !p.Owns(key) {
+			t.Errorf("single replica doesn't own %q", key)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// internal/services/source/fetch.go
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"watchrabbit/internal/services/storage"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid source URL")
+	ErrTooLarge          = errors.New("source file exceeds size limit")
+	ErrUnsupportedScheme = errors.New("unsupported source URL scheme")
+	ErrUnexpectedContent = errors.New("unexpected source content type")
+)
+
+// Fetcher downloads analysis inputs submitted by URL to a local temp file, R only reads local paths
+type Fetcher struct {
+	http     *http.Client
+	s3       *storage.S3Service
+	maxBytes int64
+	// accepted Content-Type values (parameters ignored), empty accepts anything
+	contentTypes []string
+}
+
+// NewFetcher supports http(s):// and, when s3 is non-nil, s3://bucket/key URLs
+func NewFetcher(client *http.Client, s3 *storage.S3Service, maxBytes int64, contentTypes []string) *Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Fetcher{http: client, s3: s3, maxBytes: maxBytes, contentTypes: contentTypes}
+}
+
+// Open starts downloading rawURL and returns the body for streaming (e.g. straight into R's stdin)
+// the content type is checked up front and reads fail with ErrTooLarge past the size limit
+func (f *Fetcher) Open(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	var body io.ReadCloser
+	var contentType string
+	var size int64
+	switch u.Scheme {
+	case "http", "https":
+		body, contentType, size, err = f.openHTTP(ctx, u)
+	case "s3":
+		if f.s3 == nil {
+			return nil, fmt.Errorf("%w: s3 (no S3 client configured)", ErrUnsupportedScheme)
+		}
+		body, contentType, size, err = f.s3.OpenObject(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.checkContentType(contentType); err != nil {
+		body.Close()
+		return nil, err
+	}
+	// fail before downloading anything when the size is known up front
+	if f.maxBytes > 0 && size > f.maxBytes {
+		body.Close()
+		return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrTooLarge, size, f.maxBytes)
+	}
+	if f.maxBytes <= 0 {
+		return body, nil
+	}
+	return &limitedBody{ReadCloser: body, remaining: f.maxBytes}, nil
+}
+
+// Fetch streams rawURL into a temp file named with fileType (e.g. ".csv") so the analyzer sees the right extension
+// cleanup removes the file and is safe to call even when err != nil
+func (f *Fetcher) Fetch(ctx context.Context, rawURL, fileType string) (string, func(), error) {
+	cleanup := func() {}
+
+	body, err := f.Open(ctx, rawURL)
+	if err != nil {
+		return "", cleanup, err
+	}
+	defer body.Close()
+
+	u, _ := url.Parse(rawURL)
+	if fileType == "" {
+		fileType = path.Ext(u.Path)
+	}
+	tmp, err := os.CreateTemp("", "biomarker-source-*"+fileType)
+	if err != nil {
+		return "", cleanup, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	cleanup = func() {
+		if err := os.Remove(tmp.Name()); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove downloaded source %s: %v", tmp.Name(), err)
+		}
+	}
+
+	written, copyErr := io.Copy(tmp, body)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to download %s: %w", u.Redacted(), copyErr)
+	}
+	if closeErr != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to write downloaded source: %v", closeErr)
+	}
+
+	log.Printf("Downloaded %s (%d bytes) to %s", u.Redacted(), written, tmp.Name())
+	return tmp.Name(), cleanup, nil
+}
+
+// returned when an http(s) source answers with anything but 200
+type StatusError struct {
+	URL        string // redacted
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: %s", e.URL, e.Status)
+}
+
+// IsPermanent reports whether fetching again can't help: the source rejected the request (4xx other than
+// timeouts and rate limits), or the URL, content type or size is one we'll never accept
+func IsPermanent(err error) bool {
+	if errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrTooLarge) || errors.Is(err, ErrUnsupportedScheme) || errors.Is(err, ErrUnexpectedContent) {
+		return true
+	}
+	status := 0
+	var statusErr *StatusError
+	var reqErr awserr.RequestFailure
+	switch {
+	case errors.As(err, &statusErr):
+		status = statusErr.StatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.StatusCode()
+	}
+	return status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+// errors once more than the limit has been read, for bodies without a Content-Length
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	// allow one byte past the limit so we can tell "exactly the limit" from "over it"
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+func (f *Fetcher) openHTTP(ctx context.Context, u *url.URL) (io.ReadCloser, string, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to fetch %s: %v", u.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", 0, &StatusError{URL: u.Redacted(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), resp.ContentLength, nil
+}
+
+func (f *Fetcher) checkContentType(contentType string) error {
+	if len(f.contentTypes) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, allowed := range f.contentTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnexpectedContent, contentType)
+}
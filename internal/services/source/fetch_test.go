@@ -0,0 +1,135 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/data.csv":
+			w.Header().Set("Content-Type", "text/csv")
+			fmt.Fprint(w, "id,value\n1,2\n")
+		case "/big.csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Length", "100")
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		case "/big-chunked.csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.(http.Flusher).Flush() // no Content-Length, the limit is only hit while reading
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html></html>")
+		case "/busy.csv":
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		case "/slow-down.csv":
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(server.Client(), nil, 50, []string{"text/csv"})
+
+	tests := []struct {
+		name          string
+		url           string
+		wantErr       error
+		wantPermanent bool
+		wantTransient bool
+	}{
+		{name: "ok", url: server.URL + "/data.csv"},
+		{name: "not found", url: server.URL + "/missing.csv", wantPermanent: true},
+		{name: "too large by content length", url: server.URL + "/big.csv", wantErr: ErrTooLarge, wantPermanent: true},
+		{name: "too large while streaming", url: server.URL + "/big-chunked.csv", wantErr: ErrTooLarge, wantPermanent: true},
+		{name: "wrong content type", url: server.URL + "/page.html", wantErr: ErrUnexpectedContent, wantPermanent: true},
+		{name: "unsupported scheme", url: "ftp://example.com/data.csv", wantErr: ErrUnsupportedScheme, wantPermanent: true},
+		{name: "s3 without a client", url: "s3://bucket/data.csv", wantErr: ErrUnsupportedScheme, wantPermanent: true},
+		{name: "invalid url", url: "http://[::1", wantErr: ErrInvalidURL, wantPermanent: true},
+		{name: "server error", url: server.URL + "/busy.csv", wantTransient: true},
+		{name: "rate limited", url: server.URL + "/slow-down.csv", wantTransient: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cleanup, err := fetcher.Fetch(context.Background(), tt.url, ".csv")
+			defer cleanup()
+
+			if !tt.wantPermanent && !tt.wantTransient {
+				if err != nil {
+					t.Fatalf("Fetch: %v", err)
+				}
+				if filepath.Ext(path) != ".csv" {
+					t.Errorf("downloaded to %s, want a .csv temp file", path)
+				}
+				if data, _ := os.ReadFile(path); string(data) != "id,value\n1,2\n" {
+					t.Errorf("downloaded %q", data)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("Fetch succeeded, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent(%v) = %v, want %v", err, IsPermanent(err), tt.wantPermanent)
+			}
+		})
+	}
+}
+
+func TestFetchCleansUpPartialDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, strings.Repeat("x", 100))
+	}))
+	defer server.Close()
+
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "biomarker-source-*"))
+	_, cleanup, err := NewFetcher(server.Client(), nil, 10, nil).Fetch(context.Background(), server.URL+"/big.csv", ".csv")
+	cleanup()
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+	after, _ := filepath.Glob(filepath.Join(os.TempDir(), "biomarker-source-*"))
+	if len(after) > len(before) {
+		t.Errorf("partial download left behind: %v", after)
+	}
+}
+
+func TestIsPermanentS3Errors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{403, true},
+		{404, true},
+		{429, false},
+		{500, false},
+		{503, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := fmt.Errorf("failed to get s3://bucket/key: %w", awserr.NewRequestFailure(awserr.New("Code", "message", nil), tt.status, "request-id"))
+			if got := IsPermanent(err); got != tt.want {
+				t.Errorf("IsPermanent(%d) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
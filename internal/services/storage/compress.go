@@ -0,0 +1,68 @@
+// internal/services/storage/compress.go
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"strings"
+)
+
+// text formats worth gzipping, anything else (pdf, png, zip...) is already compressed or binary
+var compressibleTypes = map[string]bool{
+	"text/html":        true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"application/json": true,
+	"image/svg+xml":    true,
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	return compressibleTypes[strings.ToLower(mediaType)]
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// gunzipReader decompresses a stored object's body as it's read, closing it closes the body too
+type gunzipReader struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func newGunzipReader(body io.ReadCloser) (*gunzipReader, error) {
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &gunzipReader{Reader: reader, body: body}, nil
+}
+
+func (g *gunzipReader) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
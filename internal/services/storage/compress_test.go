@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"html report", []byte(strings.Repeat("<tr><td>1</td><td>2</td></tr>\n", 500))},
+		{"binary", []byte{0, 1, 2, 0xff, 0xfe, 0x1f, 0x8b}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := gzipBytes(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := gunzipBytes(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("round trip = %q, want %q", got, tt.data)
+			}
+		})
+	}
+
+	if _, err := gunzipBytes([]byte("not gzip")); err == nil {
+		t.Error("expected an error gunzipping plain bytes")
+	}
+}
+
+func TestIsCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html", true},
+		{"text/html; charset=utf-8", true},
+		{"TEXT/CSV", true},
+		{"application/json", true},
+		{"application/pdf", false},
+		{"image/png", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isCompressible(tt.contentType); got != tt.want {
+			t.Errorf("isCompressible(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestStoredResultRecordMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored StoredResult
+		want   map[string]string
+	}{
+		{
+			name:   "plain upload",
+			stored: StoredResult{OriginalSize: 2048, StoredSize: 2048},
+			want:   map[string]string{"original_size": "2048", "stored_size": "2048"},
+		},
+		{
+			name:   "compressed and verified",
+			stored: StoredResult{OriginalSize: 2048, StoredSize: 312, ContentEncoding: "gzip", StoredChecksum: "abc123", ContentType: "text/html"},
+			want: map[string]string{"original_size": "2048", "stored_size": "312", "content_encoding": "gzip",
+				"stored_sha256": "abc123", "content_type": "text/html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.stored.RecordMetadata()
+			if len(got) != len(tt.want) {
+				t.Fatalf("RecordMetadata = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreResultCompresses(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, checksums: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	service, err := NewS3Service(S3Config{
+		Bucket:    "results",
+		Endpoint:  server.URL,
+		AccessKey: "test",
+		SecretKey: "test",
+		Compress:  true,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("<html><body>" + strings.Repeat("<p>mean 4.2</p>", 1000) + "</body></html>")
+	output := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(output, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := service.StoreResultWithInfo(&ResultData{
+		FilePath:    "/data/a.csv",
+		AnalysisID:  "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c",
+		ContentType: "text/html",
+		OutputPath:  output,
+	})
+	if err != nil {
+		t.Fatalf("StoreResultWithInfo: %v", err)
+	}
+
+	if stored.ContentEncoding != "gzip" || stored.OriginalSize != int64(len(content)) || stored.StoredSize >= stored.OriginalSize {
+		t.Errorf("stored %+v, want gzip with a smaller stored size than %d", stored, len(content))
+	}
+	metadata := stored.RecordMetadata()
+	if metadata["original_size"] != strconv.Itoa(len(content)) || metadata["stored_size"] != strconv.FormatInt(stored.StoredSize, 10) {
+		t.Errorf("record metadata = %v", metadata)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, object := range fake.objects {
+		if int64(len(object)) != stored.StoredSize {
+			t.Errorf("object is %d bytes, StoredSize says %d", len(object), stored.StoredSize)
+		}
+		if got, err := gunzipBytes(object); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("stored object doesn't gunzip to the report: %v", err)
+		}
+		// the record's checksum is of the report itself so it survives a change of compression,
+		// the stored one is of the bytes S3 holds
+		contentSum, objectSum := sha256.Sum256(content), sha256.Sum256(object)
+		if want := hex.EncodeToString(contentSum[:]); stored.Checksum != want {
+			t.Errorf("checksum = %s, want %s (the uncompressed report)", stored.Checksum, want)
+		}
+		if want := hex.EncodeToString(objectSum[:]); stored.StoredChecksum != want {
+			t.Errorf("stored checksum = %s, want %s (the gzipped object)", stored.StoredChecksum, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// internal/services/storage/contenttype.go
+package storage
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// how much of a result http.DetectContentType looks at
+const sniffLen = 512
+
+// report formats the analyses write, checked before sniffing since e.g. a json report sniffs as text/plain
+var contentTypesByExt = map[string]string{
+	".html": "text/html; charset=utf-8",
+	".htm":  "text/html; charset=utf-8",
+	".pdf":  "application/pdf",
+	".json": "application/json",
+}
+
+// content type a result is stored with: the caller's if set, otherwise from the output file's extension,
+// otherwise sniffed from head (the start of the content) so browsers render reports rather than download them
+func resolveContentType(result *ResultData, head []byte) string {
+	if result.ContentType != "" {
+		return result.ContentType
+	}
+	if contentType, ok := contentTypesByExt[strings.ToLower(filepath.Ext(result.OutputPath))]; ok {
+		return contentType
+	}
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	return http.DetectContentType(head)
+}
+
+// copy of result with the resolved content type, the caller's ResultData is left alone
+func withContentType(result *ResultData, head []byte) *ResultData {
+	resolved := *result
+	resolved.ContentType = resolveContentType(result, head)
+	return &resolved
+}
@@ -0,0 +1,47 @@
+// internal/services/storage/disposition.go
+package storage
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// checks configured Content-Disposition modes, keyed by content type
+func validateDispositions(dispositions map[string]string) error {
+	for contentType, mode := range dispositions {
+		if mode != "inline" && mode != "attachment" {
+			return fmt.Errorf("invalid content disposition %q for %s (expected inline or attachment)", mode, contentType)
+		}
+	}
+	return nil
+}
+
+// Content-Disposition for a result, empty when nothing is configured for its content type
+// (browsers then fall back to their own guess, which is what we had before)
+func (s *S3Service) dispositionFor(result *ResultData) string {
+	mode, ok := s.dispositions[result.ContentType]
+	if !ok {
+		return ""
+	}
+	return contentDisposition(mode, friendlyFilename(result))
+}
+
+// e.g. "biomarkers_report.html" for biomarkers.csv, rather than the temp output name with the analysis id
+func friendlyFilename(result *ResultData) string {
+	original := filepath.Base(result.FilePath)
+	stem := strings.TrimSuffix(original, filepath.Ext(original))
+	if stem == "" || stem == "." {
+		return filepath.Base(result.OutputPath)
+	}
+	return stem + "_report" + filepath.Ext(result.OutputPath)
+}
+
+func contentDisposition(mode, filename string) string {
+	// FormatMediaType handles quoting, and switches to filename* for non-ascii names
+	if disposition := mime.FormatMediaType(mode, map[string]string{"filename": filename}); disposition != "" {
+		return disposition
+	}
+	return mode
+}
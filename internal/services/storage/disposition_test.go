@@ -0,0 +1,70 @@
+package storage
+
+import "testing"
+
+func TestDispositionFor(t *testing.T) {
+	s := &S3Service{dispositions: map[string]string{
+		"text/html":       "inline",
+		"application/pdf": "attachment",
+		"text/csv":        "attachment",
+	}}
+
+	tests := []struct {
+		name   string
+		result ResultData
+		want   string
+	}{
+		{
+			name:   "html shown inline",
+			result: ResultData{FilePath: "/data/study1/biomarkers.csv", OutputPath: "/tmp/out/6f1c2a9e.html", ContentType: "text/html"},
+			want:   `inline; filename=biomarkers_report.html`,
+		},
+		{
+			name:   "pdf downloaded",
+			result: ResultData{FilePath: "/data/study1/biomarkers.csv", OutputPath: "/tmp/out/6f1c2a9e.pdf", ContentType: "application/pdf"},
+			want:   `attachment; filename=biomarkers_report.pdf`,
+		},
+		{
+			name:   "csv downloaded",
+			result: ResultData{FilePath: "/data/study1/labs.sas7bdat", OutputPath: "/tmp/out/6f1c2a9e.csv", ContentType: "text/csv"},
+			want:   `attachment; filename=labs_report.csv`,
+		},
+		{
+			name:   "unconfigured type left to the browser",
+			result: ResultData{FilePath: "/data/study1/biomarkers.csv", OutputPath: "/tmp/out/6f1c2a9e.png", ContentType: "image/png"},
+			want:   "",
+		},
+		{
+			name:   "spaces quoted",
+			result: ResultData{FilePath: "/data/study 1/visit 2.csv", OutputPath: "/tmp/out/6f1c2a9e.html", ContentType: "text/html"},
+			want:   `inline; filename="visit 2_report.html"`,
+		},
+		{
+			name:   "non-ascii names use filename*",
+			result: ResultData{FilePath: "/data/études/sérum.csv", OutputPath: "/tmp/out/6f1c2a9e.html", ContentType: "text/html"},
+			want:   `inline; filename*=utf-8''s%C3%A9rum_report.html`,
+		},
+		{
+			name:   "no input name falls back to the output name",
+			result: ResultData{FilePath: "", OutputPath: "/tmp/out/6f1c2a9e.html", ContentType: "text/html"},
+			want:   `inline; filename=6f1c2a9e.html`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.dispositionFor(&tt.result); got != tt.want {
+				t.Errorf("dispositionFor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDispositions(t *testing.T) {
+	if err := validateDispositions(map[string]string{"text/html": "inline", "application/pdf": "attachment"}); err != nil {
+		t.Errorf("valid modes rejected: %v", err)
+	}
+	if err := validateDispositions(map[string]string{"text/html": "download"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,204 @@
+// internal/services/storage/local.go
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalFSStore keeps results under a base directory with the same key layout as S3,
+// for local development and testing without S3/MinIO
+type LocalFSStore struct {
+	baseDir string
+}
+
+func NewLocalFSStore(baseDir string) (*LocalFSStore, error) {
+	if baseDir == "" {
+		return nil, errors.New("local storage needs a base directory")
+	}
+	abs, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local storage directory: %v", err)
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %v", err)
+	}
+
+	slog.Info("Initialized local result storage", slog.String("dir", abs))
+	return &LocalFSStore{baseDir: abs}, nil
+}
+
+// maps a key to its file, keys are slash separated and must stay inside the base directory
+func (l *LocalFSStore) pathFor(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid result key %q", key)
+	}
+	return filepath.Join(l.baseDir, filepath.FromSlash(key)), nil
+}
+
+// StoreResult copies the result into the base directory
+func (l *LocalFSStore) StoreResult(result *ResultData) (string, error) {
+	stored, err := l.StoreResultWithInfo(result)
+	if err != nil {
+		return "", err
+	}
+	return stored.Key, nil
+}
+
+// StoreResultWithInfo copies the result into the base directory (never compressed)
+func (l *LocalFSStore) StoreResultWithInfo(result *ResultData) (*StoredResult, error) {
+	if result == nil {
+		return nil, fmt.Errorf("cannot store nil result")
+	}
+
+	key := resultKey(time.Now(), result)
+	dest, err := l.pathFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := os.Open(result.OutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result file: %v", err)
+	}
+	defer src.Close()
+	// the start of the file, for sniffing the content type when neither the caller nor the extension says
+	reader := bufio.NewReaderSize(src, sniffLen)
+	head, _ := reader.Peek(sniffLen)
+	contentType := resolveContentType(result, head)
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create result directory: %v", err)
+	}
+
+	// write to a temp file and rename so readers never see a partial result
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create result file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write result file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, fmt.Errorf("failed to write result file: %v", err)
+	}
+
+	slog.Info("Stored result locally", slog.String("key", key), slog.Int64("bytes", size))
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	return &StoredResult{
+		Key:            key,
+		OriginalSize:   size,
+		StoredSize:     size,
+		Checksum:       checksum,
+		StoredChecksum: checksum,
+		ContentType:    contentType,
+	}, nil
+}
+
+// GetResult reads a stored result, the content type is guessed from the extension
+func (l *LocalFSStore) GetResult(key string) ([]byte, string, error) {
+	p, err := l.pathFor(key)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read result: %v", err)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return data, contentType, nil
+}
+
+// GetResultStream opens a stored result, the caller closes it
+func (l *LocalFSStore) GetResultStream(key string) (io.ReadCloser, string, error) {
+	p, err := l.pathFor(key)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read result: %v", err)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, contentType, nil
+}
+
+// DeleteResult removes a stored result, deleting a missing key is not an error (same as S3)
+func (l *LocalFSStore) DeleteResult(key string) error {
+	p, err := l.pathFor(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete result: %v", err)
+	}
+	return nil
+}
+
+// ListResults lists all keys starting with prefix
+func (l *LocalFSStore) ListResults(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(l.baseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.baseDir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local results: %v", err)
+	}
+	return keys, nil
+}
+
+// ResultExists reports whether a result is stored under key
+func (l *LocalFSStore) ResultExists(ctx context.Context, key string) (bool, error) {
+	p, err := l.pathFor(key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check result: %v", err)
+	}
+	return true, nil
+}
@@ -3,14 +3,22 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
+	"watchrabbit/internal/services/metrics"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -24,6 +32,18 @@ type S3Config struct {
 	AccessKey string
 	SecretKey string
 	Endpoint  string // Optional for local testing with MinIO/LocalStack
+	// host presigned URLs are issued for when Endpoint is only reachable internally (e.g. http://minio:9000 in compose),
+	// the signature covers the host so the URL can't just be rewritten afterwards
+	PublicEndpoint string
+	Compress  bool   // gzip text artifacts (html/json/csv) before upload
+	// content type -> "inline" or "attachment", controls whether presigned downloads render or save
+	Dispositions map[string]string
+	SSE          string // server-side encryption: "" (none), "AES256" or "aws:kms"
+	KMSKeyID     string // aws:kms only, empty uses the account's default S3 key
+	// object tags on every upload (lifecycle rules act on them, e.g. retention=90d), results can add their own
+	Tags         map[string]string
+	StorageClass string // e.g. STANDARD_IA, empty for STANDARD
+	Logger       *slog.Logger // nil for slog.Default()
 }
 
 // ResultData represents data to be stored in S3
@@ -33,17 +53,71 @@ type ResultData struct {
 	ContentType string                 `json:"contentType"`
 	OutputPath  string                 `json:"outputPath"`   // Local path to the output file
 	Metadata    map[string]string      `json:"metadata"`     // Metadata for the result
+	// S3 only: object tags added to (and overriding) S3Config.Tags, e.g. study=<id>
+	Tags         map[string]string `json:"tags,omitempty"`
+	StorageClass string            `json:"storageClass,omitempty"` // S3 only, overrides S3Config.StorageClass
+}
+
+// StoredResult describes what was actually written to S3
+type StoredResult struct {
+	Key             string
+	OriginalSize    int64  // size of the local output file
+	StoredSize      int64  // size of the uploaded object (smaller when compressed)
+	ContentEncoding string // "gzip" or empty
+	Checksum        string // hex sha256 of the original (uncompressed) content
+	StoredChecksum  string // hex sha256 of the uploaded bytes, confirmed against S3 after upload
+	ContentType     string // what the result was stored as, detected when ResultData didn't say
+}
+
+// RecordMetadata returns the upload details in the form stored on a ResultRecord
+func (r *StoredResult) RecordMetadata() map[string]string {
+	metadata := map[string]string{
+		"original_size": strconv.FormatInt(r.OriginalSize, 10),
+		"stored_size":   strconv.FormatInt(r.StoredSize, 10),
+	}
+	if r.ContentEncoding != "" {
+		metadata["content_encoding"] = r.ContentEncoding
+	}
+	if r.StoredChecksum != "" {
+		metadata["stored_sha256"] = r.StoredChecksum
+	}
+	if r.ContentType != "" {
+		metadata["content_type"] = r.ContentType
+	}
+	return metadata
 }
 
 // S3Service handles storage operations using S3
 type S3Service struct {
 	client   *s3.S3
+	presignClient *s3.S3 // same as client unless a PublicEndpoint is configured
 	uploader *s3manager.Uploader
+	downloader *s3manager.Downloader
 	bucket   string
+	compress bool
+	dispositions map[string]string
+	sse          string
+	kmsKeyID     string
+	tags         map[string]string
+	storageClass string
+	logger       *slog.Logger
 }
 
 // NewS3Service creates a new S3 storage service
 func NewS3Service(config S3Config) (*S3Service, error) {
+	if err := validateDispositions(config.Dispositions); err != nil {
+		return nil, err
+	}
+	if err := validateEncryption(config.SSE, config.KMSKeyID); err != nil {
+		return nil, err
+	}
+	if err := validateTags(config.Tags); err != nil {
+		return nil, err
+	}
+	if err := validateStorageClass(config.StorageClass); err != nil {
+		return nil, err
+	}
+
 	// Create AWS session configuration
 	awsConfig := &aws.Config{
 		Region: aws.String(config.Region),
@@ -62,6 +136,10 @@ func NewS3Service(config S3Config) (*S3Service, error) {
 	if config.Endpoint != "" {
 		awsConfig.Endpoint = aws.String(config.Endpoint)
 		awsConfig.S3ForcePathStyle = aws.Bool(true) // Required for MinIO/LocalStack
+		// signing (presigning included) needs a region even though MinIO ignores it
+		if config.Region == "" {
+			awsConfig.Region = aws.String("us-east-1")
+		}
 	}
 
 	// Create session
@@ -73,38 +151,76 @@ func NewS3Service(config S3Config) (*S3Service, error) {
 	// Create S3 client and uploader
 	s3Client := s3.New(sess)
 	uploader := s3manager.NewUploader(sess)
+	// built from the same client so downloads share its session, credentials and custom endpoint
+	downloader := s3manager.NewDownloaderWithClient(s3Client)
 
-	log.Printf("Initialized S3 service for bucket: %s in region: %s", config.Bucket, config.Region)
+	presignClient := s3Client
+	if config.PublicEndpoint != "" {
+		presignClient = s3.New(sess, &aws.Config{
+			Endpoint:         aws.String(config.PublicEndpoint),
+			S3ForcePathStyle: aws.Bool(true),
+		})
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Info("Initialized S3 service", slog.String("bucket", config.Bucket), slog.String("region", config.Region))
 	
 	// Create a new S3Service instance
 	return &S3Service{
 		client:   s3Client,
+		presignClient: presignClient,
 		uploader: uploader,
+		downloader: downloader,
 		bucket:   config.Bucket,
+		compress: config.Compress,
+		dispositions: config.Dispositions,
+		sse:          config.SSE,
+		kmsKeyID:     config.KMSKeyID,
+		tags:         config.Tags,
+		storageClass: config.StorageClass,
+		logger:       logger,
 	}, nil
 }
 
+func validateEncryption(sse, kmsKeyID string) error {
+	switch sse {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		return fmt.Errorf("invalid S3 server-side encryption %q (expected AES256 or aws:kms)", sse)
+	}
+	if kmsKeyID != "" && sse != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("a KMS key id requires aws:kms server-side encryption, got %q", sse)
+	}
+	return nil
+}
+
 // StoreResult stores analysis results in S3
 func (s *S3Service) StoreResult(result *ResultData) (string, error) {
+	stored, err := s.StoreResultWithInfo(result)
+	if err != nil {
+		return "", err
+	}
+	return stored.Key, nil
+}
+
+// StoreResultWithInfo stores analysis results in S3 and reports the stored vs original size
+func (s *S3Service) StoreResultWithInfo(result *ResultData) (*StoredResult, error) {
 	if result == nil {
-		return "", fmt.Errorf("cannot store nil result")
+		return nil, fmt.Errorf("cannot store nil result")
 	}
 
 	// Generate S3 key for the result
 	// Format: results/{year}/{month}/{day}/{analysisId}/{filename}
 	now := time.Now()
-	baseFileName := filepath.Base(result.OutputPath)
-	
-	s3Key := fmt.Sprintf("results/%d/%02d/%02d/%s/%s",
-		now.Year(), now.Month(), now.Day(),
-		result.AnalysisID,
-		baseFileName,
-	)
+	s3Key := resultKey(now, result)
 
 	// Read the file from disk
 	file, err := os.Open(result.OutputPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open result file: %v", err)
+		return nil, fmt.Errorf("failed to open result file: %v", err)
 	}
 	defer file.Close()
 
@@ -120,29 +236,137 @@ func (s *S3Service) StoreResult(result *ResultData) (string, error) {
 	awsMetadata["Timestamp"] = aws.String(now.Format(time.RFC3339))
 
 	// Upload file to S3
-	log.Printf("Uploading result to S3: %s", s3Key)
+	s.logger.Info("Uploading result to S3", slog.String("key", s3Key), slog.String("analysis_id", result.AnalysisID))
 	
 	// Read file into buffer to get content length
 	fileContent, err := io.ReadAll(file)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file content: %v", err)
+		return nil, fmt.Errorf("failed to read file content: %v", err)
 	}
 	
-	// Upload using uploader
-	_, err = s.uploader.Upload(&s3manager.UploadInput{
+	// compression, disposition and the object's Content-Type all go by the resolved type
+	result = withContentType(result, fileContent)
+
+	sum := sha256.Sum256(fileContent)
+	stored := &StoredResult{
+		Key:          s3Key,
+		OriginalSize: int64(len(fileContent)),
+		Checksum:     hex.EncodeToString(sum[:]),
+		ContentType:  result.ContentType,
+	}
+
+	body := fileContent
+	if s.compress && isCompressible(result.ContentType) {
+		compressed, err := gzipBytes(fileContent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress result: %v", err)
+		}
+		// tiny files can grow when gzipped, only keep it if it actually helps
+		if len(compressed) < len(fileContent) {
+			body = compressed
+			stored.ContentEncoding = "gzip"
+		}
+	}
+	stored.StoredSize = int64(len(body))
+	bodySum := sha256.Sum256(body)
+	stored.StoredChecksum = hex.EncodeToString(bodySum[:])
+	// small results go up in one PutObject and S3 checks the whole-object checksum on receipt,
+	// bigger ones are multipart where S3 can only check each part
+	singlePart := int64(len(body)) < s.uploader.PartSize
+
+	uploadInput := &s3manager.UploadInput{
 		Bucket:      aws.String(s.bucket),
 		Key:         aws.String(s3Key),
-		Body:        bytes.NewReader(fileContent),
+		Body:        bytes.NewReader(body),
 		ContentType: aws.String(result.ContentType),
 		Metadata:    awsMetadata,
-	})
+	}
+	// browsers decompress transparently when the object carries Content-Encoding
+	if stored.ContentEncoding != "" {
+		uploadInput.ContentEncoding = aws.String(stored.ContentEncoding)
+	}
+	// presigned URLs serve this back as-is, so it decides render vs download
+	if disposition := s.dispositionFor(result); disposition != "" {
+		uploadInput.ContentDisposition = aws.String(disposition)
+	}
+
+	// lifecycle rules act on these, e.g. moving or expiring results by retention tag
+	tagging, err := s.taggingFor(result)
+	if err != nil {
+		return nil, err
+	}
+	if tagging != "" {
+		uploadInput.Tagging = aws.String(tagging)
+	}
+	storageClass := s.storageClassFor(result)
+	if err := validateStorageClass(storageClass); err != nil {
+		return nil, err
+	}
+	if storageClass != "" {
+		uploadInput.StorageClass = aws.String(storageClass)
+	}
+
+	if s.sse != "" {
+		uploadInput.ServerSideEncryption = aws.String(s.sse)
+		if s.kmsKeyID != "" {
+			uploadInput.SSEKMSKeyId = aws.String(s.kmsKeyID)
+		}
+	}
+	if singlePart {
+		uploadInput.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(bodySum[:]))
+	} else {
+		uploadInput.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+	}
+
+	// Upload using uploader
+	_, err = s.uploader.Upload(uploadInput)
 	
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to S3: %v", err)
+		return nil, fmt.Errorf("failed to upload file to S3: %v", err)
+	}
+
+	// an evicted pod has left truncated objects behind before, so confirm what S3 actually has
+	if err := s.verifyUpload(s3Key, stored.StoredSize, bodySum[:], singlePart); err != nil {
+		if _, delErr := s.client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s3Key)}); delErr != nil {
+			s.logger.Warn("Failed to remove unverified upload", slog.String("key", s3Key), slog.Any("error", delErr))
+		}
+		return nil, err
 	}
+	metrics.S3UploadBytes.Observe(float64(stored.StoredSize))
 
-	log.Printf("Successfully uploaded result to S3 at key: %s", s3Key)
-	return s3Key, nil
+	s.logger.Info("Successfully uploaded result to S3",
+		slog.String("key", s3Key),
+		slog.String("analysis_id", result.AnalysisID),
+		slog.Int64("stored_bytes", stored.StoredSize),
+		slog.Int64("original_bytes", stored.OriginalSize))
+	return stored, nil
+}
+
+// returned (wrapped) by StoreResult when the uploaded object doesn't match what was sent
+var ErrUploadMismatch = errors.New("uploaded object does not match local result")
+
+// verifyUpload compares the stored object's size, and for single part uploads its sha256, against what was sent
+// (multipart objects only carry a checksum of the part checksums)
+func (s *S3Service) verifyUpload(s3Key string, size int64, sum []byte, singlePart bool) error {
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(s3Key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify upload %s: %v", s3Key, err)
+	}
+
+	if head.ContentLength == nil || *head.ContentLength != size {
+		return fmt.Errorf("%w: %s is %d bytes, sent %d", ErrUploadMismatch, s3Key, aws.Int64Value(head.ContentLength), size)
+	}
+	if singlePart {
+		expected := base64.StdEncoding.EncodeToString(sum)
+		if actual := aws.StringValue(head.ChecksumSHA256); actual != expected {
+			return fmt.Errorf("%w: %s has sha256 %q, sent %q", ErrUploadMismatch, s3Key, actual, expected)
+		}
+	}
+	return nil
 }
 
 // GetResult retrieves a result from S3
@@ -150,13 +374,8 @@ func (s *S3Service) GetResult(s3Key string) ([]byte, string, error) {
 	// Create a buffer to store the result
 	buf := aws.NewWriteAtBuffer([]byte{})
 	
-	// Create a downloader
-	downloader := s3manager.NewDownloader(session.Must(session.NewSession(&aws.Config{
-		Region: s.client.Config.Region,
-	})))
-	
 	// Download the file
-	_, err := downloader.Download(buf,
+	_, err := s.downloader.Download(buf,
 		&s3.GetObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(s3Key),
@@ -180,10 +399,112 @@ func (s *S3Service) GetResult(s3Key string) ([]byte, string, error) {
 	if attrs.ContentType != nil {
 		contentType = *attrs.ContentType
 	}
+
+	// objects stored with compression enabled come back gzipped
+	if attrs.ContentEncoding != nil && *attrs.ContentEncoding == "gzip" {
+		data, err := gunzipBytes(buf.Bytes())
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decompress result: %v", err)
+		}
+		return data, contentType, nil
+	}
 	
 	return buf.Bytes(), contentType, nil
 }
 
+// GetResultStream returns the object body as it downloads plus its content type, for results too large to buffer
+// (the API copies it straight to the response), the caller closes the reader
+func (s *S3Service) GetResultStream(s3Key string) (io.ReadCloser, string, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get file from S3: %v", err)
+	}
+
+	contentType := "application/octet-stream"
+	if out.ContentType != nil {
+		contentType = *out.ContentType
+	}
+
+	// objects stored with compression enabled come back gzipped
+	if out.ContentEncoding != nil && *out.ContentEncoding == "gzip" {
+		body, err := newGunzipReader(out.Body)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decompress result: %v", err)
+		}
+		return body, contentType, nil
+	}
+
+	return out.Body, contentType, nil
+}
+
+// SigV4 presigned URLs can't be valid for longer than this
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// PresignResult returns a time-limited download URL for a stored result
+func (s *S3Service) PresignResult(s3Key string, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > MaxPresignExpiry {
+		return "", fmt.Errorf("presign expiry must be between 0 and %s, got %s", MaxPresignExpiry, expiry)
+	}
+
+	req, _ := s.presignClient.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+
+	url, err := req.Presign(expiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 object: %v", err)
+	}
+
+	return url, nil
+}
+
+// OpenObject streams any object the service's credentials can read, not just results in our bucket
+// (used for analysis inputs submitted as s3:// URIs), the caller closes the body
+func (s *S3Service) OpenObject(ctx context.Context, bucket, key string) (io.ReadCloser, string, int64, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+	}
+
+	contentType := ""
+	if out.ContentType != nil {
+		contentType = *out.ContentType
+	}
+	var size int64 = -1
+	if out.ContentLength != nil {
+		size = *out.ContentLength
+	}
+	return out.Body, contentType, size, nil
+}
+
+// ResultExists reports whether a stored result is still in the bucket (e.g. before reusing it from the cache)
+func (s *S3Service) ResultExists(ctx context.Context, s3Key string) (bool, error) {
+	_, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == 404 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check S3 object: %v", err)
+	}
+	return true, nil
+}
+
+// Exists is ResultExists without a deadline, for callers that don't have a context to hand
+func (s *S3Service) Exists(s3Key string) (bool, error) {
+	return s.ResultExists(context.Background(), s3Key)
+}
+
 // DeleteResult deletes a result from S3
 func (s *S3Service) DeleteResult(s3Key string) error {
 	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
@@ -205,27 +526,26 @@ func (s *S3Service) DeleteResult(s3Key string) error {
 		return fmt.Errorf("error waiting for object deletion: %v", err)
 	}
 	
-	log.Printf("Successfully deleted S3 object at key: %s", s3Key)
+	s.logger.Info("Successfully deleted S3 object", slog.String("key", s3Key))
 	return nil
 }
 
 // ListResults lists all results in a given prefix
+// S3 returns at most 1000 keys per request, so this follows the continuation tokens until the listing is complete
 func (s *S3Service) ListResults(prefix string) ([]string, error) {
-	// List objects in the bucket with the given prefix
-	resp, err := s.client.ListObjectsV2(&s3.ListObjectsV2Input{
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucket),
 		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			keys = append(keys, *item.Key)
+		}
+		return true
 	})
-	
 	if err != nil {
 		return nil, fmt.Errorf("failed to list objects in S3: %v", err)
 	}
-	
-	// Extract the keys from the response
-	var keys []string
-	for _, item := range resp.Contents {
-		keys = append(keys, *item.Key)
-	}
-	
+
 	return keys, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,130 @@
+//go:build integration
+
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"watchrabbit/internal/services/storage"
+	"watchrabbit/internal/services/storage/s3test"
+)
+
+// writes content to a temp output file and stores it as a result of analysisID
+func storeResult(t *testing.T, service *storage.S3Service, analysisID, name, contentType string, content []byte) *storage.StoredResult {
+	t.Helper()
+
+	output := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(output, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := service.StoreResultWithInfo(&storage.ResultData{
+		FilePath:    "/data/study1/labs.csv",
+		AnalysisID:  analysisID,
+		ContentType: contentType,
+		OutputPath:  output,
+	})
+	if err != nil {
+		t.Fatalf("StoreResultWithInfo: %v", err)
+	}
+	return stored
+}
+
+func TestGetResultFromLocalStack(t *testing.T) {
+	localstack := s3test.StartLocalStack(t)
+	report := []byte("<html><body>" + strings.Repeat("<p>mean 4.2</p>", 2000) + "</body></html>")
+
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"plain", false},
+		// GetResult undoes the upload compression
+		{"compressed", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := localstack.Service(t, "results-"+tt.name, func(cfg *storage.S3Config) {
+				cfg.Compress = tt.compress
+			})
+			stored := storeResult(t, service, "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c", "report.html", "text/html", report)
+			if got := stored.ContentEncoding == "gzip"; got != tt.compress {
+				t.Fatalf("stored gzipped = %v, want %v", got, tt.compress)
+			}
+
+			// twice, the downloader is built once and reused
+			for i := 0; i < 2; i++ {
+				data, contentType, err := service.GetResult(stored.Key)
+				if err != nil {
+					t.Fatalf("GetResult #%d: %v", i+1, err)
+				}
+				if !bytes.Equal(data, report) {
+					t.Errorf("GetResult #%d returned %d bytes, want the %d byte report", i+1, len(data), len(report))
+				}
+				if !strings.HasPrefix(contentType, "text/html") {
+					t.Errorf("content type = %q, want text/html", contentType)
+				}
+			}
+		})
+	}
+}
+
+func TestGetResultMissingFromLocalStack(t *testing.T) {
+	service := s3test.StartLocalStack(t).Service(t, "results")
+
+	if _, _, err := service.GetResult("results/2026/03/01/missing/report.html"); err == nil {
+		t.Error("GetResult of a missing key = nil error")
+	}
+}
+
+func TestResultExistsAgainstLocalStack(t *testing.T) {
+	localstack := s3test.StartLocalStack(t)
+	service := localstack.Service(t, "results")
+	stored := storeResult(t, service, "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c", "report.html", "text/html", []byte("<html><body>ok</body></html>"))
+
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"stored result", stored.Key, true},
+		// a 404 from HEAD is an answer, not an error
+		{"missing key", "results/2026/03/01/missing/report.html", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := service.ResultExists(context.Background(), tt.key)
+			if err != nil {
+				t.Fatalf("ResultExists: %v", err)
+			}
+			if exists != tt.want {
+				t.Errorf("ResultExists = %v, want %v", exists, tt.want)
+			}
+			if exists, err := service.Exists(tt.key); err != nil || exists != tt.want {
+				t.Errorf("Exists = %v, %v, want %v", exists, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("deleted behind the service's back", func(t *testing.T) {
+		localstack.DeleteObject(t, "results", stored.Key)
+		exists, err := service.ResultExists(context.Background(), stored.Key)
+		if err != nil || exists {
+			t.Errorf("ResultExists = %v, %v, want false", exists, err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		// anything but a 404 is reported rather than taken as missing
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := service.ResultExists(ctx, stored.Key); err == nil {
+			t.Error("ResultExists with a cancelled context = nil error")
+		}
+	})
+}
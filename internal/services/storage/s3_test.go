@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 keeps PUT objects in memory and answers HEAD with their size and the checksum the client sent,
+// truncate and badChecksum make it misreport the stored object like a broken upload would
+// bucket listings (ListObjectsV2) come back at most listPage keys at a time, 1000 like S3 when unset
+type fakeS3 struct {
+	mu          sync.Mutex
+	objects     map[string][]byte
+	checksums   map[string]string
+	headers     map[string]http.Header // request headers of each PUT, when set
+	deleted     []string
+	truncate    int
+	badChecksum bool
+	listPage    int
+	lists       int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > f.truncate {
+			body = body[:len(body)-f.truncate]
+		}
+		f.objects[r.URL.Path] = body
+		f.checksums[r.URL.Path] = r.Header.Get("X-Amz-Checksum-Sha256")
+		if f.headers != nil {
+			f.headers[r.URL.Path] = r.Header.Clone()
+		}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		checksum := f.checksums[r.URL.Path]
+		if f.badChecksum {
+			sum := sha256.Sum256([]byte("something else"))
+			checksum = base64.StdEncoding.EncodeToString(sum[:])
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("X-Amz-Checksum-Sha256", checksum)
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") != "2" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		f.list(w, r)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		f.deleted = append(f.deleted, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// one ListObjectsV2 page, the continuation token is the index of the next key
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	f.lists++
+	bucket := r.URL.Path + "/"
+	prefix := r.URL.Query().Get("prefix")
+
+	var keys []string
+	for path := range f.objects {
+		if key := strings.TrimPrefix(path, bucket); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	pageSize := f.listPage
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	end := min(start+pageSize, len(keys))
+
+	var page strings.Builder
+	page.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>`)
+	fmt.Fprintf(&page, "<KeyCount>%d</KeyCount><IsTruncated>%t</IsTruncated>", end-start, end < len(keys))
+	if end < len(keys) {
+		fmt.Fprintf(&page, "<NextContinuationToken>%d</NextContinuationToken>", end)
+	}
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(&page, "<Contents><Key>%s</Key></Contents>", key)
+	}
+	page.WriteString("</ListBucketResult>")
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(page.String()))
+}
+
+func TestStoreResultVerifiesUpload(t *testing.T) {
+	content := []byte("id,value\n1,2\n3,4\n")
+	sum := sha256.Sum256(content)
+	wantHeader := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		truncate    int
+		badChecksum bool
+		wantErr     bool
+	}{
+		{"intact upload", 0, false, false},
+		{"truncated object", 5, false, true},
+		{"checksum mismatch", 0, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{objects: map[string][]byte{}, checksums: map[string]string{}, truncate: tt.truncate, badChecksum: tt.badChecksum}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			service, err := NewS3Service(S3Config{
+				Bucket:    "results",
+				Endpoint:  server.URL,
+				AccessKey: "test",
+				SecretKey: "test",
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := filepath.Join(t.TempDir(), "summary.csv")
+			if err := os.WriteFile(output, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := service.StoreResultWithInfo(&ResultData{
+				FilePath:    "/data/a.csv",
+				AnalysisID:  "6f1c2a9e-3b7d-4e21-9c0a-5d8e7f6a1b2c",
+				ContentType: "text/csv",
+				OutputPath:  output,
+			})
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			for path, header := range fake.checksums {
+				if header != wantHeader {
+					t.Errorf("%s uploaded with checksum %q, want %q", path, header, wantHeader)
+				}
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrUploadMismatch) {
+					t.Fatalf("StoreResultWithInfo = %v, want ErrUploadMismatch", err)
+				}
+				// what's left in the bucket can't be trusted
+				if len(fake.objects) != 0 || len(fake.deleted) != 1 {
+					t.Errorf("unverified upload kept: %d objects, %d deleted", len(fake.objects), len(fake.deleted))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("StoreResultWithInfo: %v", err)
+			}
+			if want := hex.EncodeToString(sum[:]); stored.Checksum != want || stored.StoredChecksum != want {
+				t.Errorf("checksums = %s / %s, want %s", stored.Checksum, stored.StoredChecksum, want)
+			}
+			if got := stored.RecordMetadata()["stored_sha256"]; got != stored.StoredChecksum {
+				t.Errorf("record metadata has stored_sha256 %q, want %q", got, stored.StoredChecksum)
+			}
+			if !strings.HasSuffix(stored.Key, "/summary.csv") || len(fake.objects) != 1 {
+				t.Errorf("stored %s, bucket has %d objects", stored.Key, len(fake.objects))
+			}
+		})
+	}
+}
+
+func TestListResultsPaginates(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   int
+		prefix    string
+		listPage  int
+		wantKeys  int
+		wantLists int
+	}{
+		{"single page", 5, "results/2026/", 1000, 5, 1},
+		{"exactly one full page", 4, "results/2026/", 4, 4, 1},
+		{"several pages", 11, "results/2026/", 4, 11, 3},
+		{"prefix narrows the listing", 11, "results/2026/03/01/a-1", 4, 2, 1},
+		{"nothing under the prefix", 3, "results/2025/", 4, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{objects: map[string][]byte{}, checksums: map[string]string{}, listPage: tt.listPage}
+			for i := 0; i < tt.objects; i++ {
+				fake.objects[fmt.Sprintf("/results/results/2026/03/01/a-%d/report.html", i)] = []byte("<html></html>")
+			}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			service, err := NewS3Service(S3Config{
+				Bucket:    "results",
+				Endpoint:  server.URL,
+				AccessKey: "test",
+				SecretKey: "test",
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keys, err := service.ListResults(tt.prefix)
+			if err != nil {
+				t.Fatalf("ListResults: %v", err)
+			}
+			if len(keys) != tt.wantKeys {
+				t.Errorf("listed %d keys, want %d: %v", len(keys), tt.wantKeys, keys)
+			}
+			seen := map[string]bool{}
+			for _, key := range keys {
+				if seen[key] || !strings.HasPrefix(key, tt.prefix) {
+					t.Errorf("unexpected key %q", key)
+				}
+				seen[key] = true
+			}
+			if fake.lists != tt.wantLists {
+				t.Errorf("%d list requests, want %d", fake.lists, tt.wantLists)
+			}
+		})
+	}
+}
+
+func TestStoreResultEncryptionHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		sse      string
+		kmsKeyID string
+		wantSSE  string
+		wantKey  string
+	}{
+		{name: "no encryption requested"},
+		{name: "s3 managed keys", sse: "AES256", wantSSE: "AES256"},
+		{name: "default kms key", sse: "aws:kms", wantSSE: "aws:kms"},
+		{name: "customer kms key", sse: "aws:kms", kmsKeyID: "arn:aws:kms:eu-west-1:111122223333:key/1234abcd", wantSSE: "aws:kms", wantKey: "arn:aws:kms:eu-west-1:111122223333:key/1234abcd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{objects: map[string][]byte{}, checksums: map[string]string{}, headers: map[string]http.Header{}}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			service, err := NewS3Service(S3Config{
+				Bucket:    "results",
+				Endpoint:  server.URL,
+				AccessKey: "test",
+				SecretKey: "test",
+				SSE:       tt.sse,
+				KMSKeyID:  tt.kmsKeyID,
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := filepath.Join(t.TempDir(), "report.html")
+			if err := os.WriteFile(output, []byte("<html>mean 4.2</html>"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := service.StoreResultWithInfo(&ResultData{AnalysisID: "6f1c2a9e", OutputPath: output, ContentType: "text/html"}); err != nil {
+				t.Fatalf("StoreResultWithInfo: %v", err)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if len(fake.headers) != 1 {
+				t.Fatalf("%d uploads, want 1", len(fake.headers))
+			}
+			for _, header := range fake.headers {
+				if got := header.Get("X-Amz-Server-Side-Encryption"); got != tt.wantSSE {
+					t.Errorf("server-side encryption header = %q, want %q", got, tt.wantSSE)
+				}
+				if got := header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"); got != tt.wantKey {
+					t.Errorf("kms key header = %q, want %q", got, tt.wantKey)
+				}
+			}
+		})
+	}
+}
+
+func TestNewS3ServiceRejectsBadEncryption(t *testing.T) {
+	tests := []struct {
+		name     string
+		sse      string
+		kmsKeyID string
+	}{
+		{"unknown mode", "aes256", ""},
+		{"kms key without kms", "AES256", "arn:aws:kms:eu-west-1:111122223333:key/1234abcd"},
+		{"kms key with no encryption", "", "arn:aws:kms:eu-west-1:111122223333:key/1234abcd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewS3Service(S3Config{Bucket: "results", SSE: tt.sse, KMSKeyID: tt.kmsKeyID})
+			if err == nil {
+				t.Errorf("NewS3Service(sse %q, key %q) = nil error", tt.sse, tt.kmsKeyID)
+			}
+		})
+	}
+}
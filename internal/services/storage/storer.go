@@ -0,0 +1,48 @@
+// internal/services/storage/storer.go
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// results.storage_type of records written through each backend
+const (
+	StorageTypeS3    = "s3"
+	StorageTypeLocal = "local"
+)
+
+// Storer is where analysis results go, S3 in deployments and the local filesystem for development
+type Storer interface {
+	StoreResult(result *ResultData) (string, error)
+	StoreResultWithInfo(result *ResultData) (*StoredResult, error)
+	GetResult(key string) ([]byte, string, error)
+	// GetResultStream is GetResult without buffering the whole object, the caller closes the reader
+	GetResultStream(key string) (io.ReadCloser, string, error)
+	DeleteResult(key string) error
+	ListResults(prefix string) ([]string, error)
+	ResultExists(ctx context.Context, key string) (bool, error)
+}
+
+// Presigner is implemented by backends that can hand out time-limited download links (S3 only)
+type Presigner interface {
+	PresignResult(key string, expiry time.Duration) (string, error)
+}
+
+// key layout shared by every backend: results/{year}/{month}/{day}/{analysisId}/{filename}
+func resultKey(now time.Time, result *ResultData) string {
+	return fmt.Sprintf("results/%d/%02d/%02d/%s/%s",
+		now.Year(), now.Month(), now.Day(),
+		result.AnalysisID,
+		filepath.Base(result.OutputPath),
+	)
+}
+
+var (
+	_ Storer    = (*S3Service)(nil)
+	_ Storer    = (*LocalFSStore)(nil)
+	_ Presigner = (*S3Service)(nil)
+)
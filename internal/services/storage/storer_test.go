@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultKey(t *testing.T) {
+	day := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	report := &ResultData{AnalysisID: "6f1c2a9e", OutputPath: "/tmp/out/report.html"}
+
+	if got, want := resultKey(day, report), "results/2026/03/01/6f1c2a9e/report.html"; got != want {
+		t.Errorf("resultKey = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		result  *ResultData
+		collide bool
+	}{
+		// a retried upload of the same output overwrites rather than leaving a second copy
+		{"same analysis and output", day.Add(time.Hour), &ResultData{AnalysisID: "6f1c2a9e", OutputPath: "/tmp/retry/report.html"}, true},
+		{"another analysis", day, &ResultData{AnalysisID: "0b7d4e21", OutputPath: "/tmp/out/report.html"}, false},
+		{"another output of the analysis", day, &ResultData{AnalysisID: "6f1c2a9e", OutputPath: "/tmp/out/run.log"}, false},
+		{"another day", day.AddDate(0, 0, 1), &ResultData{AnalysisID: "6f1c2a9e", OutputPath: "/tmp/out/report.html"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if collide := resultKey(tt.now, tt.result) == resultKey(day, report); collide != tt.collide {
+				t.Errorf("keys collide = %v, want %v", collide, tt.collide)
+			}
+		})
+	}
+}
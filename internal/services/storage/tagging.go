@@ -0,0 +1,75 @@
+// internal/services/storage/tagging.go
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3 limits per object
+const (
+	maxObjectTags  = 10
+	maxTagKeyLen   = 128
+	maxTagValueLen = 256
+)
+
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxObjectTags {
+		return fmt.Errorf("too many object tags: %d (S3 allows %d)", len(tags), maxObjectTags)
+	}
+	for key, value := range tags {
+		if key == "" || len(key) > maxTagKeyLen {
+			return fmt.Errorf("invalid object tag key %q (1-%d characters)", key, maxTagKeyLen)
+		}
+		if len(value) > maxTagValueLen {
+			return fmt.Errorf("object tag %s value is longer than %d characters", key, maxTagValueLen)
+		}
+	}
+	return nil
+}
+
+func validateStorageClass(storageClass string) error {
+	if storageClass == "" || slices.Contains(s3.StorageClass_Values(), storageClass) {
+		return nil
+	}
+	return fmt.Errorf("invalid storage class %q (expected one of %v)", storageClass, s3.StorageClass_Values())
+}
+
+// Tagging for a result's upload, the configured tags with the result's own on top,
+// URL query encoded the way S3 expects (empty for no tags)
+func (s *S3Service) taggingFor(result *ResultData) (string, error) {
+	if len(s.tags) == 0 && len(result.Tags) == 0 {
+		return "", nil
+	}
+	tags := make(map[string]string, len(s.tags)+len(result.Tags))
+	for key, value := range s.tags {
+		tags[key] = value
+	}
+	for key, value := range result.Tags {
+		tags[key] = value
+	}
+	if err := validateTags(tags); err != nil {
+		return "", err
+	}
+	return encodeTagging(tags), nil
+}
+
+// key=value pairs joined with &, keys sorted so the same tags always encode the same way
+func encodeTagging(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+// storage class for a result's upload, the result's own if it has one
+func (s *S3Service) storageClassFor(result *ResultData) string {
+	if result.StorageClass != "" {
+		return result.StorageClass
+	}
+	return s.storageClass
+}
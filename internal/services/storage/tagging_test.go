@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncodeTagging(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want string
+	}{
+		{"plain", map[string]string{"retention": "90d"}, "retention=90d"},
+		{"sorted by key", map[string]string{"study": "ABC123", "retention": "90d"}, "retention=90d&study=ABC123"},
+		{"spaces", map[string]string{"owner": "data team"}, "owner=data+team"},
+		{"separators in values", map[string]string{"query": "a=1&b=2"}, "query=a%3D1%26b%3D2"},
+		{"separators in keys", map[string]string{"a&b": "c"}, "a%26b=c"},
+		{"slashes and plus", map[string]string{"path": "study/1+2"}, "path=study%2F1%2B2"},
+		{"unicode", map[string]string{"site": "Zürich"}, "site=Z%C3%BCrich"},
+		{"empty value", map[string]string{"draft": ""}, "draft="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeTagging(tt.tags)
+			if got != tt.want {
+				t.Errorf("encodeTagging = %q, want %q", got, tt.want)
+			}
+			// S3 decodes it as a query string, which has to give back the same tags
+			decoded, err := url.ParseQuery(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded) != len(tt.tags) {
+				t.Fatalf("decoded %d tags, want %d", len(decoded), len(tt.tags))
+			}
+			for key, value := range tt.tags {
+				if decoded.Get(key) != value {
+					t.Errorf("tag %s decoded as %q, want %q", key, decoded.Get(key), value)
+				}
+			}
+		})
+	}
+}
+
+func TestTaggingFor(t *testing.T) {
+	service := &S3Service{tags: map[string]string{"retention": "90d", "owner": "data team"}}
+
+	tests := []struct {
+		name    string
+		service *S3Service
+		result  *ResultData
+		want    string
+		wantErr bool
+	}{
+		{"no tags", &S3Service{}, &ResultData{}, "", false},
+		{"configured tags", service, &ResultData{}, "owner=data+team&retention=90d", false},
+		{"result tags on top", service, &ResultData{Tags: map[string]string{"retention": "7d", "study": "ABC/123"}}, "owner=data+team&retention=7d&study=ABC%2F123", false},
+		{"value too long", service, &ResultData{Tags: map[string]string{"note": strings.Repeat("x", maxTagValueLen+1)}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.service.taggingFor(tt.result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("taggingFor = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("taggingFor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreResultTaggingHeader(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, checksums: map[string]string{}, headers: map[string]http.Header{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	service, err := NewS3Service(S3Config{
+		Bucket:    "results",
+		Endpoint:  server.URL,
+		AccessKey: "test",
+		SecretKey: "test",
+		Tags:      map[string]string{"owner": "data team"},
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(output, []byte("<html>mean 4.2</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := &ResultData{AnalysisID: "6f1c2a9e", OutputPath: output, ContentType: "text/html", Tags: map[string]string{"study": "ABC&123"}}
+	if _, err := service.StoreResultWithInfo(result); err != nil {
+		t.Fatalf("StoreResultWithInfo: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, header := range fake.headers {
+		if got, want := header.Get("X-Amz-Tagging"), "owner=data+team&study=ABC%26123"; got != want {
+			t.Errorf("X-Amz-Tagging = %q, want %q", got, want)
+		}
+	}
+	if len(fake.headers) != 1 {
+		t.Errorf("%d uploads, want 1", len(fake.headers))
+	}
+}
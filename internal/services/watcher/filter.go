@@ -0,0 +1,137 @@
+// internal/services/watcher/filter.go
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// patterns starting with this prefix are regular expressions, everything else is a glob
+const regexPrefix = "re:"
+
+// Filter decides whether a file should be published, matching against the base filename
+// a file must have a supported extension, match an include pattern (if any are set) and no exclude pattern
+type Filter struct {
+	extensions []string
+	include    []matcher
+	exclude    []matcher
+}
+
+type matcher func(name string) bool
+
+func NewFilter(extensions, include, exclude []string) (*Filter, error) {
+	includeMatchers, err := compilePatterns(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %v", err)
+	}
+	excludeMatchers, err := compilePatterns(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %v", err)
+	}
+
+	return &Filter{
+		extensions: extensions,
+		include:    includeMatchers,
+		exclude:    excludeMatchers,
+	}, nil
+}
+
+// Allows reports whether path passes the extension, include and exclude checks (excludes win)
+func (f *Filter) Allows(path string) bool {
+	name := filepath.Base(path)
+
+	if !isFileTypeSupported(filepath.Ext(name), f.extensions) {
+		return false
+	}
+
+	for _, m := range f.exclude {
+		if m(name) {
+			return false
+		}
+	}
+
+	// no includes means every supported extension is fair game
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, m := range f.include {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns is a compiled list of globs / "re:" regexes, matched against the base filename
+type Patterns struct {
+	sources  []string
+	matchers []matcher
+}
+
+func CompilePatterns(patterns []string) (*Patterns, error) {
+	p := &Patterns{}
+	for _, pattern := range patterns {
+		matchers, err := compilePatterns([]string{pattern})
+		if err != nil {
+			return nil, err
+		}
+		if len(matchers) == 0 {
+			continue
+		}
+		p.sources = append(p.sources, strings.TrimSpace(pattern))
+		p.matchers = append(p.matchers, matchers[0])
+	}
+	return p, nil
+}
+
+// Match returns the first pattern matching path's base name
+func (p *Patterns) Match(path string) (string, bool) {
+	name := filepath.Base(path)
+	for i, m := range p.matchers {
+		if m(name) {
+			return p.sources[i], true
+		}
+	}
+	return "", false
+}
+
+func compilePatterns(patterns []string) ([]matcher, error) {
+	var matchers []matcher
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if strings.HasPrefix(pattern, regexPrefix) {
+			re, err := regexp.Compile(strings.TrimPrefix(pattern, regexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", pattern, err)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+
+		// validate the glob once up front, filepath.Match only reports ErrBadPattern when used
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		glob := pattern
+		matchers = append(matchers, func(name string) bool {
+			matched, _ := filepath.Match(glob, name)
+			return matched
+		})
+	}
+	return matchers, nil
+}
+
+func isFileTypeSupported(ext string, supportedExts []string) bool {
+	for _, supported := range supportedExts {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package watcher
+
+import "testing"
+
+func TestFilterAllows(t *testing.T) {
+	extensions := []string{".csv", ".sas7bdat"}
+	// the config defaults: office lock files and hidden files
+	defaultExclude := []string{"~$*", ".*"}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		path    string
+		want    bool
+	}{
+		{"supported extension", nil, defaultExclude, "/data/labs.csv", true},
+		{"unsupported extension", nil, defaultExclude, "/data/labs.txt", false},
+		{"partial download", nil, defaultExclude, "/data/labs.csv.part", false},
+		{"office temp file", nil, defaultExclude, "/data/~$labs.csv", false},
+		{"hidden file", nil, defaultExclude, "/data/.labs.csv", false},
+		{"hidden directory doesn't matter", nil, defaultExclude, "/data/.staging/labs.csv", true},
+		{"regex exclude", nil, []string{`re:^tmp_\d+`}, "/data/tmp_123.csv", false},
+		{"regex exclude not matching", nil, []string{`re:^tmp_\d+`}, "/data/tmp_final.csv", true},
+		{"include matches", []string{"study1_*"}, defaultExclude, "/data/study1_labs.csv", true},
+		{"include doesn't match", []string{"study1_*"}, defaultExclude, "/data/study2_labs.csv", false},
+		{"exclude wins over include", []string{"study1_*"}, []string{"*_draft.csv"}, "/data/study1_draft.csv", false},
+		{"include still needs a supported extension", []string{"*"}, nil, "/data/notes.txt", false},
+		{"blank patterns are ignored", []string{" "}, []string{""}, "/data/labs.csv", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(extensions, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Allows(tt.path); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFilterRejectsBadPatterns(t *testing.T) {
+	if _, err := NewFilter(nil, []string{"[a-"}, nil); err == nil {
+		t.Error("expected an error for a bad include glob")
+	}
+	if _, err := NewFilter(nil, nil, []string{"re:("}); err == nil {
+		t.Error("expected an error for a bad exclude regex")
+	}
+}
+
+func TestPatternsMatch(t *testing.T) {
+	p, err := CompilePatterns([]string{" *_PHI_raw* ", "", `re:^scratch_\d+\.csv$`, ".*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path        string
+		wantPattern string
+		wantMatch   bool
+	}{
+		{"/data/labs_PHI_raw.csv", "*_PHI_raw*", true},
+		{"/data/scratch_42.csv", `re:^scratch_\d+\.csv$`, true},
+		{"/data/.hidden.csv", ".*", true},
+		{"/data/labs.csv", "", false},
+		// only the base name is matched
+		{"/data/scratch_1.csv/labs.csv", "", false},
+		{"/data/old_scratch_42.csv", "", false},
+	}
+
+	for _, tt := range tests {
+		pattern, ok := p.Match(tt.path)
+		if ok != tt.wantMatch || pattern != tt.wantPattern {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.path, pattern, ok, tt.wantPattern, tt.wantMatch)
+		}
+	}
+}
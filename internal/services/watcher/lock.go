@@ -0,0 +1,47 @@
+// internal/services/watcher/lock.go
+package watcher
+
+import (
+	"os"
+	"time"
+)
+
+// LockFiles is the companion-file convention some vendors use to mark a transfer in progress:
+// while data.csv.lock (or another configured suffix) exists, data.csv is still being written
+type LockFiles struct {
+	suffixes []string
+	// how often a locked file is re-checked, and how long to wait for the lock to go away before giving up
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+// NewLockFiles returns nil (no convention) when no suffixes are configured
+func NewLockFiles(suffixes []string, pollInterval, timeout time.Duration) *LockFiles {
+	var cleaned []string
+	for _, suffix := range suffixes {
+		if suffix != "" {
+			cleaned = append(cleaned, suffix)
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil
+	}
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	return &LockFiles{suffixes: cleaned, PollInterval: pollInterval, Timeout: timeout}
+}
+
+// Locked returns the lock file that currently exists for path, if any
+func (l *LockFiles) Locked(path string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	for _, suffix := range l.suffixes {
+		lockPath := path + suffix
+		if _, err := os.Lstat(lockPath); err == nil {
+			return lockPath, true
+		}
+	}
+	return "", false
+}
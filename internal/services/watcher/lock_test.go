@@ -0,0 +1,91 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSettlerWaitsForLockFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		quiet      time.Duration
+		removeLock bool
+		wantSettle bool
+	}{
+		{"lock removed", 20 * time.Millisecond, true, true},
+		{"lock removed without settling", 0, true, true},
+		{"lock never removed", 20 * time.Millisecond, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "data.csv")
+			lockPath := path + ".uploading"
+			for _, p := range []string{path, lockPath} {
+				if err := os.WriteFile(p, []byte("id\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			settled := make(chan string, 1)
+			s := NewSettler(tt.quiet, func(path string, info os.FileInfo, created bool) { settled <- path })
+			s.SetLockFiles(NewLockFiles([]string{".lock", ".uploading"}, 10*time.Millisecond, 300*time.Millisecond))
+			defer s.Stop()
+			s.Touch(path, true)
+
+			// still held back well past the quiet period
+			select {
+			case <-settled:
+				t.Fatal("settled while the lock file was there")
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if tt.removeLock {
+				if err := os.Remove(lockPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case got := <-settled:
+				if !tt.wantSettle {
+					t.Fatalf("%s settled although its lock was never removed", got)
+				}
+				if got != path {
+					t.Errorf("settled %s, want %s", got, path)
+				}
+			case <-time.After(time.Second):
+				if tt.wantSettle {
+					t.Fatal("never settled after the lock was removed")
+				}
+			}
+			if n := s.Pending(); n != 0 {
+				t.Errorf("%d paths still pending", n)
+			}
+		})
+	}
+}
+
+func TestLockFilesLocked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(path+".lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if lockPath, locked := NewLockFiles([]string{"", ".lock"}, 0, 0).Locked(path); !locked || lockPath != path+".lock" {
+		t.Errorf("Locked = %q, %v, want %s.lock", lockPath, locked, path)
+	}
+	if _, locked := NewLockFiles([]string{".uploading"}, 0, 0).Locked(path); locked {
+		t.Error("locked by a suffix that isn't configured")
+	}
+	// no convention configured
+	if locks := NewLockFiles([]string{""}, 0, 0); locks != nil {
+		t.Errorf("NewLockFiles without suffixes = %+v, want nil", locks)
+	} else if _, locked := locks.Locked(path); locked {
+		t.Error("nil LockFiles reported a lock")
+	}
+}
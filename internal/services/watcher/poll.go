@@ -0,0 +1,107 @@
+// internal/services/watcher/poll.go
+package watcher
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Poller is the fallback for mounts where inotify events never fire (NFS, some container volumes)
+// it re-lists the directories every interval and reports files that are new or changed since the last pass
+type Poller struct {
+	directories []string
+	interval    time.Duration
+	filter      *Filter
+	seen        map[string]fileState
+}
+
+// what we compare between passes to decide if a file changed
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func NewPoller(directories []string, interval time.Duration, filter *Filter) *Poller {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Poller{
+		directories: directories,
+		interval:    interval,
+		filter:      filter,
+		seen:        make(map[string]fileState),
+	}
+}
+
+// Run polls until stop is closed, calling onChange for every new (created=true) or modified file
+// and onRemove for files that disappeared since the last pass
+// files already present on the first pass are only recorded, matching inotify which never reports them
+func (p *Poller) Run(stop <-chan struct{}, onChange func(path string, created bool), onRemove func(path string)) {
+	p.scan(nil, nil)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.scan(onChange, onRemove)
+		}
+	}
+}
+
+func (p *Poller) scan(onChange func(path string, created bool), onRemove func(path string)) {
+	current := make(map[string]fileState, len(p.seen))
+
+	for _, dir := range p.directories {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("Error polling directory %s: %v", dir, err)
+			// keep what we knew about this directory so a transient error doesn't re-emit everything
+			for path, state := range p.seen {
+				if filepath.Dir(path) == filepath.Clean(dir) {
+					current[path] = state
+				}
+			}
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !p.filter.Allows(path) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				// removed between the listing and the stat
+				continue
+			}
+
+			state := fileState{size: info.Size(), modTime: info.ModTime()}
+			current[path] = state
+
+			previous, known := p.seen[path]
+			if onChange != nil && (!known || previous != state) {
+				onChange(path, !known)
+			}
+		}
+	}
+
+	if onRemove != nil {
+		for path := range p.seen {
+			if _, ok := current[path]; !ok {
+				onRemove(path)
+			}
+		}
+	}
+
+	p.seen = current
+}
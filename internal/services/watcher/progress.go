@@ -0,0 +1,139 @@
+// internal/services/watcher/progress.go
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"watchrabbit/internal/services/redact"
+)
+
+// ScanProgress journals the files a startup scan has published, so a scan interrupted by a restart resumes
+// instead of re-publishing everything. entries carry size and mtime: a file that changed since it was journaled
+// is published again. the worker's checksum cache (CACHE_RESULTS) catches anything that still goes out twice
+type ScanProgress struct {
+	path string
+
+	mu   sync.Mutex
+	done map[string]progressEntry
+	file *os.File
+	w    *bufio.Writer
+}
+
+type progressEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"` // unix nanoseconds
+}
+
+// OpenScanProgress loads the journal at path (if an earlier scan left one) and appends to it
+func OpenScanProgress(path string) (*ScanProgress, error) {
+	p := &ScanProgress{path: path, done: make(map[string]progressEntry)}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry progressEntry
+			// a line cut off by a crash mid-write is just ignored, that file gets published again
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			p.done[entry.Path] = entry
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scan progress %s: %v", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open scan progress %s: %v", path, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scan progress %s: %v", path, err)
+	}
+	p.file = f
+	p.w = bufio.NewWriter(f)
+
+	if len(p.done) > 0 {
+		log.Printf("Resuming startup scan, %d files were already published", len(p.done))
+	}
+	return p, nil
+}
+
+// Done reports whether path was published by an earlier (interrupted) scan and hasn't changed since
+func (p *ScanProgress) Done(path string, info os.FileInfo) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.done[path]
+	return ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano()
+}
+
+// Mark journals a published file, it's buffered until the next Flush
+func (p *ScanProgress) Mark(path string, info os.FileInfo) {
+	if p == nil {
+		return
+	}
+	entry := progressEntry{Path: path, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	line, _ := json.Marshal(entry)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[path] = entry
+	p.w.Write(line)
+	p.w.WriteByte('\n')
+}
+
+// Flush writes buffered entries through to disk, called after every page
+func (p *ScanProgress) Flush() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write scan progress: %v", err)
+	}
+	return p.file.Sync()
+}
+
+// Complete removes the journal once a scan has finished, the next startup scans from scratch
+// (already recorded files are skipped through Postgres)
+func (p *ScanProgress) Complete() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.file.Close()
+	p.done = make(map[string]progressEntry)
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove scan progress %s: %v", p.path, err)
+	}
+	return nil
+}
+
+// Close flushes and keeps the journal for the next run
+func (p *ScanProgress) Close() error {
+	if p == nil {
+		return nil
+	}
+	err := p.Flush()
+	p.mu.Lock()
+	p.file.Close()
+	p.mu.Unlock()
+	if err != nil {
+		log.Printf("Startup scan progress %s may be incomplete: %v", redact.Path(p.path), err)
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+// internal/services/watcher/scan.go
+package watcher
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"watchrabbit/internal/services/redact"
+)
+
+// StartupScan finds files that were already in the watched directories before the watcher started
+// (inotify and the poller only ever report changes), e.g. files dropped while the service was down
+type StartupScan struct {
+	directories []string
+	filter      *Filter
+	// reports whether a path has already been recorded (and so analyzed)
+	known func(ctx context.Context, path string) (bool, error)
+	// replicas split the scan, nil owns everything
+	owns     func(path string) bool
+	pageSize int
+	pause    time.Duration
+	progress *ScanProgress // nil unless resuming is enabled
+}
+
+// NewStartupScan reads each directory pageSize entries at a time and sleeps pause after every page
+// that produced events, so a directory with 100k files trickles into the queue instead of flooding it
+func NewStartupScan(directories []string, filter *Filter, known func(ctx context.Context, path string) (bool, error), owns func(path string) bool, pageSize int, pause time.Duration) *StartupScan {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+	if owns == nil {
+		owns = func(string) bool { return true }
+	}
+	return &StartupScan{
+		directories: directories,
+		filter:      filter,
+		known:       known,
+		owns:        owns,
+		pageSize:    pageSize,
+		pause:       pause,
+	}
+}
+
+// SetProgress journals published files to progress, so an interrupted scan resumes where it left off
+// the scan owns it from here: it's completed (removed) when the scan finishes and closed otherwise
+func (s *StartupScan) SetProgress(progress *ScanProgress) {
+	s.progress = progress
+}
+
+// Run calls onFound for every unknown file and returns how many were found
+// a failed lookup skips that file rather than risking a duplicate analysis
+func (s *StartupScan) Run(ctx context.Context, onFound func(path string, info os.FileInfo)) (int, error) {
+	found := 0
+	for _, dir := range s.directories {
+		n, err := s.scanDir(ctx, dir, onFound)
+		found += n
+		if err != nil {
+			s.progress.Close()
+			return found, err
+		}
+	}
+	if err := s.progress.Complete(); err != nil {
+		log.Printf("Startup scan finished but %v", err)
+	}
+	return found, nil
+}
+
+func (s *StartupScan) scanDir(ctx context.Context, dir string, onFound func(path string, info os.FileInfo)) (int, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		// same as the watchers, one bad directory shouldn't stop the rest
+		log.Printf("Error scanning directory %s: %v", dir, err)
+		return 0, nil
+	}
+	defer d.Close()
+
+	found := 0
+	for {
+		entries, err := d.ReadDir(s.pageSize)
+		pageFound := 0
+
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return found, ctx.Err()
+			}
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !s.filter.Allows(path) || !s.owns(path) {
+				continue
+			}
+
+			known, lookupErr := s.known(ctx, path)
+			if lookupErr != nil {
+				log.Printf("Startup scan skipping %s, lookup failed: %v", redact.Path(path), lookupErr)
+				continue
+			}
+			if known {
+				continue
+			}
+
+			info, statErr := entry.Info()
+			if statErr != nil {
+				// removed since the listing
+				continue
+			}
+			// published before a restart interrupted the last scan
+			if s.progress.Done(path, info) {
+				continue
+			}
+			onFound(path, info)
+			s.progress.Mark(path, info)
+			pageFound++
+		}
+		found += pageFound
+		if pageFound > 0 {
+			if err := s.progress.Flush(); err != nil {
+				log.Printf("Startup scan: %v", err)
+			}
+		}
+
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			log.Printf("Error scanning directory %s: %v", dir, err)
+			return found, nil
+		}
+
+		if pageFound > 0 && s.pause > 0 {
+			select {
+			case <-ctx.Done():
+				return found, ctx.Err()
+			case <-time.After(s.pause):
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestStartupScanResumesAfterInterruption(t *testing.T) {
+	dir := t.TempDir()
+	var all []string
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("labs_%d.csv", i))
+		if err := os.WriteFile(path, []byte("id,value\n1,2\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, path)
+	}
+	progressPath := filepath.Join(t.TempDir(), "scan.progress")
+	filter, err := NewFilter([]string{".csv"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := func(context.Context, string) (bool, error) { return false, nil }
+
+	newScan := func() *StartupScan {
+		t.Helper()
+		progress, err := OpenScanProgress(progressPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan := NewStartupScan([]string{dir}, filter, unknown, nil, 2, 0)
+		scan.SetProgress(progress)
+		return scan
+	}
+
+	// a restart interrupts the first scan after three files
+	ctx, cancel := context.WithCancel(context.Background())
+	var first []string
+	_, err = newScan().Run(ctx, func(path string, info os.FileInfo) {
+		first = append(first, path)
+		if len(first) == 3 {
+			cancel()
+		}
+	})
+	if err == nil || len(first) != 3 {
+		t.Fatalf("interrupted scan published %d files (err %v), want 3 and an error", len(first), err)
+	}
+	if _, err := os.Stat(progressPath); err != nil {
+		t.Fatalf("interrupted scan didn't keep its progress: %v", err)
+	}
+
+	// one of the published files changes before the restart, it has to go out again
+	changed := first[0]
+	if err := os.WriteFile(changed, []byte("id,value\n1,2\n3,4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var second []string
+	found, err := newScan().Run(context.Background(), func(path string, info os.FileInfo) {
+		second = append(second, path)
+	})
+	if err != nil {
+		t.Fatalf("resumed scan: %v", err)
+	}
+
+	want := []string{changed}
+	for _, path := range all {
+		if !slices.Contains(first, path) {
+			want = append(want, path)
+		}
+	}
+	sort.Strings(want)
+	sort.Strings(second)
+	if found != len(want) || fmt.Sprint(second) != fmt.Sprint(want) {
+		t.Errorf("resumed scan published %v, want the unpublished rest plus the changed file %v", second, want)
+	}
+
+	// a finished scan removes its journal, the next startup starts from scratch
+	if _, err := os.Stat(progressPath); !os.IsNotExist(err) {
+		t.Errorf("progress file still there after a complete scan: %v", err)
+	}
+}
+
+func TestScanProgressIgnoresTruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "labs.csv")
+	if err := os.WriteFile(path, []byte("id\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progressPath := filepath.Join(dir, "scan.progress")
+	saved := fmt.Sprintf("{\"path\":%q,\"size\":%d,\"modTime\":%d}\n{\"path\":\"/data/cut", path, info.Size(), info.ModTime().UnixNano())
+	if err := os.WriteFile(progressPath, []byte(saved), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	progress, err := OpenScanProgress(progressPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer progress.Close()
+	if !progress.Done(path, info) {
+		t.Errorf("%s not marked done from the saved progress", path)
+	}
+}
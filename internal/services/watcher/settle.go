@@ -0,0 +1,172 @@
+// internal/services/watcher/settle.go
+package watcher
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+	"watchrabbit/internal/services/redact"
+)
+
+// Settler debounces file events until a file stops changing
+// editors and large copies fire Create followed by a stream of Writes - we only want one event
+// once the size and modtime have held still for the quiet period
+type Settler struct {
+	quiet     time.Duration
+	onSettled func(path string, info os.FileInfo, created bool)
+	locks     *LockFiles // nil unless a lock-file convention is configured
+
+	mu      sync.Mutex
+	pending map[string]*pendingFile
+	stopped bool
+	// onSettled calls currently running, Stop waits for them
+	running sync.WaitGroup
+}
+
+type pendingFile struct {
+	timer   *time.Timer
+	size    int64
+	modTime time.Time
+	created bool
+	// when a lock file was first seen for it, zero while unlocked
+	lockedSince time.Time
+}
+
+// NewSettler calls onSettled (from a timer goroutine) once a touched path has been quiet for the given period
+// created is true if any of the debounced events was a create (new file) rather than a modification
+func NewSettler(quiet time.Duration, onSettled func(path string, info os.FileInfo, created bool)) *Settler {
+	return &Settler{
+		quiet:     quiet,
+		onSettled: onSettled,
+		pending:   make(map[string]*pendingFile),
+	}
+}
+
+// SetLockFiles holds settled files back while a companion lock file exists, see LockFiles
+// call it before the first Touch
+func (s *Settler) SetLockFiles(locks *LockFiles) {
+	s.locks = locks
+}
+
+// Touch records activity on a path and restarts its quiet period
+func (s *Settler) Touch(path string, created bool) {
+	// settling disabled, publish right away (unless it has to wait for a lock file)
+	if _, locked := s.locks.Locked(path); s.quiet <= 0 && !locked {
+		if info, err := os.Stat(path); err == nil {
+			s.onSettled(path, info, created)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+
+	if p, ok := s.pending[path]; ok {
+		p.created = p.created || created
+		p.timer.Reset(s.wait())
+		return
+	}
+
+	p := &pendingFile{size: -1, created: created}
+	p.timer = time.AfterFunc(s.wait(), func() { s.check(path) })
+	s.pending[path] = p
+}
+
+// re-stat once the quiet period is over, re-arm if the file is still growing
+func (s *Settler) check(path string) {
+	info, statErr := os.Stat(path)
+
+	s.mu.Lock()
+	p, ok := s.pending[path]
+	if !ok || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+
+	if statErr != nil {
+		// removed (or renamed away) before it settled
+		delete(s.pending, path)
+		s.mu.Unlock()
+		log.Printf("File disappeared before settling: %s", redact.Path(path))
+		return
+	}
+
+	if info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+		p.size = info.Size()
+		p.modTime = info.ModTime()
+		p.timer.Reset(s.wait())
+		s.mu.Unlock()
+		return
+	}
+
+	// the size held still but the sender says it isn't done, keep polling until the lock goes away
+	if lockPath, locked := s.locks.Locked(path); locked {
+		now := time.Now()
+		if p.lockedSince.IsZero() {
+			p.lockedSince = now
+			log.Printf("Waiting for lock file %s before processing %s", redact.Path(lockPath), redact.Path(path))
+		}
+		if s.locks.Timeout > 0 && now.Sub(p.lockedSince) >= s.locks.Timeout {
+			delete(s.pending, path)
+			s.mu.Unlock()
+			log.Printf("Gave up on %s, lock file %s was still there after %s", redact.Path(path), redact.Path(lockPath), s.locks.Timeout)
+			return
+		}
+		p.timer.Reset(s.locks.PollInterval)
+		s.mu.Unlock()
+		return
+	}
+
+	delete(s.pending, path)
+	s.running.Add(1)
+	s.mu.Unlock()
+
+	defer s.running.Done()
+	s.onSettled(path, info, p.created)
+}
+
+// quiet period before a (re-)check, must be called with mu held
+// with settling disabled only locked files are ever pending, they're polled at the lock interval
+func (s *Settler) wait() time.Duration {
+	if s.quiet <= 0 && s.locks != nil {
+		return s.locks.PollInterval
+	}
+	return s.quiet
+}
+
+// Forget drops a pending path, e.g. when it was removed before settling
+func (s *Settler) Forget(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.pending[path]; ok {
+		p.timer.Stop()
+		delete(s.pending, path)
+	}
+}
+
+// Pending returns how many paths are still waiting to settle
+func (s *Settler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Stop cancels all pending timers, files that haven't settled yet are dropped
+// blocks until any onSettled call already in progress (e.g. a publish) returns
+func (s *Settler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	for path, p := range s.pending {
+		p.timer.Stop()
+		delete(s.pending, path)
+	}
+	s.mu.Unlock()
+
+	s.running.Wait()
+}
@@ -0,0 +1,119 @@
+// internal/transport/api/analyses.go
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"watchrabbit/internal/services/database"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// AnalysisListHandler pages through analyses, newest first
+// GET /analyses?status=failed&type=descriptive&from=2024-01-01&limit=50&offset=100
+// accepts the same filters as the export
+type AnalysisListHandler struct {
+	db *database.PostgresService
+}
+
+func NewAnalysisListHandler(db *database.PostgresService) *AnalysisListHandler {
+	return &AnalysisListHandler{db: db}
+}
+
+func (h *AnalysisListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.db.ListAnalysesPage(r.Context(), filter, limit, offset)
+	if err != nil {
+		log.Printf("Failed to list analyses: %v", err)
+		http.Error(w, "failed to list analyses", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, page)
+}
+
+// AnalysisHandler returns one analysis and its results
+// GET /analyses/{uuid}
+type AnalysisHandler struct {
+	db *database.PostgresService
+}
+
+func NewAnalysisHandler(db *database.PostgresService) *AnalysisHandler {
+	return &AnalysisHandler{db: db}
+}
+
+// analysis plus its results, the shape of GET /analyses/{uuid}
+type analysisResponse struct {
+	*database.AnalysisRecord
+	Results []database.ResultRecord `json:"results"`
+}
+
+func (h *AnalysisHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	analysisUUID := r.PathValue("uuid")
+
+	analysis, err := h.db.GetAnalysisRecordByUUID(r.Context(), analysisUUID)
+	if err != nil {
+		log.Printf("Failed to look up analysis %s: %v", analysisUUID, err)
+		http.Error(w, "failed to look up analysis", http.StatusInternalServerError)
+		return
+	}
+	if analysis == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	results, err := h.db.GetResultsByAnalysisUUID(r.Context(), analysisUUID)
+	if err != nil {
+		log.Printf("Failed to look up results of analysis %s: %v", analysisUUID, err)
+		http.Error(w, "failed to look up results", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []database.ResultRecord{}
+	}
+	writeJSON(w, analysisResponse{AnalysisRecord: analysis, Results: results})
+}
+
+// limit defaults to defaultPageSize and is capped at maxPageSize
+func parsePage(r *http.Request) (int, int, error) {
+	query := r.URL.Query()
+	limit, offset := defaultPageSize, 0
+
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %q", value)
+		}
+		limit = min(n, maxPageSize)
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %q", value)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// internal/transport/api/export.go
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+// rows between flushes to the client, keeps memory flat for big exports
+const exportFlushEvery = 500
+
+var exportHeader = []string{"analysis_uuid", "file_path", "analysis_type", "status", "duration_ms", "created_at", "result_url"}
+
+// ExportHandler streams a CSV index of analyses for import into Excel
+// GET /admin/analyses/export?status=success&from=2024-01-01&to=2024-02-01
+type ExportHandler struct {
+	db            *database.PostgresService
+	storage       *storage.S3Service
+	presignExpiry time.Duration
+}
+
+func NewExportHandler(db *database.PostgresService, storage *storage.S3Service, presignExpiry time.Duration) *ExportHandler {
+	return &ExportHandler{
+		db:            db,
+		storage:       storage,
+		presignExpiry: presignExpiry,
+	}
+}
+
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="analyses_%s.csv"`, time.Now().Format("20060102")))
+
+	writer := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	if err := writer.Write(exportHeader); err != nil {
+		log.Printf("Failed to write export header: %v", err)
+		return
+	}
+
+	count := 0
+	err = h.db.ExportAnalyses(r.Context(), filter, func(row database.AnalysisExportRow) error {
+		if err := writer.Write(h.exportRecord(row)); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return writer.Error()
+	})
+	writer.Flush()
+
+	// headers are already sent at this point, so all we can do is log and cut the response short
+	if err != nil {
+		log.Printf("Analysis export failed after %d rows: %v", count, err)
+		return
+	}
+
+	log.Printf("Exported %d analyses", count)
+}
+
+func (h *ExportHandler) exportRecord(row database.AnalysisExportRow) []string {
+	duration := ""
+	if row.DurationMs != nil {
+		duration = strconv.FormatInt(*row.DurationMs, 10)
+	}
+
+	resultURL := ""
+	if row.StorageKey != nil && *row.StorageKey != "" {
+		url, err := h.storage.PresignResult(*row.StorageKey, h.presignExpiry)
+		if err != nil {
+			log.Printf("Failed to presign result for analysis %s: %v", row.AnalysisUUID, err)
+		} else {
+			resultURL = url
+		}
+	}
+
+	return []string{
+		row.AnalysisUUID,
+		row.FilePath,
+		row.AnalysisType,
+		row.Status,
+		duration,
+		row.CreatedAt.Format(time.RFC3339),
+		resultURL,
+	}
+}
+
+// from/to accept either a date (2006-01-02) or a full RFC3339 timestamp
+func parseExportFilter(r *http.Request) (database.ExportFilter, error) {
+	query := r.URL.Query()
+	filter := database.ExportFilter{Status: query.Get("status"), AnalysisType: query.Get("type")}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.CreatedAfter, err = parseTime(from); err != nil {
+			return filter, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.CreatedBefore, err = parseTime(to); err != nil {
+			return filter, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+func TestExportRecord(t *testing.T) {
+	s3Service, err := storage.NewS3Service(storage.S3Config{
+		Bucket:    "results",
+		AccessKey: "key",
+		SecretKey: "secret",
+		Endpoint:  "http://minio:9000",
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewExportHandler(nil, s3Service, time.Hour)
+
+	createdAt := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	duration := int64(1500)
+	key := "results/a/report.html"
+
+	tests := []struct {
+		name      string
+		row       database.AnalysisExportRow
+		wantLine  string
+		wantURLOf string
+	}{
+		{
+			name: "completed with result",
+			row: database.AnalysisExportRow{
+				AnalysisUUID: "uuid-1", FilePath: "/data/a.csv", AnalysisType: "descriptive",
+				Status: "completed", DurationMs: &duration, CreatedAt: createdAt, StorageKey: &key,
+			},
+			wantLine:  "uuid-1,/data/a.csv,descriptive,completed,1500,2026-03-04T05:06:07Z,",
+			wantURLOf: key,
+		},
+		{
+			name: "pending without duration or result",
+			row: database.AnalysisExportRow{
+				AnalysisUUID: "uuid-2", FilePath: "/data/b.csv", AnalysisType: "descriptive",
+				Status: "pending", CreatedAt: createdAt,
+			},
+			wantLine: "uuid-2,/data/b.csv,descriptive,pending,,2026-03-04T05:06:07Z,\n",
+		},
+		{
+			name: "path needing quotes",
+			row: database.AnalysisExportRow{
+				AnalysisUUID: "uuid-3", FilePath: `/data/site 1, "draft".csv`, AnalysisType: "descriptive",
+				Status: "failed", CreatedAt: createdAt,
+			},
+			wantLine: `uuid-3,"/data/site 1, ""draft"".csv",descriptive,failed,,2026-03-04T05:06:07Z,` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := h.exportRecord(tt.row)
+			if len(record) != len(exportHeader) {
+				t.Fatalf("record has %d columns, header has %d", len(record), len(exportHeader))
+			}
+
+			var buf bytes.Buffer
+			writer := csv.NewWriter(&buf)
+			if err := writer.Write(record); err != nil {
+				t.Fatal(err)
+			}
+			writer.Flush()
+
+			if !strings.HasPrefix(buf.String(), tt.wantLine) {
+				t.Errorf("csv row = %q, want prefix %q", buf.String(), tt.wantLine)
+			}
+			resultURL := record[len(record)-1]
+			if tt.wantURLOf == "" && resultURL != "" {
+				t.Errorf("result_url = %q, want empty", resultURL)
+			}
+			if tt.wantURLOf != "" && (!strings.HasPrefix(resultURL, "http://minio:9000/results/") || !strings.Contains(resultURL, tt.wantURLOf)) {
+				t.Errorf("result_url = %q, want a presigned link to %s", resultURL, tt.wantURLOf)
+			}
+		})
+	}
+}
+
+func TestParseExportFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    database.ExportFilter
+		wantErr bool
+	}{
+		{"", database.ExportFilter{}, false},
+		{"status=completed&type=descriptive", database.ExportFilter{Status: "completed", AnalysisType: "descriptive"}, false},
+		{"from=2024-01-01&to=2024-02-01T12:00:00Z", database.ExportFilter{
+			CreatedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedBefore: time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+		}, false},
+		{"from=yesterday", database.ExportFilter{}, true},
+		{"to=2024-13-01", database.ExportFilter{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := parseExportFilter(httptest.NewRequest("GET", "/admin/analyses/export?"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Status != tt.want.Status || got.AnalysisType != tt.want.AnalysisType ||
+				!got.CreatedAfter.Equal(tt.want.CreatedAfter) || !got.CreatedBefore.Equal(tt.want.CreatedBefore)) {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
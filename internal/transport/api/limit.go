@@ -0,0 +1,49 @@
+// internal/transport/api/limit.go
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DownloadLimiter bounds how many result downloads run at once, each one keeps an S3 stream open until the client has it
+// requests over the limit queue for up to wait, then get a 503 with Retry-After
+type DownloadLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// max <= 0 disables the limit
+func NewDownloadLimiter(max int, wait time.Duration) *DownloadLimiter {
+	if max <= 0 {
+		return &DownloadLimiter{}
+	}
+	return &DownloadLimiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+func (l *DownloadLimiter) Wrap(next http.Handler) http.Handler {
+	if l.slots == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(l.wait)
+		defer timer.Stop()
+
+		select {
+		case l.slots <- struct{}{}:
+		case <-timer.C:
+			// clients waiting this long behind a full queue should come back about one wait period later
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(l.wait.Seconds(), 1)))))
+			http.Error(w, "too many concurrent downloads, retry later", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return
+		}
+		defer func() { <-l.slots }()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a download that holds its slot until release is closed, tracking how many run at once
+type blockingDownload struct {
+	release chan struct{}
+	started chan struct{}
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func newBlockingDownload() *blockingDownload {
+	return &blockingDownload{release: make(chan struct{}), started: make(chan struct{}, 100)}
+}
+
+func (d *blockingDownload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	running := d.running.Add(1)
+	defer d.running.Add(-1)
+	for {
+		peak := d.peak.Load()
+		if running <= peak || d.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	d.started <- struct{}{}
+	<-d.release
+	w.Write([]byte("report"))
+}
+
+func fetchReport(handler http.Handler) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results/a/report.html", nil))
+	return rec
+}
+
+func TestDownloadLimiterBoundsConcurrency(t *testing.T) {
+	download := newBlockingDownload()
+	handler := NewDownloadLimiter(2, 5*time.Second).Wrap(download)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- fetchReport(handler).Code
+		}()
+	}
+
+	// two start, the rest queue behind them
+	for i := 0; i < 2; i++ {
+		<-download.started
+	}
+	time.Sleep(50 * time.Millisecond)
+	if running := download.running.Load(); running != 2 {
+		t.Fatalf("%d downloads running, want 2", running)
+	}
+
+	close(download.release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("queued download got %d, want 200", code)
+		}
+	}
+	if peak := download.peak.Load(); peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+}
+
+func TestDownloadLimiterQueueTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		wait           time.Duration
+		wantRetryAfter string
+	}{
+		{"sub-second wait rounds up", 50 * time.Millisecond, "1"},
+		{"whole seconds", 1500 * time.Millisecond, "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			download := newBlockingDownload()
+			defer close(download.release)
+			handler := NewDownloadLimiter(1, tt.wait).Wrap(download)
+
+			go fetchReport(handler)
+			<-download.started
+
+			start := time.Now()
+			rec := fetchReport(handler)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want 503", rec.Code)
+			}
+			if waited := time.Since(start); waited < tt.wait {
+				t.Errorf("gave up after %v, want at least %v", waited, tt.wait)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestDownloadLimiterDisabled(t *testing.T) {
+	download := newBlockingDownload()
+	handler := NewDownloadLimiter(0, time.Millisecond).Wrap(download)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetchReport(handler)
+		}()
+	}
+	// all of them get in without waiting on each other
+	for i := 0; i < 5; i++ {
+		<-download.started
+	}
+	close(download.release)
+	wg.Wait()
+}
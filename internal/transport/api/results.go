@@ -0,0 +1,78 @@
+// internal/transport/api/results.go
+package api
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+// ResultHandler serves a stored result by key, for clients without S3 credentials or presigned links
+// mounted at GET /results/{key...}, e.g. /results/2024/01/31/<analysis id>/analysis_x.html
+// results whose object was removed by a bucket lifecycle rule answer 410 rather than 404
+type ResultHandler struct {
+	db          resultRecords
+	storage     storage.Storer
+	storageType string
+}
+
+// the part of PostgresService the result handler needs
+type resultRecords interface {
+	GetResultRecordByStorageKey(ctx context.Context, storageType, storageKey string) (*database.ResultRecord, error)
+	MarkResultExpired(ctx context.Context, resultID int64) error
+}
+
+func NewResultHandler(db resultRecords, storage storage.Storer, storageType string) *ResultHandler {
+	return &ResultHandler{db: db, storage: storage, storageType: storageType}
+}
+
+func (h *ResultHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := "results/" + r.PathValue("key")
+
+	record, err := h.db.GetResultRecordByStorageKey(r.Context(), h.storageType, key)
+	if err != nil {
+		log.Printf("Failed to look up result record %s: %v", key, err)
+		http.Error(w, "failed to look up result", http.StatusInternalServerError)
+		return
+	}
+	if record != nil && record.ExpiredAt != nil {
+		http.Error(w, "artifact expired", http.StatusGone)
+		return
+	}
+
+	exists, err := h.storage.ResultExists(r.Context(), key)
+	if err != nil {
+		log.Printf("Failed to look up result %s: %v", key, err)
+		http.Error(w, "failed to look up result", http.StatusBadGateway)
+		return
+	}
+	if !exists {
+		// recorded but gone: expired since the reconciler's last pass, record it now
+		if record != nil {
+			if err := h.db.MarkResultExpired(r.Context(), record.ResultID); err != nil {
+				log.Printf("Failed to mark result %d expired: %v", record.ResultID, err)
+			}
+			http.Error(w, "artifact expired", http.StatusGone)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	// streamed, a large report isn't held in memory per request
+	body, contentType, err := h.storage.GetResultStream(key)
+	if err != nil {
+		log.Printf("Failed to fetch result %s: %v", key, err)
+		http.Error(w, "failed to fetch result", http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Failed to send result %s: %v", key, err)
+	}
+}
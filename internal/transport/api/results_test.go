@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/internal/services/storage"
+)
+
+// fakeResultRecords knows results by storage key and records which were marked expired
+type fakeResultRecords struct {
+	records map[string]*database.ResultRecord
+	expired []int64
+}
+
+func (f *fakeResultRecords) GetResultRecordByStorageKey(ctx context.Context, storageType, storageKey string) (*database.ResultRecord, error) {
+	return f.records[storageKey], nil
+}
+
+func (f *fakeResultRecords) MarkResultExpired(ctx context.Context, resultID int64) error {
+	f.expired = append(f.expired, resultID)
+	return nil
+}
+
+func TestResultHandler(t *testing.T) {
+	store, err := storage.NewLocalFSStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(output, []byte("<html>mean 4.2</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	storeReport := func(analysisID string) string {
+		key, err := store.StoreResult(&storage.ResultData{AnalysisID: analysisID, OutputPath: output, ContentType: "text/html"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	liveKey := storeReport("live")
+	// the bucket lifecycle rule removed it, and the reconciler has already noticed
+	expiredAt := time.Now().Add(-time.Hour)
+	markedKey := storeReport("marked")
+	// removed since the reconciler's last pass, the record still looks live
+	vanishedKey := storeReport("vanished")
+	for _, key := range []string{markedKey, vanishedKey} {
+		if err := store.DeleteResult(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		key         string
+		wantStatus  int
+		wantExpired []int64
+	}{
+		{name: "live result", key: liveKey, wantStatus: http.StatusOK},
+		{name: "expired result", key: markedKey, wantStatus: http.StatusGone},
+		{name: "object gone since the last pass", key: vanishedKey, wantStatus: http.StatusGone, wantExpired: []int64{3}},
+		{name: "unknown key", key: "results/2026/03/01/nope/report.html", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := &fakeResultRecords{records: map[string]*database.ResultRecord{
+				liveKey:     {ResultID: 1, StorageKey: liveKey},
+				markedKey:   {ResultID: 2, StorageKey: markedKey, ExpiredAt: &expiredAt},
+				vanishedKey: {ResultID: 3, StorageKey: vanishedKey},
+			}}
+			mux := http.NewServeMux()
+			mux.Handle("GET /results/{key...}", NewResultHandler(records, store, storage.StorageTypeLocal))
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+tt.key, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != "<html>mean 4.2</html>" {
+				t.Errorf("body = %q", rec.Body.String())
+			}
+			if len(records.expired) != len(tt.wantExpired) || (len(tt.wantExpired) > 0 && records.expired[0] != tt.wantExpired[0]) {
+				t.Errorf("marked expired %v, want %v", records.expired, tt.wantExpired)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// internal/transport/api/stream.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"watchrabbit/pkg/messaging"
+)
+
+// events a slow client can fall behind by before it's sent nothing more for a while
+const streamClientBuffer = 64
+
+// comment lines sent while idle, keeps proxies from closing a quiet stream
+const streamKeepAlive = 30 * time.Second
+
+// CompletedStream pushes analysis.completed events to browsers over Server-Sent Events
+// GET /events/completed, each event's data is the AnalysisCompletedEvent JSON as published by the worker
+// the RabbitMQ queue behind it only exists while at least one client is connected
+type CompletedStream struct {
+	rabbitMQ *messaging.RabbitMQClient
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	// the running tap, nil while nobody is connected
+	tap *streamTap
+}
+
+type streamTap struct {
+	cancel context.CancelFunc
+}
+
+func NewCompletedStream(rabbitMQ *messaging.RabbitMQClient) *CompletedStream {
+	return &CompletedStream{rabbitMQ: rabbitMQ, clients: make(map[chan []byte]struct{})}
+}
+
+func (s *CompletedStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := s.subscribe()
+	if err != nil {
+		log.Printf("Failed to subscribe to completed analyses: %v", err)
+		http.Error(w, "event stream unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case body, ok := <-events:
+			if !ok {
+				// lost the broker, EventSource reconnects on its own
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: analysis.completed\ndata: %s\n\n", body); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// adds a client, the first one starts the tap
+func (s *CompletedStream) subscribe() (chan []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tap == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		bodies, err := s.rabbitMQ.Tap(ctx, "biomarker.result.events", "analysis.completed.*")
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		s.tap = &streamTap{cancel: cancel}
+		go s.fanOut(bodies, s.tap)
+	}
+
+	events := make(chan []byte, streamClientBuffer)
+	s.clients[events] = struct{}{}
+	return events, nil
+}
+
+// removes a client, the last one stops the tap (which deletes its queue)
+func (s *CompletedStream) unsubscribe(events chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[events]; !ok {
+		// already dropped by fanOut
+		return
+	}
+	delete(s.clients, events)
+	if len(s.clients) == 0 && s.tap != nil {
+		s.tap.cancel()
+		s.tap = nil
+	}
+}
+
+// copies each event to every client until the tap closes
+func (s *CompletedStream) fanOut(bodies <-chan []byte, tap *streamTap) {
+	for body := range bodies {
+		s.mu.Lock()
+		for events := range s.clients {
+			select {
+			case events <- body:
+			default:
+				log.Printf("Dropping completed analysis event for a slow stream client")
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	// stopped by the last unsubscribe (maybe with a new tap already running), or the connection dropped -
+	// then every client is cut off and reconnects
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tap != tap {
+		return
+	}
+	tap.cancel()
+	s.tap = nil
+	for events := range s.clients {
+		close(events)
+		delete(s.clients, events)
+	}
+}
@@ -0,0 +1,115 @@
+// internal/transport/api/trigger.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/pkg/messaging"
+)
+
+// request bodies are a handful of fields, anything bigger is a mistake
+const maxTriggerBody = 64 << 10
+
+// requester recorded for analyses queued through the API, followed by the caller's name behind RequireAdmin
+const defaultTriggerRequester = "api"
+
+// the part of PostgresService the trigger needs
+type fileLookup interface {
+	GetFileRecordByPath(ctx context.Context, filePath string) (*database.FileRecord, error)
+}
+
+// TriggerHandler re-runs an analysis of a file the system already knows, without touching the filesystem
+// POST /analyses {"file_path": "/data/study1/labs.csv", "analysis_type": "descriptive", "force": true}
+// force skips the worker's result cache and dedup, otherwise an unchanged file gets its existing result back
+// meant to be mounted behind RequireAdmin, the analysis is attributed to the authenticated caller
+type TriggerHandler struct {
+	files   fileLookup
+	bus     messaging.MessageBus
+	scripts analyzer.ScriptRegistry // analysis types the workers are configured with
+}
+
+func NewTriggerHandler(files fileLookup, bus messaging.MessageBus, scripts analyzer.ScriptRegistry) *TriggerHandler {
+	return &TriggerHandler{files: files, bus: bus, scripts: scripts}
+}
+
+type triggerRequest struct {
+	FilePath     string            `json:"file_path"`
+	AnalysisType string            `json:"analysis_type"` // empty for the worker's default
+	Force        bool              `json:"force"`
+	Params       map[string]string `json:"params,omitempty"`
+	OutputFormat string            `json:"output_format,omitempty"`
+}
+
+func (h *TriggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req triggerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTriggerBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.FilePath = strings.TrimSpace(req.FilePath)
+	if req.FilePath == "" {
+		http.Error(w, "file_path is required", http.StatusBadRequest)
+		return
+	}
+	// caught here rather than as a failed analysis in the worker
+	req.AnalysisType = strings.TrimSpace(req.AnalysisType)
+	if _, ok := h.scripts[req.AnalysisType]; req.AnalysisType != "" && !ok {
+		http.Error(w, "unknown analysis_type: "+req.AnalysisType, http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.files.GetFileRecordByPath(r.Context(), req.FilePath)
+	if err != nil {
+		log.Printf("Failed to look up file %s: %v", req.FilePath, err)
+		http.Error(w, "failed to look up file", http.StatusInternalServerError)
+		return
+	}
+	if file == nil {
+		http.Error(w, "unknown file: "+req.FilePath, http.StatusNotFound)
+		return
+	}
+	// the worker reads the file from the watched directory, a removed one would only fail there
+	if file.RemovedAt != nil {
+		http.Error(w, "file was removed: "+req.FilePath, http.StatusConflict)
+		return
+	}
+
+	requester := defaultTriggerRequester
+	if caller := Caller(r.Context()); caller != "" {
+		requester += ":" + caller
+	}
+	requestEvent := events.AnalysisRequestedEvent{
+		FilePath:     file.FilePath,
+		FileType:     file.FileType,
+		AnalysisType: req.AnalysisType,
+		Checksum:     file.Checksum,
+		Params:       req.Params,
+		OutputFormat: req.OutputFormat,
+		Force:        req.Force,
+		Requester:    requester,
+		Timestamp:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	routingKey := events.RoutingKey("analysis.requested", file.FileType)
+	if err := h.bus.PublishEvent(ctx, "biomarker.analysis.events", routingKey, requestEvent); err != nil {
+		log.Printf("Failed to publish analysis request for %s: %v", file.FilePath, err)
+		http.Error(w, "failed to queue analysis", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Queued %s analysis of %s for %s (force: %t)", requestEvent.AnalysisType, file.FilePath, requester, req.Force)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(requestEvent); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"watchrabbit/internal/domain/events"
+	"watchrabbit/internal/services/analyzer"
+	"watchrabbit/internal/services/database"
+	"watchrabbit/pkg/messaging/memory"
+)
+
+// fakeFiles knows a single file
+type fakeFiles struct {
+	file *database.FileRecord
+}
+
+func (f fakeFiles) GetFileRecordByPath(ctx context.Context, filePath string) (*database.FileRecord, error) {
+	if f.file == nil || f.file.FilePath != filePath {
+		return nil, nil
+	}
+	return f.file, nil
+}
+
+func TestTriggerHandler(t *testing.T) {
+	scripts, err := analyzer.NewScriptRegistry(map[string]string{"qc": "qc_report.R"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]string{"ops": "s3cr3t"}
+	files := fakeFiles{file: &database.FileRecord{FilePath: "/data/study1/labs.csv", FileType: "csv"}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		wantStatus    int
+		wantType      string
+	}{
+		{
+			name:       "no token",
+			body:       `{"file_path": "/data/study1/labs.csv"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong token",
+			authorization: "Bearer guess",
+			body:          `{"file_path": "/data/study1/labs.csv"}`,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "default analysis type",
+			authorization: "Bearer s3cr3t",
+			body:          `{"file_path": "/data/study1/labs.csv"}`,
+			wantStatus:    http.StatusAccepted,
+		},
+		{
+			name:          "configured analysis type",
+			authorization: "Bearer s3cr3t",
+			body:          `{"file_path": "/data/study1/labs.csv", "analysis_type": " qc "}`,
+			wantStatus:    http.StatusAccepted,
+			wantType:      "qc",
+		},
+		{
+			name:          "unknown analysis type",
+			authorization: "Bearer s3cr3t",
+			body:          `{"file_path": "/data/study1/labs.csv", "analysis_type": "qcc"}`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			// the caller can't pick who the analysis is attributed to
+			name:          "body requester ignored",
+			authorization: "Bearer s3cr3t",
+			body:          `{"file_path": "/data/study1/labs.csv", "requester": "file-watcher"}`,
+			wantStatus:    http.StatusAccepted,
+		},
+		{
+			name:          "unknown file",
+			authorization: "Bearer s3cr3t",
+			body:          `{"file_path": "/data/study1/other.csv"}`,
+			wantStatus:    http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := memory.New()
+			defer bus.Close()
+			handler := RequireAdmin(tokens, NewTriggerHandler(files, bus, scripts))
+
+			req := httptest.NewRequest(http.MethodPost, "/analyses", strings.NewReader(tt.body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			published := bus.Published()
+			if tt.wantStatus != http.StatusAccepted {
+				if len(published) != 0 {
+					t.Errorf("rejected request published %d messages", len(published))
+				}
+				return
+			}
+
+			if len(published) != 1 || published[0].RoutingKey != "analysis.requested.csv" {
+				t.Fatalf("published %+v, want one analysis.requested.csv", published)
+			}
+			var requested events.AnalysisRequestedEvent
+			if err := json.Unmarshal(published[0].Body, &requested); err != nil {
+				t.Fatal(err)
+			}
+			if requested.AnalysisType != tt.wantType {
+				t.Errorf("analysis type = %q, want %q", requested.AnalysisType, tt.wantType)
+			}
+			if requested.Requester != "api:ops" {
+				t.Errorf("requester = %q, want api:ops", requested.Requester)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+#!/usr/bin/env python3
+# sample_descriptive_analysis.py - pandas version of sample_descriptive_analysis.R - TO REFINE
+# Usage: python3 sample_descriptive_analysis.py <input_file> <output_file> [--key=value ...]
+# register it with e.g. ANALYSIS_SCRIPTS=profile:sample_descriptive_analysis.py|.html
+
+import html
+import os
+import sys
+
+import pandas as pd
+
+
+def parse_args(argv):
+    if len(argv) < 2:
+        sys.exit("Usage: sample_descriptive_analysis.py <input_file> <output_file> [--key=value ...]")
+    params = {}
+    for arg in argv[2:]:
+        if arg.startswith("--") and "=" in arg:
+            key, value = arg[2:].split("=", 1)
+            params[key] = value
+    return argv[0], argv[1], params
+
+
+def read_input(input_file, input_type):
+    source = sys.stdin.buffer if input_file == "-" else input_file
+    readers = {
+        "csv": pd.read_csv,
+        "sas7bdat": lambda src: pd.read_sas(src, format="sas7bdat"),
+        "xlsx": pd.read_excel,
+        "parquet": pd.read_parquet,
+    }
+    if input_type not in readers:
+        raise ValueError(f"unsupported input type '{input_type}' (supported: {', '.join(readers)})")
+    return readers[input_type](source)
+
+
+def main():
+    input_file, output_file, params = parse_args(sys.argv[1:])
+    # input type comes from the worker, fall back to the extension when run by hand
+    input_type = params.get("input_type") or os.path.splitext(input_file)[1].lstrip(".").lower()
+
+    print(f"Reading file: {input_file} as {input_type}")
+    data = read_input(input_file, input_type)
+
+    print("Analyzing data...")
+    numeric = data.select_dtypes("number")
+    sections = [
+        "<h1>Biomarker Descriptive Analysis</h1>",
+        f"<p><b>File analyzed:</b> {html.escape(os.path.basename(input_file))}</p>",
+        f"<p><b>Number of observations:</b> {len(data)}</p>",
+        f"<p><b>Number of variables:</b> {len(data.columns)}</p>",
+        "<h2>Data Structure</h2>",
+        data.head(20).to_html(),
+        "<h2>Summary Statistics</h2>",
+        data.describe(include="all").to_html(),
+    ]
+    if numeric.shape[1] > 1:
+        sections += ["<h2>Correlation Matrix</h2>", numeric.corr().round(2).to_html()]
+
+    print("Generating report...")
+    with open(output_file, "w", encoding="utf-8") as out:
+        out.write("<html><head><meta charset=\"utf-8\"></head><body>\n")
+        out.write("\n".join(sections))
+        out.write("\n<p>This is an automated report generated by the biomarker analysis system.</p></body></html>\n")
+
+
+if __name__ == "__main__":
+    main()
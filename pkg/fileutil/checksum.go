@@ -0,0 +1,27 @@
+// pkg/fileutil/checksum.go
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SHA256File returns the hex encoded sha256 of a file's contents
+// streams the file so large .sas7bdat files aren't loaded into memory
+func SHA256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for checksum: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read file for checksum: %v", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
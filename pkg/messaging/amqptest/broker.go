@@ -0,0 +1,179 @@
+//go:build integration
+
+// pkg/messaging/amqptest/broker.go
+// Integration test harness: runs a real RabbitMQ in a container via testcontainers-go.
+// Only built with `go test -tags integration ./...` so unit tests stay fast and docker-free.
+package amqptest
+
+import (
+	"context"
+	"testing"
+	"time"
+	"watchrabbit/pkg/messaging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/testcontainers/testcontainers-go/modules/rabbitmq"
+)
+
+const (
+	DefaultImage = "rabbitmq:3.12-management-alpine"
+	// how long the Assert helpers poll before failing
+	DefaultWait = 10 * time.Second
+)
+
+// Broker is a throwaway RabbitMQ container, terminated automatically via t.Cleanup
+type Broker struct {
+	URI       string
+	container *rabbitmq.RabbitMQContainer
+}
+
+// StartBroker starts a RabbitMQ container for the duration of the test
+func StartBroker(t testing.TB) *Broker {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := rabbitmq.Run(ctx, DefaultImage)
+	if err != nil {
+		t.Fatalf("failed to start rabbitmq container: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Logf("failed to terminate rabbitmq container: %v", err)
+		}
+	})
+
+	uri, err := container.AmqpURL(ctx)
+	if err != nil {
+		t.Fatalf("failed to get rabbitmq url: %v", err)
+	}
+
+	return &Broker{URI: uri, container: container}
+}
+
+// NewClient starts a broker and returns a connected client with the standard infrastructure declared
+func NewClient(t testing.TB) (*messaging.RabbitMQClient, *Broker) {
+	t.Helper()
+	broker := StartBroker(t)
+	return broker.Client(t), broker
+}
+
+// Client connects a new RabbitMQClient to the broker, closed via t.Cleanup
+func (b *Broker) Client(t testing.TB) *messaging.RabbitMQClient {
+	t.Helper()
+
+	client, err := messaging.NewRabbitMQClient(b.URI)
+	if err != nil {
+		t.Fatalf("failed to connect to rabbitmq: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if err := client.SetupInfrastructure(); err != nil {
+		t.Fatalf("failed to set up rabbitmq infrastructure: %v", err)
+	}
+
+	return client
+}
+
+// DropConnections force-closes every client connection on the broker, used to exercise reconnects
+func (b *Broker) DropConnections(t testing.TB) {
+	t.Helper()
+
+	code, _, err := b.container.Exec(context.Background(), []string{"rabbitmqctl", "close_all_connections", "amqptest"})
+	if err != nil || code != 0 {
+		t.Fatalf("failed to close broker connections (exit %d): %v", code, err)
+	}
+}
+
+// StopApp stops RabbitMQ inside the container, dropping every connection and refusing new ones until StartApp
+// unlike DropConnections, clients stay disconnected long enough to observe it
+func (b *Broker) StopApp(t testing.TB) {
+	t.Helper()
+	b.rabbitmqctl(t, "stop_app")
+}
+
+// StartApp starts RabbitMQ again after StopApp, durable queues and their messages survive
+func (b *Broker) StartApp(t testing.TB) {
+	t.Helper()
+	b.rabbitmqctl(t, "start_app")
+}
+
+func (b *Broker) rabbitmqctl(t testing.TB, args ...string) {
+	t.Helper()
+
+	code, _, err := b.container.Exec(context.Background(), append([]string{"rabbitmqctl"}, args...))
+	if err != nil || code != 0 {
+		t.Fatalf("rabbitmqctl %v failed (exit %d): %v", args, code, err)
+	}
+}
+
+// QueueDepth returns the number of ready messages in a queue, using a side connection
+func (b *Broker) QueueDepth(t testing.TB, queue string) int {
+	t.Helper()
+
+	ch := b.channel(t)
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+	if err != nil {
+		t.Fatalf("failed to inspect queue %s: %v", queue, err)
+	}
+	return q.Messages
+}
+
+// AssertQueueDepth waits up to DefaultWait for the queue to reach the expected depth
+func (b *Broker) AssertQueueDepth(t testing.TB, queue string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(DefaultWait)
+	got := b.QueueDepth(t, queue)
+	for got != want && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		got = b.QueueDepth(t, queue)
+	}
+	if got != want {
+		t.Fatalf("queue %s depth = %d, want %d", queue, got, want)
+	}
+}
+
+// AssertMessage waits up to DefaultWait for a message matching match to arrive on the queue
+// messages are consumed (basic.get + ack) while searching
+func (b *Broker) AssertMessage(t testing.TB, queue string, match func(amqp.Delivery) bool) amqp.Delivery {
+	t.Helper()
+
+	ch := b.channel(t)
+	defer ch.Close()
+
+	deadline := time.Now().Add(DefaultWait)
+	for time.Now().Before(deadline) {
+		msg, ok, err := ch.Get(queue, true)
+		if err != nil {
+			t.Fatalf("failed to get from queue %s: %v", queue, err)
+		}
+		if !ok {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if match(msg) {
+			return msg
+		}
+	}
+
+	t.Fatalf("no matching message on queue %s within %s", queue, DefaultWait)
+	return amqp.Delivery{}
+}
+
+func (b *Broker) channel(t testing.TB) *amqp.Channel {
+	t.Helper()
+
+	conn, err := amqp.Dial(b.URI)
+	if err != nil {
+		t.Fatalf("failed to dial rabbitmq: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("failed to open channel: %v", err)
+	}
+	return ch
+}
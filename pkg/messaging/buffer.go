@@ -0,0 +1,129 @@
+// pkg/messaging/buffer.go
+package messaging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const DefaultPublishBufferSize = 1000
+
+// returned by PublishEvent when the client is disconnected and the buffer has no room left
+var ErrPublishBufferFull = errors.New("rabbitmq publish buffer is full")
+
+type pendingPublish struct {
+	exchange   string
+	routingKey string
+	mandatory  bool
+	msg        amqp.Publishing
+}
+
+// bounded FIFO of publishes issued while the connection is down
+// all fields except the counters are guarded by RabbitMQClient.mu
+type publishBuffer struct {
+	capacity int
+	items    []pendingPublish
+	flushing bool
+
+	buffered atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// counters for publishes that went through the buffer
+type PublishStats struct {
+	Buffered uint64 // publishes queued while disconnected
+	Dropped  uint64 // publishes rejected because the buffer was full
+	Pending  int    // publishes currently waiting for a reconnect
+}
+
+func (b *publishBuffer) len() int {
+	return len(b.items)
+}
+
+func (b *publishBuffer) push(p pendingPublish) error {
+	if len(b.items) >= b.capacity {
+		b.dropped.Add(1)
+		return ErrPublishBufferFull
+	}
+	b.items = append(b.items, p)
+	b.buffered.Add(1)
+	return nil
+}
+
+// sets how many publishes are held while disconnected, 0 disables buffering
+func (c *RabbitMQClient) SetPublishBufferSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	c.mu.Lock()
+	c.buffer.capacity = size
+	c.mu.Unlock()
+}
+
+func (c *RabbitMQClient) PublishStats() PublishStats {
+	c.mu.Lock()
+	pending := c.buffer.len()
+	c.mu.Unlock()
+
+	return PublishStats{
+		Buffered: c.buffer.buffered.Load(),
+		Dropped:  c.buffer.dropped.Load(),
+		Pending:  pending,
+	}
+}
+
+// re-publishes buffered messages in order after a reconnect
+// new publishes keep queueing behind the buffer until it has fully drained
+func (c *RabbitMQClient) flushBuffer() {
+	c.mu.Lock()
+	if c.buffer.flushing || c.buffer.len() == 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.buffer.flushing = true
+	c.mu.Unlock()
+
+	flushed := 0
+	for {
+		c.mu.Lock()
+		if c.buffer.len() == 0 || !c.connected {
+			c.buffer.flushing = false
+			c.mu.Unlock()
+			break
+		}
+		next := c.buffer.items[0]
+		ch := c.ch
+		c.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := ch.PublishWithContext(ctx, next.exchange, next.routingKey, next.mandatory, false, next.msg)
+		cancel()
+
+		if errors.Is(err, amqp.ErrClosed) {
+			// leave it at the head of the buffer, the next reconnect picks it back up
+			c.logger.Warn("Connection lost while flushing buffered publishes", slog.Any("error", err))
+			c.mu.Lock()
+			c.buffer.flushing = false
+			c.mu.Unlock()
+			break
+		}
+		if err != nil {
+			c.logger.Error("Dropping buffered publish", slog.String("exchange", next.exchange), slog.String("routing_key", next.routingKey), slog.Any("error", err))
+			c.buffer.dropped.Add(1)
+		}
+
+		c.mu.Lock()
+		c.buffer.items = c.buffer.items[1:]
+		c.mu.Unlock()
+		flushed++
+	}
+
+	if flushed > 0 {
+		c.logger.Info("Flushed buffered publishes to RabbitMQ", slog.Int("count", flushed))
+	}
+}
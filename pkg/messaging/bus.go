@@ -0,0 +1,23 @@
+// pkg/messaging/bus.go
+package messaging
+
+import (
+	"context"
+)
+
+// MessageBus is what the services publish and consume through: RabbitMQClient in deployments,
+// memory.Bus where handlers are exercised without a broker
+// broker specifics (infrastructure, prefetch, inspection) stay on RabbitMQClient
+type MessageBus interface {
+	PublishEvent(ctx context.Context, exchange, routingKey string, event interface{}) error
+	PublishEventWithOptions(ctx context.Context, exchange, routingKey string, event interface{}, opts PublishOptions) error
+	Subscribe(queue string, handler func([]byte) error) error
+	SubscribeWithContext(ctx context.Context, queue string, handler func([]byte) error) error
+	SubscribeConcurrent(queue string, handler func([]byte) error, workers int) error
+	SubscribeConcurrentWithContext(ctx context.Context, queue string, handler func([]byte) error, workers int) error
+	// publishes held back for a reconnect, so callers can report them alongside a failed publish
+	PublishStats() PublishStats
+	Close() error
+}
+
+var _ MessageBus = (*RabbitMQClient)(nil)
@@ -0,0 +1,71 @@
+// pkg/messaging/declare.go
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// returned (wrapped) by SetupInfrastructure when a queue already exists with different settings,
+// e.g. it was once declared non-durable and we now declare it durable
+var ErrQueueMismatch = errors.New("queue exists with different settings")
+
+// SetRecreateMismatchedQueues makes SetupInfrastructure delete and redeclare a queue whose existing settings differ
+// instead of failing. dangerous: any messages in the queue are lost, off by default
+func (c *RabbitMQClient) SetRecreateMismatchedQueues(enabled bool) {
+	c.mu.Lock()
+	c.recreateMismatched = enabled
+	c.mu.Unlock()
+}
+
+// declareQueue declares on a throwaway channel, the broker closes a channel on PRECONDITION_FAILED
+// and we don't want that to be the shared one
+func (c *RabbitMQClient) declareQueue(name string, durable, autoDelete bool, args amqp.Table) error {
+	c.mu.Lock()
+	conn := c.conn
+	recreate := c.recreateMismatched
+	c.mu.Unlock()
+
+	err := withChannel(conn, func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(name, durable, autoDelete, false, false, args)
+		return err
+	})
+
+	var amqpErr *amqp.Error
+	if err == nil || !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		return err
+	}
+
+	if !recreate {
+		return fmt.Errorf("%w: %s (%s). delete the queue so it can be recreated (rabbitmqctl delete_queue %s) "+
+			"or enable recreating mismatched queues, which drops anything queued in it", ErrQueueMismatch, name, amqpErr.Reason, name)
+	}
+
+	c.logger.Warn("Queue exists with different settings, deleting and recreating it", slog.String("queue", name), slog.String("reason", amqpErr.Reason))
+	return withChannel(conn, func(ch *amqp.Channel) error {
+		dropped, err := ch.QueueDelete(name, false, false, false)
+		if err != nil {
+			return fmt.Errorf("failed to delete mismatched queue %s: %v", name, err)
+		}
+		if dropped > 0 {
+			c.logger.Warn("Dropped messages from recreated queue", slog.String("queue", name), slog.Int("dropped", dropped))
+		}
+		_, err = ch.QueueDeclare(name, durable, autoDelete, false, false, args)
+		return err
+	})
+}
+
+func withChannel(conn *amqp.Connection, fn func(ch *amqp.Channel) error) error {
+	if conn == nil {
+		return errors.New("not connected to RabbitMQ")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	return fn(ch)
+}
@@ -0,0 +1,121 @@
+// pkg/messaging/delivery.go
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// outcome of one message handled by Subscribe
+type DeliveryRecord struct {
+	Queue     string
+	MessageID string
+	// "acked", "nacked" (requeued), "retrying" (waiting in the retry queue), "dead-lettered" (out of retries)
+	// or "rejected" (permanent failure, parked in the queue's DLQ)
+	Outcome    string
+	Err        error // set for acked deliveries too when the handler errored but asked for an ack
+	ReceivedAt time.Time
+	Duration   time.Duration
+}
+
+// called after every delivery Subscribe handles, must not block (e.g. hand off to a buffered writer)
+type DeliveryHook func(DeliveryRecord)
+
+func (c *RabbitMQClient) SetDeliveryHook(hook DeliveryHook) {
+	c.mu.Lock()
+	c.onDelivery = hook
+	c.mu.Unlock()
+}
+
+func (c *RabbitMQClient) reportDelivery(record DeliveryRecord) {
+	c.mu.Lock()
+	hook := c.onDelivery
+	c.mu.Unlock()
+
+	if hook != nil {
+		hook(record)
+	}
+}
+
+// handlers return a permanent error for messages that will never succeed, Subscribe parks them in <queue>.dlq
+// (see DeadLetterQueueName) instead of redelivering them forever
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// handlers return a handled error for failures they've already dealt with (e.g. recorded the analysis as failed),
+// Subscribe acks the message and only reports the error, so a poison file doesn't loop
+type handledError struct {
+	err error
+}
+
+func (e *handledError) Error() string { return e.err.Error() }
+func (e *handledError) Unwrap() error { return e.err }
+
+func Handled(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &handledError{err: err}
+}
+
+func IsHandled(err error) bool {
+	var h *handledError
+	return errors.As(err, &h)
+}
+
+// what Subscribe does with a delivery once its handler returns
+type Decision int
+
+const (
+	Ack    Decision = iota // done with it, even if the handler errored
+	Nack                   // requeue it (through the retry queue when SetRetry is on for the queue)
+	Reject                 // park it in the queue's DLQ for a look, cmd/dlq-replay can send it back
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Ack:
+		return "ack"
+	case Nack:
+		return "nack"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Decision(%d)", int(d))
+}
+
+// DeliveryHandler settles its own deliveries, the error is only reported (delivery hook, logs)
+type DeliveryHandler func(body []byte) (Decision, error)
+
+// Decide gives a plain handler Subscribe's usual behavior: ack on success or a Handled error,
+// reject a Permanent error and requeue anything else
+func Decide(handler func([]byte) error) DeliveryHandler {
+	return func(body []byte) (Decision, error) {
+		err := handler(body)
+		switch {
+		case err == nil, IsHandled(err):
+			return Ack, err
+		case IsPermanent(err):
+			return Reject, err
+		default:
+			return Nack, err
+		}
+	}
+}
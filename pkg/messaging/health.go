@@ -0,0 +1,54 @@
+// pkg/messaging/health.go
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotConnected is returned by HealthCheck while the client is between connections
+var ErrNotConnected = errors.New("rabbitmq client is not connected")
+
+// IsConnected reports whether the client currently holds an open connection and channel
+func (c *RabbitMQClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected && !c.closed && c.conn != nil && !c.conn.IsClosed() && c.ch != nil && !c.ch.IsClosed()
+}
+
+// HealthCheck does a round trip to the broker on a throwaway channel
+// (a failed passive declare closes the channel it runs on, so the shared one is never used)
+func (c *RabbitMQClient) HealthCheck(ctx context.Context) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		ch, err := conn.Channel()
+		if err != nil {
+			done <- fmt.Errorf("failed to open health check channel: %v", err)
+			return
+		}
+		defer ch.Close()
+
+		// amq.topic exists on every broker, so this only fails if the broker itself is unhappy
+		if err := ch.ExchangeDeclarePassive("amq.topic", "topic", true, false, false, false, nil); err != nil {
+			done <- fmt.Errorf("passive exchange declare failed: %v", err)
+			return
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
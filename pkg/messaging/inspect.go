@@ -0,0 +1,79 @@
+// pkg/messaging/inspect.go
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Inspect logs every message published to the given exchanges (routing key, size, truncated body) at debug level
+// for debugging routing. it uses its own channel and an exclusive auto-delete queue bound with "#", so normal consumers
+// see exactly what they would without it. runs until ctx is done or the connection drops
+func (c *RabbitMQClient) Inspect(ctx context.Context, exchanges []string, maxBody int) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open inspector channel: %v", err)
+	}
+
+	// server-named, gone as soon as the inspector's channel closes
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to declare inspector queue: %v", err)
+	}
+	for _, exchange := range exchanges {
+		if err := ch.QueueBind(q.Name, "#", exchange, false, nil); err != nil {
+			ch.Close()
+			return fmt.Errorf("failed to bind inspector to %s: %v", exchange, err)
+		}
+	}
+
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to consume inspector queue: %v", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		ch.Close()
+	}()
+
+	go func() {
+		for msg := range msgs {
+			c.logger.Debug("Inspected event",
+				slog.String("exchange", msg.Exchange),
+				slog.String("routing_key", msg.RoutingKey),
+				slog.Int("size", len(msg.Body)),
+				slog.String("body", truncateBody(msg, maxBody)))
+		}
+	}()
+
+	c.logger.Info("Inspecting events", slog.Any("exchanges", exchanges))
+	return nil
+}
+
+func truncateBody(msg amqp.Delivery, maxBody int) string {
+	body := msg.Body
+	if maxBody > 0 && len(body) > maxBody {
+		// don't cut a multi-byte character in half
+		cut := maxBody
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s... (%d more bytes)", body[:cut], len(body)-cut)
+	}
+	return string(body)
+}
@@ -0,0 +1,30 @@
+package messaging
+
+import (
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestTruncateBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		maxBody int
+		want    string
+	}{
+		{"short body", `{"a":"b"}`, 64, `{"a":"b"}`},
+		{"no limit", strings.Repeat("x", 100), 0, strings.Repeat("x", 100)},
+		{"cut", "abcdefgh", 4, "abcd... (4 more bytes)"},
+		{"cut before a multi-byte character", "abcé", 4, "abc... (2 more bytes)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateBody(amqp.Delivery{Body: []byte(tt.body)}, tt.maxBody); got != tt.want {
+				t.Errorf("truncateBody = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// pkg/messaging/memory/memory.go
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"watchrabbit/pkg/messaging"
+)
+
+// messages a queue holds before publishing to it fails, plenty for a test
+const queueSize = 1024
+
+var ErrClosed = errors.New("message bus closed")
+
+// Message is one published event as the broker would have seen it
+type Message struct {
+	Exchange   string
+	RoutingKey string
+	Body       []byte
+	Options    messaging.PublishOptions
+}
+
+// Bus is an in-process messaging.MessageBus for running handlers without RabbitMQ
+// queues only receive what's routed to them through Bind, with the same topic matching as the broker
+// a handler error doesn't requeue the message, it's kept for DeadLetters instead (unless it's messaging.Handled)
+type Bus struct {
+	mu          sync.Mutex
+	bindings    []binding
+	queues      map[string]chan []byte
+	published   []Message
+	deadLetters map[string][][]byte
+	// messages routed to a queue and not yet handled, Wait blocks until it's back to 0
+	pending  int
+	idle     *sync.Cond
+	closed   bool
+	done     chan struct{}
+	handlers sync.WaitGroup
+}
+
+type binding struct {
+	queue    string
+	exchange string
+	pattern  string
+}
+
+func New() *Bus {
+	b := &Bus{
+		queues:      make(map[string]chan []byte),
+		deadLetters: make(map[string][][]byte),
+		done:        make(chan struct{}),
+	}
+	b.idle = sync.NewCond(&b.mu)
+	return b
+}
+
+var _ messaging.MessageBus = (*Bus)(nil)
+
+// Bind routes messages published to exchange with a routing key matching pattern ("*" one word, "#" any) to queue
+func (b *Bus) Bind(queue, exchange, pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue(queue)
+	b.bindings = append(b.bindings, binding{queue: queue, exchange: exchange, pattern: pattern})
+}
+
+// must be called with mu held
+func (b *Bus) queue(name string) chan []byte {
+	q, ok := b.queues[name]
+	if !ok {
+		q = make(chan []byte, queueSize)
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *Bus) PublishEvent(ctx context.Context, exchange, routingKey string, event interface{}) error {
+	return b.PublishEventWithOptions(ctx, exchange, routingKey, event, messaging.PublishOptions{})
+}
+
+// records the event and routes it to every bound queue, unroutable messages are only recorded
+func (b *Bus) PublishEventWithOptions(ctx context.Context, exchange, routingKey string, event interface{}, opts messaging.PublishOptions) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	b.published = append(b.published, Message{Exchange: exchange, RoutingKey: routingKey, Body: body, Options: opts})
+
+	for _, bound := range b.bindings {
+		if bound.exchange != exchange || !matchTopic(bound.pattern, routingKey) {
+			continue
+		}
+		select {
+		case b.queues[bound.queue] <- body:
+			b.pending++
+		default:
+			return fmt.Errorf("queue %s is full (%d messages)", bound.queue, queueSize)
+		}
+	}
+	return nil
+}
+
+func (b *Bus) Subscribe(queue string, handler func([]byte) error) error {
+	return b.SubscribeWithContext(context.Background(), queue, handler)
+}
+
+// handles the queue's messages one at a time on a goroutine until ctx is done or the bus is closed
+func (b *Bus) SubscribeWithContext(ctx context.Context, queue string, handler func([]byte) error) error {
+	return b.SubscribeConcurrentWithContext(ctx, queue, handler, 1)
+}
+
+func (b *Bus) SubscribeConcurrent(queue string, handler func([]byte) error, workers int) error {
+	return b.SubscribeConcurrentWithContext(context.Background(), queue, handler, workers)
+}
+
+// handles up to workers of the queue's messages at once until ctx is done or the bus is closed
+func (b *Bus) SubscribeConcurrentWithContext(ctx context.Context, queue string, handler func([]byte) error, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	q := b.queue(queue)
+	b.handlers.Add(workers)
+	b.mu.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go b.consume(ctx, queue, q, handler)
+	}
+	return nil
+}
+
+func (b *Bus) consume(ctx context.Context, queue string, q chan []byte, handler func([]byte) error) {
+	defer b.handlers.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		case body := <-q:
+			err := handler(body)
+
+			b.mu.Lock()
+			if err != nil && !messaging.IsHandled(err) {
+				b.deadLetters[queue] = append(b.deadLetters[queue], body)
+			}
+			b.pending--
+			if b.pending == 0 {
+				b.idle.Broadcast()
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// Wait blocks until every routed message has been handled, make sure something subscribes to each bound queue
+func (b *Bus) Wait(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.idle.Broadcast()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.pending > 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%d messages still pending: %w", b.pending, err)
+		}
+		b.idle.Wait()
+	}
+	return nil
+}
+
+// PublishStats is always zero, publishes go straight to the queues and are never buffered
+func (b *Bus) PublishStats() messaging.PublishStats {
+	return messaging.PublishStats{}
+}
+
+// Published returns everything published so far, in order
+func (b *Bus) Published() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.published...)
+}
+
+// DeadLetters returns the bodies of the queue's messages whose handler returned an error
+func (b *Bus) DeadLetters(queue string) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([][]byte(nil), b.deadLetters[queue]...)
+}
+
+// Close stops the subscribers once their current message is handled
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+
+	b.handlers.Wait()
+	return nil
+}
+
+// topic exchange matching: words are dot separated, "*" matches exactly one and "#" zero or more
+func matchTopic(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	if pattern[0] == "#" {
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(key) == 0 || (pattern[0] != "*" && pattern[0] != key[0]) {
+		return false
+	}
+	return matchWords(pattern[1:], key[1:])
+}
@@ -4,25 +4,88 @@ package messaging
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type RabbitMQClient struct {
+	// guards conn/ch/closed/connected and the publish buffer, which the reconnect goroutine swaps out
+	mu sync.Mutex
 	conn *amqp.Connection
 	ch *amqp.Channel
 	uri string
 	connRetry chan struct{}
+	// closed by Close so reconnectMonitor (and a retry loop in progress) exits
+	done chan struct{}
+	// closed and replaced every time connect succeeds, subscriptions wait on it to consume again
+	reconnected chan struct{}
 	closed bool
+	connected bool
+	// default delivery mode for PublishEvent (Transient or Persistent)
+	deliveryMode uint8
+	// publishes issued while disconnected, flushed in order on reconnect
+	buffer publishBuffer
+	// called for mandatory publishes the broker couldn't route and nobody waits on
+	onReturn ReturnHandler
+	// mandatory publishes on ch waiting for their confirm, replaced along with ch
+	confirms *publishConfirms
+	// called after each handled delivery (auditing)
+	onDelivery DeliveryHook
+	// called once per event that couldn't be published or buffered (metrics)
+	onPublishError func()
+	// largest marshalled body PublishEvent will send, 0 for no limit
+	maxMessageSize int
+	// unacked deliveries the broker will push to each consumer, 0 for unlimited
+	prefetch int
+	// deliveries currently inside a Subscribe handler
+	inFlight atomic.Int64
+	// one per running Subscribe loop, so shutdown can wait for handlers to finish
+	consumers sync.WaitGroup
+	// SetupInfrastructure deletes and redeclares queues whose existing settings differ
+	recreateMismatched bool
+	// queue -> delayed redelivery of failed messages, see SetRetry
+	retries map[string]retryPolicy
+	logger *slog.Logger
+}
+
+// delivery modes re-exported so callers don't need to import amqp directly
+const (
+	Transient  = amqp.Transient
+	Persistent = amqp.Persistent
+)
+
+// matches the broker's default max_message_size on recent RabbitMQ releases
+const DefaultMaxMessageSize = 16 * 1024 * 1024
+
+// returned (wrapped) by PublishEvent when the marshalled event is over the configured limit
+var ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
+// per-publish overrides, zero values fall back to the client defaults
+type PublishOptions struct {
+	DeliveryMode uint8
+	// ask the broker to return the message if no queue binding matches the routing key
+	Mandatory bool
 }
 
 func NewRabbitMQClient(uri string) (*RabbitMQClient, error) {
 	client := &RabbitMQClient{
 		uri: uri,
 		connRetry: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		reconnected: make(chan struct{}),
 		closed: false,
+		deliveryMode: Persistent,
+		buffer: publishBuffer{capacity: DefaultPublishBufferSize},
+		onReturn: logReturnedMessage,
+		maxMessageSize: DefaultMaxMessageSize,
+		logger: slog.Default(),
 	}
 
 	if err := client.connect(); err != nil {
@@ -48,17 +111,62 @@ func (c *RabbitMQClient) connect() error {
         return err
     }
 
+	c.mu.Lock()
+	prefetch := c.prefetch
+	c.mu.Unlock()
+	if prefetch > 0 {
+		if err := ch.Qos(prefetch, 0, false); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	// confirms tell a mandatory publish whether it was routed, see publishConfirms
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+	confirms := newPublishConfirms()
+	// both unbuffered so the library hands them over in the order they arrived
+	go c.watchPublishes(confirms, ch.NotifyPublish(make(chan amqp.Confirmation)), ch.NotifyReturn(make(chan amqp.Return)))
+
 	//store connection to client
+	c.mu.Lock()
 	c.conn = conn
 	c.ch = ch
+	c.confirms = confirms
+	c.connected = true
+	close(c.reconnected)
+	c.reconnected = make(chan struct{})
+	c.mu.Unlock()
 
 	//connection monitoring, waiting for connection to close
 	go func() {
-		<-c.conn.NotifyClose(make(chan *amqp.Error))
+		<-conn.NotifyClose(make(chan *amqp.Error))
+		c.mu.Lock()
+		c.connected = false
+		closed := c.closed
+		c.mu.Unlock()
 		//reconnect if not intentionally closed.
-		if !c.closed {
-			c.connRetry <- struct{}{}
+		if !closed {
+			select {
+			case c.connRetry <- struct{}{}:
+			case <-c.done:
+			}
+		}
+	}()
+
+	// the broker can close just the channel (e.g. a publish to a missing exchange) and leave the connection up,
+	// closing the connection hands it to the watcher above, which reopens the channel, resumes consumers and
+	// flushes whatever got buffered in the meantime
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		err := <-chClosed
+		if err == nil || c.isClosed() || conn.IsClosed() {
+			return
 		}
+		c.logger.Warn("RabbitMQ channel closed by the broker, reconnecting", slog.Any("error", err))
+		conn.Close()
 	}()
 
 	return nil
@@ -70,21 +178,36 @@ func (c *RabbitMQClient) connect() error {
 func (c *RabbitMQClient) reconnectMonitor() {
 	for {
 		select {
+		case <-c.done:
+			return
 		case <-c.connRetry:
 			// don't reconnect client-intentional closings
-			if c.closed {
+			if c.isClosed() {
 				return
 			}
 
-			log.Println("RabbitMQ connection lost. Attempting to reconnect...")
+			c.logger.Warn("RabbitMQ connection lost, attempting to reconnect")
 
 			for {
 				if err := c.connect(); err != nil {
-					log.Printf("Failed to reconnect to RabbitMQ: %v. Retrying in 5 seconds...", err)
-					time.Sleep(5* time.Second)
+					c.logger.Error("Failed to reconnect to RabbitMQ, retrying in 5 seconds", slog.Any("error", err))
+					select {
+					case <-c.done:
+						return
+					case <-time.After(5 * time.Second):
+					}
 					continue
 				}
-				log.Println("Succesfully reconnected to RabbitMQ")
+				// Close may have run while we were dialing, don't leave the new connection open
+				if c.isClosed() {
+					c.mu.Lock()
+					conn := c.conn
+					c.mu.Unlock()
+					conn.Close()
+					return
+				}
+				c.logger.Info("Successfully reconnected to RabbitMQ")
+				c.flushBuffer()
 				break
 			}
 		}
@@ -104,10 +227,12 @@ func (c *RabbitMQClient) SetupInfrastructure() error {
 		{"biomarker.file.events", "topic", true, false},
 		{"biomarker.analysis.events", "topic", true, false},
 		{"biomarker.result.events", "topic", true, false},
+		// liveness only, consumers bind their own (transient) queues
+		{"biomarker.heartbeat.events", "topic", false, false},
 	}
 
 	for _, e := range exchanges {
-		if err := c.ch.ExchangeDeclare(
+		if err := c.channel().ExchangeDeclare(
 			e.name,
 			e.kind,
 			e.durable,
@@ -126,21 +251,24 @@ func (c *RabbitMQClient) SetupInfrastructure() error {
 		autoDelete bool
 	}{
 		{"file.detected", true, false},
+		{"file.changed", true, false},
+		{"file.removed", true, false},
 		{"analysis.requested", true, false},
+		{"analysis.started", true, false},
 		{"analysis.completed", true, false},
 	}
 
 	for _, q := range queues {
-		if _, err := c.ch.QueueDeclare(
-			q.name,
-			q.durable,
-			q.autoDelete,
-			false,
-			false,
-			nil,
-		); err != nil {
+		if err := c.declareQueue(q.name, q.durable, q.autoDelete, nil); err != nil {
 			return err
 		}
+		// where permanently rejected deliveries are parked, see deadLetter
+		if err := c.declareQueue(DeadLetterQueueName(q.name), true, false, nil); err != nil {
+			return err
+		}
+	}
+	if err := c.declareRetryQueues(); err != nil {
+		return err
 	}
 	// Bind queues to exchanges using routing keys - which queue connects to which exchange (using what pattern), no wait, extraArgs
 	bindings := []struct {
@@ -149,12 +277,15 @@ func (c *RabbitMQClient) SetupInfrastructure() error {
 		routingKey string
 	}{
 		{"file.detected", "biomarker.file.events", "file.detected.*"},
+		{"file.changed", "biomarker.file.events", "file.changed.*"},
+		{"file.removed", "biomarker.file.events", "file.removed.*"},
 		{"analysis.requested", "biomarker.analysis.events", "analysis.requested.*"},
+		{"analysis.started", "biomarker.result.events", "analysis.started.*"},
 		{"analysis.completed", "biomarker.result.events", "analysis.completed.*"},
 	}
 
 	for _, b := range bindings {
-		if err := c.ch.QueueBind(
+		if err := c.channel().QueueBind(
 			b.queue,
 			b.routingKey,
 			b.exchange,
@@ -168,72 +299,394 @@ func (c *RabbitMQClient) SetupInfrastructure() error {
 	return nil
 }
 
+// sets the delivery mode used by PublishEvent when no per-publish override is given
+func (c *RabbitMQClient) SetDeliveryMode(mode uint8) error {
+	if mode != Transient && mode != Persistent {
+		return fmt.Errorf("invalid delivery mode: %d", mode)
+	}
+	c.mu.Lock()
+	c.deliveryMode = mode
+	c.mu.Unlock()
+	return nil
+}
+
+// replaces the default (slog.Default()) logger, call it right after NewRabbitMQClient
+func (c *RabbitMQClient) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	c.logger = logger
+}
+
+// sets the largest event body PublishEvent will send, 0 disables the check
+func (c *RabbitMQClient) SetMaxMessageSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	c.mu.Lock()
+	c.maxMessageSize = size
+	c.mu.Unlock()
+}
+
+// sets a callback for every event PublishEvent fails to send or buffer, e.g. to count them,
+// must not block
+func (c *RabbitMQClient) SetPublishErrorHook(hook func()) {
+	c.mu.Lock()
+	c.onPublishError = hook
+	c.mu.Unlock()
+}
+
+// limits unacked deliveries per consumer, so extra consumers on a queue actually share the backlog
+// kept across reconnects, 0 restores the unlimited default
+func (c *RabbitMQClient) SetPrefetch(count int) error {
+	if count < 0 {
+		count = 0
+	}
+	c.mu.Lock()
+	c.prefetch = count
+	ch := c.ch
+	c.mu.Unlock()
+
+	if ch == nil {
+		return nil
+	}
+	return ch.Qos(count, 0, false)
+}
+
 // publish events to an exchange
 func (c *RabbitMQClient) PublishEvent(ctx context.Context, exchange, routingKey string, event interface{}) error {
+	return c.PublishEventWithOptions(ctx, exchange, routingKey, event, PublishOptions{})
+}
+
+// same as PublishEvent, but lets the caller pick e.g. transient delivery for high-volume events
+func (c *RabbitMQClient) PublishEventWithOptions(ctx context.Context, exchange, routingKey string, event interface{}, opts PublishOptions) (err error) {
+	c.mu.Lock()
+	deliveryMode, maxMessageSize, onPublishError := c.deliveryMode, c.maxMessageSize, c.onPublishError
+	c.mu.Unlock()
+	defer func() {
+		if err != nil && onPublishError != nil {
+			onPublishError()
+		}
+	}()
+	if opts.DeliveryMode != 0 {
+		if opts.DeliveryMode != Transient && opts.DeliveryMode != Persistent {
+			return fmt.Errorf("invalid delivery mode: %d", opts.DeliveryMode)
+		}
+		deliveryMode = opts.DeliveryMode
+	}
+
 	// convert event to JSON
 	body, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
-	//publishing
-	// exchange name, routing key, mandatory, immediate, Publishing Notes
-	return c.ch.PublishWithContext(ctx,
-		exchange,
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
+
+	// fail clearly here rather than with a cryptic frame/channel error from the broker
+	if maxMessageSize > 0 && len(body) > maxMessageSize {
+		return fmt.Errorf("%w: %d bytes for %s on %s (limit %d) - store large payloads externally (e.g. S3) and publish a reference instead",
+			ErrMessageTooLarge, len(body), routingKey, exchange, maxMessageSize)
+	}
+	return c.publish(ctx, pendingPublish{
+		exchange: exchange,
+		routingKey: routingKey,
+		mandatory: opts.Mandatory,
+		msg: amqp.Publishing{
 			ContentType: "application/json",
-			DeliveryMode: amqp.Presistent,
+			DeliveryMode: deliveryMode,
+			MessageId: uuid.New().String(),
 			Body: body,
 			Timestamp: time.Now(),
 		},
-	)
+	})
+}
+
+// publishes straight to the channel when connected, otherwise buffers until reconnect
+func (c *RabbitMQClient) publish(ctx context.Context, p pendingPublish) error {
+	c.mu.Lock()
+	// anything already buffered must go out first to keep ordering
+	if !c.connected || c.buffer.flushing || c.buffer.len() > 0 {
+		err := c.buffer.push(p)
+		c.mu.Unlock()
+		return err
+	}
+	ch, confirms := c.ch, c.confirms
+	c.mu.Unlock()
+
+	if p.mandatory {
+		return c.publishMandatory(ctx, ch, confirms, p)
+	}
+
+	//publishing
+	// exchange name, routing key, mandatory, immediate, Publishing Notes
+	err := ch.PublishWithContext(ctx, p.exchange, p.routingKey, p.mandatory, false, p.msg)
+	if errors.Is(err, amqp.ErrClosed) {
+		// connection dropped between the check and the publish
+		c.mu.Lock()
+		err = c.buffer.push(p)
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// publishes and waits for the broker's confirm, so an unroutable message comes back as ErrUnroutable
+func (c *RabbitMQClient) publishMandatory(ctx context.Context, ch *amqp.Channel, confirms *publishConfirms, p pendingPublish) error {
+	waiter := confirms.expect(p.msg.MessageId)
+	conf, err := ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, p.routingKey, true, false, p.msg)
+	if err != nil {
+		confirms.forget(p.msg.MessageId)
+		if errors.Is(err, amqp.ErrClosed) {
+			// connection dropped between the check and the publish
+			c.mu.Lock()
+			err = c.buffer.push(p)
+			c.mu.Unlock()
+		}
+		return err
+	}
+	confirms.sent(p.msg.MessageId, conf.DeliveryTag)
+
+	select {
+	case err := <-waiter.done:
+		return err
+	case <-ctx.Done():
+		confirms.forget(p.msg.MessageId)
+		return ctx.Err()
+	}
+}
+
+func (c *RabbitMQClient) channel() *amqp.Channel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ch
+}
+
+func (c *RabbitMQClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
 }
 
 // subscribes to messages from a queue
 func (c *RabbitMQClient) Subscribe(queue string, handler func([]byte) error) error {
+	return c.SubscribeWithContext(context.Background(), queue, handler)
+}
+
+// same as Subscribe, but stops consuming once ctx is done
+// deliveries already handed to the client are still handled and acked, use WaitForHandlers to wait for them
+func (c *RabbitMQClient) SubscribeWithContext(ctx context.Context, queue string, handler func([]byte) error) error {
+	return c.SubscribeConcurrentWithContext(ctx, queue, handler, 1)
+}
+
+// SubscribeConcurrent handles up to workers deliveries from queue at once, each acked/nacked on its own
+// the broker only hands out as many unacked messages as the prefetch allows, so keep it at or above workers (SetPrefetch)
+func (c *RabbitMQClient) SubscribeConcurrent(queue string, handler func([]byte) error, workers int) error {
+	return c.SubscribeConcurrentWithContext(context.Background(), queue, handler, workers)
+}
+
+// same as SubscribeConcurrent, but stops consuming once ctx is done, the pool drains what it was already handed
+// before exiting (WaitForHandlers waits for that)
+func (c *RabbitMQClient) SubscribeConcurrentWithContext(ctx context.Context, queue string, handler func([]byte) error, workers int) error {
+	return c.SubscribeDecisions(ctx, queue, Decide(handler), workers)
+}
+
+// SubscribeDecisions is SubscribeConcurrentWithContext for handlers that decide themselves whether each delivery
+// is acked, requeued or rejected
+// the subscription survives reconnects: once the connection is back it consumes from the queue again on the new channel
+func (c *RabbitMQClient) SubscribeDecisions(ctx context.Context, queue string, handler DeliveryHandler, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ch := c.channel()
+	consumerTag, msgs, err := consume(ch, queue)
+	if err != nil {
+		return err
+	}
+
+	c.consumers.Add(1)
+	go func() {
+		defer c.consumers.Done()
+		for {
+			c.runConsumer(ctx, ch, queue, consumerTag, msgs, handler, workers)
+
+			// msgs closed: either we're shutting down or the channel went away with the connection
+			var ok bool
+			ch, consumerTag, msgs, ok = c.resumeConsuming(ctx, queue, ch)
+			if !ok {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func consume(ch *amqp.Channel, queue string) (string, <-chan amqp.Delivery, error) {
+	// named so the consumer can be cancelled on shutdown
+	consumerTag := "watchrabbit-" + uuid.New().String()
+
 	// start consuming from specified queue
 	// queue name, consumer tag, auto-acknowledge, exclusive, no-local, no-wait, extraArgs
-	msgs, err := c.ch.Consume(
+	msgs, err := ch.Consume(
 		queue,
-		"",
+		consumerTag,
 		false,
 		false,
 		false,
 		false,
 		nil,
 	)
-	if err != nil {
-		return err
-	}
-	//spin up goroutine to process method (non-blocking)
+	return consumerTag, msgs, err
+}
+
+// handles msgs on a pool of workers, returns once msgs is closed and every worker is done
+func (c *RabbitMQClient) runConsumer(ctx context.Context, ch *amqp.Channel, queue, consumerTag string, msgs <-chan amqp.Delivery, handler DeliveryHandler, workers int) {
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		for msg := range msgs {
-			err := handler(msg.Body)
-			// if an error occurs, reject the message and requeue it
-			if err != nil {
-				log.Printf("Error handling message: %v", err)
-				// reject multiple? , requeue?
-				msg.Nack(false, true)
-			} else {
-				msg.Ack(false)
+		select {
+		case <-ctx.Done():
+			// broker stops delivering, msgs closes once the already-delivered messages are drained
+			if err := ch.Cancel(consumerTag, false); err != nil && !errors.Is(err, amqp.ErrClosed) {
+				c.logger.Warn("Failed to cancel consumer", slog.String("queue", queue), slog.Any("error", err))
 			}
+		case <-done:
 		}
 	}()
 
-	return nil
+	//spin up the pool to process messages, every worker ranges over the same deliveries
+	var pool sync.WaitGroup
+	pool.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.Done()
+			for msg := range msgs {
+				c.handleDelivery(ch, queue, msg, handler)
+			}
+		}()
+	}
+	pool.Wait()
+}
+
+// waits for a connection newer than old and consumes from queue on its channel
+// returns false once ctx is done or the client is closed
+func (c *RabbitMQClient) resumeConsuming(ctx context.Context, queue string, old *amqp.Channel) (*amqp.Channel, string, <-chan amqp.Delivery, bool) {
+	for {
+		c.mu.Lock()
+		ch, connected, closed, reconnected := c.ch, c.connected, c.closed, c.reconnected
+		c.mu.Unlock()
+		if closed || ctx.Err() != nil {
+			return nil, "", nil, false
+		}
+
+		var retry <-chan time.Time
+		if connected && ch != old {
+			consumerTag, msgs, err := consume(ch, queue)
+			if err == nil {
+				c.logger.Info("Resumed consuming after reconnect", slog.String("queue", queue))
+				return ch, consumerTag, msgs, true
+			}
+			c.logger.Error("Failed to resume consuming, retrying in 5 seconds", slog.String("queue", queue), slog.Any("error", err))
+			retry = time.After(5 * time.Second)
+		}
+
+		select {
+		case <-reconnected:
+		case <-retry:
+		case <-ctx.Done():
+			return nil, "", nil, false
+		case <-c.done:
+			return nil, "", nil, false
+		}
+	}
+}
+
+// runs the handler on one delivery and acks, requeues, retries or rejects it as the handler decided
+func (c *RabbitMQClient) handleDelivery(ch *amqp.Channel, queue string, msg amqp.Delivery, handler DeliveryHandler) {
+	receivedAt := time.Now()
+	c.inFlight.Add(1)
+	decision, err := handler(msg.Body)
+	c.inFlight.Add(-1)
+	outcome := "acked"
+	switch decision {
+	case Reject:
+		// retrying can't help, park it in the queue's DLQ for a look instead of requeueing it
+		c.logger.Warn("Rejecting message permanently", slog.String("queue", queue), slog.String("message_id", msg.MessageId), slog.Any("error", err))
+		if c.deadLetter(ch, queue, msg) {
+			outcome = "rejected"
+		} else {
+			msg.Nack(false, true)
+			outcome = "nacked"
+		}
+	case Nack:
+		c.logger.Error("Error handling message", slog.String("queue", queue), slog.String("message_id", msg.MessageId), slog.Any("error", err))
+		if retried, ok := c.retryLater(ch, queue, msg); ok {
+			outcome = retried
+		} else {
+			// reject multiple? , requeue?
+			msg.Nack(false, true)
+			outcome = "nacked"
+		}
+	default:
+		if err != nil {
+			c.logger.Warn("Acking message despite handler error", slog.String("queue", queue), slog.String("message_id", msg.MessageId), slog.Any("error", err))
+		}
+		msg.Ack(false)
+	}
+
+	c.reportDelivery(DeliveryRecord{
+		Queue:      queue,
+		MessageID:  msg.MessageId,
+		Outcome:    outcome,
+		Err:        err,
+		ReceivedAt: receivedAt,
+		Duration:   time.Since(receivedAt),
+	})
+}
+
+// blocks until every Subscribe loop has exited (their contexts were cancelled or the client closed)
+// returns an error if ctx expires first, with handlers possibly still running
+func (c *RabbitMQClient) WaitForHandlers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.consumers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d deliveries still in flight: %w", c.InFlight(), ctx.Err())
+	}
+}
+
+// number of deliveries currently being handled across all subscriptions
+func (c *RabbitMQClient) InFlight() int {
+	return int(c.inFlight.Load())
 }
 
 func (c *RabbitMQClient) Close() error {
+    c.mu.Lock()
+    if c.closed {
+        c.mu.Unlock()
+        return nil
+    }
     c.closed = true
+    ch, conn := c.ch, c.conn
+    c.mu.Unlock()
+
+    // stops reconnectMonitor
+    close(c.done)
+
+    if pending := c.PublishStats().Pending; pending > 0 {
+        c.logger.Warn("Closing RabbitMQ client with buffered publishes that were never sent", slog.Int("pending", pending))
+    }
     
-    if c.ch != nil {
-        c.ch.Close()
+    if ch != nil {
+        ch.Close()
     }
     
-    if c.conn != nil {
-        return c.conn.Close()
+    if conn != nil {
+        return conn.Close()
     }
     
     return nil
@@ -0,0 +1,467 @@
+//go:build integration
+
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"watchrabbit/pkg/messaging"
+	"watchrabbit/pkg/messaging/amqptest"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublishDeliveryMode(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		clientMode  uint8
+		publishMode uint8
+		want        uint8
+	}{
+		{"client default", 0, 0, messaging.Persistent},
+		{"client transient", messaging.Transient, 0, messaging.Transient},
+		{"per-publish override", messaging.Transient, messaging.Persistent, messaging.Persistent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := tt.clientMode
+			if mode == 0 {
+				mode = messaging.Persistent
+			}
+			if err := client.SetDeliveryMode(mode); err != nil {
+				t.Fatalf("SetDeliveryMode: %v", err)
+			}
+
+			err := client.PublishEventWithOptions(ctx, "biomarker.file.events", "file.detected.csv",
+				map[string]string{"case": tt.name}, messaging.PublishOptions{DeliveryMode: tt.publishMode})
+			if err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+
+			msg := broker.AssertMessage(t, "file.detected", func(d amqp.Delivery) bool { return true })
+			if msg.DeliveryMode != tt.want {
+				t.Errorf("delivery mode = %d, want %d", msg.DeliveryMode, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDeliveryModeRejectsUnknownMode(t *testing.T) {
+	client, _ := amqptest.NewClient(t)
+	if err := client.SetDeliveryMode(3); err == nil {
+		t.Fatal("expected an error for delivery mode 3")
+	}
+}
+
+func TestPublishBufferAcrossOutage(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+	client.SetPublishBufferSize(2)
+	ctx := context.Background()
+
+	// DropConnections alone lets the client reconnect straight away, stopping the app keeps it out long enough
+	// to publish into the buffer deterministically
+	broker.StopApp(t)
+	waitFor(t, "client to notice the outage", func() bool { return !client.IsConnected() })
+
+	for i := 0; i < 3; i++ {
+		err := client.PublishEvent(ctx, "biomarker.file.events", "file.detected.csv", map[string]int{"seq": i})
+		switch {
+		case i < 2 && err != nil:
+			t.Fatalf("publish %d while disconnected: %v", i, err)
+		case i == 2 && !errors.Is(err, messaging.ErrPublishBufferFull):
+			t.Fatalf("publish %d past the buffer size = %v, want ErrPublishBufferFull", i, err)
+		}
+	}
+	stats := client.PublishStats()
+	if stats.Buffered != 2 || stats.Dropped != 1 || stats.Pending != 2 {
+		t.Fatalf("stats while disconnected = %+v, want 2 buffered, 1 dropped, 2 pending", stats)
+	}
+
+	broker.StartApp(t)
+	waitFor(t, "client to reconnect", client.IsConnected)
+
+	// flushed in order once the connection is back
+	broker.AssertQueueDepth(t, "file.detected", 2)
+	for i := 0; i < 2; i++ {
+		want := fmt.Sprintf(`{"seq":%d}`, i)
+		msg := broker.AssertMessage(t, "file.detected", func(amqp.Delivery) bool { return true })
+		if string(msg.Body) != want {
+			t.Errorf("flushed message %d = %s, want %s", i, msg.Body, want)
+		}
+	}
+	if pending := client.PublishStats().Pending; pending != 0 {
+		t.Errorf("pending after reconnect = %d, want 0", pending)
+	}
+}
+
+func TestPublishAfterBrokerClosesChannel(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+	ctx := context.Background()
+
+	// the broker answers with a 404 channel close, the connection stays up
+	if err := client.PublishEvent(ctx, "no.such.exchange", "file.detected.csv", map[string]int{"seq": -1}); err != nil {
+		t.Fatalf("publish to a missing exchange: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := client.PublishEvent(ctx, "biomarker.file.events", "file.detected.csv", map[string]int{"seq": i}); err != nil {
+			t.Fatalf("publish %d after the channel closed: %v", i, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	broker.AssertQueueDepth(t, "file.detected", 3)
+	waitFor(t, "the buffer to drain", func() bool { return client.PublishStats().Pending == 0 })
+
+	// and it keeps publishing straight through afterwards
+	if err := client.PublishEvent(ctx, "biomarker.file.events", "file.detected.csv", map[string]int{"seq": 3}); err != nil {
+		t.Fatalf("publish after reconnect: %v", err)
+	}
+	broker.AssertQueueDepth(t, "file.detected", 4)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(amqptest.DefaultWait)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMandatoryPublishUnroutable(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+	ctx := context.Background()
+
+	returns := make(chan messaging.ReturnedMessage, 1)
+	client.SetReturnHandler(func(msg messaging.ReturnedMessage) { returns <- msg })
+	mandatory := messaging.PublishOptions{Mandatory: true}
+
+	err := client.PublishEventWithOptions(ctx, "biomarker.file.events", "bogus.routing.key", map[string]string{"a": "b"}, mandatory)
+	if !errors.Is(err, messaging.ErrUnroutable) {
+		t.Fatalf("unroutable mandatory publish = %v, want ErrUnroutable", err)
+	}
+
+	if err := client.PublishEventWithOptions(ctx, "biomarker.file.events", "file.detected.csv", map[string]string{"a": "b"}, mandatory); err != nil {
+		t.Fatalf("routable mandatory publish: %v", err)
+	}
+	broker.AssertQueueDepth(t, "file.detected", 1)
+
+	// the caller already got the error, the handler is only for returns nobody waits on
+	select {
+	case msg := <-returns:
+		t.Errorf("return handler called for %s", msg.RoutingKey)
+	default:
+	}
+}
+
+func TestSubscriptionSurvivesReconnect(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan string, 10)
+	err := client.SubscribeConcurrentWithContext(ctx, "file.detected", func(body []byte) error {
+		received <- string(body)
+		return nil
+	}, 2)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	publishAndReceive := func(want string) {
+		t.Helper()
+		if err := client.PublishEvent(context.Background(), "biomarker.file.events", "file.detected.csv", want); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		select {
+		case got := <-received:
+			if got != `"`+want+`"` {
+				t.Fatalf("received %s, want %q", got, want)
+			}
+		case <-time.After(amqptest.DefaultWait):
+			t.Fatalf("%q was never handled", want)
+		}
+	}
+
+	publishAndReceive("before")
+
+	broker.DropConnections(t)
+	waitFor(t, "client to reconnect", client.IsConnected)
+	publishAndReceive("after drop")
+
+	broker.StopApp(t)
+	waitFor(t, "client to notice the outage", func() bool { return !client.IsConnected() })
+	broker.StartApp(t)
+	waitFor(t, "client to reconnect", client.IsConnected)
+	publishAndReceive("after restart")
+
+	// shutting down still ends the subscription
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), amqptest.DefaultWait)
+	defer waitCancel()
+	if err := client.WaitForHandlers(waitCtx); err != nil {
+		t.Fatalf("subscription didn't stop after cancel: %v", err)
+	}
+}
+
+func TestCloseLeaksNoGoroutines(t *testing.T) {
+	broker := amqptest.StartBroker(t)
+	before := runtime.NumGoroutine()
+
+	client, err := messaging.NewRabbitMQClient(broker.URI)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := client.SetupInfrastructure(); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := client.SubscribeConcurrent("file.detected", func([]byte) error { return nil }, 4); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	waitFor(t, "client goroutines to exit", func() bool { return runtime.NumGoroutine() <= before })
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	broker := amqptest.StartBroker(t)
+	client, err := messaging.NewRabbitMQClient(broker.URI)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Close()
+	client.SetRetry("file.detected", 100*time.Millisecond, 1)
+	if err := client.SetupInfrastructure(); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	// fail everything until it's parked in the DLQ
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.SubscribeWithContext(ctx, "file.detected", func([]byte) error { return errors.New("broken") }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	for _, routingKey := range []string{"file.detected.csv", "file.detected.sas7bdat"} {
+		if err := client.PublishEvent(context.Background(), "biomarker.file.events", routingKey, routingKey); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	dlq := messaging.DeadLetterQueueName("file.detected")
+	broker.AssertQueueDepth(t, dlq, 2)
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), amqptest.DefaultWait)
+	defer waitCancel()
+	if err := client.WaitForHandlers(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	csvOnly := func(letter messaging.DeadLetter) bool { return letter.RoutingKey == "file.detected.csv" }
+
+	dry, err := client.ReplayDeadLetters(context.Background(), dlq, messaging.ReplayOptions{Filter: csvOnly, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(dry.Replayed) != 1 || dry.Skipped != 1 {
+		t.Fatalf("dry run = %d replayed, %d skipped, want 1 and 1", len(dry.Replayed), dry.Skipped)
+	}
+	if letter := dry.Replayed[0]; letter.Queue != "file.detected" || letter.Exchange != "biomarker.file.events" {
+		t.Errorf("dry run letter = %+v, want it traced back to file.detected via biomarker.file.events", letter)
+	}
+	broker.AssertQueueDepth(t, dlq, 2)
+	broker.AssertQueueDepth(t, "file.detected", 0)
+
+	result, err := client.ReplayDeadLetters(context.Background(), dlq, messaging.ReplayOptions{Filter: csvOnly})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(result.Replayed) != 1 || result.Skipped != 1 {
+		t.Fatalf("replay = %d replayed, %d skipped, want 1 and 1", len(result.Replayed), result.Skipped)
+	}
+	broker.AssertQueueDepth(t, dlq, 1)
+
+	// back on the source queue straight away, not waiting out file.detected.retry again, with no retry history
+	broker.AssertQueueDepth(t, messaging.RetryQueueName("file.detected"), 0)
+	msg := broker.AssertMessage(t, "file.detected", func(amqp.Delivery) bool { return true })
+	if msg.Exchange != "biomarker.file.events" || msg.RoutingKey != "file.detected.csv" {
+		t.Errorf("replayed to %q/%s, want biomarker.file.events/file.detected.csv", msg.Exchange, msg.RoutingKey)
+	}
+	for _, header := range []string{"x-death", messaging.RetryCountHeader, messaging.OriginalExchangeHeader, messaging.OriginalRoutingKeyHeader} {
+		if _, ok := msg.Headers[header]; ok {
+			t.Errorf("replayed message still has %s", header)
+		}
+	}
+}
+
+func TestPermanentErrorParkedInDeadLetterQueue(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := make(chan struct{}, 1)
+	err := client.SubscribeWithContext(ctx, "analysis.requested", func([]byte) error {
+		handled <- struct{}{}
+		return messaging.Permanent(errors.New("source rejected the input"))
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := client.PublishEvent(context.Background(), "biomarker.analysis.events", "analysis.requested.csv", map[string]string{"a": "b"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(amqptest.DefaultWait):
+		t.Fatal("message was never handled")
+	}
+
+	// kept, not dropped or redelivered
+	dlq := messaging.DeadLetterQueueName("analysis.requested")
+	broker.AssertQueueDepth(t, dlq, 1)
+	broker.AssertQueueDepth(t, "analysis.requested", 0)
+
+	dry, err := client.ReplayDeadLetters(context.Background(), dlq, messaging.ReplayOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(dry.Replayed) != 1 {
+		t.Fatalf("dry run = %d replayed, %d skipped, want the rejected message", len(dry.Replayed), dry.Skipped)
+	}
+	if letter := dry.Replayed[0]; letter.Queue != "analysis.requested" || letter.Exchange != "biomarker.analysis.events" ||
+		letter.RoutingKey != "analysis.requested.csv" || letter.Reason != "rejected" {
+		t.Errorf("dead letter = %+v, want it traced back to analysis.requested.csv", letter)
+	}
+}
+
+// keeps every record logged through it, whatever the level
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// routing keys of the inspected events, only counting ones logged at debug level
+func (h *recordingHandler) inspected() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var keys []string
+	for _, r := range h.records {
+		if r.Message != "Inspected event" || r.Level != slog.LevelDebug {
+			continue
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "routing_key" {
+				keys = append(keys, a.Value.String())
+			}
+			return true
+		})
+	}
+	return keys
+}
+
+func TestInspectLogsEveryExchange(t *testing.T) {
+	client, broker := amqptest.NewClient(t)
+	logs := &recordingHandler{}
+	client.SetLogger(slog.New(logs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exchanges := []string{"biomarker.file.events", "biomarker.analysis.events", "biomarker.result.events"}
+	if err := client.Inspect(ctx, exchanges, 64); err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	published := map[string]string{
+		"biomarker.file.events":     "file.detected.csv",
+		"biomarker.analysis.events": "analysis.requested.csv",
+		"biomarker.result.events":   "no.consumer.for.this",
+	}
+	for exchange, routingKey := range published {
+		if err := client.PublishEvent(context.Background(), exchange, routingKey, map[string]string{"a": "b"}); err != nil {
+			t.Fatalf("publish to %s: %v", exchange, err)
+		}
+	}
+	waitFor(t, "every event to be inspected", func() bool { return len(logs.inspected()) == len(published) })
+
+	// normal consumers still get theirs
+	broker.AssertQueueDepth(t, "file.detected", 1)
+	broker.AssertQueueDepth(t, "analysis.requested", 1)
+}
+
+func TestSetupInfrastructureQueueMismatch(t *testing.T) {
+	broker := amqptest.StartBroker(t)
+	ctx := context.Background()
+
+	// file.detected as an old deployment might have left it: non-durable, with a message waiting
+	conn, err := amqp.Dial(broker.URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ch.QueueDeclare("file.detected", false, false, false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.PublishWithContext(ctx, "", "file.detected", false, false, amqp.Publishing{Body: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	broker.AssertQueueDepth(t, "file.detected", 1)
+
+	client, err := messaging.NewRabbitMQClient(broker.URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = client.SetupInfrastructure()
+	if !errors.Is(err, messaging.ErrQueueMismatch) {
+		t.Fatalf("SetupInfrastructure = %v, want ErrQueueMismatch", err)
+	}
+	// nothing was dropped, and the PRECONDITION_FAILED only closed the throwaway channel
+	broker.AssertQueueDepth(t, "file.detected", 1)
+	if err := client.PublishEvent(ctx, "", "file.detected", map[string]string{"a": "b"}); err != nil {
+		t.Fatalf("publish after the mismatch: %v", err)
+	}
+	broker.AssertQueueDepth(t, "file.detected", 2)
+	if pending := client.PublishStats().Pending; pending != 0 {
+		t.Errorf("%d publishes buffered, the shared channel shouldn't have closed", pending)
+	}
+
+	client.SetRecreateMismatchedQueues(true)
+	if err := client.SetupInfrastructure(); err != nil {
+		t.Fatalf("SetupInfrastructure with recreate: %v", err)
+	}
+	broker.AssertQueueDepth(t, "file.detected", 0)
+	// declaring it durable now matches rather than failing
+	if _, err := ch.QueueDeclare("file.detected", true, false, false, false, nil); err != nil {
+		t.Errorf("queue wasn't recreated durable: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// pkg/messaging/replay.go
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// header our retry logic counts attempts in, cleared on replay so a replayed message gets a fresh set of retries
+const RetryCountHeader = "x-retry-count"
+
+// DeadLetter is a dead-lettered message along with where it originally came from (the newest x-death entry,
+// or the original exchange/routing key headers for messages parked by our retry logic)
+type DeadLetter struct {
+	MessageID  string
+	Queue      string // queue it was dead-lettered from, the source queue rather than its .retry queue
+	Exchange   string // exchange it was originally published to
+	RoutingKey string
+	Reason     string // rejected, expired, maxlen, ...
+	Count      int64  // times it was dead-lettered from Queue for Reason
+	Body       []byte
+}
+
+// ReplayOptions limits which dead letters are replayed
+type ReplayOptions struct {
+	Limit  int                   // stop after this many replays, 0 for the whole queue
+	Filter func(DeadLetter) bool // nil replays everything
+	// report what would be replayed without publishing or removing anything
+	DryRun bool
+}
+
+// ReplayResult counts what ReplayDeadLetters did
+type ReplayResult struct {
+	Replayed []DeadLetter
+	Skipped  int // filtered out, left in the DLQ
+}
+
+// ReplayDeadLetters pulls messages off a dead-letter queue and republishes them to their original exchange and routing key
+// each message is only removed from the DLQ once the broker has confirmed the republish
+// messages that were neither dead-lettered by the broker (x-death) nor parked by a rejecting handler, or that
+// don't pass the filter, are left where they are
+func (c *RabbitMQClient) ReplayDeadLetters(ctx context.Context, dlq string, opts ReplayOptions) (ReplayResult, error) {
+	var result ReplayResult
+
+	if !c.IsConnected() {
+		return result, ErrNotConnected
+	}
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	// own channel so confirms and unacked gets don't interfere with the shared one
+	// anything still unacked when it closes (skipped / dry run) goes back to the DLQ
+	ch, err := conn.Channel()
+	if err != nil {
+		return result, fmt.Errorf("failed to open replay channel: %v", err)
+	}
+	defer ch.Close()
+
+	if !opts.DryRun {
+		if err := ch.Confirm(false); err != nil {
+			return result, fmt.Errorf("failed to enable publisher confirms: %v", err)
+		}
+	}
+
+	for opts.Limit <= 0 || len(result.Replayed) < opts.Limit {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		// basic.get rather than a consumer so we never hold more than one message we aren't going to replay
+		msg, ok, err := ch.Get(dlq, false)
+		if err != nil {
+			return result, fmt.Errorf("failed to get from %s: %v", dlq, err)
+		}
+		if !ok {
+			// queue drained (unacked messages aren't handed out again on this channel)
+			return result, nil
+		}
+
+		letter, err := deadLetterFromDelivery(msg)
+		if err != nil || (opts.Filter != nil && !opts.Filter(letter)) {
+			result.Skipped++
+			continue
+		}
+
+		if opts.DryRun {
+			result.Replayed = append(result.Replayed, letter)
+			continue
+		}
+
+		conf, err := ch.PublishWithDeferredConfirmWithContext(ctx, letter.Exchange, letter.RoutingKey, false, false, replayPublishing(msg))
+		if err != nil {
+			return result, fmt.Errorf("failed to republish message %s: %v", letter.MessageID, err)
+		}
+		acked, err := conf.WaitContext(ctx)
+		if err != nil {
+			return result, err
+		}
+		if !acked {
+			return result, fmt.Errorf("broker rejected republish of message %s", letter.MessageID)
+		}
+
+		if err := msg.Ack(false); err != nil {
+			// already republished, it will show up again in the DLQ and get replayed twice if this is rerun
+			return result, fmt.Errorf("republished message %s but failed to remove it from %s: %v", letter.MessageID, dlq, err)
+		}
+		result.Replayed = append(result.Replayed, letter)
+	}
+
+	return result, nil
+}
+
+func deadLetterFromDelivery(msg amqp.Delivery) (DeadLetter, error) {
+	deaths, ok := msg.Headers["x-death"].([]interface{})
+	if !ok || len(deaths) == 0 {
+		return rejectedLetter(msg)
+	}
+	// newest death first
+	death, ok := deaths[0].(amqp.Table)
+	if !ok {
+		return DeadLetter{}, errors.New("malformed x-death header")
+	}
+
+	letter := DeadLetter{MessageID: msg.MessageId, Body: msg.Body}
+	letter.Queue, _ = death["queue"].(string)
+	letter.Exchange, _ = death["exchange"].(string)
+	letter.Reason, _ = death["reason"].(string)
+	letter.Count, _ = death["count"].(int64)
+	if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+		letter.RoutingKey, _ = keys[0].(string)
+	}
+
+	// parked by retryLater: the newest death is the retry queue expiring it back to the source queue, replaying to
+	// that routing key would send it through <queue>.retry (and its delay) again, so go back to where it was
+	// first published, or straight to the source queue for messages parked before the original was recorded
+	if source, ok := strings.CutSuffix(letter.Queue, ".retry"); ok {
+		letter.Queue = source
+		letter.Exchange, letter.RoutingKey = "", source
+	}
+	if routingKey, ok := msg.Headers[OriginalRoutingKeyHeader].(string); ok && routingKey != "" {
+		letter.Exchange, _ = msg.Headers[OriginalExchangeHeader].(string)
+		letter.RoutingKey = routingKey
+	}
+
+	// published straight to a queue through the default exchange
+	if letter.Exchange == "" && letter.RoutingKey == "" {
+		letter.RoutingKey = letter.Queue
+	}
+	if letter.Exchange == "" && letter.RoutingKey == "" {
+		return DeadLetter{}, errors.New("x-death header has no source queue or routing key")
+	}
+	return letter, nil
+}
+
+// parked by deadLetter after a handler rejected it, the broker never dead-lettered it so there's no x-death
+func rejectedLetter(msg amqp.Delivery) (DeadLetter, error) {
+	queue, _ := msg.Headers[RejectedQueueHeader].(string)
+	if queue == "" {
+		return DeadLetter{}, errors.New("message has no x-death header")
+	}
+
+	letter := DeadLetter{MessageID: msg.MessageId, Queue: queue, Reason: "rejected", Count: 1, Body: msg.Body}
+	letter.Exchange, _ = msg.Headers[OriginalExchangeHeader].(string)
+	letter.RoutingKey, _ = msg.Headers[OriginalRoutingKeyHeader].(string)
+	if letter.RoutingKey == "" {
+		letter.Exchange, letter.RoutingKey = "", queue
+	}
+	return letter, nil
+}
+
+// same message and properties, minus the dead-letter bookkeeping and retry state
+func replayPublishing(msg amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		switch {
+		case key == "x-death", key == RetryCountHeader, key == OriginalExchangeHeader, key == OriginalRoutingKeyHeader, key == RejectedQueueHeader,
+			strings.HasPrefix(key, "x-first-death-"), strings.HasPrefix(key, "x-last-death-"):
+			continue
+		}
+		headers[key] = value
+	}
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
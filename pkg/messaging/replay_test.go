@@ -0,0 +1,107 @@
+package messaging
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeadLetterFromDelivery(t *testing.T) {
+	death := func(queue, exchange, routingKey, reason string) amqp.Table {
+		return amqp.Table{
+			"queue":        queue,
+			"exchange":     exchange,
+			"routing-keys": []interface{}{routingKey},
+			"reason":       reason,
+			"count":        int64(1),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    DeadLetter
+		wantErr bool
+	}{
+		{
+			name:    "rejected by the broker",
+			headers: amqp.Table{"x-death": []interface{}{death("file.detected", "biomarker.file.events", "file.detected.csv", "rejected")}},
+			want:    DeadLetter{Queue: "file.detected", Exchange: "biomarker.file.events", RoutingKey: "file.detected.csv", Reason: "rejected", Count: 1},
+		},
+		{
+			name: "parked by the retry logic goes back to the original routing key",
+			headers: amqp.Table{
+				"x-death":                []interface{}{death("analysis.requested.retry", "", "analysis.requested.retry", "expired")},
+				OriginalExchangeHeader:   "biomarker.analysis.events",
+				OriginalRoutingKeyHeader: "analysis.requested.csv",
+			},
+			want: DeadLetter{Queue: "analysis.requested", Exchange: "biomarker.analysis.events", RoutingKey: "analysis.requested.csv", Reason: "expired", Count: 1},
+		},
+		{
+			name:    "parked before the original was recorded goes straight to the source queue",
+			headers: amqp.Table{"x-death": []interface{}{death("analysis.requested.retry", "", "analysis.requested.retry", "expired")}},
+			want:    DeadLetter{Queue: "analysis.requested", Exchange: "", RoutingKey: "analysis.requested", Reason: "expired", Count: 1},
+		},
+		{
+			name:    "newest death wins",
+			headers: amqp.Table{"x-death": []interface{}{death("file.changed", "biomarker.file.events", "file.changed.csv", "expired"), death("file.detected", "biomarker.file.events", "file.detected.csv", "rejected")}},
+			want:    DeadLetter{Queue: "file.changed", Exchange: "biomarker.file.events", RoutingKey: "file.changed.csv", Reason: "expired", Count: 1},
+		},
+		{
+			name: "rejected by a handler",
+			headers: amqp.Table{
+				RejectedQueueHeader:      "analysis.requested",
+				OriginalExchangeHeader:   "biomarker.analysis.events",
+				OriginalRoutingKeyHeader: "analysis.requested.csv",
+			},
+			want: DeadLetter{Queue: "analysis.requested", Exchange: "biomarker.analysis.events", RoutingKey: "analysis.requested.csv", Reason: "rejected", Count: 1},
+		},
+		{name: "no x-death", headers: amqp.Table{}, wantErr: true},
+		{name: "malformed x-death", headers: amqp.Table{"x-death": []interface{}{"nope"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := deadLetterFromDelivery(amqp.Delivery{MessageId: "msg-1", Headers: tt.headers})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			tt.want.MessageID = "msg-1"
+			got.Body = nil
+			if got.MessageID != tt.want.MessageID || got.Queue != tt.want.Queue || got.Exchange != tt.want.Exchange ||
+				got.RoutingKey != tt.want.RoutingKey || got.Reason != tt.want.Reason || got.Count != tt.want.Count {
+				t.Errorf("dead letter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayPublishingStripsDeadLetterState(t *testing.T) {
+	msg := amqp.Delivery{
+		MessageId:   "msg-1",
+		ContentType: "application/json",
+		Body:        []byte(`{"a":1}`),
+		Headers: amqp.Table{
+			"x-death":                []interface{}{amqp.Table{"queue": "q"}},
+			"x-first-death-queue":    "q",
+			"x-first-death-reason":   "expired",
+			"x-last-death-exchange":  "",
+			RetryCountHeader:         int64(3),
+			OriginalExchangeHeader:   "biomarker.file.events",
+			OriginalRoutingKeyHeader: "file.detected.csv",
+			RejectedQueueHeader:      "file.detected",
+			"traceparent":            "00-abc-def-01",
+		},
+	}
+
+	got := replayPublishing(msg)
+	if len(got.Headers) != 1 || got.Headers["traceparent"] != "00-abc-def-01" {
+		t.Errorf("headers = %v, want only traceparent kept", got.Headers)
+	}
+	if got.MessageId != msg.MessageId || got.ContentType != msg.ContentType || string(got.Body) != string(msg.Body) {
+		t.Errorf("publishing = %+v, want the original message", got)
+	}
+}
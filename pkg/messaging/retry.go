@@ -0,0 +1,165 @@
+// pkg/messaging/retry.go
+package messaging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// delayed redelivery for one queue, see SetRetry
+type retryPolicy struct {
+	delay      time.Duration
+	maxRetries int
+}
+
+// where a message was first published, stamped on its first move to the retry queue since every later hop goes
+// through the default exchange, lets a replay from the DLQ go back to the original routing key
+const (
+	OriginalExchangeHeader   = "x-original-exchange"
+	OriginalRoutingKeyHeader = "x-original-routing-key"
+)
+
+// queue a delivery was rejected from, set when it's parked in that queue's DLQ without going through the broker's
+// dead-lettering (so without an x-death header)
+const RejectedQueueHeader = "x-rejected-queue"
+
+// RetryQueueName is where failed deliveries from queue wait out the retry delay
+func RetryQueueName(queue string) string { return queue + ".retry" }
+
+// DeadLetterQueueName is where deliveries from queue are parked once they're out of retries, see cmd/dlq-replay
+func DeadLetterQueueName(queue string) string { return queue + ".dlq" }
+
+// SetRetry makes a failed delivery from queue wait delay in <queue>.retry before it's redelivered, instead of
+// being requeued straight away (which hot-loops), up to maxRetries times before it's parked in <queue>.dlq
+// the retry queue's x-message-ttl expires it back to queue through the default exchange, so the queue's own
+// settings don't change. call before SetupInfrastructure, which declares both queues, maxRetries 0 turns it off
+func (c *RabbitMQClient) SetRetry(queue string, delay time.Duration, maxRetries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxRetries <= 0 || delay <= 0 {
+		delete(c.retries, queue)
+		return
+	}
+	if c.retries == nil {
+		c.retries = make(map[string]retryPolicy)
+	}
+	c.retries[queue] = retryPolicy{delay: delay, maxRetries: maxRetries}
+}
+
+// declares the retry and dead-letter queues for every queue with a retry policy
+func (c *RabbitMQClient) declareRetryQueues() error {
+	c.mu.Lock()
+	retries := make(map[string]retryPolicy, len(c.retries))
+	for queue, policy := range c.retries {
+		retries[queue] = policy
+	}
+	c.mu.Unlock()
+
+	for queue, policy := range retries {
+		args := amqp.Table{
+			"x-message-ttl":             policy.delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		}
+		if err := c.declareQueue(RetryQueueName(queue), true, false, args); err != nil {
+			return err
+		}
+		if err := c.declareQueue(DeadLetterQueueName(queue), true, false, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moves a failed delivery to the retry queue, or the dead-letter queue once it's out of retries, and acks it
+// returns the outcome, or false when queue has no retry policy or the move failed and the caller should requeue
+func (c *RabbitMQClient) retryLater(ch *amqp.Channel, queue string, msg amqp.Delivery) (string, bool) {
+	c.mu.Lock()
+	policy, ok := c.retries[queue]
+	c.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	retries := retryCount(msg.Headers)
+	target, outcome := RetryQueueName(queue), "retrying"
+	if retries >= policy.maxRetries {
+		target, outcome = DeadLetterQueueName(queue), "dead-lettered"
+	}
+
+	headers := originalHeaders(msg)
+	headers[RetryCountHeader] = int64(retries + 1)
+	if err := moveMessage(ch, target, msg, headers); err != nil {
+		c.logger.Warn("Failed to move message to retry queue, requeueing it instead", slog.String("queue", target), slog.String("message_id", msg.MessageId), slog.Any("error", err))
+		return "", false
+	}
+
+	msg.Ack(false)
+	if outcome == "dead-lettered" {
+		c.logger.Warn("Message is out of retries, parked in dead-letter queue", slog.String("queue", target), slog.String("message_id", msg.MessageId), slog.Int("retries", retries))
+	} else {
+		c.logger.Info("Message will be retried", slog.String("queue", queue), slog.String("message_id", msg.MessageId), slog.Int("retry", retries+1), slog.Duration("delay", policy.delay))
+	}
+	return outcome, true
+}
+
+// parks a permanently rejected delivery in <queue>.dlq and acks it, false when the move failed and the caller
+// should requeue it rather than lose it
+func (c *RabbitMQClient) deadLetter(ch *amqp.Channel, queue string, msg amqp.Delivery) bool {
+	headers := originalHeaders(msg)
+	headers[RejectedQueueHeader] = queue
+	target := DeadLetterQueueName(queue)
+	if err := moveMessage(ch, target, msg, headers); err != nil {
+		c.logger.Warn("Failed to move rejected message to dead-letter queue, requeueing it instead", slog.String("queue", target), slog.String("message_id", msg.MessageId), slog.Any("error", err))
+		return false
+	}
+
+	msg.Ack(false)
+	c.logger.Warn("Rejected message parked in dead-letter queue", slog.String("queue", target), slog.String("message_id", msg.MessageId))
+	return true
+}
+
+// msg's headers, stamped with where it was first published unless an earlier move already did
+func originalHeaders(msg amqp.Delivery) amqp.Table {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	if _, ok := headers[OriginalRoutingKeyHeader]; !ok {
+		headers[OriginalExchangeHeader] = msg.Exchange
+		headers[OriginalRoutingKeyHeader] = msg.RoutingKey
+	}
+	return headers
+}
+
+// republishes msg straight to the target queue through the default exchange, the delay queue hands it back the same way
+func moveMessage(ch *amqp.Channel, target string, msg amqp.Delivery, headers amqp.Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return ch.PublishWithContext(ctx, "", target, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    Persistent,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Body:            msg.Body,
+	})
+}
+
+// retries a delivery has been through, the header's integer type depends on who set it
+func retryCount(headers amqp.Table) int {
+	switch count := headers[RetryCountHeader].(type) {
+	case int64:
+		return int(count)
+	case int32:
+		return int(count)
+	case int:
+		return count
+	default:
+		return 0
+	}
+}
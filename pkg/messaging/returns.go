@@ -0,0 +1,176 @@
+// pkg/messaging/returns.go
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// returned (wrapped) by a mandatory PublishEvent the broker couldn't route to any queue
+var ErrUnroutable = errors.New("message could not be routed to any queue")
+
+// a mandatory publish that the broker could not route to any queue
+type ReturnedMessage struct {
+	Exchange   string
+	RoutingKey string
+	ReplyCode  uint16
+	ReplyText  string
+	Body       []byte
+}
+
+type ReturnHandler func(ReturnedMessage)
+
+// replaces the default (log only) handling of unroutable mandatory publishes that nobody is waiting on
+// (buffered publishes flushed after a reconnect), direct mandatory publishes return ErrUnroutable instead
+func (c *RabbitMQClient) SetReturnHandler(handler ReturnHandler) {
+	if handler == nil {
+		handler = logReturnedMessage
+	}
+	c.mu.Lock()
+	c.onReturn = handler
+	c.mu.Unlock()
+}
+
+// mandatory publishes waiting to hear whether they were routed, one per channel
+// the broker sends basic.return before the basic.ack of the same message, so once a publish is confirmed
+// its return (if any) has already been seen
+type publishConfirms struct {
+	mu        sync.Mutex
+	confirmed uint64 // highest delivery tag confirmed so far, confirmations arrive in order
+	closed    bool
+	waiting   map[string]*confirmWaiter // by message id
+}
+
+type confirmWaiter struct {
+	tag      uint64 // 0 until the publish went out
+	returned *ReturnedMessage
+	done     chan error
+}
+
+func newPublishConfirms() *publishConfirms {
+	return &publishConfirms{waiting: make(map[string]*confirmWaiter)}
+}
+
+// registers a publish before it's sent, the return can arrive before the publish call comes back
+func (p *publishConfirms) expect(messageID string) *confirmWaiter {
+	w := &confirmWaiter{done: make(chan error, 1)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		w.done <- amqp.ErrClosed
+		return w
+	}
+	p.waiting[messageID] = w
+	return w
+}
+
+// records the delivery tag the publish went out with, resolving it if it was already confirmed
+func (p *publishConfirms) sent(messageID string, tag uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w, ok := p.waiting[messageID]; ok {
+		w.tag = tag
+		if tag <= p.confirmed {
+			p.resolve(messageID, w)
+		}
+	}
+}
+
+func (p *publishConfirms) forget(messageID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiting, messageID)
+}
+
+// reports whether someone is waiting for the returned message
+func (p *publishConfirms) returned(messageID string, msg ReturnedMessage) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok := p.waiting[messageID]
+	if ok {
+		w.returned = &msg
+	}
+	return ok
+}
+
+func (p *publishConfirms) confirm(tag uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if tag > p.confirmed {
+		p.confirmed = tag
+	}
+	for id, w := range p.waiting {
+		if w.tag != 0 && w.tag <= p.confirmed {
+			p.resolve(id, w)
+		}
+	}
+}
+
+// channel is gone, whatever is still waiting won't hear back
+func (p *publishConfirms) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for id, w := range p.waiting {
+		w.done <- amqp.ErrClosed
+		delete(p.waiting, id)
+	}
+}
+
+// must be called with mu held
+func (p *publishConfirms) resolve(messageID string, w *confirmWaiter) {
+	delete(p.waiting, messageID)
+	if w.returned == nil {
+		w.done <- nil
+		return
+	}
+	w.done <- fmt.Errorf("%w: %s on %s (%d %s)", ErrUnroutable, w.returned.RoutingKey, w.returned.Exchange, w.returned.ReplyCode, w.returned.ReplyText)
+}
+
+// runs for the lifetime of a channel, the amqp library closes both channels when it goes away
+// returns and confirms are read by this one goroutine from unbuffered channels, so they're handled in the
+// order the broker sent them
+func (c *RabbitMQClient) watchPublishes(confirms *publishConfirms, acks <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	defer confirms.close()
+	for acks != nil || returns != nil {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			msg := ReturnedMessage{
+				Exchange:   r.Exchange,
+				RoutingKey: r.RoutingKey,
+				ReplyCode:  r.ReplyCode,
+				ReplyText:  r.ReplyText,
+				Body:       r.Body,
+			}
+			if confirms.returned(r.MessageId, msg) {
+				continue
+			}
+			c.mu.Lock()
+			handler := c.onReturn
+			c.mu.Unlock()
+			handler(msg)
+		case ack, ok := <-acks:
+			if !ok {
+				acks = nil
+				continue
+			}
+			confirms.confirm(ack.DeliveryTag)
+		}
+	}
+}
+
+func logReturnedMessage(msg ReturnedMessage) {
+	slog.Warn("Unroutable message returned by RabbitMQ",
+		slog.String("exchange", msg.Exchange),
+		slog.String("routing_key", msg.RoutingKey),
+		slog.Int("reply_code", int(msg.ReplyCode)),
+		slog.String("reply_text", msg.ReplyText))
+}
@@ -0,0 +1,86 @@
+package messaging
+
+import (
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublishConfirms(t *testing.T) {
+	returned := ReturnedMessage{Exchange: "biomarker.file.events", RoutingKey: "bogus", ReplyCode: 312, ReplyText: "NO_ROUTE"}
+
+	tests := []struct {
+		name    string
+		steps   func(p *publishConfirms)
+		wantErr error
+	}{
+		{"confirmed", func(p *publishConfirms) {
+			p.sent("m1", 1)
+			p.confirm(1)
+		}, nil},
+		{"confirmed before the publish call came back", func(p *publishConfirms) {
+			p.confirm(1)
+			p.sent("m1", 1)
+		}, nil},
+		{"returned then confirmed", func(p *publishConfirms) {
+			p.sent("m1", 1)
+			p.returned("m1", returned)
+			p.confirm(1)
+		}, ErrUnroutable},
+		{"returned and confirmed before the publish call came back", func(p *publishConfirms) {
+			p.returned("m1", returned)
+			p.confirm(1)
+			p.sent("m1", 1)
+		}, ErrUnroutable},
+		{"channel closed", func(p *publishConfirms) {
+			p.sent("m1", 1)
+			p.close()
+		}, amqp.ErrClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPublishConfirms()
+			waiter := p.expect("m1")
+			tt.steps(p)
+
+			select {
+			case err := <-waiter.done:
+				if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				t.Fatal("publish was never resolved")
+			}
+			if len(p.waiting) != 0 {
+				t.Errorf("%d waiters left behind", len(p.waiting))
+			}
+		})
+	}
+}
+
+func TestPublishConfirmsWaitsForItsOwnTag(t *testing.T) {
+	p := newPublishConfirms()
+	waiter := p.expect("m2")
+	p.sent("m2", 2)
+	p.confirm(1)
+
+	select {
+	case err := <-waiter.done:
+		t.Fatalf("resolved by an earlier confirm: %v", err)
+	default:
+	}
+
+	p.confirm(2)
+	if err := <-waiter.done; err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+func TestPublishConfirmsIgnoresReturnsNobodyWaitsOn(t *testing.T) {
+	p := newPublishConfirms()
+	if p.returned("someone-else", ReturnedMessage{}) {
+		t.Fatal("return claimed for a publish nobody is waiting on")
+	}
+}
@@ -0,0 +1,53 @@
+// pkg/messaging/stats.go
+package messaging
+
+import (
+	"context"
+	"fmt"
+)
+
+// QueueStats is what a passive declare reports about a queue
+type QueueStats struct {
+	Messages  int // ready messages, not counting unacked deliveries
+	Consumers int
+}
+
+// QueueStats looks up a queue's depth without modifying it
+// runs on a throwaway channel like HealthCheck, since a missing queue closes the channel
+func (c *RabbitMQClient) QueueStats(ctx context.Context, queue string) (QueueStats, error) {
+	if !c.IsConnected() {
+		return QueueStats{}, ErrNotConnected
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	type result struct {
+		stats QueueStats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ch, err := conn.Channel()
+		if err != nil {
+			done <- result{err: fmt.Errorf("failed to open queue stats channel: %v", err)}
+			return
+		}
+		defer ch.Close()
+
+		q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+		if err != nil {
+			done <- result{err: fmt.Errorf("passive declare of %s failed: %v", queue, err)}
+			return
+		}
+		done <- result{stats: QueueStats{Messages: q.Messages, Consumers: q.Consumers}}
+	}()
+
+	select {
+	case r := <-done:
+		return r.stats, r.err
+	case <-ctx.Done():
+		return QueueStats{}, ctx.Err()
+	}
+}
@@ -0,0 +1,70 @@
+// pkg/messaging/tap.go
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Tap receives a copy of every message published to exchange with a matching routing key, e.g. to push
+// events out to browsers. like Inspect it uses its own channel and an exclusive auto-delete queue, so
+// it doesn't take anything away from the real consumers. the returned channel carries message bodies
+// and is closed once ctx is done (which drops the queue and its binding) or the connection goes away
+func (c *RabbitMQClient) Tap(ctx context.Context, exchange, routingKey string) (<-chan []byte, error) {
+	if !c.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tap channel: %v", err)
+	}
+
+	// server-named and transient, gone as soon as the channel closes
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to declare tap queue: %v", err)
+	}
+	if err := ch.QueueBind(q.Name, routingKey, exchange, false, nil); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to bind tap to %s: %v", exchange, err)
+	}
+
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to consume tap queue: %v", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		ch.Close()
+	}()
+
+	bodies := make(chan []byte)
+	go func() {
+		defer close(bodies)
+		for msg := range msgs {
+			if !deliver(ctx, bodies, msg) {
+				return
+			}
+		}
+	}()
+	return bodies, nil
+}
+
+func deliver(ctx context.Context, bodies chan<- []byte, msg amqp.Delivery) bool {
+	select {
+	case bodies <- msg.Body:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}